@@ -0,0 +1,301 @@
+package pdf
+
+import "math"
+
+// 计算页面内容的外接矩形，用于自动裁掉空白边。
+// 路径按控制点计算，文字按字体宽度和字号估计，图像为单位正方形变换后的范围，
+// 白色填充的路径当作背景不计入
+
+// eachContentOp 依次读取内容流中的操作符和它的操作数，
+// 内嵌图像作为 BI 操作符，操作数为 *InlineImage。fn 返回 false 时停止
+func eachContentOp(content []byte, fn func(op string, args []interface{}) bool) error {
+	c := newContentParser(content)
+	for {
+		op, err := c.next()
+		if err != nil || op == nil {
+			return err
+		}
+		args := op.Operands
+		if op.Image != nil {
+			args = []interface{}{op.Image}
+		}
+		if !fn(op.Name, args) {
+			return nil
+		}
+	}
+}
+
+// pageContentData 返回页面所有内容流解码后连接起来的数据
+func (p *PDF) pageContentData(page *Obj) []byte {
+	data := make([]byte, 0)
+	for _, obj := range p.pageContents(page) {
+		buf, _, err := p.decodeStream(obj)
+		if err != nil {
+			continue
+		}
+		data = append(data, buf...)
+		data = append(data, '\n')
+	}
+	return data
+}
+
+// graphicsState 计算范围时需要的图形状态
+type graphicsState struct {
+	ctm       matrix
+	lineWidth float64
+	fillWhite bool      // 填充颜色为白色
+	fill      []float64 // 填充颜色的分量，按分量个数当作 Gray、RGB 或者 CMYK
+	font      *pdfFont
+	fontSize  float64
+	charSpace float64
+	wordSpace float64
+	hScale    float64
+	leading   float64
+	rise      float64
+	render    int
+}
+
+// boundsWalker 遍历内容流，累计画出的内容的范围
+type boundsWalker struct {
+	p      *PDF
+	bounds Rect
+	fonts  map[*Obj]*pdfFont
+	depth  int
+}
+
+// contentBounds 返回页面内容在默认用户空间中的外接矩形，没有内容时为空矩形
+func (p *PDF) contentBounds(page *Obj, resources []*Pair) Rect {
+	w := &boundsWalker{p: p, fonts: make(map[*Obj]*pdfFont)}
+	w.walk(p.pageContentData(page), resources, identityMatrix)
+	return w.bounds
+}
+
+func (w *boundsWalker) add(r Rect) {
+	w.bounds = w.bounds.union(r)
+}
+
+func (w *boundsWalker) walk(content []byte, resources []*Pair, ctm matrix) {
+	p := w.p
+	gs := graphicsState{ctm: ctm, lineWidth: 1, hScale: 1}
+	stack := make([]graphicsState, 0)
+	var path Rect
+	hasPath := false
+	var tm, tlm matrix
+	addPoint := func(x, y float64) {
+		x, y = gs.ctm.transform(x, y)
+		if !hasPath {
+			path, hasPath = Rect{x, y, x, y}, true
+			return
+		}
+		path.LLX, path.LLY = math.Min(path.LLX, x), math.Min(path.LLY, y)
+		path.URX, path.URY = math.Max(path.URX, x), math.Max(path.URY, y)
+	}
+	nums := func(args []interface{}) []float64 {
+		list := make([]float64, 0, len(args))
+		for _, arg := range args {
+			if v, ok := toFloat(arg); ok {
+				list = append(list, v)
+			}
+		}
+		return list
+	}
+	showText := func(data []byte) {
+		if gs.font == nil || gs.render == 3 {
+			// 没有设置字体，或者是不可见的文字
+			return
+		}
+		for _, code := range gs.font.codes(data) {
+			wx := gs.font.width(code) / 1000 * gs.fontSize
+			box := Rect{0, gs.rise - 0.25*gs.fontSize, wx * gs.hScale, gs.rise + gs.fontSize}
+			w.add(tm.multiply(gs.ctm).transformRect(box))
+			tx := wx + gs.charSpace
+			if !gs.font.composite && code == ' ' {
+				tx += gs.wordSpace
+			}
+			tm = matrix{1, 0, 0, 1, tx * gs.hScale, 0}.multiply(tm)
+		}
+	}
+	eachContentOp(content, func(op string, args []interface{}) bool {
+		v := nums(args)
+		switch op {
+		case "q":
+			stack = append(stack, gs)
+		case "Q":
+			if len(stack) > 0 {
+				gs = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if m, ok := toMatrix(args); ok {
+				gs.ctm = m.multiply(gs.ctm)
+			}
+		case "w":
+			if len(v) == 1 {
+				gs.lineWidth = v[0]
+			}
+		case "g":
+			gs.fillWhite = len(v) == 1 && v[0] == 1
+		case "rg":
+			gs.fillWhite = len(v) == 3 && v[0] == 1 && v[1] == 1 && v[2] == 1
+		case "k":
+			gs.fillWhite = len(v) == 4 && v[0] == 0 && v[1] == 0 && v[2] == 0 && v[3] == 0
+		case "sc", "scn", "cs":
+			gs.fillWhite = false
+		case "m", "l":
+			if len(v) == 2 {
+				addPoint(v[0], v[1])
+			}
+		case "c", "v", "y":
+			for i := 0; i+1 < len(v); i += 2 {
+				addPoint(v[i], v[i+1])
+			}
+		case "re":
+			if len(v) == 4 {
+				addPoint(v[0], v[1])
+				addPoint(v[0]+v[2], v[1]+v[3])
+			}
+		case "S", "s":
+			if hasPath {
+				d := gs.lineWidth * gs.ctm.scale() / 2
+				w.add(Rect{path.LLX - d, path.LLY - d, path.URX + d, path.URY + d})
+			}
+			hasPath = false
+		case "f", "F", "f*":
+			if hasPath && !gs.fillWhite {
+				w.add(path)
+			}
+			hasPath = false
+		case "B", "B*", "b", "b*":
+			if hasPath {
+				d := gs.lineWidth * gs.ctm.scale() / 2
+				w.add(Rect{path.LLX - d, path.LLY - d, path.URX + d, path.URY + d})
+			}
+			hasPath = false
+		case "n":
+			hasPath = false
+		case "BI":
+			w.add(gs.ctm.transformRect(Rect{0, 0, 1, 1}))
+		case "Do":
+			if len(args) == 1 {
+				if name, ok := args[0].(*NameObj); ok {
+					w.doXObject(resources, name.Name, gs.ctm)
+				}
+			}
+		case "BT":
+			tm, tlm = identityMatrix, identityMatrix
+		case "Tf":
+			if len(args) == 2 {
+				if name, ok := args[0].(*NameObj); ok {
+					gs.font = w.font(p.getResolvedDict(resources, "/Font"), name.Name)
+				}
+				gs.fontSize, _ = toFloat(args[1])
+			}
+		case "Tc":
+			if len(v) == 1 {
+				gs.charSpace = v[0]
+			}
+		case "Tw":
+			if len(v) == 1 {
+				gs.wordSpace = v[0]
+			}
+		case "Tz":
+			if len(v) == 1 {
+				gs.hScale = v[0] / 100
+			}
+		case "TL":
+			if len(v) == 1 {
+				gs.leading = v[0]
+			}
+		case "Ts":
+			if len(v) == 1 {
+				gs.rise = v[0]
+			}
+		case "Tr":
+			if len(v) == 1 {
+				gs.render = int(v[0])
+			}
+		case "Td", "TD":
+			if len(v) == 2 {
+				if op == "TD" {
+					gs.leading = -v[1]
+				}
+				tlm = matrix{1, 0, 0, 1, v[0], v[1]}.multiply(tlm)
+				tm = tlm
+			}
+		case "Tm":
+			if m, ok := toMatrix(args); ok {
+				tm, tlm = m, m
+			}
+		case "T*":
+			tlm = matrix{1, 0, 0, 1, 0, -gs.leading}.multiply(tlm)
+			tm = tlm
+		case "Tj", "'", "\"":
+			if op != "Tj" {
+				if op == "\"" && len(v) >= 2 {
+					gs.wordSpace, gs.charSpace = v[0], v[1]
+				}
+				tlm = matrix{1, 0, 0, 1, 0, -gs.leading}.multiply(tlm)
+				tm = tlm
+			}
+			if len(args) > 0 {
+				if str, ok := args[len(args)-1].(string); ok {
+					showText(decodePDFString(str))
+				}
+			}
+		case "TJ":
+			if len(args) == 1 {
+				list, _ := args[0].([]interface{})
+				for _, item := range list {
+					if str, ok := item.(string); ok {
+						showText(decodePDFString(str))
+					} else if n, ok := toFloat(item); ok {
+						tm = matrix{1, 0, 0, 1, -n / 1000 * gs.fontSize * gs.hScale, 0}.multiply(tm)
+					}
+				}
+			}
+		}
+		return true
+	})
+}
+
+// font 取资源中的字体
+func (w *boundsWalker) font(fonts []*Pair, name string) *pdfFont {
+	return w.p.cachedFont(w.fonts, fonts, name)
+}
+
+// doXObject 图像为单位正方形，Form 递归计算，并限制在它的 /BBox 中
+func (w *boundsWalker) doXObject(resources []*Pair, name string, ctm matrix) {
+	p := w.p
+	obj, _ := p.resolve(p.getValueByKey(p.getResolvedDict(resources, "/XObject"), name)).(*Obj)
+	if obj == nil || obj.Stream == nil {
+		return
+	}
+	subtype := p.getNameObjByKey(obj.Dict, "/Subtype")
+	if subtype == nil {
+		return
+	}
+	switch subtype.Name {
+	case "/Image":
+		w.add(ctm.transformRect(Rect{0, 0, 1, 1}))
+	case "/Form":
+		form := p.openForm(obj, resources, w.depth)
+		if form == nil {
+			return
+		}
+		ctm = form.matrix.multiply(ctm)
+		data, _, err := p.decodeStream(obj)
+		if err != nil {
+			return
+		}
+		saved := w.bounds
+		w.bounds = Rect{}
+		w.depth++
+		w.walk(data, form.resources, ctm)
+		w.depth--
+		inner := w.bounds
+		if bbox, ok := p.getRect(p.getValueByKey(obj.Dict, "/BBox")); ok {
+			inner = inner.intersect(ctm.transformRect(bbox))
+		}
+		w.bounds = saved.union(inner)
+	}
+}
@@ -0,0 +1,575 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// CCITT 传真编码 (Group 3 / Group 4) 的编解码
+// 参考: ITU-T T.4 / T.6 以及 PDF 规范 7.4.6 CCITTFaxDecode Filter
+
+// CCITTParams 对应 CCITTFaxDecode 的 /DecodeParms
+type CCITTParams struct {
+	K                int // <0: 纯二维编码(G4), =0: 纯一维编码(G3 1D), >0: 一维二维混合编码(G3 2D)
+	Columns          int
+	Rows             int // 为0表示不确定，解码到数据结束为止
+	BlackIs1         bool
+	EncodedByteAlign bool
+	EndOfLine        bool
+	EndOfBlock       bool
+}
+
+var errCCITTInvalidCode = errors.New("ccitt: invalid code")
+
+type ccittCode struct {
+	val  int
+	code string
+}
+
+const (
+	ccittModePass = iota
+	ccittModeH
+	ccittModeV0
+	ccittModeVR1
+	ccittModeVR2
+	ccittModeVR3
+	ccittModeVL1
+	ccittModeVL2
+	ccittModeVL3
+	ccittModeExt
+)
+
+// T.6 Table 1
+var ccittModeCodes = []ccittCode{
+	{ccittModePass, "0001"}, {ccittModeH, "001"}, {ccittModeV0, "1"},
+	{ccittModeVR1, "011"}, {ccittModeVR2, "000011"}, {ccittModeVR3, "0000011"},
+	{ccittModeVL1, "010"}, {ccittModeVL2, "000010"}, {ccittModeVL3, "0000010"},
+	{ccittModeExt, "0000001"},
+}
+
+// 垂直模式对应的 a1 - b1 偏移
+var ccittVerticalDelta = map[int]int{
+	ccittModeV0: 0, ccittModeVR1: 1, ccittModeVR2: 2, ccittModeVR3: 3,
+	ccittModeVL1: -1, ccittModeVL2: -2, ccittModeVL3: -3,
+}
+
+// T.4 Table 2 / Table 3, 白色游程
+var ccittWhiteCodes = []ccittCode{
+	{0, "00110101"}, {1, "000111"}, {2, "0111"}, {3, "1000"}, {4, "1011"}, {5, "1100"},
+	{6, "1110"}, {7, "1111"}, {8, "10011"}, {9, "10100"}, {10, "00111"}, {11, "01000"},
+	{12, "001000"}, {13, "000011"}, {14, "110100"}, {15, "110101"}, {16, "101010"}, {17, "101011"},
+	{18, "0100111"}, {19, "0001100"}, {20, "0001000"}, {21, "0010111"}, {22, "0000011"}, {23, "0000100"},
+	{24, "0101000"}, {25, "0101011"}, {26, "0010011"}, {27, "0100100"}, {28, "0011000"}, {29, "00000010"},
+	{30, "00000011"}, {31, "00011010"}, {32, "00011011"}, {33, "00010010"}, {34, "00010011"}, {35, "00010100"},
+	{36, "00010101"}, {37, "00010110"}, {38, "00010111"}, {39, "00101000"}, {40, "00101001"}, {41, "00101010"},
+	{42, "00101011"}, {43, "00101100"}, {44, "00101101"}, {45, "00000100"}, {46, "00000101"}, {47, "00001010"},
+	{48, "00001011"}, {49, "01010010"}, {50, "01010011"}, {51, "01010100"}, {52, "01010101"}, {53, "00100100"},
+	{54, "00100101"}, {55, "01011000"}, {56, "01011001"}, {57, "01011010"}, {58, "01011011"}, {59, "01001010"},
+	{60, "01001011"}, {61, "00110010"}, {62, "00110011"}, {63, "00110100"}, {64, "11011"}, {128, "10010"},
+	{192, "010111"}, {256, "0110111"}, {320, "00110110"}, {384, "00110111"}, {448, "01100100"}, {512, "01100101"},
+	{576, "01101000"}, {640, "01100111"}, {704, "011001100"}, {768, "011001101"}, {832, "011010010"}, {896, "011010011"},
+	{960, "011010100"}, {1024, "011010101"}, {1088, "011010110"}, {1152, "011010111"}, {1216, "011011000"}, {1280, "011011001"},
+	{1344, "011011010"}, {1408, "011011011"}, {1472, "010011000"}, {1536, "010011001"}, {1600, "010011010"}, {1664, "011000"},
+	{1728, "010011011"}, {1792, "00000001000"}, {1856, "00000001100"}, {1920, "00000001101"}, {1984, "000000010010"}, {2048, "000000010011"},
+	{2112, "000000010100"}, {2176, "000000010101"}, {2240, "000000010110"}, {2304, "000000010111"}, {2368, "000000011100"}, {2432, "000000011101"},
+	{2496, "000000011110"}, {2560, "000000011111"},
+}
+
+// T.4 Table 2 / Table 3, 黑色游程
+var ccittBlackCodes = []ccittCode{
+	{0, "0000110111"}, {1, "010"}, {2, "11"}, {3, "10"}, {4, "011"}, {5, "0011"},
+	{6, "0010"}, {7, "00011"}, {8, "000101"}, {9, "000100"}, {10, "0000100"}, {11, "0000101"},
+	{12, "0000111"}, {13, "00000100"}, {14, "00000111"}, {15, "000011000"}, {16, "0000010111"}, {17, "0000011000"},
+	{18, "0000001000"}, {19, "00001100111"}, {20, "00001101000"}, {21, "00001101100"}, {22, "00000110111"}, {23, "00000101000"},
+	{24, "00000010111"}, {25, "00000011000"}, {26, "000011001010"}, {27, "000011001011"}, {28, "000011001100"}, {29, "000011001101"},
+	{30, "000001101000"}, {31, "000001101001"}, {32, "000001101010"}, {33, "000001101011"}, {34, "000011010010"}, {35, "000011010011"},
+	{36, "000011010100"}, {37, "000011010101"}, {38, "000011010110"}, {39, "000011010111"}, {40, "000001101100"}, {41, "000001101101"},
+	{42, "000011011010"}, {43, "000011011011"}, {44, "000001010100"}, {45, "000001010101"}, {46, "000001010110"}, {47, "000001010111"},
+	{48, "000001100100"}, {49, "000001100101"}, {50, "000001010010"}, {51, "000001010011"}, {52, "000000100100"}, {53, "000000110111"},
+	{54, "000000111000"}, {55, "000000100111"}, {56, "000000101000"}, {57, "000001011000"}, {58, "000001011001"}, {59, "000000101011"},
+	{60, "000000101100"}, {61, "000001011010"}, {62, "000001100110"}, {63, "000001100111"}, {64, "0000001111"}, {128, "000011001000"},
+	{192, "000011001001"}, {256, "000001011011"}, {320, "000000110011"}, {384, "000000110100"}, {448, "000000110101"}, {512, "0000001101100"},
+	{576, "0000001101101"}, {640, "0000001001010"}, {704, "0000001001011"}, {768, "0000001001100"}, {832, "0000001001101"}, {896, "0000001110010"},
+	{960, "0000001110011"}, {1024, "0000001110100"}, {1088, "0000001110101"}, {1152, "0000001110110"}, {1216, "0000001110111"}, {1280, "0000001010010"},
+	{1344, "0000001010011"}, {1408, "0000001010100"}, {1472, "0000001010101"}, {1536, "0000001011010"}, {1600, "0000001011011"}, {1664, "0000001100100"},
+	{1728, "0000001100101"}, {1792, "00000001000"}, {1856, "00000001100"}, {1920, "00000001101"}, {1984, "000000010010"}, {2048, "000000010011"},
+	{2112, "000000010100"}, {2176, "000000010101"}, {2240, "000000010110"}, {2304, "000000010111"}, {2368, "000000011100"}, {2432, "000000011101"},
+	{2496, "000000011110"}, {2560, "000000011111"},
+}
+
+// 解码查找表, key 为 码长<<16 | 码值
+var (
+	ccittModeTable  = buildCCITTTable(ccittModeCodes)
+	ccittWhiteTable = buildCCITTTable(ccittWhiteCodes)
+	ccittBlackTable = buildCCITTTable(ccittBlackCodes)
+)
+
+// 编码查找表, key 为游程长度
+var (
+	ccittWhiteRuns = buildCCITTRuns(ccittWhiteCodes)
+	ccittBlackRuns = buildCCITTRuns(ccittBlackCodes)
+)
+
+func buildCCITTTable(codes []ccittCode) map[uint32]int {
+	table := make(map[uint32]int, len(codes))
+	for _, c := range codes {
+		bits := uint32(0)
+		for _, ch := range c.code {
+			bits = bits<<1 | uint32(ch-'0')
+		}
+		table[uint32(len(c.code))<<16|bits] = c.val
+	}
+	return table
+}
+
+func buildCCITTRuns(codes []ccittCode) map[int]string {
+	runs := make(map[int]string, len(codes))
+	for _, c := range codes {
+		runs[c.val] = c.code
+	}
+	return runs
+}
+
+type ccittBitReader struct {
+	data []byte
+	pos  int // 当前读到的bit位置
+}
+
+func (r *ccittBitReader) eof() bool {
+	return r.pos >= len(r.data)*8
+}
+
+func (r *ccittBitReader) bitAt(pos int) (uint32, bool) {
+	if pos >= len(r.data)*8 {
+		return 0, false
+	}
+	return uint32(r.data[pos>>3]>>(7-uint(pos&7))) & 1, true
+}
+
+func (r *ccittBitReader) readBit() (uint32, bool) {
+	b, ok := r.bitAt(r.pos)
+	if ok {
+		r.pos++
+	}
+	return b, ok
+}
+
+func (r *ccittBitReader) align() {
+	r.pos = (r.pos + 7) &^ 7
+}
+
+// 跳过填充的0和一个 EOL (000000000001)，没有读到 EOL 时不移动位置
+func (r *ccittBitReader) skipEOL() bool {
+	zeros := 0
+	for {
+		b, ok := r.bitAt(r.pos + zeros)
+		if !ok {
+			// 剩下的全是0, 当作填充位
+			r.pos += zeros
+			return false
+		}
+		if b == 1 {
+			break
+		}
+		zeros++
+	}
+	if zeros < 11 {
+		return false
+	}
+	r.pos += zeros + 1
+	return true
+}
+
+func (r *ccittBitReader) readCode(table map[uint32]int) (int, error) {
+	bits := uint32(0)
+	for n := uint32(1); n <= 13; n++ {
+		b, ok := r.readBit()
+		if !ok {
+			return 0, io.ErrUnexpectedEOF
+		}
+		bits = bits<<1 | b
+		if v, ok := table[n<<16|bits]; ok {
+			return v, nil
+		}
+	}
+	return 0, errCCITTInvalidCode
+}
+
+// 读一个完整的游程: 若干个 make-up 码 + 一个 terminating 码
+func (r *ccittBitReader) readRun(white bool) (int, error) {
+	table := ccittBlackTable
+	if white {
+		table = ccittWhiteTable
+	}
+	total := 0
+	for {
+		n, err := r.readCode(table)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+		if n < 64 {
+			return total, nil
+		}
+	}
+}
+
+// 一维编码的一行，返回颜色变化的位置
+func (r *ccittBitReader) decode1D(columns int) ([]int, error) {
+	line := make([]int, 0)
+	a0 := 0
+	white := true
+	for a0 < columns {
+		n, err := r.readRun(white)
+		if err != nil {
+			return nil, err
+		}
+		a0 += n
+		line = append(line, a0)
+		white = !white
+	}
+	return trimCCITTLine(line, columns), nil
+}
+
+// 二维编码的一行，ref 为参考行的颜色变化位置
+func (r *ccittBitReader) decode2D(ref []int, columns int) ([]int, error) {
+	ref = padCCITTLine(ref, columns)
+	line := make([]int, 0)
+	a0 := -1
+	white := true
+	for a0 < columns {
+		b1, b2 := findCCITTB(ref, a0, white)
+		mode, err := r.readCode(ccittModeTable)
+		if err != nil {
+			return nil, err
+		}
+		switch mode {
+		case ccittModePass:
+			a0 = b2
+		case ccittModeH:
+			start := a0
+			if start < 0 {
+				start = 0
+			}
+			run1, err := r.readRun(white)
+			if err != nil {
+				return nil, err
+			}
+			run2, err := r.readRun(!white)
+			if err != nil {
+				return nil, err
+			}
+			a1 := start + run1
+			a2 := a1 + run2
+			line = append(line, a1, a2)
+			a0 = a2
+		case ccittModeExt:
+			return nil, errors.New("ccitt: unsupported extension mode")
+		default:
+			a1 := b1 + ccittVerticalDelta[mode]
+			if a1 < 0 || a1 < a0 {
+				return nil, errCCITTInvalidCode
+			}
+			line = append(line, a1)
+			a0 = a1
+			white = !white
+		}
+	}
+	return trimCCITTLine(line, columns), nil
+}
+
+// 参考行末尾补上哨兵，保证总能找到 b1, b2
+func padCCITTLine(line []int, columns int) []int {
+	padded := make([]int, 0, len(line)+3)
+	padded = append(padded, line...)
+	return append(padded, columns, columns, columns)
+}
+
+// 去掉超出行宽的变化位置
+func trimCCITTLine(line []int, columns int) []int {
+	for i, v := range line {
+		if v >= columns {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// b1: 参考行上 a0 右侧第一个与当前颜色相反的变化位置, b2: b1 之后的下一个变化位置
+// 偶数下标是白变黑, 奇数下标是黑变白
+func findCCITTB(ref []int, a0 int, white bool) (int, int) {
+	for i := 0; i+1 < len(ref); i++ {
+		if ref[i] <= a0 || (i%2 == 0) != white {
+			continue
+		}
+		return ref[i], ref[i+1]
+	}
+	columns := ref[len(ref)-1]
+	return columns, columns
+}
+
+// DecodeCCITT 解码 CCITTFaxDecode 的数据，返回的灰度图中
+// 0 和 255 分别对应解码后采样值 0 和 1 (BlackIs1 为 false 时 0 为黑色)
+func DecodeCCITT(data []byte, params *CCITTParams) (*image.Gray, error) {
+	columns := params.Columns
+	if columns <= 0 {
+		columns = 1728
+	}
+	r := &ccittBitReader{data: data}
+	rows := make([][]int, 0)
+	ref := make([]int, 0)
+	for params.Rows <= 0 || len(rows) < params.Rows {
+		if params.EncodedByteAlign && (params.K < 0 || !params.EndOfLine) {
+			r.align()
+		}
+		if params.K >= 0 || params.EndOfLine {
+			if r.skipEOL() {
+				if r.endOfBlock(params.K) {
+					break
+				}
+				// EOL 前后都可能有填充位，保证数据行从字节边界开始
+				if params.EncodedByteAlign {
+					r.align()
+				}
+			}
+		} else if r.skipEOL() {
+			// G4 以两个连续的 EOL (EOFB) 结束
+			break
+		}
+		if r.eof() {
+			break
+		}
+		twoD := params.K < 0
+		if params.K > 0 {
+			tag, _ := r.readBit()
+			twoD = tag == 0
+		}
+		var line []int
+		var err error
+		if twoD {
+			line, err = r.decode2D(ref, columns)
+		} else {
+			line, err = r.decode1D(columns)
+		}
+		if err != nil {
+			// 不能用部分的行代替整个图像，否则重新编码时会丢掉后面的内容
+			return nil, fmt.Errorf("ccitt row %d: %v", len(rows)+1, err)
+		}
+		rows = append(rows, line)
+		ref = line
+	}
+	height := len(rows)
+	if params.Rows > 0 {
+		height = params.Rows
+	}
+	img := image.NewGray(image.Rect(0, 0, columns, height))
+	black, white := uint8(0), uint8(255)
+	if params.BlackIs1 {
+		black, white = white, black
+	}
+	for y := 0; y < height; y++ {
+		pix := img.Pix[y*img.Stride : y*img.Stride+columns]
+		var line []int
+		if y < len(rows) {
+			line = rows[y]
+		}
+		x := 0
+		for i := 0; i <= len(line); i++ {
+			end := columns
+			if i < len(line) {
+				end = line[i]
+			}
+			v := white
+			if i%2 == 1 {
+				v = black
+			}
+			for ; x < end; x++ {
+				pix[x] = v
+			}
+		}
+	}
+	return img, nil
+}
+
+// 刚读过一个 EOL，检查后面是否紧跟着另一个 EOL (RTC)
+func (r *ccittBitReader) endOfBlock(k int) bool {
+	pos := r.pos
+	if k > 0 {
+		r.readBit()
+	}
+	if r.skipEOL() {
+		return true
+	}
+	r.pos = pos
+	return false
+}
+
+type ccittBitWriter struct {
+	buf   []byte
+	nbits int
+}
+
+func (w *ccittBitWriter) writeCode(code string) {
+	for _, ch := range code {
+		if w.nbits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if ch == '1' {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.nbits%8)
+		}
+		w.nbits++
+	}
+}
+
+func (w *ccittBitWriter) writeRun(white bool, n int) {
+	runs := ccittBlackRuns
+	if white {
+		runs = ccittWhiteRuns
+	}
+	for n >= 2560 {
+		w.writeCode(runs[2560])
+		n -= 2560
+	}
+	if n >= 64 {
+		w.writeCode(runs[n/64*64])
+		n %= 64
+	}
+	w.writeCode(runs[n])
+}
+
+func (w *ccittBitWriter) encode2D(line, ref []int, columns int) {
+	cur := make([]int, 0, len(line)+2)
+	cur = append(cur, line...)
+	cur = append(cur, columns, columns)
+	ref = padCCITTLine(ref, columns)
+	a0 := -1
+	white := true
+	i := 0
+	for a0 < columns {
+		for cur[i] <= a0 {
+			i++
+		}
+		a1, a2 := cur[i], cur[i+1]
+		b1, b2 := findCCITTB(ref, a0, white)
+		if b2 < a1 {
+			w.writeCode(ccittModeCodes[ccittModePass].code)
+			a0 = b2
+			continue
+		}
+		if d := a1 - b1; d >= -3 && d <= 3 {
+			for mode, delta := range ccittVerticalDelta {
+				if delta == d {
+					w.writeCode(ccittModeCodes[mode].code)
+					break
+				}
+			}
+			a0 = a1
+			white = !white
+			continue
+		}
+		start := a0
+		if start < 0 {
+			start = 0
+		}
+		w.writeCode(ccittModeCodes[ccittModeH].code)
+		w.writeRun(white, a1-start)
+		w.writeRun(!white, a2-a1)
+		a0 = a2
+	}
+}
+
+// EncodeCCITTG4 把图像二值化后用 CCITT Group 4 (K = -1) 编码，
+// 亮度小于128的像素编码为黑色，对应 BlackIs1 为 false 时的采样值 0
+func EncodeCCITTG4(img image.Image) []byte {
+	b := img.Bounds()
+	columns := b.Dx()
+	w := &ccittBitWriter{}
+	ref := make([]int, 0)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		line := make([]int, 0)
+		white := true
+		for x := 0; x < columns; x++ {
+			isWhite := isWhitePixel(img, b.Min.X+x, y)
+			if isWhite != white {
+				line = append(line, x)
+				white = isWhite
+			}
+		}
+		w.encode2D(line, ref, columns)
+		ref = line
+	}
+	// EOFB
+	w.writeCode("000000000001")
+	w.writeCode("000000000001")
+	return w.buf
+}
+
+func isWhitePixel(img image.Image, x, y int) bool {
+	if gray, ok := img.(*image.Gray); ok {
+		return gray.GrayAt(x, y).Y >= 128
+	}
+	return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y >= 128
+}
+
+// EncodeTIFF 把二值图像保存为 CCITT Group 4 压缩的 TIFF 文件
+func EncodeTIFF(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	data := EncodeCCITTG4(img)
+
+	buf := bytes.NewBuffer([]byte{'I', 'I', 42, 0})
+	//  first_ifd (Image file directory) / offset
+	tmp := make([]byte, 4)
+	binary.LittleEndian.PutUint32(tmp, uint32(8))
+	buf.Write(tmp)
+
+	ifdLength := 10
+	headerLength := 8 + 2 + (ifdLength*12 + 4)
+
+	tmp = make([]byte, 2)
+	binary.LittleEndian.PutUint16(tmp, uint16(ifdLength))
+	buf.Write(tmp)
+
+	// Dictionary should be in order based on the TiffTag value
+	writeTIFFTag(buf, 254, 4, 1, 0)
+	writeTIFFTag(buf, 256, 4, 1, width)
+	writeTIFFTag(buf, 257, 4, 1, height)
+	writeTIFFTag(buf, 258, 3, 1, 1)
+	writeTIFFTag(buf, 259, 3, 1, 4) // Compression: CCITT Group 4
+	writeTIFFTag(buf, 262, 3, 1, 0) // WhiteIsZero
+	writeTIFFTag(buf, 273, 4, 1, headerLength)
+	writeTIFFTag(buf, 277, 3, 1, 1)
+	writeTIFFTag(buf, 278, 4, 1, height)
+	writeTIFFTag(buf, 279, 4, 1, len(data))
+
+	tmp = make([]byte, 4)
+	binary.LittleEndian.PutUint32(tmp, uint32(0))
+	buf.Write(tmp)
+
+	buf.Write(data)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeTIFFTag(w *bytes.Buffer, tag, typ, count, value int) {
+	tmp := make([]byte, 2)
+	binary.LittleEndian.PutUint16(tmp, uint16(tag))
+	w.Write(tmp)
+
+	tmp = make([]byte, 2)
+	binary.LittleEndian.PutUint16(tmp, uint16(typ))
+	w.Write(tmp)
+
+	tmp = make([]byte, 4)
+	binary.LittleEndian.PutUint32(tmp, uint32(count))
+	w.Write(tmp)
+
+	tmp = make([]byte, 4)
+	binary.LittleEndian.PutUint32(tmp, uint32(value))
+	w.Write(tmp)
+}
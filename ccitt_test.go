@@ -0,0 +1,213 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"image"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/ccitt"
+)
+
+// testBilevel 生成一个有横线、竖线、斜线和方块的二值图像，
+// 宽度不是 8 的倍数，包含很长的白色和黑色游程
+func testBilevel() *image.Gray {
+	const w, h = 2700, 40
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			black := y == 3 ||
+				x == 7 || x == w-1 ||
+				(x-y)%97 == 0 ||
+				(x >= 100 && x < 2690 && y >= 20 && y < 24) ||
+				(x/5+y/3)%11 == 0 && x < 300
+			if !black {
+				img.Pix[y*img.Stride+x] = 255
+			}
+		}
+	}
+	return img
+}
+
+func sameGray(t *testing.T, name string, got, want *image.Gray) {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("%s: bounds %v, want %v", name, got.Bounds(), want.Bounds())
+	}
+	if !bytes.Equal(got.Pix, want.Pix) {
+		n := 0
+		for i := range got.Pix {
+			if got.Pix[i] != want.Pix[i] {
+				n++
+			}
+		}
+		t.Fatalf("%s: %d pixels differ", name, n)
+	}
+}
+
+func TestCCITTG4RoundTrip(t *testing.T) {
+	want := testBilevel()
+	w, h := want.Bounds().Dx(), want.Bounds().Dy()
+	data := EncodeCCITTG4(want)
+
+	for _, rows := range []int{h, 0} {
+		got, err := DecodeCCITT(data, &CCITTParams{K: -1, Columns: w, Rows: rows})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sameGray(t, "decode", got, want)
+	}
+
+	// 其他解码器也要能解出同样的图像
+	got := image.NewGray(want.Bounds())
+	if err := ccitt.DecodeIntoGray(got, bytes.NewReader(data), ccitt.MSB, ccitt.Group4, nil); err != nil {
+		t.Fatal(err)
+	}
+	sameGray(t, "x/image/ccitt", got, want)
+
+	// BlackIs1 时采样值反转
+	inv, err := DecodeCCITT(data, &CCITTParams{K: -1, Columns: w, Rows: h, BlackIs1: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range inv.Pix {
+		if inv.Pix[i] != 255-want.Pix[i] {
+			t.Fatalf("BlackIs1: pixel %d is %d", i, inv.Pix[i])
+		}
+	}
+}
+
+// encodeG3 按 G3 编码，k > 0 时每 k 行中第一行为一维编码
+func encodeG3(img *image.Gray, k int, align bool) []byte {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	lines := make([][]int, h)
+	for y := range lines {
+		white := true
+		for x := 0; x < w; x++ {
+			if isWhite := img.Pix[y*img.Stride+x] == 255; isWhite != white {
+				lines[y] = append(lines[y], x)
+				white = isWhite
+			}
+		}
+	}
+	bw := &ccittBitWriter{}
+	var ref []int
+	for y, line := range lines {
+		if align {
+			// 填充位使 EOL 在字节边界结束
+			for (bw.nbits+12)%8 != 0 {
+				bw.writeCode("0")
+			}
+		}
+		bw.writeCode("000000000001")
+		oneD := k == 0 || y%k == 0
+		if k > 0 {
+			if oneD {
+				bw.writeCode("1")
+			} else {
+				bw.writeCode("0")
+			}
+		}
+		if oneD {
+			white, a0 := true, 0
+			for _, x := range append(line, w) {
+				bw.writeRun(white, x-a0)
+				white, a0 = !white, x
+			}
+		} else {
+			bw.encode2D(line, ref, w)
+		}
+		ref = line
+	}
+	// RTC
+	for i := 0; i < 6; i++ {
+		bw.writeCode("000000000001")
+		if k > 0 {
+			bw.writeCode("1")
+		}
+	}
+	return bw.buf
+}
+
+func TestCCITTG3(t *testing.T) {
+	want := testBilevel()
+	w := want.Bounds().Dx()
+	for _, c := range []struct {
+		name  string
+		k     int
+		align bool
+	}{
+		{"1D", 0, false},
+		{"1D aligned", 0, true},
+		{"2D", 4, false},
+	} {
+		params := &CCITTParams{K: c.k, Columns: w, EndOfLine: true, EncodedByteAlign: c.align}
+		got, err := DecodeCCITT(encodeG3(want, c.k, c.align), params)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		sameGray(t, c.name, got, want)
+	}
+}
+
+func TestCCITTTruncated(t *testing.T) {
+	img := testBilevel()
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	data := EncodeCCITTG4(img)
+	if _, err := DecodeCCITT(data[:len(data)/2], &CCITTParams{K: -1, Columns: w, Rows: h}); err == nil {
+		t.Error("truncated data decoded without error")
+	}
+}
+
+// ccittObj 用 ASCIIHexDecode 和 CCITTFaxDecode 两个过滤器保存 G3 编码的图像
+func ccittObj(p *PDF, img *image.Gray, data []byte) *Obj {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return p.newStreamObj([]*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/XObject"}},
+		{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Image"}},
+		{Key: &NameObj{Name: "/Width"}, Value: w},
+		{Key: &NameObj{Name: "/Height"}, Value: h},
+		{Key: &NameObj{Name: "/ColorSpace"}, Value: &NameObj{Name: "/DeviceGray"}},
+		{Key: &NameObj{Name: "/BitsPerComponent"}, Value: 1},
+		{Key: &NameObj{Name: "/Filter"}, Value: []interface{}{&NameObj{Name: "/ASCIIHexDecode"}, &NameObj{Name: "/CCITTFaxDecode"}}},
+		{Key: &NameObj{Name: "/DecodeParms"}, Value: []interface{}{nil, []*Pair{
+			{Key: &NameObj{Name: "/K"}, Value: 0},
+			{Key: &NameObj{Name: "/Columns"}, Value: w},
+			{Key: &NameObj{Name: "/Rows"}, Value: h},
+			{Key: &NameObj{Name: "/EndOfLine"}, Value: true},
+		}}},
+	}, []byte(hex.EncodeToString(data)+">"))
+}
+
+func TestCompressCCITTFilterChain(t *testing.T) {
+	want := testBilevel()
+	p := &PDF{}
+	obj := ccittObj(p, want, encodeG3(want, 0, false))
+	if reason := p.compressOneImage(obj, nil); reason != "" {
+		t.Fatalf("skipped: %v", reason)
+	}
+	if filter := p.getValueByKey(obj.Dict, "/Filter"); !reflect.DeepEqual(filter, &NameObj{Name: "/CCITTFaxDecode"}) {
+		t.Fatalf("filter %v", filter)
+	}
+	got, err := p.decodeCCITTObj(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameGray(t, "compressed", got, want)
+	var tiff bytes.Buffer
+	if err := p.SaveTIFF(obj, &tiff); err != nil {
+		t.Fatal(err)
+	}
+
+	// 数据损坏时不修改对象
+	data := encodeG3(want, 0, false)
+	broken := ccittObj(p, want, data[:len(data)/2])
+	old := broken.Stream.data()
+	if reason := p.compressOneImage(broken, nil); reason != SkipDecodeError {
+		t.Fatalf("broken stream: reason %q", reason)
+	}
+	if !bytes.Equal(broken.Stream.data(), old) {
+		t.Error("broken stream was replaced")
+	}
+}
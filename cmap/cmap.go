@@ -0,0 +1,290 @@
+// Package cmap 解析 PDF 字体中用到的 CMap。
+// /ToUnicode CMap 把字符编码对应到 Unicode 文字，编码 CMap (如 UniGB-UCS2-H) 把字符编码对应到 CID。
+// 包中内嵌了 Adobe-GB1 的 CID 到 Unicode 的对应表和常用的简体中文预定义 CMap，
+// 参考 Adobe Technical Note #5014 和 #5099
+package cmap
+
+import (
+	"unicode/utf16"
+)
+
+// CMap 字符编码的拆分规则，以及编码到 Unicode 或者 CID 的对应关系
+type CMap struct {
+	Name string
+
+	codespaces []codespace
+	chars      map[int]string
+	ranges     []bfRange
+	cids       map[int]int
+	cidRanges  []cidRange
+	parent     *CMap // usecmap 引用的 CMap
+
+	identity bool // Identity-H 和 Identity-V，CID 和编码相同
+	utf16    bool // 编码就是 UTF-16，如 UniGB-UCS2-H
+}
+
+// codespace 编码的字节数和每个字节的范围
+type codespace struct {
+	low, high []byte
+}
+
+// bfRange 连续的一段编码，dst 为第一个编码的文字，后面的依次加一；
+// 或者 list 中每个编码单独给出文字
+type bfRange struct {
+	low, high int
+	dst       []uint16
+	list      []string
+}
+
+// cidRange 连续的一段编码对应从 cid 开始的连续的 CID
+type cidRange struct {
+	low, high int
+	cid       int
+}
+
+func newCMap() *CMap {
+	return &CMap{chars: make(map[int]string), cids: make(map[int]int)}
+}
+
+// Parse 解析 CMap 文件或者 /ToUnicode 流的内容，只读取 codespacerange、bfchar、bfrange、
+// cidchar、cidrange 和 usecmap，其他 PostScript 语句忽略
+func Parse(data []byte) (*CMap, error) {
+	return parse(data, Predefined)
+}
+
+// parse 和 Parse 相同，usecmap 引用的 CMap 由 use 取得
+func parse(data []byte, use func(name string) *CMap) (*CMap, error) {
+	c := newCMap()
+	s := &scanner{data: data}
+	args := make([]interface{}, 0)
+	// section 读取 beginxxx 和 endxxx 之间的操作数
+	section := func() ([]interface{}, error) {
+		list := make([]interface{}, 0)
+		for {
+			v, keyword, err := s.next()
+			if err != nil || keyword != "" {
+				return list, err
+			}
+			if v == nil {
+				return list, nil
+			}
+			list = append(list, v)
+		}
+	}
+	for {
+		v, keyword, err := s.next()
+		if err != nil {
+			return c, err
+		}
+		if v == nil && keyword == "" {
+			return c, nil
+		}
+		if keyword == "" {
+			args = append(args, v)
+			continue
+		}
+		switch keyword {
+		case "begincodespacerange":
+			list, err := section()
+			if err != nil {
+				return c, err
+			}
+			for i := 0; i+1 < len(list); i += 2 {
+				low, _ := list[i].([]byte)
+				high, _ := list[i+1].([]byte)
+				if len(low) > 0 && len(low) == len(high) {
+					c.codespaces = append(c.codespaces, codespace{low: low, high: high})
+				}
+			}
+		case "beginbfchar":
+			list, err := section()
+			if err != nil {
+				return c, err
+			}
+			for i := 0; i+1 < len(list); i += 2 {
+				c.chars[toCode(list[i])] = toText(list[i+1])
+			}
+		case "beginbfrange":
+			list, err := section()
+			if err != nil {
+				return c, err
+			}
+			for i := 0; i+2 < len(list); i += 3 {
+				r := bfRange{low: toCode(list[i]), high: toCode(list[i+1])}
+				if r.high < r.low || r.high-r.low > 0xffff {
+					continue
+				}
+				if arr, ok := list[i+2].([]interface{}); ok {
+					for _, item := range arr {
+						r.list = append(r.list, toText(item))
+					}
+				} else if buf, ok := list[i+2].([]byte); ok && len(buf) > 0 {
+					r.dst = utf16Units(buf)
+				} else {
+					continue
+				}
+				c.ranges = append(c.ranges, r)
+			}
+		case "begincidchar":
+			list, err := section()
+			if err != nil {
+				return c, err
+			}
+			for i := 0; i+1 < len(list); i += 2 {
+				if cid, ok := list[i+1].(int); ok {
+					c.cids[toCode(list[i])] = cid
+				}
+			}
+		case "begincidrange":
+			list, err := section()
+			if err != nil {
+				return c, err
+			}
+			for i := 0; i+2 < len(list); i += 3 {
+				cid, ok := list[i+2].(int)
+				r := cidRange{low: toCode(list[i]), high: toCode(list[i+1]), cid: cid}
+				if ok && r.low <= r.high {
+					c.cidRanges = append(c.cidRanges, r)
+				}
+			}
+		case "usecmap":
+			if len(args) > 0 {
+				if name, ok := args[len(args)-1].(string); ok {
+					c.parent = use(name)
+				}
+			}
+		case "def":
+			if len(args) == 2 && args[0] == "/CMapName" {
+				if name, ok := args[1].(string); ok {
+					c.Name = name[1:]
+				}
+			}
+		}
+		args = args[:0]
+	}
+}
+
+// toCode 把字节按大端转换为编码
+func toCode(v interface{}) int {
+	code := 0
+	buf, _ := v.([]byte)
+	for _, b := range buf {
+		code = code<<8 | int(b)
+	}
+	return code
+}
+
+// toText 目标文字为 UTF-16BE 的字符串
+func toText(v interface{}) string {
+	buf, _ := v.([]byte)
+	return string(utf16.Decode(utf16Units(buf)))
+}
+
+func utf16Units(buf []byte) []uint16 {
+	units := make([]uint16, 0, len(buf)/2+1)
+	for i := 0; i+1 < len(buf); i += 2 {
+		units = append(units, uint16(buf[i])<<8|uint16(buf[i+1]))
+	}
+	if len(buf)%2 == 1 {
+		// 单字节的目标按一个字符处理
+		units = append(units, uint16(buf[len(buf)-1]))
+	}
+	return units
+}
+
+// Split 按 codespacerange 把字符串拆分为编码，没有 codespacerange 时返回 nil。
+// 不在任何范围中的字节按单字节处理
+func (c *CMap) Split(data []byte) []int {
+	parts := c.SplitBytes(data)
+	if parts == nil {
+		return nil
+	}
+	codes := make([]int, 0, len(parts))
+	for _, part := range parts {
+		codes = append(codes, toCode(part))
+	}
+	return codes
+}
+
+// SplitBytes 和 Split 相同，但返回每个编码原来的字节
+func (c *CMap) SplitBytes(data []byte) [][]byte {
+	spaces := c.codespaces
+	for p := c.parent; len(spaces) == 0 && p != nil; p = p.parent {
+		spaces = p.codespaces
+	}
+	if len(spaces) == 0 {
+		return nil
+	}
+	parts := make([][]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		n := 1
+		for _, cs := range spaces {
+			if i+len(cs.low) <= len(data) && cs.contains(data[i:i+len(cs.low)]) {
+				n = len(cs.low)
+				break
+			}
+		}
+		parts = append(parts, data[i:i+n])
+		i += n
+	}
+	return parts
+}
+
+func (cs codespace) contains(buf []byte) bool {
+	for i, b := range buf {
+		if b < cs.low[i] || b > cs.high[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Unicode 返回编码对应的文字，没有时返回 false
+func (c *CMap) Unicode(code int) (string, bool) {
+	if text, ok := c.chars[code]; ok {
+		return text, true
+	}
+	for _, r := range c.ranges {
+		if code < r.low || code > r.high {
+			continue
+		}
+		if r.list != nil {
+			if i := code - r.low; i < len(r.list) {
+				return r.list[i], true
+			}
+			return "", false
+		}
+		units := append([]uint16{}, r.dst...)
+		units[len(units)-1] += uint16(code - r.low)
+		return string(utf16.Decode(units)), true
+	}
+	if c.utf16 {
+		if code > 0xffff {
+			return string(utf16.Decode([]uint16{uint16(code >> 16), uint16(code)})), true
+		}
+		return string(rune(code)), true
+	}
+	if c.parent != nil {
+		return c.parent.Unicode(code)
+	}
+	return "", false
+}
+
+// CID 返回编码对应的 CID，没有时返回 false
+func (c *CMap) CID(code int) (int, bool) {
+	if c.identity {
+		return code, true
+	}
+	if cid, ok := c.cids[code]; ok {
+		return cid, true
+	}
+	for _, r := range c.cidRanges {
+		if code >= r.low && code <= r.high {
+			return r.cid + code - r.low, true
+		}
+	}
+	if c.parent != nil {
+		return c.parent.CID(code)
+	}
+	return 0, false
+}
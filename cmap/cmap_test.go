@@ -0,0 +1,172 @@
+package cmap
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testCMap = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CMapName /Test-UCS2 def
+2 begincodespacerange
+<00> <80>
+<8140> <FEFE>
+endcodespacerange
+3 beginbfchar
+<41> <0042>
+<8140> <D83DDE00>
+<8141> <00660069>
+endbfchar
+2 beginbfrange
+<8150> <8152> [<0061> <0062> <00660066>]
+<8160> <8162> <4E2D>
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(testCMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "Test-UCS2" {
+		t.Errorf("name %q", c.Name)
+	}
+	// 不在任何范围中的字节按单字节处理
+	if got, want := c.Split([]byte("\x20\x81\x40\xff\x81")), []int{0x20, 0x8140, 0xff, 0x81}; !reflect.DeepEqual(got, want) {
+		t.Errorf("split %x, want %x", got, want)
+	}
+	for _, tc := range []struct {
+		code int
+		text string
+		ok   bool
+	}{
+		{0x41, "B", true},
+		{0x8140, "😀", true},
+		{0x8141, "fi", true},
+		{0x8150, "a", true},
+		{0x8152, "ff", true},
+		{0x8160, "中", true},
+		{0x8162, "丯", true},
+		{0x8153, "", false},
+		{0x42, "", false},
+	} {
+		if text, ok := c.Unicode(tc.code); text != tc.text || ok != tc.ok {
+			t.Errorf("unicode %#x: %q %v, want %q %v", tc.code, text, ok, tc.text, tc.ok)
+		}
+	}
+}
+
+func TestParseUseCMap(t *testing.T) {
+	c, err := Parse([]byte("/GB-EUC-H usecmap\n1 begincidchar <B0A2> 5 endcidchar\n1 begincidrange <21> <22> 100 endcidrange"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 自己的对应关系优先，没有的再查 usecmap 引用的 CMap，codespacerange 也使用它的
+	for _, tc := range []struct {
+		code, cid int
+		ok        bool
+	}{
+		{0xb0a2, 5, true},
+		{0x22, 101, true},
+		{0xb0a1, 778, true},
+		{0x41, 34, true},
+		{0xa2a1, 0, false},
+	} {
+		if cid, ok := c.CID(tc.code); cid != tc.cid || ok != tc.ok {
+			t.Errorf("cid %#x: %d %v, want %d %v", tc.code, cid, ok, tc.cid, tc.ok)
+		}
+	}
+	if got, want := c.Split([]byte("A\xb0\xa1")), []int{0x41, 0xb0a1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("split %x, want %x", got, want)
+	}
+}
+
+func TestPredefined(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		data  string
+		codes []int
+		cids  []int // -1 表示没有 CID
+		texts []string
+	}{
+		{"GB-EUC-H", "A\xb0\xa1", []int{0x41, 0xb0a1}, []int{34, 778}, []string{"", ""}},
+		{"/GB-EUC-H", "A", []int{0x41}, []int{34}, []string{""}},
+		{"GBpc-EUC-H", "\x80\xb0\xa1\xfd", []int{0x80, 0xb0a1, 0xfd}, []int{-1, 778, -1}, []string{"ü", "", "©"}},
+		{"GBK-EUC-H", "\x80\xb0\xa1\x81\x40", []int{0x80, 0xb0a1, 0x8140}, []int{-1, 778, -1}, []string{"€", "啊", "丂"}},
+		{"UniGB-UCS2-H", "\x00A\x55\x4a\x4e\x02", []int{0x41, 0x554a, 0x4e02}, []int{34, 778, -1}, []string{"A", "啊", "丂"}},
+		{"UniGB-UTF16-H", "\xd8\x3d\xde\x00\x55\x4a", []int{0xd83dde00, 0x554a}, []int{-1, 778}, []string{"😀", "啊"}},
+		{"Identity-H", "\x12\x34", []int{0x1234}, []int{0x1234}, []string{""}},
+	} {
+		c := Predefined(tc.name)
+		if c == nil {
+			t.Errorf("%s not found", tc.name)
+			continue
+		}
+		if codes := c.Split([]byte(tc.data)); !reflect.DeepEqual(codes, tc.codes) {
+			t.Errorf("%s: split %x, want %x", tc.name, codes, tc.codes)
+			continue
+		}
+		for i, code := range tc.codes {
+			cid, ok := c.CID(code)
+			if !ok {
+				cid = -1
+			}
+			if cid != tc.cids[i] {
+				t.Errorf("%s: cid %#x is %d, want %d", tc.name, code, cid, tc.cids[i])
+			}
+			if text, _ := c.Unicode(code); text != tc.texts[i] {
+				t.Errorf("%s: unicode %#x is %q, want %q", tc.name, code, text, tc.texts[i])
+			}
+		}
+	}
+	// 内嵌的 Adobe-GB1 CID 和 Unicode 的对应关系
+	if text, ok := Predefined("Adobe-GB1-UCS2").Unicode(778); !ok || text != "啊" {
+		t.Errorf("Adobe-GB1-UCS2 cid 778: %q", text)
+	}
+	if Predefined("Unknown-H") != nil {
+		t.Error("unknown cmap found")
+	}
+}
+
+func TestSetDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Test-H":   "/GB-EUC-H usecmap\n1 begincidchar <B0A1> 9 endcidchar",
+		"GB-EUC-H": "1 begincodespacerange <00> <80> endcodespacerange\n1 begincidrange <20> <7E> 500 endcidrange",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if Predefined("Test-H") != nil {
+		t.Fatal("Test-H found before SetDir")
+	}
+	SetDir(dir)
+	defer SetDir("")
+	// 目录中的文件优先于内嵌的数据，usecmap 也从目录中读取
+	c := Predefined("/Test-H")
+	if c == nil || c.Name != "Test-H" {
+		t.Fatalf("Test-H: %v", c)
+	}
+	if cid, _ := c.CID(0xb0a1); cid != 9 {
+		t.Errorf("Test-H cid %d, want 9", cid)
+	}
+	if cid, _ := c.CID(0x41); cid != 533 {
+		t.Errorf("Test-H parent cid %d, want 533", cid)
+	}
+	// 目录中没有的仍然使用内嵌的数据
+	if cid, _ := Predefined("UniGB-UCS2-H").CID(0x554a); cid != 778 {
+		t.Errorf("UniGB-UCS2-H cid %d, want 778", cid)
+	}
+	SetDir("")
+	if cid, _ := Predefined("GB-EUC-H").CID(0x41); cid != 34 {
+		t.Errorf("embedded GB-EUC-H cid %d after SetDir(\"\")", cid)
+	}
+}
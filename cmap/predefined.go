@@ -0,0 +1,159 @@
+package cmap
+
+import (
+	_ "embed"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 内嵌的 CMap 数据:
+// Adobe-GB1-UCS2 为 Adobe-GB1 中 CID 1 到 7540 (ASCII 和 GB 2312 的全部字符) 对应的 Unicode，
+// GB-EUC-H 为 GB 2312 的 EUC 编码到 CID 的对应关系，
+// GBK-EUC-UCS2 为 GBK 的全部编码 (包括 0x80 的欧元符号) 对应的 Unicode。
+// 其他 CMap 由它们推导: UniGB-UCS2-H 是 Adobe-GB1-UCS2 的反向对应。
+// 内嵌的数据不包含 Adobe-GB1-1 以后增加的 CID，需要完整的数据时用 SetDir 指定 Adobe 的 CMap 文件所在的目录
+
+//go:embed data/Adobe-GB1-UCS2
+var adobeGB1UCS2 []byte
+
+//go:embed data/GB-EUC-H
+var gbEUCH []byte
+
+//go:embed data/GBK-EUC-UCS2
+var gbkEUCUCS2 []byte
+
+var (
+	predefinedLock sync.Mutex
+	predefined     = make(map[string]*CMap)
+	predefinedDir  string
+)
+
+// SetDir 设置 CMap 文件所在的目录，如 Adobe 的 cmap-resources 中 Adobe-GB1-5/CMap。
+// 之后 Predefined 先读取目录中和名字同名的文件，没有时再使用内嵌的数据
+func SetDir(dir string) {
+	predefinedLock.Lock()
+	defer predefinedLock.Unlock()
+	predefinedDir = dir
+	predefined = make(map[string]*CMap)
+}
+
+// Predefined 返回预定义的 CMap，名字前面可以带 /。不认识的名字返回 nil。
+// 内嵌的数据支持 Identity-H/V、UniGB-UCS2-H/V、UniGB-UTF16-H/V、GB-EUC-H/V、GBpc-EUC-H/V、
+// GBK-EUC-H/V，以及 CID 到 Unicode 的 Adobe-GB1-UCS2。
+// GBK-EUC 的全部编码都有对应的文字，但它和 UniGB 都只有 GB 2312 中的字符有 CID，
+// 其他字符的 CID 返回 false，需要时用 SetDir 读取完整的 CMap 文件
+func Predefined(name string) *CMap {
+	predefinedLock.Lock()
+	defer predefinedLock.Unlock()
+	return loadPredefined(name)
+}
+
+// loadPredefined 需要持有 predefinedLock
+func loadPredefined(name string) *CMap {
+	name = strings.TrimPrefix(name, "/")
+	if c, ok := predefined[name]; ok {
+		return c
+	}
+	// 先占位，避免 usecmap 循环引用
+	predefined[name] = nil
+	c := loadFile(name)
+	if c == nil {
+		c = loadEmbedded(name)
+	}
+	if c == nil {
+		delete(predefined, name)
+		return nil
+	}
+	c.Name = name
+	predefined[name] = c
+	return c
+}
+
+// loadFile 读取 SetDir 指定的目录中的 CMap 文件
+func loadFile(name string) *CMap {
+	if predefinedDir == "" || name != filepath.Base(name) {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(predefinedDir, name))
+	if err != nil {
+		return nil
+	}
+	c, err := parse(data, loadPredefined)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+func loadEmbedded(name string) *CMap {
+	var c *CMap
+	switch name {
+	case "Identity-H", "Identity-V":
+		c = newCMap()
+		c.identity = true
+		c.codespaces = []codespace{{low: []byte{0, 0}, high: []byte{0xff, 0xff}}}
+	case "Adobe-GB1-UCS2":
+		c, _ = parse(adobeGB1UCS2, loadPredefined)
+	case "UniGB-UCS2-H", "UniGB-UCS2-V", "UniGB-UTF16-H", "UniGB-UTF16-V":
+		c = reverse(loadPredefined("Adobe-GB1-UCS2"))
+		c.utf16 = true
+		c.codespaces = []codespace{{low: []byte{0, 0}, high: []byte{0xff, 0xff}}}
+		if strings.HasPrefix(name, "UniGB-UTF16") {
+			// 代理对为 4 字节的编码
+			c.codespaces = []codespace{
+				{low: []byte{0, 0}, high: []byte{0xd7, 0xff}},
+				{low: []byte{0xd8, 0, 0xdc, 0}, high: []byte{0xdb, 0xff, 0xdf, 0xff}},
+				{low: []byte{0xe0, 0}, high: []byte{0xff, 0xff}},
+			}
+		}
+	case "GB-EUC-H", "GB-EUC-V":
+		c, _ = parse(gbEUCH, loadPredefined)
+	case "GBpc-EUC-H", "GBpc-EUC-V":
+		// Mac OS 的简体中文编码，双字节和 GB-EUC-H 相同，单字节另外有 0x80 和 0xFD 到 0xFF
+		c = newCMap()
+		c.parent = loadPredefined("GB-EUC-H")
+		c.codespaces = []codespace{
+			{low: []byte{0}, high: []byte{0x80}},
+			{low: []byte{0xa1, 0xa1}, high: []byte{0xfc, 0xfe}},
+			{low: []byte{0xfd}, high: []byte{0xff}},
+		}
+		c.chars[0x80] = "ü"
+		c.chars[0xfd] = "©"
+		c.chars[0xfe] = "™"
+		c.chars[0xff] = "…"
+	case "GBK-EUC-H", "GBK-EUC-V":
+		// 文字使用 GBK 的对应表，CID 只有 GB 2312 中的字符
+		c, _ = parse(gbkEUCUCS2, loadPredefined)
+		c.parent = loadPredefined("GB-EUC-H")
+	}
+	return c
+}
+
+// reverse 把 CID 到 Unicode 的对应关系反过来，得到 Unicode 到 CID 的 CMap。
+// 一个字符对应多个 CID 时取最小的
+func reverse(src *CMap) *CMap {
+	c := newCMap()
+	set := func(text string, cid int) {
+		units := []rune(text)
+		if len(units) != 1 || units[0] > 0xffff {
+			return
+		}
+		code := int(units[0])
+		if old, ok := c.cids[code]; !ok || cid < old {
+			c.cids[code] = cid
+		}
+	}
+	for cid, text := range src.chars {
+		set(text, cid)
+	}
+	for _, r := range src.ranges {
+		for cid := r.low; cid <= r.high; cid++ {
+			if text, ok := src.Unicode(cid); ok {
+				set(text, cid)
+			}
+		}
+	}
+	return c
+}
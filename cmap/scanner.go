@@ -0,0 +1,177 @@
+package cmap
+
+import (
+	"errors"
+	"strconv"
+)
+
+// scanner CMap 是 PostScript 语法，只需要识别其中的几种 token。
+// 十六进制和小括号字符串为 []byte，数字为 int，名字为带 / 的 string，数组为 []interface{}
+type scanner struct {
+	data []byte
+	pos  int
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\f' || b == 0
+}
+
+func isDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// next 读取下一个值或者关键字，都为空时表示结束
+func (s *scanner) next() (interface{}, string, error) {
+	for s.pos < len(s.data) {
+		b := s.data[s.pos]
+		if isSpace(b) {
+			s.pos++
+			continue
+		}
+		if b == '%' {
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' && s.data[s.pos] != '\r' {
+				s.pos++
+			}
+			continue
+		}
+		break
+	}
+	if s.pos >= len(s.data) {
+		return nil, "", nil
+	}
+	start := s.pos
+	switch b := s.data[s.pos]; b {
+	case '<':
+		if s.pos+1 < len(s.data) && s.data[s.pos+1] == '<' {
+			s.pos += 2
+			return nil, "<<", nil
+		}
+		return s.readHex()
+	case '>':
+		if s.pos+1 < len(s.data) && s.data[s.pos+1] == '>' {
+			s.pos += 2
+			return nil, ">>", nil
+		}
+		return nil, "", errors.New("unexpected >")
+	case '(':
+		return s.readString()
+	case '[':
+		s.pos++
+		list := make([]interface{}, 0)
+		for {
+			v, keyword, err := s.next()
+			if err != nil {
+				return nil, "", err
+			}
+			if keyword == "]" {
+				return list, "", nil
+			}
+			if v == nil && keyword == "" {
+				return nil, "", errors.New("expect ]")
+			}
+			if v != nil {
+				list = append(list, v)
+			}
+		}
+	case ']', '{', '}':
+		s.pos++
+		return nil, string(b), nil
+	case '/':
+		s.pos++
+	}
+	for s.pos < len(s.data) && !isSpace(s.data[s.pos]) && !isDelimiter(s.data[s.pos]) {
+		s.pos++
+	}
+	word := string(s.data[start:s.pos])
+	if word[0] == '/' {
+		return word, "", nil
+	}
+	if v, err := strconv.Atoi(word); err == nil {
+		return v, "", nil
+	}
+	return nil, word, nil
+}
+
+// readHex 读取 <...> 字符串，奇数个数字时最后补 0
+func (s *scanner) readHex() (interface{}, string, error) {
+	s.pos++
+	buf := make([]byte, 0, 4)
+	digits := 0
+	var v byte
+	for s.pos < len(s.data) {
+		b := s.data[s.pos]
+		s.pos++
+		var d byte
+		switch {
+		case b == '>':
+			if digits%2 == 1 {
+				buf = append(buf, v<<4)
+			}
+			return buf, "", nil
+		case b >= '0' && b <= '9':
+			d = b - '0'
+		case b >= 'a' && b <= 'f':
+			d = b - 'a' + 10
+		case b >= 'A' && b <= 'F':
+			d = b - 'A' + 10
+		default:
+			continue
+		}
+		if digits%2 == 0 {
+			v = d
+		} else {
+			buf = append(buf, v<<4|d)
+		}
+		digits++
+	}
+	return nil, "", errors.New("expect >")
+}
+
+// readString 读取 (...) 字符串，处理嵌套的括号和常用的转义
+func (s *scanner) readString() (interface{}, string, error) {
+	s.pos++
+	buf := make([]byte, 0)
+	depth := 1
+	for s.pos < len(s.data) {
+		b := s.data[s.pos]
+		s.pos++
+		switch b {
+		case '\\':
+			if s.pos >= len(s.data) {
+				continue
+			}
+			b = s.data[s.pos]
+			s.pos++
+			switch b {
+			case 'n':
+				b = '\n'
+			case 'r':
+				b = '\r'
+			case 't':
+				b = '\t'
+			default:
+				if b >= '0' && b <= '7' {
+					v := int(b - '0')
+					for j := 0; j < 2 && s.pos < len(s.data) && s.data[s.pos] >= '0' && s.data[s.pos] <= '7'; j++ {
+						v = v*8 + int(s.data[s.pos]-'0')
+						s.pos++
+					}
+					b = byte(v)
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return buf, "", nil
+			}
+		}
+		buf = append(buf, b)
+	}
+	return nil, "", errors.New("expect )")
+}
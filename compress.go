@@ -0,0 +1,506 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"log"
+	"runtime"
+)
+
+// CMYKMode CMYK 图像压缩时的处理方式
+type CMYKMode int
+
+const (
+	// CMYKToRGB 用简单的公式转换为 RGB，颜色会有偏差
+	CMYKToRGB CMYKMode = iota
+	// CMYKToRGBICC 使用 /ICCBased 颜色空间中嵌入的 profile 转换为 RGB，
+	// 没有 profile 或者 profile 不支持时退回到简单公式
+	CMYKToRGBICC
+	// CMYKKeep 保持 CMYK，适合需要印刷的文件
+	CMYKKeep
+)
+
+// CompressOptions 图像压缩的选项
+type CompressOptions struct {
+	Quality   int      // JPEG 质量 1-100，默认为 5
+	CMYK      CMYKMode // CMYK 图像的处理方式
+	MaxWidth  int      // JPEG 图像的最大宽度，超过时按比例缩小，0 表示不限制
+	MaxHeight int      // JPEG 图像的最大高度
+	// TranscodeJPX 把 JPEG 2000 图像解码后转为 JPEG，兼容不支持 JPX 的阅读器，
+	// 即使结果更大也会替换
+	TranscodeJPX bool
+	Workers      int // 并发压缩的 goroutine 数量，默认为 CPU 的个数
+	// 默认 DCT 图像不重新编码，只去掉 EXIF、缩略图、XMP 等标记段并优化 Huffman 表，
+	// 解码出的图像和原来完全一样。Lossy 为 true 时才按 Quality、MaxWidth、MaxHeight
+	// 和 CMYK 重新编码，画质会下降
+	Lossy       bool
+	Progressive bool // 不重新编码时输出渐进式 JPEG，通常更小
+	StripICC    bool // 不重新编码时同时去掉 JPEG 中的 ICC profile，PDF 按 /ColorSpace 显示，不使用它
+	// ReduceColor 检测接近灰度或者黑白的图像 (例如白纸黑字的彩色扫描件):
+	// 接近黑白的二值化后用 CCITT G4 或者 Flate 保存，接近灰度的转为 DeviceGray。
+	// 会改变图像，只在 Lossy 时起作用
+	ReduceColor bool
+}
+
+func (opts *CompressOptions) workers() int {
+	if opts == nil || opts.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return opts.Workers
+}
+
+// lossy 是否允许重新编码 DCT 图像
+func (opts *CompressOptions) lossy() bool {
+	return opts != nil && opts.Lossy
+}
+
+func (opts *CompressOptions) quality() int {
+	if opts == nil || opts.Quality <= 0 {
+		return 5
+	}
+	if opts.Quality > 100 {
+		return 100
+	}
+	return opts.Quality
+}
+
+func (opts *CompressOptions) cmykMode() CMYKMode {
+	if opts == nil {
+		return CMYKToRGB
+	}
+	return opts.CMYK
+}
+
+// targetSize 按 MaxWidth 和 MaxHeight 计算缩小后的尺寸，保持宽高比
+func (opts *CompressOptions) targetSize(width, height int) (int, int) {
+	if opts == nil || width <= 0 || height <= 0 {
+		return width, height
+	}
+	scale := 1.0
+	if opts.MaxWidth > 0 && width > opts.MaxWidth {
+		scale = float64(opts.MaxWidth) / float64(width)
+	}
+	if opts.MaxHeight > 0 && height > opts.MaxHeight {
+		if s := float64(opts.MaxHeight) / float64(height); s < scale {
+			scale = s
+		}
+	}
+	if scale == 1 {
+		return width, height
+	}
+	w, h := int(float64(width)*scale+0.5), int(float64(height)*scale+0.5)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// Compress 压缩文档中的图像对象，opts 为 nil 时使用默认选项。
+// 压缩后调用 SaveFile(file, false) 保存
+func (p *PDF) Compress(opts *CompressOptions) error {
+	return p.CompressContext(context.Background(), opts)
+}
+
+// CompressContext 和 Compress 相同，ctx 取消时不再开始新的图像，
+// 等正在处理的图像完成后返回 ctx.Err()，已经压缩的图像保留
+func (p *PDF) CompressContext(ctx context.Context, opts *CompressOptions) error {
+	_, err := p.compressImageObj(ctx, opts)
+	return err
+}
+
+// CompressWithReport 和 CompressContext 相同，同时返回每个图像的处理结果。
+// ctx 取消时报告中只有已经处理的图像
+func (p *PDF) CompressWithReport(ctx context.Context, opts *CompressOptions) (*CompressReport, error) {
+	return p.compressImageObj(ctx, opts)
+}
+
+// compressDCTObj 重新编码 JPEG 图像，结果更小时才替换。
+// CMYK 和 YCCK 的图像先按 PDF 的语义还原出实际的油墨值 (考虑 Adobe 反转和 /Decode)，
+// 再按 opts 转换为 RGB 或者保持 CMYK
+func (p *PDF) compressDCTObj(obj *Obj, opts *CompressOptions) SkipReason {
+	if p.hasColorKeyMask(obj) {
+		return SkipMask
+	}
+	buf, filter, err := p.decodeStream(obj)
+	if err != nil || filter != "/DCTDecode" {
+		return SkipDecodeError
+	}
+	img, err := decodeDCT(buf)
+	if err != nil {
+		log.Default().Printf("decode jpeg obj %d %d err: %v", obj.ID, obj.GenID, err)
+		return SkipDecodeError
+	}
+	inverted := p.isDecodeInverted(obj)
+	if inverted {
+		img = invertImage(img)
+	}
+	b := img.Bounds()
+	width, height := opts.targetSize(b.Dx(), b.Dy())
+	resized := width != b.Dx() || height != b.Dy()
+	if resized {
+		img = resizeImage(img, width, height)
+	}
+	out := bytes.Buffer{}
+	cmyk, isCMYK := img.(*image.CMYK)
+	keepCMYK := isCMYK && opts.cmykMode() == CMYKKeep
+	switch {
+	case keepCMYK:
+		err = encodeCMYKJPEG(&out, cmyk, opts.quality())
+	case isCMYK:
+		img = p.convertCMYK(obj, cmyk, opts.cmykMode())
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: opts.quality()})
+	default:
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: opts.quality()})
+	}
+	if err != nil {
+		log.Default().Printf("encode jpeg obj %d %d err: %v", obj.ID, obj.GenID, err)
+		return SkipEncodeError
+	}
+	old := len(obj.Stream.data())
+	log.Default().Printf("compress jpeg %d ---> %d", old, out.Len())
+	if out.Len() >= old {
+		return SkipLarger
+	}
+	p.updateStream(obj, out.Bytes())
+	p.setDictValue(obj, "/Filter", &NameObj{Name: "/DCTDecode"})
+	p.deleteDictValue(obj, "/DecodeParms")
+	if resized {
+		p.setDictValue(obj, "/Width", width)
+		p.setDictValue(obj, "/Height", height)
+	}
+	switch {
+	case keepCMYK:
+		// 按 Adobe 的习惯保存的是反转的值
+		p.setDictValue(obj, "/Decode", []interface{}{1, 0, 1, 0, 1, 0, 1, 0})
+	case isCMYK:
+		p.setDictValue(obj, "/ColorSpace", &NameObj{Name: "/DeviceRGB"})
+		p.deleteDictValue(obj, "/Decode")
+	default:
+		// 解码时已经处理了反转
+		p.deleteDictValue(obj, "/Decode")
+	}
+	return ""
+}
+
+// optimizeDCTObj 无损优化 DCT 图像，只有变小时才替换
+func (p *PDF) optimizeDCTObj(obj *Obj, opts *CompressOptions) SkipReason {
+	buf, filter, err := p.decodeStream(obj)
+	if err != nil || filter != "/DCTDecode" {
+		return SkipDecodeError
+	}
+	if opts == nil {
+		opts = &CompressOptions{}
+	}
+	out, err := OptimizeJPEG(buf, opts.Progressive, !opts.StripICC)
+	if err != nil {
+		log.Default().Printf("optimize jpeg obj %d %d err: %v", obj.ID, obj.GenID, err)
+		return SkipUnsupported
+	}
+	old := len(obj.Stream.data())
+	log.Default().Printf("optimize jpeg %d ---> %d", old, len(out))
+	if len(out) >= old {
+		return SkipLarger
+	}
+	// 只保留 DCTDecode 以及它的 /DecodeParms (可能有 /ColorTransform)
+	var dctParms []*Pair
+	names, parms := p.getFilters(obj)
+	for i, name := range names {
+		if name == "/DCTDecode" {
+			dctParms = parms[i]
+		}
+	}
+	p.updateStream(obj, out)
+	p.setDictValue(obj, "/Filter", &NameObj{Name: "/DCTDecode"})
+	if dctParms != nil {
+		p.setDictValue(obj, "/DecodeParms", dctParms)
+	} else {
+		p.deleteDictValue(obj, "/DecodeParms")
+	}
+	return ""
+}
+
+// compressJPXObj 把 JPX 图像转为 JPEG
+func (p *PDF) compressJPXObj(obj *Obj, opts *CompressOptions) SkipReason {
+	if p.getIntByKey(obj.Dict, "/SMaskInData") != 0 {
+		// 透明通道在码流中，转换后会丢失
+		log.Default().Printf("skip jpx obj %d %d with SMaskInData", obj.ID, obj.GenID)
+		return SkipMask
+	}
+	if p.hasColorKeyMask(obj) {
+		return SkipMask
+	}
+	img, err := p.decodeImageColor(obj)
+	if err != nil {
+		log.Default().Printf("decode jpx obj %d %d err: %v", obj.ID, obj.GenID, err)
+		return SkipDecodeError
+	}
+	b := img.Bounds()
+	width, height := opts.targetSize(b.Dx(), b.Dy())
+	if width != b.Dx() || height != b.Dy() {
+		img = resizeImage(img, width, height)
+	}
+	out := bytes.Buffer{}
+	colorSpace := "/DeviceRGB"
+	cmyk, isCMYK := img.(*image.CMYK)
+	keepCMYK := isCMYK && opts.cmykMode() == CMYKKeep
+	switch {
+	case keepCMYK:
+		colorSpace = "/DeviceCMYK"
+		err = encodeCMYKJPEG(&out, cmyk, opts.quality())
+	case isCMYK:
+		img = p.convertCMYK(obj, cmyk, opts.cmykMode())
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: opts.quality()})
+	default:
+		if _, ok := img.(*image.Gray); ok {
+			colorSpace = "/DeviceGray"
+		}
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: opts.quality()})
+	}
+	if err != nil {
+		log.Default().Printf("encode jpeg obj %d %d err: %v", obj.ID, obj.GenID, err)
+		return SkipEncodeError
+	}
+	log.Default().Printf("transcode jpx %d ---> %d", len(obj.Stream.data()), out.Len())
+	p.updateStream(obj, out.Bytes())
+	p.setDictValue(obj, "/Filter", &NameObj{Name: "/DCTDecode"})
+	p.deleteDictValue(obj, "/DecodeParms")
+	p.setDictValue(obj, "/Width", width)
+	p.setDictValue(obj, "/Height", height)
+	p.setDictValue(obj, "/BitsPerComponent", 8)
+	p.deleteDictValue(obj, "/SMaskInData")
+	if keepCMYK {
+		p.setDictValue(obj, "/Decode", []interface{}{1, 0, 1, 0, 1, 0, 1, 0})
+	} else {
+		p.deleteDictValue(obj, "/Decode")
+	}
+	if !p.isDeviceColorSpace(obj, colorSpace) {
+		p.setDictValue(obj, "/ColorSpace", &NameObj{Name: colorSpace})
+	}
+	return ""
+}
+
+// isDeviceColorSpace 判断图像的颜色空间解析后是否为 name
+func (p *PDF) isDeviceColorSpace(obj *Obj, name string) bool {
+	cs, err := p.getColorSpace(p.getValueByKey(obj.Dict, "/ColorSpace"))
+	return err == nil && cs.Name == name
+}
+
+// convertCMYK 把 CMYK 图像转换为 RGB
+func (p *PDF) convertCMYK(obj *Obj, img *image.CMYK, mode CMYKMode) image.Image {
+	if mode == CMYKToRGBICC {
+		if profile := p.getICCProfile(obj); profile != nil {
+			t, err := parseICCProfile(profile)
+			if err == nil {
+				return t.convertCMYK(img)
+			}
+			log.Default().Printf("parse icc profile of obj %d %d err: %v", obj.ID, obj.GenID, err)
+		}
+	}
+	return cmykToRGB(img)
+}
+
+// imageMasks 返回被其他图像的 /SMask 或 /Mask 引用的蒙版对象
+func (p *PDF) imageMasks() map[*Obj]bool {
+	masks := make(map[*Obj]bool)
+	for _, obj := range p.Objects {
+		if obj.IsImageStream() {
+			for _, mask := range p.getMasks(obj) {
+				masks[mask] = true
+			}
+		}
+	}
+	return masks
+}
+
+// getMasks 返回图像的 /SMask 以及流形式的 /Mask (stencil mask)，
+// 数组形式的 /Mask 是颜色键，不需要处理
+func (p *PDF) getMasks(obj *Obj) []*Obj {
+	list := make([]*Obj, 0)
+	for _, key := range []string{"/SMask", "/Mask"} {
+		mask, _ := p.resolve(p.getValueByKey(obj.Dict, key)).(*Obj)
+		if mask != nil && mask != obj && mask.IsImageStream() {
+			list = append(list, mask)
+		}
+	}
+	return list
+}
+
+// hasColorKeyMask 图像是否有数组形式的 /Mask (颜色键)。颜色键按原来的采样值精确匹配，
+// 有损的重新编码或者改变颜色空间后就对应不上了
+func (p *PDF) hasColorKeyMask(obj *Obj) bool {
+	_, ok := p.resolve(p.getValueByKey(obj.Dict, "/Mask")).([]interface{})
+	return ok
+}
+
+// compressMaskObj 无损压缩蒙版: stencil mask 保持 1 bit 用 CCITT G4 编码，/SMask 用 Flate 编码。
+// 所属的图像从 baseWidth x baseHeight 缩小到 newWidth x newHeight 时，蒙版按相同的比例缩小，
+// 这时即使结果更大也要替换，保证和图像一致
+func (p *PDF) compressMaskObj(mask *Obj, baseWidth, baseHeight, newWidth, newHeight int) SkipReason {
+	img, err := p.decodeImageColor(mask)
+	if err != nil {
+		log.Default().Printf("decode mask obj %d %d err: %v", mask.ID, mask.GenID, err)
+		return SkipDecodeError
+	}
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if baseWidth > 0 && baseHeight > 0 && (newWidth != baseWidth || newHeight != baseHeight) {
+		width = b.Dx() * newWidth / baseWidth
+		height = b.Dy() * newHeight / baseHeight
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+	}
+	resized := width != b.Dx() || height != b.Dy()
+	old := len(mask.Stream.data())
+	if p.getBoolByKey(mask.Dict, "/ImageMask") {
+		// 解码结果中绘制的地方不透明，转回采样值 0 (绘制) 和 1
+		gray := image.NewGray(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				_, _, _, a := img.At(x, y).RGBA()
+				if a < 0x8000 {
+					gray.SetGray(x, y, color.Gray{Y: 255})
+				}
+			}
+		}
+		if resized {
+			gray = thresholdGray(resizeImage(gray, width, height).(*image.Gray))
+		}
+		data := EncodeCCITTG4(gray)
+		log.Default().Printf("compress image mask %d ---> %d", old, len(data))
+		if len(data) >= old && !resized {
+			return SkipLarger
+		}
+		p.updateStream(mask, data)
+		p.setDictValue(mask, "/Filter", &NameObj{Name: "/CCITTFaxDecode"})
+		p.setCCITTParams(mask, gray)
+		p.setDictValue(mask, "/Width", width)
+		p.setDictValue(mask, "/Height", height)
+		p.setDictValue(mask, "/BitsPerComponent", 1)
+		p.deleteDictValue(mask, "/Decode")
+		return ""
+	}
+
+	gray := toGray(img)
+	if resized {
+		gray = resizeImage(gray, width, height).(*image.Gray)
+	}
+	pix := make([]byte, 0, width*height)
+	for y := 0; y < height; y++ {
+		pix = append(pix, gray.Pix[y*gray.Stride:y*gray.Stride+width]...)
+	}
+	data := flateEncode(pix)
+	var parms []*Pair
+	if predicted := flateEncode(pngUpEncode(pix, width)); len(predicted) < len(data) {
+		data = predicted
+		parms = []*Pair{
+			{Key: &NameObj{Name: "/Predictor"}, Value: 12},
+			{Key: &NameObj{Name: "/Columns"}, Value: width},
+		}
+	}
+	log.Default().Printf("compress soft mask %d ---> %d", old, len(data))
+	if len(data) >= old && !resized {
+		return SkipLarger
+	}
+	p.updateStream(mask, data)
+	p.setDictValue(mask, "/Filter", &NameObj{Name: "/FlateDecode"})
+	if parms != nil {
+		p.setDictValue(mask, "/DecodeParms", parms)
+	} else {
+		p.deleteDictValue(mask, "/DecodeParms")
+	}
+	p.setDictValue(mask, "/Width", width)
+	p.setDictValue(mask, "/Height", height)
+	p.setDictValue(mask, "/BitsPerComponent", 8)
+	p.setDictValue(mask, "/ColorSpace", &NameObj{Name: "/DeviceGray"})
+	p.deleteDictValue(mask, "/Decode")
+	return ""
+}
+
+// toGray 转换为灰度图
+func toGray(img image.Image) *image.Gray {
+	if gray, ok := img.(*image.Gray); ok {
+		return gray
+	}
+	b := img.Bounds()
+	gray := image.NewGray(b)
+	draw.Draw(gray, b, img, b.Min, draw.Src)
+	return gray
+}
+
+// thresholdGray 二值化，缩小后的灰度按 128 分为黑白
+func thresholdGray(img *image.Gray) *image.Gray {
+	for i, v := range img.Pix {
+		if v < 128 {
+			img.Pix[i] = 0
+		} else {
+			img.Pix[i] = 255
+		}
+	}
+	return img
+}
+
+// resizeImage 按区域平均缩小图像，灰度和 CMYK 保持原来的类型，其他的转换为 RGBA
+func resizeImage(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	rect := image.Rect(0, 0, width, height)
+	switch src := img.(type) {
+	case *image.Gray:
+		dst := image.NewGray(rect)
+		boxResize(src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, 1, b.Dx(), b.Dy(), dst.Pix, dst.Stride, width, height)
+		return dst
+	case *image.CMYK:
+		dst := image.NewCMYK(rect)
+		boxResize(src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, 4, b.Dx(), b.Dy(), dst.Pix, dst.Stride, width, height)
+		return dst
+	}
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dst := image.NewRGBA(rect)
+	boxResize(src.Pix, src.Stride, 4, b.Dx(), b.Dy(), dst.Pix, dst.Stride, width, height)
+	return dst
+}
+
+// boxResize 目标的每个像素取源图像对应区域的平均值，n 为每个像素的字节数
+func boxResize(src []byte, srcStride, n, srcWidth, srcHeight int, dst []byte, dstStride, width, height int) {
+	sum := make([]int, n)
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := (y + 1) * srcHeight / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := (x + 1) * srcWidth / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			for c := range sum {
+				sum[c] = 0
+			}
+			for sy := y0; sy < y1; sy++ {
+				row := src[sy*srcStride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < n; c++ {
+						sum[c] += int(row[sx*n+c])
+					}
+				}
+			}
+			count := (y1 - y0) * (x1 - x0)
+			for c := 0; c < n; c++ {
+				dst[y*dstStride+x*n+c] = uint8((sum[c] + count/2) / count)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// 内容流的操作符模型: 解码后的内容流解析为操作符序列，修改后可以再写回去。
+// 操作数的表示和对象解析保持一致，见 lexer
+
+// Operator 内容流中的一个操作符和它前面的操作数，如 q、cm、BT、Tf、Tj、TJ、Do、re、f。
+// 内嵌图像的操作符为 BI，没有操作数，图像的字典和数据在 Image 中
+type Operator struct {
+	Name     string
+	Operands []interface{}
+	Image    *InlineImage
+}
+
+// String 按内容流的语法输出操作符，如 1 0 0 1 72 720 cm
+func (op *Operator) String() string {
+	var w bytes.Buffer
+	op.write(&w)
+	return w.String()
+}
+
+func (op *Operator) write(w *bytes.Buffer) {
+	if op.Name == "BI" && op.Image != nil {
+		w.WriteString("BI")
+		for _, pair := range op.Image.Dict {
+			w.WriteByte(' ')
+			w.WriteString(pair.Key.Name)
+			w.WriteByte(' ')
+			writeContentValue(w, pair.Value)
+		}
+		w.WriteString(" ID ")
+		w.Write(op.Image.Data)
+		w.WriteString("\nEI")
+		return
+	}
+	for _, v := range op.Operands {
+		writeContentValue(w, v)
+		w.WriteByte(' ')
+	}
+	w.WriteString(op.Name)
+}
+
+// writeContentValue 输出操作数，数组和字典写在一行中
+func writeContentValue(w *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case *NameObj:
+		w.WriteString(v.Name)
+	case string:
+		w.WriteString(v)
+	case int:
+		w.WriteString(strconv.Itoa(v))
+	case float64:
+		w.WriteString(formatFloat(v))
+	case bool:
+		w.WriteString(strconv.FormatBool(v))
+	case *Obj:
+		fmt.Fprintf(w, "%d %d R", v.ID, v.GenID)
+	case []interface{}:
+		w.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				w.WriteByte(' ')
+			}
+			writeContentValue(w, item)
+		}
+		w.WriteByte(']')
+	case []*Pair:
+		w.WriteString("<<")
+		for _, pair := range v {
+			w.WriteString(pair.Key.Name)
+			w.WriteByte(' ')
+			writeContentValue(w, pair.Value)
+			w.WriteByte(' ')
+		}
+		w.WriteString(">>")
+	case nil:
+		w.WriteString("null")
+	default:
+		w.WriteString(fmt.Sprint(v))
+	}
+}
+
+// ParseContent 把解码后的内容流解析为操作符序列
+func ParseContent(data []byte) ([]*Operator, error) {
+	ops := make([]*Operator, 0)
+	c := newContentParser(data)
+	for {
+		op, err := c.next()
+		if err != nil {
+			return ops, err
+		}
+		if op == nil {
+			return ops, nil
+		}
+		ops = append(ops, op)
+	}
+}
+
+// WriteContent 把操作符序列写为内容流，每个操作符一行
+func WriteContent(ops []*Operator) []byte {
+	var w bytes.Buffer
+	for _, op := range ops {
+		op.write(&w)
+		w.WriteByte('\n')
+	}
+	return w.Bytes()
+}
+
+// contentParser 逐个读取内容流中的操作符
+type contentParser struct {
+	l *lexer
+}
+
+func newContentParser(data []byte) *contentParser {
+	return &contentParser{l: newLexer(data)}
+}
+
+// next 读取下一个操作符，内容流结束时返回 nil。结尾处多余的操作数丢弃
+func (c *contentParser) next() (*Operator, error) {
+	args := make([]interface{}, 0)
+	for {
+		tok, err := c.l.next()
+		if err != nil {
+			return nil, err
+		}
+		switch tok.typ {
+		case tokenEOF:
+			return nil, nil
+		case tokenKeyword:
+			op := &Operator{Name: tok.value.(string), Operands: args}
+			if op.Name == "BI" {
+				img, err := c.l.readInlineImage(tok.start)
+				if err != nil {
+					return nil, err
+				}
+				op.Image, op.Operands = img, nil
+			}
+			return op, nil
+		default:
+			v, err := c.l.readObjectFrom(tok)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+		}
+	}
+}
+
+// Content 解析页面的内容，多个内容流连接起来作为一个
+func (pg *Page) Content() ([]*Operator, error) {
+	return ParseContent(pg.pdf.pageContentData(pg.obj))
+}
+
+// SetContent 用 ops 替换页面的内容，写为一个新的内容流。
+// 原来的内容流可能被其他页面共用，不修改
+func (pg *Page) SetContent(ops []*Operator) {
+	p := pg.pdf
+	obj := p.newStreamObj(nil, nil)
+	p.setContentData(obj, WriteContent(ops))
+	p.setDictValue(pg.obj, "/Contents", objRef(obj))
+}
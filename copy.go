@@ -0,0 +1,215 @@
+package pdf
+
+import "sort"
+
+// objCopier 把对象从 src 复制到 dst，按引用递归复制，并分配新的对象序号
+type objCopier struct {
+	src    *PDF
+	dst    *PDF
+	ids    map[*Obj]*Obj // 源对象 -> 复制后的对象
+	skip   map[*Obj]bool // 不复制的对象，引用它们的地方改为 null
+	nextID int
+}
+
+func newObjCopier(src, dst *PDF) *objCopier {
+	c := &objCopier{src: src, dst: dst, ids: make(map[*Obj]*Obj), skip: make(map[*Obj]bool), nextID: 1}
+	for _, obj := range dst.Objects {
+		if obj.ID >= c.nextID {
+			c.nextID = obj.ID + 1
+		}
+	}
+	return c
+}
+
+// newObj 在 dst 中创建新对象，xref 在 finishDocument 中重建
+func (c *objCopier) newObj() *Obj {
+	obj := &Obj{ID: c.nextID}
+	c.nextID++
+	c.dst.Objects = append(c.dst.Objects, obj)
+	return obj
+}
+
+// objRef 返回对象的引用
+func objRef(obj *Obj) *Obj {
+	return &Obj{ID: obj.ID, GenID: obj.GenID}
+}
+
+// copyObj 复制 src 中的对象及它引用的所有对象，返回复制后的对象，被跳过时返回 nil
+func (c *objCopier) copyObj(obj *Obj) *Obj {
+	if obj == nil {
+		return nil
+	}
+	if dup, ok := c.ids[obj]; ok {
+		return dup
+	}
+	if c.skip[obj] {
+		return nil
+	}
+	dup := c.newObj()
+	// 先登记，处理循环引用
+	c.ids[obj] = dup
+	c.fillObj(dup, obj)
+	return dup
+}
+
+// fillObj 把 obj 的内容复制到已经分配了序号的 dup
+func (c *objCopier) fillObj(dup, obj *Obj) {
+	dup.Dict = c.copyDict(obj.Dict)
+	if obj.Stream != nil {
+		dup.Stream = &Stream{body: obj.Stream.body}
+	}
+	if obj.Array != nil {
+		dup.Array = c.copyArray(obj.Array)
+	}
+	dup.Int = obj.Int
+	dup.typ = obj.typ
+	dup.value = obj.value
+}
+
+func (c *objCopier) copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *Obj:
+		dup := c.copyObj(c.src.getObj(v))
+		if dup == nil {
+			return nil
+		}
+		return objRef(dup)
+	case []*Pair:
+		return c.copyDict(v)
+	case []interface{}:
+		return c.copyArray(v)
+	case *NameObj:
+		return &NameObj{Name: v.Name}
+	}
+	return value
+}
+
+func (c *objCopier) copyDict(dict []*Pair) []*Pair {
+	if dict == nil {
+		return nil
+	}
+	list := make([]*Pair, 0, len(dict))
+	for _, pair := range dict {
+		list = append(list, &Pair{Key: &NameObj{Name: pair.Key.Name}, Value: c.copyValue(pair.Value)})
+	}
+	return list
+}
+
+func (c *objCopier) copyArray(array []interface{}) []interface{} {
+	list := make([]interface{}, 0, len(array))
+	for _, item := range array {
+		list = append(list, c.copyValue(item))
+	}
+	return list
+}
+
+// inheritedKeys 页面中可以从页面树节点继承的属性
+var inheritedKeys = []string{"/Resources", "/MediaBox", "/CropBox", "/Rotate"}
+
+// reserve 预先给对象分配序号，复制其他对象时指向它的引用会使用新的序号
+func (c *objCopier) reserve(obj *Obj) *Obj {
+	dup := c.ids[obj]
+	if dup == nil {
+		dup = c.newObj()
+		c.ids[obj] = dup
+	}
+	return dup
+}
+
+// copyPage 复制页面对象，/Parent 指向 parent，继承的属性直接写到页面中
+func (c *objCopier) copyPage(page, parent *Obj) *Obj {
+	dup := c.reserve(page)
+	dict := make([]*Pair, 0, len(page.Dict)+len(inheritedKeys))
+	for _, pair := range page.Dict {
+		if pair.Key.Name != "/Parent" {
+			dict = append(dict, pair)
+		}
+	}
+	for _, key := range inheritedKeys {
+		if c.src.getValueByKey(page.Dict, key) == nil {
+			if v := c.src.inheritedValue(page, key); v != nil {
+				dict = append(dict, &Pair{Key: &NameObj{Name: key}, Value: v})
+			}
+		}
+	}
+	c.fillObj(dup, &Obj{Dict: dict})
+	setPairValue(&dup.Dict, "/Parent", objRef(parent))
+	return dup
+}
+
+// skipPageTree 跳过 src 的页面树节点和所有页面，复制其他对象时不会把整个文档带进来，
+// 需要的页面再用 copyPage 复制
+func (c *objCopier) skipPageTree() {
+	if c.src.Trailer == nil {
+		return
+	}
+	root, _ := c.src.resolve(c.src.getValueByKey(c.src.Trailer.Dict, "/Root")).(*Obj)
+	if root == nil {
+		return
+	}
+	var walk func(node *Obj)
+	walk = func(node *Obj) {
+		if node == nil || c.skip[node] {
+			return
+		}
+		c.skip[node] = true
+		kids, _ := c.src.resolve(c.src.getValueByKey(node.Dict, "/Kids")).([]interface{})
+		for _, kid := range kids {
+			obj, _ := c.src.resolve(kid).(*Obj)
+			walk(obj)
+		}
+	}
+	pages, _ := c.src.resolve(c.src.getValueByKey(root.Dict, "/Pages")).(*Obj)
+	walk(pages)
+}
+
+// newDocument 创建只有文件头的空文档，对象加入后调用 finishDocument
+func newDocument(header []byte) *PDF {
+	if len(header) == 0 {
+		header = []byte("%PDF-1.7")
+	}
+	return &PDF{Header: append([]byte{}, header...), Objects: make([]*Obj, 0)}
+}
+
+// newPageTree 在 dst 中创建目录和页面树的根节点
+func (c *objCopier) newPageTree() (catalog, pages *Obj) {
+	catalog, pages = c.newObj(), c.newObj()
+	catalog.Dict = []*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/Catalog"}},
+		{Key: &NameObj{Name: "/Pages"}, Value: objRef(pages)},
+	}
+	pages.Dict = []*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/Pages"}},
+		{Key: &NameObj{Name: "/Kids"}, Value: []interface{}{}},
+		{Key: &NameObj{Name: "/Count"}, Value: 0},
+	}
+	return catalog, pages
+}
+
+// appendKid 把页面加到页面树节点的 /Kids 中，并更新 /Count
+func (p *PDF) appendKid(pages, page *Obj) {
+	kids, _ := p.getValueByKey(pages.Dict, "/Kids").([]interface{})
+	setPairValue(&pages.Dict, "/Kids", append(kids, objRef(page)))
+	setPairValue(&pages.Dict, "/Count", len(kids)+1)
+}
+
+// finishDocument 按对象序号排序，重建 xref 和 trailer
+func (p *PDF) finishDocument(catalog *Obj, info interface{}) {
+	sort.SliceStable(p.Objects, func(i, j int) bool {
+		return p.Objects[i].ID < p.Objects[j].ID
+	})
+	p.Xref = []*XrefItem{{ID: 0, GID: 65535, Flag: "f"}}
+	size := 1
+	for _, obj := range p.Objects {
+		p.Xref = append(p.Xref, &XrefItem{ID: obj.ID, GID: obj.GenID, Flag: "n"})
+		size = obj.ID + 1
+	}
+	dict := []*Pair{
+		{Key: &NameObj{Name: "/Size"}, Value: size},
+		{Key: &NameObj{Name: "/Root"}, Value: objRef(catalog)},
+	}
+	if info != nil {
+		dict = append(dict, &Pair{Key: &NameObj{Name: "/Info"}, Value: info})
+	}
+	p.Trailer = &Trailer{Dict: dict}
+}
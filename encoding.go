@@ -0,0 +1,186 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// 简单字体的编码: 字符编码先对应到字形名，再按字形名得到 Unicode。
+// 内置编码参考 PDF 规范附录 D Latin Character Set and Encodings
+
+// asciiGlyphNames 0x20 到 0x7e 的字形名，WinAnsiEncoding 和 MacRomanEncoding 相同
+var asciiGlyphNames = []string{
+	"space", "exclam", "quotedbl", "numbersign", "dollar", "percent", "ampersand", "quotesingle",
+	"parenleft", "parenright", "asterisk", "plus", "comma", "hyphen", "period", "slash",
+	"zero", "one", "two", "three", "four", "five", "six", "seven",
+	"eight", "nine", "colon", "semicolon", "less", "equal", "greater", "question",
+	"at", "A", "B", "C", "D", "E", "F", "G",
+	"H", "I", "J", "K", "L", "M", "N", "O",
+	"P", "Q", "R", "S", "T", "U", "V", "W",
+	"X", "Y", "Z", "bracketleft", "backslash", "bracketright", "asciicircum", "underscore",
+	"grave", "a", "b", "c", "d", "e", "f", "g",
+	"h", "i", "j", "k", "l", "m", "n", "o",
+	"p", "q", "r", "s", "t", "u", "v", "w",
+	"x", "y", "z", "braceleft", "bar", "braceright", "asciitilde",
+}
+
+// latin1GlyphNames 0xa0 到 0xff 的字形名，和 ISO 8859-1 的字符一一对应
+var latin1GlyphNames = []string{
+	"nbspace", "exclamdown", "cent", "sterling", "currency", "yen", "brokenbar", "section",
+	"dieresis", "copyright", "ordfeminine", "guillemotleft", "logicalnot", "sfthyphen", "registered", "macron",
+	"degree", "plusminus", "twosuperior", "threesuperior", "acute", "mu", "paragraph", "periodcentered",
+	"cedilla", "onesuperior", "ordmasculine", "guillemotright", "onequarter", "onehalf", "threequarters", "questiondown",
+	"Agrave", "Aacute", "Acircumflex", "Atilde", "Adieresis", "Aring", "AE", "Ccedilla",
+	"Egrave", "Eacute", "Ecircumflex", "Edieresis", "Igrave", "Iacute", "Icircumflex", "Idieresis",
+	"Eth", "Ntilde", "Ograve", "Oacute", "Ocircumflex", "Otilde", "Odieresis", "multiply",
+	"Oslash", "Ugrave", "Uacute", "Ucircumflex", "Udieresis", "Yacute", "Thorn", "germandbls",
+	"agrave", "aacute", "acircumflex", "atilde", "adieresis", "aring", "ae", "ccedilla",
+	"egrave", "eacute", "ecircumflex", "edieresis", "igrave", "iacute", "icircumflex", "idieresis",
+	"eth", "ntilde", "ograve", "oacute", "ocircumflex", "otilde", "odieresis", "divide",
+	"oslash", "ugrave", "uacute", "ucircumflex", "udieresis", "yacute", "thorn", "ydieresis",
+}
+
+// winAnsiHighNames WinAnsiEncoding 0x80 到 0x9f 的字形名 (Windows 1252)
+var winAnsiHighNames = []string{
+	"Euro", "", "quotesinglbase", "florin", "quotedblbase", "ellipsis", "dagger", "daggerdbl",
+	"circumflex", "perthousand", "Scaron", "guilsinglleft", "OE", "", "Zcaron", "",
+	"", "quoteleft", "quoteright", "quotedblleft", "quotedblright", "bullet", "endash", "emdash",
+	"tilde", "trademark", "scaron", "guilsinglright", "oe", "", "zcaron", "Ydieresis",
+}
+
+// macRomanHighNames MacRomanEncoding 0x80 到 0xff 的字形名
+var macRomanHighNames = []string{
+	"Adieresis", "Aring", "Ccedilla", "Eacute", "Ntilde", "Odieresis", "Udieresis", "aacute",
+	"agrave", "acircumflex", "adieresis", "atilde", "aring", "ccedilla", "eacute", "egrave",
+	"ecircumflex", "edieresis", "iacute", "igrave", "icircumflex", "idieresis", "ntilde", "oacute",
+	"ograve", "ocircumflex", "odieresis", "otilde", "uacute", "ugrave", "ucircumflex", "udieresis",
+	"dagger", "degree", "cent", "sterling", "section", "bullet", "paragraph", "germandbls",
+	"registered", "copyright", "trademark", "acute", "dieresis", "notequal", "AE", "Oslash",
+	"infinity", "plusminus", "lessequal", "greaterequal", "yen", "mu", "partialdiff", "summation",
+	"product", "pi", "integral", "ordfeminine", "ordmasculine", "Omega", "ae", "oslash",
+	"questiondown", "exclamdown", "logicalnot", "radical", "florin", "approxequal", "Delta", "guillemotleft",
+	"guillemotright", "ellipsis", "space", "Agrave", "Atilde", "Otilde", "OE", "oe",
+	"endash", "emdash", "quotedblleft", "quotedblright", "quoteleft", "quoteright", "divide", "lozenge",
+	"ydieresis", "Ydieresis", "fraction", "currency", "guilsinglleft", "guilsinglright", "fi", "fl",
+	"daggerdbl", "periodcentered", "quotesinglbase", "quotedblbase", "perthousand", "Acircumflex", "Ecircumflex", "Aacute",
+	"Edieresis", "Egrave", "Iacute", "Icircumflex", "Idieresis", "Igrave", "Oacute", "Ocircumflex",
+	"", "Ograve", "Uacute", "Ucircumflex", "Ugrave", "dotlessi", "circumflex", "tilde",
+	"macron", "breve", "dotaccent", "ring", "cedilla", "hungarumlaut", "ogonek", "caron",
+}
+
+// standardHighNames StandardEncoding 中 0x80 以上有字形的编码
+var standardHighNames = map[int]string{
+	0xa1: "exclamdown", 0xa2: "cent", 0xa3: "sterling", 0xa4: "fraction", 0xa5: "yen", 0xa6: "florin",
+	0xa7: "section", 0xa8: "currency", 0xa9: "quotesingle", 0xaa: "quotedblleft", 0xab: "guillemotleft",
+	0xac: "guilsinglleft", 0xad: "guilsinglright", 0xae: "fi", 0xaf: "fl", 0xb1: "endash", 0xb2: "dagger",
+	0xb3: "daggerdbl", 0xb4: "periodcentered", 0xb6: "paragraph", 0xb7: "bullet", 0xb8: "quotesinglbase",
+	0xb9: "quotedblbase", 0xba: "quotedblright", 0xbb: "guillemotright", 0xbc: "ellipsis", 0xbd: "perthousand",
+	0xbf: "questiondown", 0xc1: "grave", 0xc2: "acute", 0xc3: "circumflex", 0xc4: "tilde", 0xc5: "macron",
+	0xc6: "breve", 0xc7: "dotaccent", 0xc8: "dieresis", 0xca: "ring", 0xcb: "cedilla", 0xcd: "hungarumlaut",
+	0xce: "ogonek", 0xcf: "caron", 0xd0: "emdash", 0xe1: "AE", 0xe3: "ordfeminine", 0xe8: "Lslash",
+	0xe9: "Oslash", 0xea: "OE", 0xeb: "ordmasculine", 0xf1: "ae", 0xf5: "dotlessi", 0xf8: "lslash",
+	0xf9: "oslash", 0xfa: "oe", 0xfb: "germandbls",
+}
+
+// 其他字形名对应的字符，ASCII 和 Latin-1 的字形名按编码计算
+var extraGlyphNames = map[string]string{
+	"Euro": "€", "quotesinglbase": "‚", "florin": "ƒ", "quotedblbase": "„", "ellipsis": "…",
+	"dagger": "†", "daggerdbl": "‡", "circumflex": "ˆ", "perthousand": "‰", "Scaron": "Š",
+	"guilsinglleft": "‹", "OE": "Œ", "Zcaron": "Ž", "quoteleft": "‘", "quoteright": "’",
+	"quotedblleft": "“", "quotedblright": "”", "bullet": "•", "endash": "–", "emdash": "—",
+	"tilde": "˜", "trademark": "™", "scaron": "š", "guilsinglright": "›", "oe": "œ",
+	"zcaron": "ž", "Ydieresis": "Ÿ", "fraction": "⁄", "dotlessi": "ı", "Lslash": "Ł",
+	"lslash": "ł", "breve": "˘", "dotaccent": "˙", "ring": "˚", "hungarumlaut": "˝",
+	"ogonek": "˛", "caron": "ˇ", "notequal": "≠", "infinity": "∞", "lessequal": "≤",
+	"greaterequal": "≥", "partialdiff": "∂", "summation": "∑", "product": "∏", "pi": "π",
+	"integral": "∫", "Omega": "Ω", "radical": "√", "approxequal": "≈", "Delta": "∆",
+	"lozenge": "◊", "minus": "−", "space": " ", "hyphen": "-", "nbspace": " ", "sfthyphen": "-",
+	"nonbreakingspace": " ", "periodcentered": "·", "middot": "·", "mu": "µ", "Tcedilla": "Ţ",
+	// 连字展开为多个字母，便于搜索
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+}
+
+var (
+	glyphNames       map[string]string
+	standardEncoding [256]string
+	winAnsiEncoding  [256]string
+	macRomanEncoding [256]string
+)
+
+func init() {
+	glyphNames = make(map[string]string, 512)
+	for i, name := range asciiGlyphNames {
+		glyphNames[name] = string(rune(0x20 + i))
+		standardEncoding[0x20+i] = name
+		winAnsiEncoding[0x20+i] = name
+		macRomanEncoding[0x20+i] = name
+	}
+	for i, name := range latin1GlyphNames {
+		glyphNames[name] = string(rune(0xa0 + i))
+		winAnsiEncoding[0xa0+i] = name
+	}
+	for name, text := range extraGlyphNames {
+		glyphNames[name] = text
+	}
+	for i, name := range winAnsiHighNames {
+		winAnsiEncoding[0x80+i] = name
+	}
+	// WinAnsiEncoding 中 0xa0 和 0xad 分别是 space 和 hyphen
+	winAnsiEncoding[0xa0], winAnsiEncoding[0xad] = "space", "hyphen"
+	for i, name := range macRomanHighNames {
+		macRomanEncoding[0x80+i] = name
+	}
+	standardEncoding[0x27], standardEncoding[0x60] = "quoteright", "quoteleft"
+	for code, name := range standardHighNames {
+		standardEncoding[code] = name
+	}
+}
+
+// baseEncoding 按名字返回内置的编码，不认识的返回 nil
+func baseEncoding(name string) *[256]string {
+	switch name {
+	case "/StandardEncoding":
+		return &standardEncoding
+	case "/WinAnsiEncoding":
+		return &winAnsiEncoding
+	case "/MacRomanEncoding":
+		return &macRomanEncoding
+	}
+	return nil
+}
+
+// glyphText 返回字形名对应的字符，支持 uniXXXX、uXXXX 形式的名字，
+// 以及 .sc 等后缀和 f_f_i 这样的连字名。不认识时返回空串
+func glyphText(name string) string {
+	if text, ok := glyphNames[name]; ok {
+		return text
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return glyphText(name[:i])
+	}
+	if strings.Contains(name, "_") {
+		text := ""
+		for _, part := range strings.Split(name, "_") {
+			text += glyphText(part)
+		}
+		return text
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 && (len(name)-3)%4 == 0 {
+		units := make([]uint16, 0, (len(name)-3)/4)
+		for i := 3; i < len(name); i += 4 {
+			v, err := strconv.ParseUint(name[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			units = append(units, uint16(v))
+		}
+		return string(utf16.Decode(units))
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if v, err := strconv.ParseUint(name[1:], 16, 32); err == nil && v <= 0x10ffff {
+			return string(rune(v))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,353 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 流过滤器的解码，参考 PDF 规范 7.4 Filters
+
+// 图像编码的过滤器，解码出来就是图像文件本身，不在这里处理
+var imageFilters = map[string]bool{
+	"/DCTDecode":      true,
+	"/CCITTFaxDecode": true,
+	"/JPXDecode":      true,
+	"/JBIG2Decode":    true,
+}
+
+// getFilters 返回流对象上的过滤器列表，以及每个过滤器对应的 /DecodeParms
+func (p *PDF) getFilters(obj *Obj) ([]string, [][]*Pair) {
+	names := make([]string, 0)
+	parms := make([][]*Pair, 0)
+	for _, pair := range obj.Dict {
+		if pair.Key.Name != "/Filter" {
+			continue
+		}
+		switch v := p.resolve(pair.Value).(type) {
+		case *NameObj:
+			names = append(names, v.Name)
+		case []interface{}:
+			for _, item := range v {
+				if name, ok := item.(*NameObj); ok {
+					names = append(names, name.Name)
+				}
+			}
+		}
+	}
+	for _, pair := range obj.Dict {
+		if pair.Key.Name != "/DecodeParms" {
+			continue
+		}
+		// 参数字典和数组都可以是间接对象
+		if list, ok := p.resolve(pair.Value).([]interface{}); ok {
+			for _, item := range list {
+				parms = append(parms, p.resolveDict(item))
+			}
+		} else {
+			parms = append(parms, p.resolveDict(pair.Value))
+		}
+	}
+	for len(parms) < len(names) {
+		parms = append(parms, nil)
+	}
+	return names, parms
+}
+
+// getFilterName 返回最后一个过滤器的名字，没有过滤器时返回空字符串
+func (p *PDF) getFilterName(obj *Obj) string {
+	names, _ := p.getFilters(obj)
+	if len(names) == 0 {
+		return ""
+	}
+	return names[len(names)-1]
+}
+
+// decodeStream 依次执行流对象上的过滤器，遇到图像编码的过滤器时停止。
+// 返回解码后的数据，以及没有处理的图像过滤器名字
+func (p *PDF) decodeStream(obj *Obj) ([]byte, string, error) {
+	data := obj.Stream.data()
+	names, parms := p.getFilters(obj)
+	for i, name := range names {
+		if imageFilters[name] {
+			return data, name, nil
+		}
+		var err error
+		data, err = decodeFilter(name, data, parms[i])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return data, "", nil
+}
+
+func decodeFilter(name string, data []byte, parms []*Pair) ([]byte, error) {
+	var err error
+	switch name {
+	case "/FlateDecode", "/Fl":
+		data, err = flateDecode(data)
+	case "/LZWDecode", "/LZW":
+		early := 1
+		for _, pair := range parms {
+			if v, ok := pair.Value.(int); ok && pair.Key.Name == "/EarlyChange" {
+				early = v
+			}
+		}
+		data, err = lzwDecode(data, early == 1)
+	case "/ASCIIHexDecode", "/AHx":
+		return asciiHexDecode(data)
+	case "/ASCII85Decode", "/A85":
+		return ascii85Decode(data)
+	case "/RunLengthDecode", "/RL":
+		return runLengthDecode(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported filter: %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return applyPredictor(data, parms)
+}
+
+func flateDecode(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	buf, err := io.ReadAll(r)
+	// 有些文件的压缩流没有正常结束，保留已经解出的数据
+	if err != nil && len(buf) == 0 {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func flateEncode(data []byte) []byte {
+	buf := bytes.Buffer{}
+	w, _ := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	buf := make([]byte, 0, len(data))
+	for _, b := range data {
+		if b == '>' {
+			break
+		}
+		if b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\f' || b == 0 {
+			continue
+		}
+		buf = append(buf, b)
+	}
+	if len(buf)%2 == 1 {
+		buf = append(buf, '0')
+	}
+	dst := make([]byte, len(buf)/2)
+	_, err := hex.Decode(dst, buf)
+	return dst, err
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if idx := bytes.Index(data, []byte("~>")); idx >= 0 {
+		data = data[:idx]
+	}
+	dst := make([]byte, len(data)*4/5+4)
+	n, _, err := ascii85.Decode(dst, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return dst[:n], nil
+}
+
+func runLengthDecode(data []byte) []byte {
+	buf := make([]byte, 0, len(data)*2)
+	for len(data) > 0 {
+		n := int(data[0])
+		data = data[1:]
+		if n == 128 {
+			break
+		}
+		if n < 128 {
+			n++
+			if n > len(data) {
+				n = len(data)
+			}
+			buf = append(buf, data[:n]...)
+			data = data[n:]
+			continue
+		}
+		if len(data) == 0 {
+			break
+		}
+		for i := 0; i < 257-n; i++ {
+			buf = append(buf, data[0])
+		}
+		data = data[1:]
+	}
+	return buf
+}
+
+// PDF 的 LZW 与 TIFF 相同，码长在码表满之前提前一位增长 (EarlyChange)
+func lzwDecode(data []byte, early bool) ([]byte, error) {
+	buf := make([]byte, 0, len(data)*3)
+	table := make([][]byte, 258, 4096)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+	width := 9
+	var prev []byte
+	bits, nbits := uint32(0), 0
+	for _, b := range data {
+		bits = bits<<8 | uint32(b)
+		nbits += 8
+		for nbits >= width {
+			code := int(bits>>uint(nbits-width)) & (1<<uint(width) - 1)
+			nbits -= width
+			switch {
+			case code == 256:
+				table = table[:258]
+				width = 9
+				prev = nil
+				continue
+			case code == 257:
+				return buf, nil
+			case code < len(table):
+				entry := table[code]
+				buf = append(buf, entry...)
+				if prev != nil {
+					table = append(table, append(append([]byte{}, prev...), entry[0]))
+				}
+				prev = entry
+			case code == len(table) && prev != nil:
+				entry := append(append([]byte{}, prev...), prev[0])
+				buf = append(buf, entry...)
+				table = append(table, entry)
+				prev = entry
+			default:
+				return nil, errors.New("lzw: invalid code")
+			}
+			size := len(table)
+			if early {
+				size++
+			}
+			if size >= 1<<uint(width) && width < 12 {
+				width++
+			}
+		}
+	}
+	return buf, nil
+}
+
+// applyPredictor 处理 /DecodeParms 中的 /Predictor，支持 TIFF Predictor 2 和 PNG 预测
+func applyPredictor(data []byte, parms []*Pair) ([]byte, error) {
+	predictor, colors, bpc, columns := 1, 1, 8, 1
+	for _, pair := range parms {
+		v, ok := pair.Value.(int)
+		if !ok {
+			continue
+		}
+		switch pair.Key.Name {
+		case "/Predictor":
+			predictor = v
+		case "/Colors":
+			colors = v
+		case "/BitsPerComponent":
+			bpc = v
+		case "/Columns":
+			columns = v
+		}
+	}
+	if predictor <= 1 {
+		return data, nil
+	}
+	bpp := (colors*bpc + 7) / 8
+	rowLen := (colors*bpc*columns + 7) / 8
+	if predictor == 2 {
+		if bpc != 8 {
+			return nil, fmt.Errorf("unsupported tiff predictor bpc: %d", bpc)
+		}
+		for row := 0; row+rowLen <= len(data); row += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				data[row+i] += data[row+i-bpp]
+			}
+		}
+		return data, nil
+	}
+	// PNG 预测，每行前面多一个字节表示预测算法
+	buf := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for len(data) > 0 {
+		typ := data[0]
+		data = data[1:]
+		n := rowLen
+		if n > len(data) {
+			n = len(data)
+		}
+		row := make([]byte, rowLen)
+		copy(row, data[:n])
+		data = data[n:]
+		for i := 0; i < rowLen; i++ {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch typ {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		buf = append(buf, row...)
+		prev = row
+	}
+	return buf, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// pngUpEncode 按 PNG 的 Up 算法做预测，对应 /Predictor 12，渐变的蒙版压缩效果更好
+func pngUpEncode(data []byte, rowLen int) []byte {
+	buf := make([]byte, 0, len(data)+len(data)/rowLen+1)
+	prev := make([]byte, rowLen)
+	for row := 0; row+rowLen <= len(data); row += rowLen {
+		cur := data[row : row+rowLen]
+		buf = append(buf, 2)
+		for i := 0; i < rowLen; i++ {
+			buf = append(buf, cur[i]-prev[i])
+		}
+		prev = cur
+	}
+	return buf
+}
@@ -0,0 +1,300 @@
+package pdf
+
+import (
+	"log"
+	"strings"
+
+	"github.com/wuyq101/pdf/cmap"
+)
+
+// pdfFont 字体的度量信息，宽度的单位都是 1/1000 字号
+type pdfFont struct {
+	dict      []*Pair
+	name      string // /BaseFont，去掉了子集的前缀
+	composite bool   // Type0 字体，按 2 字节的编码处理 (Identity-H 等)
+
+	encoding  *[256]string // 简单字体的编码对应的字形名
+	toUnicode *cmap.CMap
+	cmap      *cmap.CMap // Type0 字体的 /Encoding，把编码拆分并对应到 CID
+	cidText   *cmap.CMap // CID 字体的字符集合 (如 Adobe-GB1) 中 CID 对应的文字
+	ascent    float64
+	descent   float64
+
+	firstChar int
+	widths    []float64
+	missing   float64 // 简单字体中没有宽度的字符
+
+	cidWidths    map[int]float64
+	defaultWidth float64 // Type0 字体的 /DW
+	noCID        bool    // 已经记录过编码没有 CID 的日志
+}
+
+// defaultGlyphWidth 没有宽度信息时使用的宽度，按等宽字体估计，宁可大一些
+const defaultGlyphWidth = 600
+
+// loadFont 读取字体字典中的宽度信息
+func (p *PDF) loadFont(dict []*Pair) *pdfFont {
+	f := &pdfFont{dict: dict, missing: defaultGlyphWidth, defaultWidth: 1000, ascent: 1000, descent: -250}
+	if name := p.getNameObjByKey(dict, "/BaseFont"); name != nil {
+		f.name = name.Name[1:]
+		if i := strings.IndexByte(f.name, '+'); i == 6 {
+			f.name = f.name[i+1:]
+		}
+	}
+	if obj, ok := p.resolve(p.getValueByKey(dict, "/ToUnicode")).(*Obj); ok && obj.Stream != nil {
+		if data, _, err := p.decodeStream(obj); err == nil {
+			f.toUnicode, _ = cmap.Parse(data)
+		}
+	}
+	subtype := p.getNameObjByKey(dict, "/Subtype")
+	if subtype != nil && subtype.Name == "/Type0" {
+		f.composite = true
+		f.cidWidths = make(map[int]float64)
+		f.loadCMap(p)
+		descendants, _ := p.resolve(p.getValueByKey(dict, "/DescendantFonts")).([]interface{})
+		if len(descendants) > 0 {
+			cid := p.resolveDict(descendants[0])
+			info := p.getResolvedDict(cid, "/CIDSystemInfo")
+			registry, _ := p.resolve(p.getValueByKey(info, "/Registry")).(string)
+			ordering, _ := p.resolve(p.getValueByKey(info, "/Ordering")).(string)
+			f.cidText = cmap.Predefined(string(decodePDFString(registry)) + "-" + string(decodePDFString(ordering)) + "-UCS2")
+			if dw, ok := toFloat(p.resolve(p.getValueByKey(cid, "/DW"))); ok {
+				f.defaultWidth = dw
+			}
+			w, _ := p.resolve(p.getValueByKey(cid, "/W")).([]interface{})
+			p.parseCIDWidths(w, f.cidWidths)
+		}
+		return f
+	}
+	f.firstChar = p.getIntByKey(dict, "/FirstChar")
+	if widths, ok := p.resolve(p.getValueByKey(dict, "/Widths")).([]interface{}); ok {
+		for _, item := range widths {
+			w, _ := toFloat(p.resolve(item))
+			f.widths = append(f.widths, w)
+		}
+	}
+	desc := p.getResolvedDict(dict, "/FontDescriptor")
+	if mw, ok := toFloat(p.resolve(p.getValueByKey(desc, "/MissingWidth"))); ok && mw > 0 {
+		f.missing = mw
+	}
+	f.loadMetrics(p, desc)
+	f.loadEncoding(p, subtype)
+	return f
+}
+
+// loadCMap 读取 Type0 字体的 /Encoding，可以是预定义 CMap 的名字或者内嵌的 CMap 流，
+// 不认识时按 Identity-H 处理
+func (f *pdfFont) loadCMap(p *PDF) {
+	switch v := p.resolve(p.getValueByKey(f.dict, "/Encoding")).(type) {
+	case *NameObj:
+		f.cmap = cmap.Predefined(v.Name)
+	case *Obj:
+		if v.Stream != nil {
+			if data, _, err := p.decodeStream(v); err == nil {
+				f.cmap, _ = cmap.Parse(data)
+			}
+		}
+	}
+	if f.cmap == nil {
+		f.cmap = cmap.Predefined("Identity-H")
+	}
+}
+
+// loadMetrics 读取字体描述中的上升和下降高度
+func (f *pdfFont) loadMetrics(p *PDF, desc []*Pair) {
+	if v, ok := toFloat(p.resolve(p.getValueByKey(desc, "/Ascent"))); ok && v > 0 {
+		f.ascent = v
+	}
+	if v, ok := toFloat(p.resolve(p.getValueByKey(desc, "/Descent"))); ok && v < 0 {
+		f.descent = v
+	}
+}
+
+// loadEncoding 读取简单字体的 /Encoding，包括 /BaseEncoding 和 /Differences。
+// 没有指定时 TrueType 字体按 WinAnsiEncoding，其他按 StandardEncoding
+func (f *pdfFont) loadEncoding(p *PDF, subtype *NameObj) {
+	base := &standardEncoding
+	if subtype != nil && subtype.Name == "/TrueType" {
+		base = &winAnsiEncoding
+	}
+	if f.name == "Symbol" || f.name == "ZapfDingbats" {
+		// 符号字体使用字体内置的编码
+		base = nil
+	}
+	value := p.resolve(p.getValueByKey(f.dict, "/Encoding"))
+	var diffs []interface{}
+	switch v := value.(type) {
+	case *NameObj:
+		if enc := baseEncoding(v.Name); enc != nil {
+			base = enc
+		}
+	default:
+		dict := p.resolveDict(v)
+		if name := p.getNameObjByKey(dict, "/BaseEncoding"); name != nil && baseEncoding(name.Name) != nil {
+			base = baseEncoding(name.Name)
+		}
+		diffs, _ = p.resolve(p.getValueByKey(dict, "/Differences")).([]interface{})
+	}
+	if base == nil && len(diffs) == 0 {
+		return
+	}
+	enc := [256]string{}
+	if base != nil {
+		enc = *base
+	}
+	// Differences: 编码后面跟着从这个编码开始的字形名
+	code := 0
+	for _, item := range diffs {
+		switch v := p.resolve(item).(type) {
+		case int:
+			code = v
+		case *NameObj:
+			if code >= 0 && code < 256 {
+				enc[code] = v.Name[1:]
+			}
+			code++
+		}
+	}
+	f.encoding = &enc
+}
+
+// cachedFont 取资源中名为 name 的字体，同一个字体对象只读取一次
+func (p *PDF) cachedFont(cache map[*Obj]*pdfFont, fonts []*Pair, name string) *pdfFont {
+	obj, _ := p.resolve(p.getValueByKey(fonts, name)).(*Obj)
+	if obj == nil {
+		return nil
+	}
+	if f, ok := cache[obj]; ok {
+		return f
+	}
+	f := p.loadFont(obj.Dict)
+	cache[obj] = f
+	return f
+}
+
+// parseCIDWidths 解析 /W 数组: c [w1 w2 ...] 或者 cfirst clast w
+func (p *PDF) parseCIDWidths(w []interface{}, widths map[int]float64) {
+	for i := 0; i < len(w); {
+		first, ok := toFloat(p.resolve(w[i]))
+		if !ok || i+1 >= len(w) {
+			return
+		}
+		if list, ok := p.resolve(w[i+1]).([]interface{}); ok {
+			for j, item := range list {
+				if v, ok := toFloat(p.resolve(item)); ok {
+					widths[int(first)+j] = v
+				}
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last, ok1 := toFloat(p.resolve(w[i+1]))
+		v, ok2 := toFloat(p.resolve(w[i+2]))
+		if !ok1 || !ok2 {
+			return
+		}
+		for c := int(first); c <= int(last) && c-int(first) < 65536; c++ {
+			widths[c] = v
+		}
+		i += 3
+	}
+}
+
+// codes 把字符串的字节拆分为字符编码，Type0 字体按 /Encoding 的 codespacerange 拆分
+func (f *pdfFont) codes(data []byte) []int {
+	parts := f.split(data)
+	list := make([]int, 0, len(parts))
+	for _, part := range parts {
+		code := 0
+		for _, b := range part {
+			code = code<<8 | int(b)
+		}
+		list = append(list, code)
+	}
+	return list
+}
+
+// split 和 codes 相同，但返回每个字符编码原来的字节
+func (f *pdfFont) split(data []byte) [][]byte {
+	if f.composite && f.cmap != nil {
+		if list := f.cmap.SplitBytes(data); list != nil {
+			return list
+		}
+	}
+	list := make([][]byte, 0, len(data))
+	if !f.composite {
+		for i := range data {
+			list = append(list, data[i:i+1])
+		}
+		return list
+	}
+	for i := 0; i+1 < len(data); i += 2 {
+		list = append(list, data[i:i+2])
+	}
+	return list
+}
+
+// width 字符编码对应的字形宽度
+func (f *pdfFont) width(code int) float64 {
+	if f.composite {
+		cid, ok := f.cid(code)
+		if !ok {
+			// 没有 CID 的编码按 CID 0 (.notdef) 计算宽度，不能把编码当作 CID。
+			// 内嵌的 UniGB-UCS2-H 等只有 GB 2312 中的字符，完整的对应关系需要 cmap.SetDir
+			if !f.noCID {
+				f.noCID = true
+				log.Default().Printf("font %s: code %#x not in cmap %s, use the width of cid 0", f.name, code, f.cmap.Name)
+			}
+			cid = 0
+		}
+		if w, ok := f.cidWidths[cid]; ok {
+			return w
+		}
+		return f.defaultWidth
+	}
+	if i := code - f.firstChar; i >= 0 && i < len(f.widths) && f.widths[i] > 0 {
+		return f.widths[i]
+	}
+	return f.missing
+}
+
+// text 字符编码对应的文字，先查 ToUnicode，再按编码的字形名。不知道时返回空串
+func (f *pdfFont) text(code int) string {
+	if f.toUnicode != nil {
+		if text, ok := f.toUnicode.Unicode(code); ok {
+			return text
+		}
+	}
+	if f.composite {
+		// UniGB-UCS2-H 等编码本身就是 Unicode，其他的按 CID 查字符集合的对应表
+		if text, ok := f.cmap.Unicode(code); ok {
+			return text
+		}
+		if cid, ok := f.cid(code); ok && f.cidText != nil {
+			text, _ := f.cidText.Unicode(cid)
+			return text
+		}
+		return ""
+	}
+	if f.encoding != nil && code >= 0 && code < 256 {
+		if text := glyphText(f.encoding[code]); text != "" {
+			return text
+		}
+	}
+	if code >= 0x20 && code < 0x7f {
+		// 符号字体或者编码中没有的字形，按 ASCII 处理
+		return string(rune(code))
+	}
+	return ""
+}
+
+// cid Type0 字体中字符编码对应的 CID
+func (f *pdfFont) cid(code int) (int, bool) {
+	if f.cmap == nil {
+		return code, true
+	}
+	return f.cmap.CID(code)
+}
@@ -0,0 +1,29 @@
+package pdf
+
+import "testing"
+
+func TestCIDFontWidth(t *testing.T) {
+	p := testPDF(t, []string{
+		"<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [2 0 R] >>",
+		"<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+			"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /DW 1000 /W [0 [500] 778 [700] 19970 [123]] >>",
+	})
+	f := p.loadFont(p.Objects[0].Dict)
+	// 丂 (U+4E02) 不在 GB 2312 中，内嵌的 UniGB-UCS2-H 没有它的 CID，
+	// 按 CID 0 计算宽度，不能把 0x4E02 当作 CID 19970
+	for _, tc := range []struct {
+		code  int
+		width float64
+	}{
+		{0x554a, 700},
+		{0x41, 1000},
+		{0x4e02, 500},
+	} {
+		if w := f.width(tc.code); w != tc.width {
+			t.Errorf("width %#x: %v, want %v", tc.code, w, tc.width)
+		}
+	}
+	if text := f.text(0x4e02); text != "丂" {
+		t.Errorf("text %q", text)
+	}
+}
@@ -0,0 +1,506 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+)
+
+// ICC profile 的简单实现，只用于把 CMYK 图像按嵌入的 profile 转换为 sRGB。
+// 只读取 A2B0 (感知意图) 标签，支持 lut8 (mft1)、lut16 (mft2) 和 lutAtoB (mAB ) 三种类型
+
+// iccCurve 一维曲线，输入输出都在 0-1 之间
+type iccCurve func(v float64) float64
+
+func iccIdentity(v float64) float64 {
+	return v
+}
+
+// iccTableCurve 按采样表线性插值
+func iccTableCurve(table []float64) iccCurve {
+	if len(table) == 0 {
+		return iccIdentity
+	}
+	if len(table) == 1 {
+		return func(v float64) float64 { return table[0] }
+	}
+	return func(v float64) float64 {
+		v = clamp01(v)
+		f := v * float64(len(table)-1)
+		i := int(f)
+		if i >= len(table)-1 {
+			return table[len(table)-1]
+		}
+		t := f - float64(i)
+		return table[i]*(1-t) + table[i+1]*t
+	}
+}
+
+// iccLut 多维颜色查找表
+type iccLut struct {
+	inChans  int
+	outChans int
+	grid     []int
+	table    []float64 // 按 grid 顺序排列，第一个输入变化最慢
+}
+
+// lookup 多线性插值
+func (lut *iccLut) lookup(in []float64, out []float64) {
+	n := lut.inChans
+	idx := make([]int, n)
+	frac := make([]float64, n)
+	for i := 0; i < n; i++ {
+		g := lut.grid[i]
+		f := clamp01(in[i]) * float64(g-1)
+		k := int(f)
+		if k >= g-1 {
+			k = g - 2
+			if k < 0 {
+				k = 0
+			}
+		}
+		idx[i] = k
+		frac[i] = f - float64(k)
+	}
+	for j := range out[:lut.outChans] {
+		out[j] = 0
+	}
+	for corner := 0; corner < 1<<uint(n); corner++ {
+		w := 1.0
+		offset := 0
+		for i := 0; i < n; i++ {
+			k := idx[i]
+			if corner>>uint(n-1-i)&1 == 1 {
+				if lut.grid[i] > 1 {
+					k++
+				}
+				w *= frac[i]
+			} else {
+				w *= 1 - frac[i]
+			}
+			offset = offset*lut.grid[i] + k
+		}
+		if w == 0 {
+			continue
+		}
+		offset *= lut.outChans
+		for j := 0; j < lut.outChans; j++ {
+			out[j] += w * lut.table[offset+j]
+		}
+	}
+}
+
+// iccTransform 从设备颜色到 PCS 的转换
+type iccTransform struct {
+	inChans  int
+	pcsLab   bool
+	lab16    bool // lut16 中 Lab 使用老的编码方式，L 的 100 对应 0xff00
+	aCurves  []iccCurve
+	lut      *iccLut
+	mCurves  []iccCurve
+	matrix   []float64 // 3x3 矩阵，加上3个偏移量
+	bCurves  []iccCurve
+	cache    map[uint32][3]uint8
+	tempIn   []float64
+	tempOut  []float64
+	tempNext []float64
+}
+
+// parseICCProfile 解析 ICC profile，返回设备颜色到 PCS 的转换
+func parseICCProfile(data []byte) (*iccTransform, error) {
+	if len(data) < 132 {
+		return nil, errors.New("icc: profile too short")
+	}
+	pcs := string(data[20:24])
+	if pcs != "Lab " && pcs != "XYZ " {
+		return nil, errors.New("icc: unsupported pcs " + pcs)
+	}
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(data) {
+			break
+		}
+		if string(data[entry:entry+4]) != "A2B0" {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(data[entry+4:]))
+		size := int(binary.BigEndian.Uint32(data[entry+8:]))
+		if offset < 0 || size < 12 || offset+size > len(data) {
+			return nil, errors.New("icc: invalid A2B0 tag")
+		}
+		t, err := parseICCLut(data[offset : offset+size])
+		if err != nil {
+			return nil, err
+		}
+		t.pcsLab = pcs == "Lab "
+		t.cache = make(map[uint32][3]uint8)
+		t.tempIn = make([]float64, 16)
+		t.tempOut = make([]float64, 16)
+		t.tempNext = make([]float64, 16)
+		return t, nil
+	}
+	return nil, errors.New("icc: A2B0 tag not found")
+}
+
+func parseICCLut(tag []byte) (*iccTransform, error) {
+	typ := string(tag[:4])
+	switch typ {
+	case "mft1", "mft2":
+		if len(tag) < 52 {
+			return nil, errors.New("icc: invalid lut tag")
+		}
+		in, out, grid := int(tag[8]), int(tag[9]), int(tag[10])
+		if in == 0 || in > 8 || out != 3 || grid < 2 {
+			return nil, errors.New("icc: unsupported lut")
+		}
+		t := &iccTransform{inChans: in, lab16: typ == "mft2"}
+		var inEntries, outEntries, width, pos int
+		if typ == "mft1" {
+			inEntries, outEntries, width, pos = 256, 256, 1, 48
+		} else {
+			inEntries = int(binary.BigEndian.Uint16(tag[48:]))
+			outEntries = int(binary.BigEndian.Uint16(tag[50:]))
+			width, pos = 2, 52
+		}
+		clutSize := out
+		for i := 0; i < in; i++ {
+			clutSize *= grid
+		}
+		if pos+(in*inEntries+clutSize+out*outEntries)*width > len(tag) {
+			return nil, errors.New("icc: lut tag too short")
+		}
+		read := func(n int) []float64 {
+			list := make([]float64, n)
+			for i := range list {
+				if width == 1 {
+					list[i] = float64(tag[pos]) / 255
+				} else {
+					list[i] = float64(binary.BigEndian.Uint16(tag[pos:])) / 65535
+				}
+				pos += width
+			}
+			return list
+		}
+		// lut8/lut16 中的矩阵只用于 XYZ 输入，这里输入是设备颜色，忽略
+		for i := 0; i < in; i++ {
+			t.aCurves = append(t.aCurves, iccTableCurve(read(inEntries)))
+		}
+		grids := make([]int, in)
+		for i := range grids {
+			grids[i] = grid
+		}
+		t.lut = &iccLut{inChans: in, outChans: out, grid: grids, table: read(clutSize)}
+		for i := 0; i < out; i++ {
+			t.bCurves = append(t.bCurves, iccTableCurve(read(outEntries)))
+		}
+		return t, nil
+	case "mAB ":
+		if len(tag) < 32 {
+			return nil, errors.New("icc: invalid mAB tag")
+		}
+		in, out := int(tag[8]), int(tag[9])
+		if in == 0 || in > 8 || out != 3 {
+			return nil, errors.New("icc: unsupported mAB")
+		}
+		t := &iccTransform{inChans: in}
+		offB := int(binary.BigEndian.Uint32(tag[12:]))
+		offMatrix := int(binary.BigEndian.Uint32(tag[16:]))
+		offM := int(binary.BigEndian.Uint32(tag[20:]))
+		offCLUT := int(binary.BigEndian.Uint32(tag[24:]))
+		offA := int(binary.BigEndian.Uint32(tag[28:]))
+		var err error
+		if offB != 0 {
+			if t.bCurves, err = parseICCCurves(tag, offB, out); err != nil {
+				return nil, err
+			}
+		}
+		if offMatrix != 0 {
+			if offMatrix+48 > len(tag) {
+				return nil, errors.New("icc: invalid matrix")
+			}
+			for i := 0; i < 12; i++ {
+				t.matrix = append(t.matrix, s15Fixed16(tag[offMatrix+i*4:]))
+			}
+		}
+		if offM != 0 {
+			if t.mCurves, err = parseICCCurves(tag, offM, out); err != nil {
+				return nil, err
+			}
+		}
+		if offCLUT != 0 {
+			if t.lut, err = parseICCCLUT(tag, offCLUT, in, out); err != nil {
+				return nil, err
+			}
+		}
+		if offA != 0 {
+			if t.aCurves, err = parseICCCurves(tag, offA, in); err != nil {
+				return nil, err
+			}
+		}
+		if t.lut == nil && in != 3 {
+			return nil, errors.New("icc: mAB without clut")
+		}
+		return t, nil
+	}
+	return nil, errors.New("icc: unsupported tag type " + typ)
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// parseICCCurves 解析连续的 n 条曲线 (curv 或 para)，每条按4字节对齐
+func parseICCCurves(tag []byte, pos, n int) ([]iccCurve, error) {
+	curves := make([]iccCurve, 0, n)
+	for i := 0; i < n; i++ {
+		if pos+12 > len(tag) {
+			return nil, errors.New("icc: invalid curve")
+		}
+		var size int
+		switch string(tag[pos : pos+4]) {
+		case "curv":
+			count := int(binary.BigEndian.Uint32(tag[pos+8:]))
+			size = 12 + count*2
+			if pos+size > len(tag) {
+				return nil, errors.New("icc: invalid curv")
+			}
+			switch count {
+			case 0:
+				curves = append(curves, iccIdentity)
+			case 1:
+				g := float64(binary.BigEndian.Uint16(tag[pos+12:])) / 256
+				curves = append(curves, func(v float64) float64 { return math.Pow(clamp01(v), g) })
+			default:
+				table := make([]float64, count)
+				for j := range table {
+					table[j] = float64(binary.BigEndian.Uint16(tag[pos+12+j*2:])) / 65535
+				}
+				curves = append(curves, iccTableCurve(table))
+			}
+		case "para":
+			fn := int(binary.BigEndian.Uint16(tag[pos+8:]))
+			counts := []int{1, 3, 4, 5, 7}
+			if fn >= len(counts) {
+				return nil, errors.New("icc: invalid para")
+			}
+			size = 12 + counts[fn]*4
+			if pos+size > len(tag) {
+				return nil, errors.New("icc: invalid para")
+			}
+			// g a b c d e f
+			var params [7]float64
+			params[1] = 1
+			for j := 0; j < counts[fn]; j++ {
+				params[j] = s15Fixed16(tag[pos+12+j*4:])
+			}
+			curves = append(curves, parametricCurve(fn, params))
+		default:
+			return nil, errors.New("icc: unsupported curve type")
+		}
+		pos += (size + 3) &^ 3
+	}
+	return curves, nil
+}
+
+// parametricCurve ICC 规范 10.18 中的参数曲线
+func parametricCurve(fn int, params [7]float64) iccCurve {
+	g, a, b, c, d, e, f := params[0], params[1], params[2], params[3], params[4], params[5], params[6]
+	return func(x float64) float64 {
+		x = clamp01(x)
+		var y float64
+		switch fn {
+		case 0:
+			y = math.Pow(x, g)
+		case 1:
+			if x >= -b/a {
+				y = math.Pow(a*x+b, g)
+			}
+		case 2:
+			y = c
+			if x >= -b/a {
+				y = math.Pow(a*x+b, g) + c
+			}
+		case 3:
+			y = c * x
+			if x >= d {
+				y = math.Pow(a*x+b, g)
+			}
+		case 4:
+			y = c*x + f
+			if x >= d {
+				y = math.Pow(a*x+b, g) + e
+			}
+		}
+		return clamp01(y)
+	}
+}
+
+func parseICCCLUT(tag []byte, pos, in, out int) (*iccLut, error) {
+	if pos+20 > len(tag) {
+		return nil, errors.New("icc: invalid clut")
+	}
+	grids := make([]int, in)
+	size := out
+	for i := 0; i < in; i++ {
+		grids[i] = int(tag[pos+i])
+		if grids[i] < 1 {
+			return nil, errors.New("icc: invalid clut grid")
+		}
+		size *= grids[i]
+	}
+	precision := int(tag[pos+16])
+	if precision != 1 && precision != 2 {
+		return nil, errors.New("icc: invalid clut precision")
+	}
+	data := tag[pos+20:]
+	if len(data) < size*precision {
+		return nil, errors.New("icc: clut too short")
+	}
+	table := make([]float64, size)
+	for i := range table {
+		if precision == 1 {
+			table[i] = float64(data[i]) / 255
+		} else {
+			table[i] = float64(binary.BigEndian.Uint16(data[i*2:])) / 65535
+		}
+	}
+	return &iccLut{inChans: in, outChans: out, grid: grids, table: table}, nil
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// toPCS 设备颜色 (0-1) 转换为 PCS 的 XYZ (D50)
+func (t *iccTransform) toPCS(in []float64) (x, y, z float64) {
+	cur := t.tempIn[:t.inChans]
+	copy(cur, in)
+	for i, c := range t.aCurves {
+		if i < len(cur) {
+			cur[i] = c(cur[i])
+		}
+	}
+	if t.lut != nil {
+		out := t.tempOut[:t.lut.outChans]
+		t.lut.lookup(cur, out)
+		cur = out
+	}
+	for i, c := range t.mCurves {
+		if i < len(cur) {
+			cur[i] = c(cur[i])
+		}
+	}
+	if len(t.matrix) == 12 && len(cur) >= 3 {
+		m := t.matrix
+		next := t.tempNext[:3]
+		for i := 0; i < 3; i++ {
+			next[i] = m[i*3]*cur[0] + m[i*3+1]*cur[1] + m[i*3+2]*cur[2] + m[9+i]
+		}
+		cur = next
+	}
+	for i, c := range t.bCurves {
+		if i < len(cur) {
+			cur[i] = c(cur[i])
+		}
+	}
+	if len(cur) < 3 {
+		return 0, 0, 0
+	}
+	if !t.pcsLab {
+		// u1Fixed15 编码
+		k := 65535.0 / 32768
+		return cur[0] * k, cur[1] * k, cur[2] * k
+	}
+	var l, a, b float64
+	if t.lab16 {
+		l = cur[0] * 65535 / 65280 * 100
+		a = cur[1]*65535/256 - 128
+		b = cur[2]*65535/256 - 128
+	} else {
+		l = cur[0] * 100
+		a = cur[1]*255 - 128
+		b = cur[2]*255 - 128
+	}
+	return labToXYZ(l, a, b)
+}
+
+// labToXYZ D50 白点
+func labToXYZ(l, a, b float64) (x, y, z float64) {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - b/200
+	finv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	return 0.9642 * finv(fx), finv(fy), 0.8249 * finv(fz)
+}
+
+// xyzToSRGB D50 的 XYZ 经 Bradford 变换到 D65，再转换为 sRGB
+func xyzToSRGB(x, y, z float64) (uint8, uint8, uint8) {
+	r := 3.1338561*x - 1.6168667*y - 0.4906146*z
+	g := -0.9787684*x + 1.9161415*y + 0.0334540*z
+	b := 0.0719453*x - 0.2289914*y + 1.4052427*z
+	gamma := func(v float64) uint8 {
+		v = clamp01(v)
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		return uint8(math.Round(v * 255))
+	}
+	return gamma(r), gamma(g), gamma(b)
+}
+
+// convertCMYK 按 profile 把 CMYK 图像转换为 sRGB，相同的颜色只计算一次
+func (t *iccTransform) convertCMYK(img *image.CMYK) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	in := make([]float64, 4)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.CMYKAt(x, y)
+			key := uint32(c.C)<<24 | uint32(c.M)<<16 | uint32(c.Y)<<8 | uint32(c.K)
+			rgb, ok := t.cache[key]
+			if !ok {
+				in[0], in[1], in[2], in[3] = float64(c.C)/255, float64(c.M)/255, float64(c.Y)/255, float64(c.K)/255
+				rgb[0], rgb[1], rgb[2] = xyzToSRGB(t.toPCS(in))
+				t.cache[key] = rgb
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255})
+		}
+	}
+	return dst
+}
+
+// getICCProfile 返回图像 /ColorSpace 中 ICCBased 的 profile 数据，没有时返回 nil
+func (p *PDF) getICCProfile(obj *Obj) []byte {
+	list, ok := p.resolve(p.getValueByKey(obj.Dict, "/ColorSpace")).([]interface{})
+	if !ok || len(list) < 2 {
+		return nil
+	}
+	if name, ok := list[0].(*NameObj); !ok || name.Name != "/ICCBased" {
+		return nil
+	}
+	stream, _ := p.resolve(list[1]).(*Obj)
+	if stream == nil || stream.Stream == nil {
+		return nil
+	}
+	data, _, err := p.decodeStream(stream)
+	if err != nil {
+		return nil
+	}
+	return data
+}
@@ -2,9 +2,13 @@ package pdf
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"image"
+	"image/color"
 	"image/jpeg"
 	"log"
+	"strings"
 
 	"golang.org/x/image/tiff"
 )
@@ -44,3 +48,417 @@ func CompressTIFFImage(data []byte) []byte {
 	log.Default().Printf("compress tiff %d ---> %d", len(data), buf.Len())
 	return buf.Bytes()
 }
+
+// colorSpace 图像的颜色空间
+type colorSpace struct {
+	Name   string // /DeviceGray /DeviceRGB /DeviceCMYK /Indexed /ICCBased ...
+	N      int    // 每个像素的分量数
+	Base   *colorSpace
+	HiVal  int    // Indexed 颜色表的最大下标
+	Lookup []byte // Indexed 颜色表
+}
+
+func (p *PDF) getColorSpace(value interface{}) (*colorSpace, error) {
+	switch v := p.resolve(value).(type) {
+	case *NameObj:
+		switch v.Name {
+		case "/DeviceGray", "/CalGray", "/G":
+			return &colorSpace{Name: "/DeviceGray", N: 1}, nil
+		case "/DeviceRGB", "/CalRGB", "/RGB":
+			return &colorSpace{Name: "/DeviceRGB", N: 3}, nil
+		case "/DeviceCMYK", "/CMYK":
+			return &colorSpace{Name: "/DeviceCMYK", N: 4}, nil
+		}
+		return nil, fmt.Errorf("unsupported color space: %s", v.Name)
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, errors.New("empty color space")
+		}
+		name, _ := v[0].(*NameObj)
+		if name == nil {
+			return nil, errors.New("expect color space name")
+		}
+		switch name.Name {
+		case "/CalGray", "/CalRGB", "/CalCMYK":
+			return p.getColorSpace(&NameObj{Name: name.Name})
+		case "/ICCBased":
+			if len(v) < 2 {
+				return nil, errors.New("expect ICC stream")
+			}
+			stream, _ := p.resolve(v[1]).(*Obj)
+			if stream == nil {
+				return nil, errors.New("expect ICC stream")
+			}
+			if alt := p.getValueByKey(stream.Dict, "/Alternate"); alt != nil {
+				cs, err := p.getColorSpace(alt)
+				if err == nil {
+					return cs, nil
+				}
+			}
+			switch p.getIntByKey(stream.Dict, "/N") {
+			case 1:
+				return &colorSpace{Name: "/DeviceGray", N: 1}, nil
+			case 4:
+				return &colorSpace{Name: "/DeviceCMYK", N: 4}, nil
+			}
+			return &colorSpace{Name: "/DeviceRGB", N: 3}, nil
+		case "/Indexed", "/I":
+			if len(v) < 4 {
+				return nil, errors.New("invalid indexed color space")
+			}
+			base, err := p.getColorSpace(v[1])
+			if err != nil {
+				return nil, err
+			}
+			hival, _ := p.resolve(v[2]).(int)
+			lookup, err := p.getStringBytes(v[3])
+			if err != nil {
+				return nil, err
+			}
+			return &colorSpace{Name: "/Indexed", N: 1, Base: base, HiVal: hival, Lookup: lookup}, nil
+		case "/Separation":
+			return &colorSpace{Name: "/Separation", N: 1}, nil
+		case "/DeviceN":
+			names, _ := p.resolve(v[1]).([]interface{})
+			return &colorSpace{Name: "/DeviceN", N: len(names)}, nil
+		}
+		return nil, fmt.Errorf("unsupported color space: %s", name.Name)
+	}
+	return nil, errors.New("unknown color space")
+}
+
+// getStringBytes 取字符串或者流对象的内容, 用于 Indexed 的颜色表等
+func (p *PDF) getStringBytes(value interface{}) ([]byte, error) {
+	switch v := p.resolve(value).(type) {
+	case string:
+		return decodePDFString(v), nil
+	case *Obj:
+		if v.Stream == nil {
+			return nil, errors.New("expect stream")
+		}
+		data, _, err := p.decodeStream(v)
+		return data, err
+	}
+	return nil, errors.New("expect string")
+}
+
+// decodePDFString 解码 (...) 或 <...> 形式的字符串
+func decodePDFString(str string) []byte {
+	if strings.HasPrefix(str, "<") {
+		buf, _ := asciiHexDecode([]byte(strings.TrimPrefix(str, "<")))
+		return buf
+	}
+	str = strings.TrimPrefix(str, "(")
+	str = strings.TrimSuffix(str, ")")
+	buf := make([]byte, 0, len(str))
+	for i := 0; i < len(str); i++ {
+		ch := str[i]
+		if ch != '\\' || i+1 >= len(str) {
+			buf = append(buf, ch)
+			continue
+		}
+		i++
+		switch ch = str[i]; ch {
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case '\r', '\n':
+			// 续行
+			if ch == '\r' && i+1 < len(str) && str[i+1] == '\n' {
+				i++
+			}
+		default:
+			if ch >= '0' && ch <= '7' {
+				v := 0
+				j := 0
+				for ; j < 3 && i+j < len(str) && str[i+j] >= '0' && str[i+j] <= '7'; j++ {
+					v = v*8 + int(str[i+j]-'0')
+				}
+				i += j - 1
+				buf = append(buf, byte(v))
+				continue
+			}
+			buf = append(buf, ch)
+		}
+	}
+	return buf
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// getDecodeArray 返回 /Decode 数组，没有时返回 nil
+func (p *PDF) getDecodeArray(obj *Obj) []float64 {
+	list, ok := p.resolve(p.getValueByKey(obj.Dict, "/Decode")).([]interface{})
+	if !ok {
+		return nil
+	}
+	decode := make([]float64, 0, len(list))
+	for _, item := range list {
+		f, ok := toFloat(p.resolve(item))
+		if !ok {
+			return nil
+		}
+		decode = append(decode, f)
+	}
+	return decode
+}
+
+// isDecodeInverted 判断 /Decode 是否为 [1 0 ...] 这种反转形式
+func (p *PDF) isDecodeInverted(obj *Obj) bool {
+	decode := p.getDecodeArray(obj)
+	return len(decode) >= 2 && decode[0] > decode[1]
+}
+
+// decodeImage 把图像对象解码为 image.Image，处理 /Decode、/ImageMask 以及 /SMask 透明通道
+func (p *PDF) decodeImage(obj *Obj) (image.Image, error) {
+	img, err := p.decodeImageColor(obj)
+	if err != nil {
+		return nil, err
+	}
+	smask, _ := p.resolve(p.getValueByKey(obj.Dict, "/SMask")).(*Obj)
+	if smask == nil || smask.Stream == nil {
+		return img, nil
+	}
+	alpha, err := p.decodeImageColor(smask)
+	if err != nil {
+		log.Default().Printf("decode smask %d %d err: %v", smask.ID, smask.GenID, err)
+		return img, nil
+	}
+	return applyAlpha(img, alpha), nil
+}
+
+// applyAlpha 把 alpha 的灰度作为 img 的透明通道, 尺寸不同时按最近邻缩放
+func applyAlpha(img, alpha image.Image) *image.NRGBA {
+	b := img.Bounds()
+	ab := alpha.Bounds()
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		ay := ab.Min.Y + (y-b.Min.Y)*ab.Dy()/b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			ax := ab.Min.X + (x-b.Min.X)*ab.Dx()/b.Dx()
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			c.A = color.GrayModel.Convert(alpha.At(ax, ay)).(color.Gray).Y
+			dst.SetNRGBA(x, y, c)
+		}
+	}
+	return dst
+}
+
+func (p *PDF) decodeImageColor(obj *Obj) (image.Image, error) {
+	data, filter, err := p.decodeStream(obj)
+	if err != nil {
+		return nil, err
+	}
+	width := p.getIntByKey(obj.Dict, "/Width")
+	height := p.getIntByKey(obj.Dict, "/Height")
+	var jpx *jpxImage
+	switch filter {
+	case "":
+	case "/DCTDecode":
+		img, err := decodeDCT(data)
+		if err != nil {
+			return nil, err
+		}
+		if p.isDecodeInverted(obj) {
+			// CMYK 的 JPEG 通常带 /Decode [1 0 1 0 1 0 1 0]
+			img = invertImage(img)
+		}
+		return img, nil
+	case "/CCITTFaxDecode":
+		gray, err := DecodeCCITT(data, p.getCCITTParams(obj))
+		if err != nil {
+			return nil, err
+		}
+		// 转回 1 bit 的采样数据，按普通图像处理 /Decode 和 /ImageMask
+		width, height = gray.Bounds().Dx(), gray.Bounds().Dy()
+		data = packBits(gray)
+	case "/JPXDecode":
+		jpx, err = decodeJPX(data)
+		if err != nil {
+			return nil, err
+		}
+		width, height = jpx.width, jpx.height
+	default:
+		return nil, fmt.Errorf("unsupported image filter: %s", filter)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("invalid image size")
+	}
+
+	imageMask := p.getBoolByKey(obj.Dict, "/ImageMask")
+	bpc := p.getIntByKey(obj.Dict, "/BitsPerComponent")
+	cs := &colorSpace{Name: "/DeviceGray", N: 1}
+	if imageMask || filter == "/CCITTFaxDecode" {
+		bpc = 1
+	}
+	if !imageMask {
+		if v := p.getValueByKey(obj.Dict, "/ColorSpace"); v != nil {
+			cs, err = p.getColorSpace(v)
+			if err != nil {
+				return nil, err
+			}
+		} else if jpx != nil {
+			cs = jpx.deviceColorSpace()
+		}
+	}
+	// 默认的 /Decode
+	decode := p.getDecodeArray(obj)
+	if jpx != nil {
+		// JPX 忽略 /Decode，采样统一转为 8 bit，Indexed 保留原始下标
+		bpc = 8
+		decode = nil
+		data = jpx.pixels(cs.N, cs.Name != "/Indexed")
+	}
+	if bpc == 0 {
+		bpc = 8
+	}
+	maxVal := float64(int(1)<<uint(bpc) - 1)
+	if len(decode) < 2*cs.N {
+		decode = make([]float64, 0, 2*cs.N)
+		for i := 0; i < cs.N; i++ {
+			if cs.Name == "/Indexed" {
+				decode = append(decode, 0, maxVal)
+			} else {
+				decode = append(decode, 0, 1)
+			}
+		}
+	}
+	rowLen := (width*cs.N*bpc + 7) / 8
+	if len(data) < rowLen*height {
+		// 数据不足时补0
+		data = append(data, make([]byte, rowLen*height-len(data))...)
+	}
+
+	rect := image.Rect(0, 0, width, height)
+	var gray *image.Gray
+	var rgba *image.NRGBA
+	var cmyk *image.CMYK
+	switch {
+	case imageMask:
+		rgba = image.NewNRGBA(rect)
+	case cs.Name == "/Indexed" || cs.N == 3:
+		rgba = image.NewNRGBA(rect)
+	case cs.N == 4:
+		cmyk = image.NewCMYK(rect)
+	default:
+		gray = image.NewGray(rect)
+	}
+	comps := make([]float64, cs.N)
+	for y := 0; y < height; y++ {
+		row := data[y*rowLen : (y+1)*rowLen]
+		for x := 0; x < width; x++ {
+			for c := 0; c < cs.N; c++ {
+				v := float64(readSample(row, x*cs.N+c, bpc))
+				comps[c] = decode[2*c] + v*(decode[2*c+1]-decode[2*c])/maxVal
+			}
+			switch {
+			case imageMask:
+				// 采样值为0的地方绘制
+				if comps[0] < 0.5 {
+					rgba.SetNRGBA(x, y, color.NRGBA{A: 255})
+				}
+			case cs.Name == "/Indexed":
+				rgba.SetNRGBA(x, y, cs.lookupColor(int(comps[0]+0.5)))
+			case cs.N == 3:
+				rgba.SetNRGBA(x, y, color.NRGBA{R: toByte(comps[0]), G: toByte(comps[1]), B: toByte(comps[2]), A: 255})
+			case cs.N == 4:
+				cmyk.SetCMYK(x, y, color.CMYK{C: toByte(comps[0]), M: toByte(comps[1]), Y: toByte(comps[2]), K: toByte(comps[3])})
+			case cs.Name == "/Separation" || cs.Name == "/DeviceN":
+				// 色调值为1时颜料最多，近似为黑色
+				gray.SetGray(x, y, color.Gray{Y: 255 - toByte(comps[0])})
+			default:
+				gray.SetGray(x, y, color.Gray{Y: toByte(comps[0])})
+			}
+		}
+	}
+	var img image.Image = rgba
+	switch {
+	case gray != nil:
+		img = gray
+	case cmyk != nil:
+		img = cmyk
+	}
+	if jpx != nil && p.getIntByKey(obj.Dict, "/SMaskInData") != 0 && len(jpx.comps) > cs.N {
+		// 码流中多出的分量是透明通道
+		alpha := image.NewGray(rect)
+		alpha.Pix = jpx.componentBytes(cs.N, true)
+		img = applyAlpha(img, alpha)
+	}
+	return img, nil
+}
+
+func (cs *colorSpace) lookupColor(idx int) color.NRGBA {
+	if idx > cs.HiVal {
+		idx = cs.HiVal
+	}
+	n := cs.Base.N
+	c := color.NRGBA{A: 255}
+	if (idx+1)*n > len(cs.Lookup) {
+		return c
+	}
+	v := cs.Lookup[idx*n : (idx+1)*n]
+	switch n {
+	case 1:
+		c.R, c.G, c.B = v[0], v[0], v[0]
+	case 3:
+		c.R, c.G, c.B = v[0], v[1], v[2]
+	case 4:
+		r, g, b := color.CMYKToRGB(v[0], v[1], v[2], v[3])
+		c.R, c.G, c.B = r, g, b
+	}
+	return c
+}
+
+// readSample 读取一行数据中第 idx 个采样值
+func readSample(row []byte, idx, bpc int) uint32 {
+	switch bpc {
+	case 8:
+		return uint32(row[idx])
+	case 16:
+		return uint32(row[2*idx])<<8 | uint32(row[2*idx+1])
+	}
+	bit := idx * bpc
+	v := uint32(row[bit/8]) >> uint(8-bpc-bit%8)
+	return v & (1<<uint(bpc) - 1)
+}
+
+func toByte(v float64) uint8 {
+	v = v*255 + 0.5
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+// packBits 把灰度图按 1 bit 打包，亮度大于等于128为1
+func packBits(img *image.Gray) []byte {
+	b := img.Bounds()
+	rowLen := (b.Dx() + 7) / 8
+	buf := make([]byte, rowLen*b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if img.Pix[y*img.Stride+x] >= 128 {
+				buf[y*rowLen+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return buf
+}
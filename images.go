@@ -0,0 +1,298 @@
+package pdf
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ImageInfo 文档中一个图像对象的描述信息
+type ImageInfo struct {
+	ID               int   // 对象序号
+	GenID            int   // 生产号
+	Pages            []int // 使用该图像的页码，从1开始
+	Width            int
+	Height           int
+	ColorSpace       string
+	BitsPerComponent int
+	Filter           string
+	Size             int  // 流数据的字节数
+	Inline           bool // 内嵌图像，ID 和 GenID 为所在内容流的对象
+	Index            int  // 内嵌图像在内容流中的序号，从0开始
+
+	pdf *PDF
+	obj *Obj
+}
+
+// ImageIter 图像迭代器，用法:
+//
+//	it := p.Images()
+//	for it.Next() {
+//		img := it.Image()
+//	}
+type ImageIter struct {
+	list []*ImageInfo
+	cur  *ImageInfo
+}
+
+func (it *ImageIter) Next() bool {
+	if len(it.list) == 0 {
+		it.cur = nil
+		return false
+	}
+	it.cur = it.list[0]
+	it.list = it.list[1:]
+	return true
+}
+
+func (it *ImageIter) Image() *ImageInfo {
+	return it.cur
+}
+
+// Images 返回文档中所有图像对象的迭代器
+func (p *PDF) Images() *ImageIter {
+	pages := p.imagePages()
+	list := make([]*ImageInfo, 0)
+	for _, obj := range p.Objects {
+		if !obj.IsImageStream() {
+			continue
+		}
+		info := p.newImageInfo(obj)
+		info.Pages = pages[obj]
+		list = append(list, info)
+	}
+	// 内嵌图像
+	type inlineKey struct {
+		obj   *Obj
+		index int
+	}
+	inlines := make(map[inlineKey]*ImageInfo)
+	p.inlineImages(func(cs *contentStream, content []byte, images []*InlineImage) {
+		for i, img := range images {
+			key := inlineKey{obj: cs.obj, index: i}
+			info := inlines[key]
+			if info == nil {
+				info = p.newImageInfo(img.obj())
+				info.ID, info.GenID = cs.obj.ID, cs.obj.GenID
+				info.Inline = true
+				info.Index = i
+				inlines[key] = info
+				list = append(list, info)
+			}
+			if n := len(info.Pages); n == 0 || info.Pages[n-1] != cs.page {
+				info.Pages = append(info.Pages, cs.page)
+			}
+		}
+	})
+	return &ImageIter{list: list}
+}
+
+func (p *PDF) newImageInfo(obj *Obj) *ImageInfo {
+	info := &ImageInfo{
+		ID:               obj.ID,
+		GenID:            obj.GenID,
+		Width:            p.getIntByKey(obj.Dict, "/Width"),
+		Height:           p.getIntByKey(obj.Dict, "/Height"),
+		BitsPerComponent: p.getIntByKey(obj.Dict, "/BitsPerComponent"),
+		Filter:           p.getFilterName(obj),
+		Size:             len(obj.Stream.data()),
+		pdf:              p,
+		obj:              obj,
+	}
+	switch v := p.resolve(p.getValueByKey(obj.Dict, "/ColorSpace")).(type) {
+	case *NameObj:
+		info.ColorSpace = v.Name
+	case []interface{}:
+		if len(v) > 0 {
+			if name, ok := v[0].(*NameObj); ok {
+				info.ColorSpace = name.Name
+			}
+		}
+	}
+	if p.getBoolByKey(obj.Dict, "/ImageMask") {
+		info.BitsPerComponent = 1
+	}
+	return info
+}
+
+// imagePages 统计每个图像对象被哪些页面使用
+func (p *PDF) imagePages() map[*Obj][]int {
+	pages := make(map[*Obj][]int)
+	num := 0
+	p.walkPages(func(page *Obj, resources []*Pair) {
+		num++
+		seen := make(map[*Obj]bool)
+		p.walkImages(resources, seen, func(img *Obj) {
+			pages[img] = append(pages[img], num)
+		})
+	})
+	return pages
+}
+
+// walkImages 遍历资源字典中的图像，包括 Form XObject 中嵌套的图像以及图像的 /SMask
+func (p *PDF) walkImages(resources []*Pair, seen map[*Obj]bool, fn func(img *Obj)) {
+	xobjects := p.getResolvedDict(resources, "/XObject")
+	for _, pair := range xobjects {
+		obj, _ := p.resolve(pair.Value).(*Obj)
+		if obj == nil || seen[obj] {
+			continue
+		}
+		seen[obj] = true
+		if obj.IsImageStream() {
+			fn(obj)
+			if smask, _ := p.resolve(p.getValueByKey(obj.Dict, "/SMask")).(*Obj); smask != nil && !seen[smask] {
+				seen[smask] = true
+				fn(smask)
+			}
+			continue
+		}
+		subtype := p.getNameObjByKey(obj.Dict, "/Subtype")
+		if subtype != nil && subtype.Name == "/Form" {
+			p.walkImages(p.getResolvedDict(obj.Dict, "/Resources"), seen, fn)
+		}
+	}
+}
+
+// Ext 导出图像时使用的文件扩展名
+func (info *ImageInfo) Ext() string {
+	switch info.Filter {
+	case "/DCTDecode":
+		return ".jpg"
+	case "/JPXDecode":
+		return ".jp2"
+	case "/CCITTFaxDecode":
+		return ".tif"
+	case "/JBIG2Decode":
+		return ".jb2"
+	}
+	return ".png"
+}
+
+// Extract 按图像的实际编码导出：DCT 和 JPX 原样输出为 jpg 和 jp2，
+// CCITT 输出为 tif，JBIG2 加上文件头和 /JBIG2Globals 输出为 jb2，
+// 其他的解码后输出为 png (处理 /Decode、/SMask 和 /ImageMask)
+func (info *ImageInfo) Extract(w io.Writer) error {
+	p, obj := info.pdf, info.obj
+	switch info.Filter {
+	case "/DCTDecode", "/JPXDecode":
+		data, _, err := p.decodeStream(obj)
+		if err != nil {
+			return err
+		}
+		if info.Filter == "/DCTDecode" && p.needCMYKFix(obj, data) {
+			// 单独的 CMYK JPEG 文件按 Adobe 的习惯保存反转的值，和 PDF 中的不一致时重新编码
+			img, err := p.decodeImageColor(obj)
+			if err != nil {
+				return err
+			}
+			if cmyk, ok := img.(*image.CMYK); ok {
+				return encodeCMYKJPEG(w, cmyk, 95)
+			}
+		}
+		_, err = w.Write(data)
+		return err
+	case "/CCITTFaxDecode":
+		img, err := p.decodeCCITTObj(obj)
+		if err != nil {
+			return err
+		}
+		if p.isDecodeInverted(obj) {
+			for i := range img.Pix {
+				img.Pix[i] = 255 - img.Pix[i]
+			}
+		}
+		return EncodeTIFF(w, img)
+	case "/JBIG2Decode":
+		data, _, err := p.decodeStream(obj)
+		if err != nil {
+			return err
+		}
+		return writeJBIG2File(w, p.getJBIG2Globals(obj), data)
+	}
+	img, err := p.decodeImage(obj)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// Image 解码为 image.Image
+func (info *ImageInfo) Image() (image.Image, error) {
+	return info.pdf.decodeImage(info.obj)
+}
+
+// ExportImages 把所有图像导出到 dir 目录，文件名为 <id>-<gen>.<ext>，
+// 内嵌图像为 <id>-<gen>-inline-<index>.<ext>
+func (p *PDF) ExportImages(dir string) error {
+	it := p.Images()
+	for it.Next() {
+		info := it.Image()
+		name := fmt.Sprintf("%d-%d", info.ID, info.GenID)
+		if info.Inline {
+			name = fmt.Sprintf("%d-%d-inline-%d", info.ID, info.GenID, info.Index)
+		}
+		file := filepath.Join(dir, name+info.Ext())
+		log.Default().Printf("export image obj %d %d to %s", info.ID, info.GenID, file)
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		err = info.Extract(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("extract image %d %d: %w", info.ID, info.GenID, err)
+		}
+	}
+	return nil
+}
+
+// needCMYKFix 判断 CMYK 的 JPEG 原样导出时颜色是否会反转。
+// 有 APP14 并且 /Decode 反转时，和常见看图软件的理解一致，可以原样导出
+func (p *PDF) needCMYKFix(obj *Obj, data []byte) bool {
+	info, err := parseJPEGInfo(data)
+	if err != nil || info.Components != 4 {
+		return false
+	}
+	return !(info.Adobe && p.isDecodeInverted(obj))
+}
+
+// jbig2FileID JBIG2 文件的标识，见 T.88 附录 D.4
+var jbig2FileID = []byte{0x97, 0x4a, 0x42, 0x32, 0x0d, 0x0a, 0x1a, 0x0a}
+
+// writeJBIG2File PDF 中的 JBIG2 是没有文件头的嵌入格式，
+// 加上顺序组织、单页的文件头，全局段放在页面数据之前
+func writeJBIG2File(w io.Writer, globals, data []byte) error {
+	header := append([]byte{}, jbig2FileID...)
+	header = append(header, 0x01, 0, 0, 0, 1)
+	for _, b := range [][]byte{header, globals, data} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getJBIG2Globals 取 /DecodeParms 中 /JBIG2Globals 流的内容
+func (p *PDF) getJBIG2Globals(obj *Obj) []byte {
+	names, parms := p.getFilters(obj)
+	for i, name := range names {
+		if name != "/JBIG2Decode" {
+			continue
+		}
+		globals, _ := p.resolve(p.getValueByKey(parms[i], "/JBIG2Globals")).(*Obj)
+		if globals == nil || globals.Stream == nil {
+			return nil
+		}
+		data, _, err := p.decodeStream(globals)
+		if err != nil {
+			log.Default().Printf("decode jbig2 globals %d %d err: %v", globals.ID, globals.GenID, err)
+			return nil
+		}
+		return data
+	}
+	return nil
+}
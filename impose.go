@@ -0,0 +1,190 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+)
+
+// 拼版: 把原来的页面转为 Form XObject，按网格缩放后放到新的纸张上
+
+// ImposeOptions 拼版的参数
+type ImposeOptions struct {
+	Columns     int     // 每张纸的列数，默认 2
+	Rows        int     // 每张纸的行数，默认 1
+	Width       float64 // 纸张的宽，为 0 时使用第一页的大小，网格是横向时把纸横过来
+	Height      float64
+	Margin      float64 // 纸张四周的边距
+	Gutter      float64 // 格子之间的间距
+	ColumnMajor bool    // 先从上到下再从左到右排列，默认先从左到右
+	RightToLeft bool    // 从右往左排列，用于竖排的书
+}
+
+func (opts *ImposeOptions) grid() (int, int) {
+	cols, rows := 2, 1
+	if opts != nil && opts.Columns > 0 {
+		cols = opts.Columns
+	}
+	if opts != nil && opts.Rows > 0 {
+		rows = opts.Rows
+	}
+	return cols, rows
+}
+
+// NUp 生成 N 合 1 的新文档，每张纸上按网格放 Columns x Rows 页
+func (p *PDF) NUp(opts *ImposeOptions) (*PDF, error) {
+	if opts == nil {
+		opts = &ImposeOptions{}
+	}
+	cols, rows := opts.grid()
+	n := p.NumPages()
+	per := cols * rows
+	sheets := make([][]int, 0, (n+per-1)/per)
+	for i := 0; i < n; i += per {
+		slots := make([]int, per)
+		for j := range slots {
+			slots[j] = -1
+			if i+j < n {
+				slots[j] = i + j
+			}
+		}
+		sheets = append(sheets, slots)
+	}
+	return p.impose(opts, cols, rows, sheets)
+}
+
+// Booklet 生成骑马钉小册子的拼版，每张纸的一面放两页，页数补齐到 4 的倍数。
+// 打印时双面打印后对折即可，Columns 和 Rows 不使用
+func (p *PDF) Booklet(opts *ImposeOptions) (*PDF, error) {
+	if opts == nil {
+		opts = &ImposeOptions{}
+	}
+	n := p.NumPages()
+	total := (n + 3) / 4 * 4
+	page := func(i int) int {
+		if i < n {
+			return i
+		}
+		return -1
+	}
+	sheets := make([][]int, 0, total/2)
+	for j := 0; j < total/2; j++ {
+		// 正面为 最后一页、第一页，背面为 第二页、倒数第二页，依次向中间
+		left, right := total-1-j, j
+		if j%2 == 1 {
+			left, right = j, total-1-j
+		}
+		sheets = append(sheets, []int{page(left), page(right)})
+	}
+	booklet := *opts
+	booklet.Columns, booklet.Rows = 2, 1
+	booklet.ColumnMajor = false
+	return p.impose(&booklet, 2, 1, sheets)
+}
+
+// impose 按 sheets 生成新文档，sheets 中每一项是一张纸上各个格子的页码 (从0开始)，-1 表示空白
+func (p *PDF) impose(opts *ImposeOptions, cols, rows int, sheets [][]int) (*PDF, error) {
+	pages := p.Pages()
+	if len(pages) == 0 {
+		return nil, errors.New("document has no pages")
+	}
+	width, height := opts.Width, opts.Height
+	if width <= 0 || height <= 0 {
+		width, height = pages[0].Size()
+		if cols != rows && (cols > rows) != (width > height) {
+			width, height = height, width
+		}
+	}
+	cellW := (width - 2*opts.Margin - float64(cols-1)*opts.Gutter) / float64(cols)
+	cellH := (height - 2*opts.Margin - float64(rows-1)*opts.Gutter) / float64(rows)
+	if cellW <= 0 || cellH <= 0 {
+		return nil, fmt.Errorf("margin and gutter are too large for %vx%v sheet", width, height)
+	}
+
+	doc := newDocument(p.Header)
+	c := newObjCopier(p, doc)
+	c.skipPageTree()
+	catalog, root := c.newPageTree()
+	forms := make(map[int]*Obj)
+	for _, slots := range sheets {
+		sheet := c.newObj()
+		sheet.Dict = []*Pair{
+			{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/Page"}},
+			{Key: &NameObj{Name: "/Parent"}, Value: objRef(root)},
+			{Key: &NameObj{Name: "/MediaBox"}, Value: Rect{0, 0, width, height}.array()},
+		}
+		xobjects := make([]*Pair, 0, len(slots))
+		content := make([]byte, 0)
+		for k, idx := range slots {
+			if idx < 0 || idx >= len(pages) {
+				continue
+			}
+			form := forms[idx]
+			if form == nil {
+				form = c.pageForm(pages[idx])
+				forms[idx] = form
+			}
+			col, row := k%cols, k/cols
+			if opts.ColumnMajor {
+				col, row = k/rows, k%rows
+			}
+			if opts.RightToLeft {
+				col = cols - 1 - col
+			}
+			// 第0行在最上面
+			cell := Rect{
+				LLX: opts.Margin + float64(col)*(cellW+opts.Gutter),
+				LLY: height - opts.Margin - float64(row+1)*cellH - float64(row)*opts.Gutter,
+			}
+			cell.URX, cell.URY = cell.LLX+cellW, cell.LLY+cellH
+			name := fmt.Sprintf("/P%d", k+1)
+			xobjects = append(xobjects, &Pair{Key: &NameObj{Name: name}, Value: objRef(form)})
+			content = append(content, fmt.Sprintf("q %s cm %s Do Q\n", placeMatrix(pages[idx], cell), name)...)
+		}
+		sheet.Dict = append(sheet.Dict, &Pair{Key: &NameObj{Name: "/Resources"}, Value: []*Pair{
+			{Key: &NameObj{Name: "/XObject"}, Value: xobjects},
+		}})
+		contents := c.newObj()
+		contents.Stream = &Stream{}
+		doc.setContentData(contents, content)
+		sheet.Dict = append(sheet.Dict, &Pair{Key: &NameObj{Name: "/Contents"}, Value: objRef(contents)})
+		doc.appendKid(root, sheet)
+	}
+	var info interface{}
+	if p.Trailer != nil {
+		info = c.copyValue(p.getValueByKey(p.Trailer.Dict, "/Info"))
+	}
+	doc.finishDocument(catalog, info)
+	log.Default().Printf("impose %d pages on %d sheets (%dx%d)", len(pages), len(sheets), cols, rows)
+	return doc, nil
+}
+
+// pageForm 把页面的内容和资源复制为 dst 中的 Form XObject，/BBox 为页面的 CropBox
+func (c *objCopier) pageForm(pg *Page) *Obj {
+	form := c.newObj()
+	form.Stream = &Stream{}
+	form.Dict = []*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/XObject"}},
+		{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Form"}},
+		{Key: &NameObj{Name: "/BBox"}, Value: pg.CropBox.array()},
+	}
+	if res := c.copyValue(c.src.inheritedValue(pg.obj, "/Resources")); res != nil {
+		form.Dict = append(form.Dict, &Pair{Key: &NameObj{Name: "/Resources"}, Value: res})
+	}
+	c.dst.setContentData(form, c.src.pageContentData(pg.obj))
+	return form
+}
+
+// placeMatrix 把页面按显示的方向缩放后居中放到 cell 中的变换矩阵
+func placeMatrix(pg *Page, cell Rect) matrix {
+	// 页面顺时针旋转 Rotate 度显示
+	theta := -float64(pg.Rotate) * math.Pi / 180
+	cos, sin := math.Round(math.Cos(theta)), math.Round(math.Sin(theta))
+	m := matrix{cos, sin, -sin, cos, 0, 0}
+	box := m.transformRect(pg.CropBox)
+	s := math.Min(cell.Width()/box.Width(), cell.Height()/box.Height())
+	dx := cell.LLX + (cell.Width()-box.Width()*s)/2
+	dy := cell.LLY + (cell.Height()-box.Height()*s)/2
+	return m.multiply(matrix{s, 0, 0, s, -box.LLX * s, -box.LLY * s}).multiply(matrix{1, 0, 0, 1, dx, dy})
+}
@@ -0,0 +1,365 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// 内嵌图像字典的缩写，参考 PDF 规范 8.9.7 Inline Images
+var inlineImageKeys = map[string]string{
+	"/BPC": "/BitsPerComponent",
+	"/CS":  "/ColorSpace",
+	"/D":   "/Decode",
+	"/DP":  "/DecodeParms",
+	"/F":   "/Filter",
+	"/H":   "/Height",
+	"/IM":  "/ImageMask",
+	"/I":   "/Interpolate",
+	"/W":   "/Width",
+	"/L":   "/Length",
+}
+
+var inlineImageValues = map[string]string{
+	"/G":    "/DeviceGray",
+	"/RGB":  "/DeviceRGB",
+	"/CMYK": "/DeviceCMYK",
+	"/I":    "/Indexed",
+	"/AHx":  "/ASCIIHexDecode",
+	"/A85":  "/ASCII85Decode",
+	"/LZW":  "/LZWDecode",
+	"/Fl":   "/FlateDecode",
+	"/RL":   "/RunLengthDecode",
+	"/CCF":  "/CCITTFaxDecode",
+	"/DCT":  "/DCTDecode",
+}
+
+// InlineImage 内容流中 BI ... ID ... EI 形式的内嵌图像
+type InlineImage struct {
+	Dict  []*Pair // 展开缩写后的图像字典
+	Data  []byte  // ID 和 EI 之间的数据
+	Start int     // BI 在解码后的内容流中的位置
+	End   int     // EI 之后的位置
+}
+
+// obj 把内嵌图像包装成图像对象，复用图像对象的解码逻辑
+func (img *InlineImage) obj() *Obj {
+	obj := &Obj{Dict: img.Dict, Stream: &Stream{}}
+	obj.Stream.setData(img.Data)
+	return obj
+}
+
+// parseInlineImages 从解码后的内容流中找出所有内嵌图像
+func parseInlineImages(content []byte) ([]*InlineImage, error) {
+	list := make([]*InlineImage, 0)
+	l := newLexer(content)
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return list, err
+		}
+		if tok.typ == tokenEOF {
+			return list, nil
+		}
+		if tok.typ != tokenKeyword || tok.value != "BI" {
+			continue
+		}
+		img, err := l.readInlineImage(tok.start)
+		if err != nil {
+			return list, err
+		}
+		list = append(list, img)
+	}
+}
+
+// readInlineImage 读取 BI 之后的图像字典和数据
+func (l *lexer) readInlineImage(start int) (*InlineImage, error) {
+	dict, err := l.readDictBody(tokenKeyword)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.typ != tokenKeyword || tok.value != "ID" {
+		return nil, errors.New("expect ID")
+	}
+	// ID 后面紧跟一个空白字符，然后是图像数据
+	l.pos++
+	dict = expandInlineDict(dict)
+	size := inlineImageSize(dict)
+	end := -1
+	if size > 0 && l.pos+size <= len(l.data) {
+		end = l.pos + size
+	} else {
+		end = findInlineImageEnd(l.data, l.pos)
+	}
+	if end < 0 {
+		return nil, errors.New("expect EI")
+	}
+	img := &InlineImage{Dict: dict, Data: l.data[l.pos:end], Start: start}
+	l.pos = end
+	tok, err = l.next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.typ != tokenKeyword || tok.value != "EI" {
+		return nil, errors.New("expect EI")
+	}
+	img.End = l.pos
+	return img, nil
+}
+
+// expandInlineDict 把字典中的缩写展开为完整的名字
+func expandInlineDict(dict []*Pair) []*Pair {
+	list := make([]*Pair, 0, len(dict))
+	for _, pair := range dict {
+		key := pair.Key.Name
+		if full, ok := inlineImageKeys[key]; ok {
+			key = full
+		}
+		value := pair.Value
+		if key == "/ColorSpace" || key == "/Filter" {
+			value = expandInlineValue(value)
+		}
+		list = append(list, &Pair{Key: &NameObj{Name: key}, Value: value})
+	}
+	return list
+}
+
+func expandInlineValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *NameObj:
+		if full, ok := inlineImageValues[v.Name]; ok {
+			return &NameObj{Name: full}
+		}
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = expandInlineValue(item)
+		}
+		return list
+	}
+	return value
+}
+
+// inlineImageSize 根据图像字典计算数据的长度，有过滤器或者无法确定时返回 -1
+func inlineImageSize(dict []*Pair) int {
+	// 只用到字典的辅助方法
+	p := &PDF{}
+	if length := p.getIntByKey(dict, "/Length"); length > 0 {
+		return length
+	}
+	if p.getValueByKey(dict, "/Filter") != nil {
+		return -1
+	}
+	comps := 0
+	if p.getBoolByKey(dict, "/ImageMask") {
+		comps = 1
+	}
+	switch v := p.getValueByKey(dict, "/ColorSpace").(type) {
+	case *NameObj:
+		switch v.Name {
+		case "/DeviceGray":
+			comps = 1
+		case "/DeviceRGB":
+			comps = 3
+		case "/DeviceCMYK":
+			comps = 4
+		}
+	case []interface{}:
+		if name, ok := v[0].(*NameObj); ok && name.Name == "/Indexed" {
+			comps = 1
+		}
+	}
+	bpc := p.getIntByKey(dict, "/BitsPerComponent")
+	if comps == 1 && bpc == 0 {
+		bpc = 1
+	}
+	width := p.getIntByKey(dict, "/Width")
+	height := p.getIntByKey(dict, "/Height")
+	if comps == 0 || bpc == 0 || width <= 0 || height <= 0 {
+		return -1
+	}
+	return (width*comps*bpc + 7) / 8 * height
+}
+
+// findInlineImageEnd 查找前后都是空白字符的 EI，后面的内容还必须像是正常的内容流，
+// 避免把图像数据中恰好出现的 EI 当作结束
+func findInlineImageEnd(data []byte, start int) int {
+	pos := start
+	for {
+		idx := bytes.Index(data[pos:], []byte("EI"))
+		if idx < 0 {
+			return -1
+		}
+		idx += pos
+		pos = idx + 2
+		if idx == start || !isWhiteSpace(data[idx-1]) {
+			continue
+		}
+		if pos < len(data) && !isWhiteSpace(data[pos]) {
+			continue
+		}
+		next := pos + 32
+		if next > len(data) {
+			next = len(data)
+		}
+		if !isPlainText(data[pos:next]) {
+			continue
+		}
+		return idx - 1
+	}
+}
+
+func isPlainText(buf []byte) bool {
+	for _, b := range buf {
+		if b >= 0x7f || (b < 0x20 && !isWhiteSpace(b)) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveInlineColorSpace 内嵌图像的颜色空间可以是页面资源 /ColorSpace 中的名字，替换为实际的值
+func (p *PDF) resolveInlineColorSpace(img *InlineImage, resources []*Pair) {
+	for _, pair := range img.Dict {
+		if pair.Key.Name != "/ColorSpace" {
+			continue
+		}
+		name, ok := pair.Value.(*NameObj)
+		if !ok {
+			continue
+		}
+		if cs := p.getValueByKey(p.getResolvedDict(resources, "/ColorSpace"), name.Name); cs != nil {
+			pair.Value = cs
+		}
+	}
+}
+
+// inlineImages 遍历所有内容流中的内嵌图像
+func (p *PDF) inlineImages(fn func(cs *contentStream, content []byte, images []*InlineImage)) {
+	p.walkContentStreams(func(cs *contentStream) {
+		content, _, err := p.decodeStream(cs.obj)
+		if err != nil || !bytes.Contains(content, []byte("BI")) {
+			return
+		}
+		images, err := parseInlineImages(content)
+		if err != nil {
+			log.Default().Printf("parse inline image in obj %d %d err: %v", cs.obj.ID, cs.obj.GenID, err)
+		}
+		if len(images) == 0 {
+			return
+		}
+		for _, img := range images {
+			p.resolveInlineColorSpace(img, cs.resources)
+		}
+		fn(cs, content, images)
+	})
+}
+
+// ConvertInlineImages 把数据不小于 minSize 字节的内嵌图像转换为图像 XObject，
+// 这样压缩时也能处理它们。返回转换的图像个数
+func (p *PDF) ConvertInlineImages(minSize int) int {
+	// 多个页面可以共用一个内容流，先找出每个内容流的所有资源字典，
+	// 转换后的 XObject 要加到每一个中
+	type conversion struct {
+		obj     *Obj
+		content []byte
+		images  []*InlineImage
+		owners  []*Obj
+	}
+	list := make([]*conversion, 0)
+	byObj := make(map[*Obj]*conversion)
+	p.inlineImages(func(cs *contentStream, content []byte, images []*InlineImage) {
+		c := byObj[cs.obj]
+		if c == nil {
+			c = &conversion{obj: cs.obj, content: content, images: images}
+			byObj[cs.obj] = c
+			list = append(list, c)
+		}
+		for _, owner := range c.owners {
+			if owner == cs.owner {
+				return
+			}
+		}
+		c.owners = append(c.owners, cs.owner)
+	})
+	cnt := 0
+	for _, c := range list {
+		buf := bytes.Buffer{}
+		last := 0
+		for _, img := range c.images {
+			if len(img.Data) < minSize {
+				continue
+			}
+			name := p.sharedXObjectName(c.owners, "/InlineIm")
+			dict := []*Pair{
+				{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/XObject"}},
+				{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Image"}},
+			}
+			data := img.Data
+			for _, pair := range img.Dict {
+				if pair.Key.Name != "/Length" {
+					dict = append(dict, pair)
+				}
+			}
+			if p.getValueByKey(img.Dict, "/Filter") == nil {
+				data = flateEncode(data)
+				dict = append(dict, &Pair{Key: &NameObj{Name: "/Filter"}, Value: &NameObj{Name: "/FlateDecode"}})
+			}
+			xobj := p.newStreamObj(dict, data)
+			for _, owner := range c.owners {
+				p.setDictPath(&owner.Dict, []string{"/Resources", "/XObject", name}, &Obj{ID: xobj.ID, GenID: xobj.GenID})
+			}
+
+			buf.Write(c.content[last:img.Start])
+			buf.WriteString(name + " Do")
+			last = img.End
+			cnt++
+		}
+		if last == 0 {
+			continue
+		}
+		buf.Write(c.content[last:])
+		p.setContentData(c.obj, buf.Bytes())
+	}
+	log.Default().Printf("convert %d inline images", cnt)
+	return cnt
+}
+
+// sharedXObjectName 生成在 owners 的资源字典中都没有用过的 XObject 名字
+func (p *PDF) sharedXObjectName(owners []*Obj, prefix string) string {
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		used := false
+		for _, owner := range owners {
+			res := p.getResolvedDict(owner.Dict, "/Resources")
+			if p.getValueByKey(p.getResolvedDict(res, "/XObject"), name) != nil {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return name
+		}
+	}
+}
+
+// newXObjectName 生成资源字典中没有用过的 XObject 名字
+func (p *PDF) newXObjectName(resources []*Pair, prefix string) string {
+	return p.newResourceName(resources, "/XObject", prefix)
+}
+
+// newResourceName 生成资源字典的 category 子字典 (如 /Font) 中没有用过的名字
+func (p *PDF) newResourceName(resources []*Pair, category, prefix string) string {
+	dict := p.getResolvedDict(resources, category)
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		if p.getValueByKey(dict, name) == nil {
+			return name
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+// JPEG 标记段的解析，按 PDF DCTDecode 的语义解码，以及 CMYK JPEG 的编码
+
+const (
+	jpegSOI   = 0xd8
+	jpegEOI   = 0xd9
+	jpegSOS   = 0xda
+	jpegAPP14 = 0xee
+)
+
+// jpegInfo JPEG 文件头中的信息
+type jpegInfo struct {
+	Width       int
+	Height      int
+	Components  int
+	Progressive bool
+	Adobe       bool // 有 Adobe APP14 标记段
+	Transform   int  // APP14 中的颜色变换: 0 无变换(RGB/CMYK), 1 YCbCr, 2 YCCK
+}
+
+// parseJPEGInfo 扫描 JPEG 的标记段，读到 SOF 为止
+func parseJPEGInfo(data []byte) (*jpegInfo, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != jpegSOI {
+		return nil, errors.New("expect jpeg SOI")
+	}
+	info := &jpegInfo{}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xff {
+			return nil, errors.New("expect jpeg marker")
+		}
+		marker := data[pos+1]
+		if marker == 0xff {
+			// 填充字节
+			pos++
+			continue
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		seg := data[pos+4:]
+		if size < 2 || len(seg) < size-2 {
+			return nil, errors.New("invalid jpeg segment")
+		}
+		seg = seg[:size-2]
+		switch {
+		case marker == jpegAPP14 && len(seg) >= 12 && bytes.HasPrefix(seg, []byte("Adobe")):
+			info.Adobe = true
+			info.Transform = int(seg[11])
+		case marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc:
+			if len(seg) < 6 {
+				return nil, errors.New("invalid jpeg SOF")
+			}
+			info.Height = int(binary.BigEndian.Uint16(seg[1:]))
+			info.Width = int(binary.BigEndian.Uint16(seg[3:]))
+			info.Components = int(seg[5])
+			info.Progressive = marker == 0xc2 || marker == 0xc6 || marker == 0xca || marker == 0xce
+			return info, nil
+		case marker == jpegSOS || marker == jpegEOI:
+			return nil, errors.New("jpeg SOF not found")
+		}
+		pos += 2 + size
+	}
+	return nil, errors.New("jpeg SOF not found")
+}
+
+// adobeSegment APP14 标记段，transform 为 0 表示数据就是 CMYK
+func adobeSegment(transform byte) []byte {
+	return []byte{0xff, jpegAPP14, 0, 14, 'A', 'd', 'o', 'b', 'e', 0, 100, 0, 0, 0, 0, transform}
+}
+
+// decodeDCT 解码 DCT 数据，返回和 PDF DCTDecode 一致的采样值 (还没有处理 /Decode)。
+// Go 的解码器按 Adobe 的习惯把 4 分量的 JPEG 反转 (255 为无油墨)，这里反转回来；
+// 没有 APP14 的 CMYK JPEG，Go 不能解码，插入一个 transform 为 0 的 APP14 再解码
+func decodeDCT(data []byte) (image.Image, error) {
+	info, err := parseJPEGInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	if info.Components == 4 && !info.Adobe {
+		buf := make([]byte, 0, len(data)+16)
+		buf = append(buf, data[:2]...)
+		buf = append(buf, adobeSegment(0)...)
+		data = append(buf, data[2:]...)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cmyk, ok := img.(*image.CMYK); ok {
+		for i := range cmyk.Pix {
+			cmyk.Pix[i] = 255 - cmyk.Pix[i]
+		}
+	}
+	return img, nil
+}
+
+// invertImage 反转每个颜色分量，用于 /Decode [1 0 ...]
+func invertImage(img image.Image) image.Image {
+	switch v := img.(type) {
+	case *image.Gray:
+		for i := range v.Pix {
+			v.Pix[i] = 255 - v.Pix[i]
+		}
+		return v
+	case *image.CMYK:
+		for i := range v.Pix {
+			v.Pix[i] = 255 - v.Pix[i]
+		}
+		return v
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			dst.SetNRGBA(x, y, color.NRGBA{R: 255 - c.R, G: 255 - c.G, B: 255 - c.B, A: c.A})
+		}
+	}
+	return dst
+}
+
+// cmykToRGB 用简单公式把 CMYK 转换为 RGB
+func cmykToRGB(img *image.CMYK) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.CMYKAt(x, y)
+			r, g, bl := color.CMYKToRGB(c.C, c.M, c.Y, c.K)
+			dst.SetRGBA(x, y, color.RGBA{R: r, G: g, B: bl, A: 255})
+		}
+	}
+	return dst
+}
+
+// 下面是一个简单的 baseline JPEG 编码器，只用于 Go 的 image/jpeg 不支持的 CMYK 图像。
+// 量化表和 Huffman 表使用 JPEG 规范附录 K 中的标准亮度表
+
+// 标准亮度量化表，zigzag 顺序
+var jpegLumaQuant = [64]byte{
+	16, 11, 12, 14, 12, 10, 16, 14,
+	13, 14, 18, 17, 16, 19, 24, 40,
+	26, 24, 22, 22, 24, 49, 35, 37,
+	29, 40, 58, 51, 61, 60, 57, 51,
+	56, 55, 64, 72, 92, 78, 64, 68,
+	87, 69, 55, 56, 80, 109, 81, 87,
+	95, 98, 103, 104, 103, 62, 77, 113,
+	121, 112, 100, 120, 92, 101, 103, 99,
+}
+
+// zigzag 顺序到 8x8 块中自然顺序的下标
+var jpegZigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// jpegHuffmanSpec 按码长统计的个数以及对应的值，和 DHT 标记段的格式一致
+type jpegHuffmanSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+var jpegLumaDC = jpegHuffmanSpec{
+	[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+	[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+}
+
+var jpegLumaAC = jpegHuffmanSpec{
+	[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+	[]byte{
+		0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+		0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+		0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+		0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+		0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+		0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+		0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+		0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+		0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+		0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+		0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+		0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+		0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+		0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+		0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+		0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+		0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+		0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+		0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+		0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+		0xf9, 0xfa,
+	},
+}
+
+// jpegCode 一个 Huffman 码字
+type jpegCode struct {
+	code uint32
+	size uint
+}
+
+// codes 按规范 C.2 生成每个值对应的码字
+func (spec *jpegHuffmanSpec) codes() map[byte]jpegCode {
+	codes := make(map[byte]jpegCode, len(spec.values))
+	code := uint32(0)
+	k := 0
+	for i, n := range spec.counts {
+		for j := 0; j < int(n); j++ {
+			codes[spec.values[k]] = jpegCode{code: code, size: uint(i + 1)}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+// jpegBitWriter 写熵编码数据，0xff 后面补 0x00
+type jpegBitWriter struct {
+	w     *bufio.Writer
+	bits  uint32
+	nbits uint
+}
+
+func (w *jpegBitWriter) emit(bits uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.bits = w.bits<<1 | (bits>>uint(i))&1
+		w.nbits++
+		if w.nbits == 8 {
+			b := byte(w.bits)
+			w.w.WriteByte(b)
+			if b == 0xff {
+				w.w.WriteByte(0)
+			}
+			w.bits, w.nbits = 0, 0
+		}
+	}
+}
+
+// flush 用1填充到字节边界
+func (w *jpegBitWriter) flush() {
+	for w.nbits != 0 {
+		w.emit(1, 1)
+	}
+}
+
+// jpegCategory 返回 v 的位数以及附加位
+func jpegCategory(v int) (uint, uint32) {
+	a := v
+	if a < 0 {
+		a = -a
+		v--
+	}
+	n := uint(0)
+	for a > 0 {
+		n++
+		a >>= 1
+	}
+	return n, uint32(v) & (1<<n - 1)
+}
+
+// scaledQuant 按质量缩放量化表，和 libjpeg 的算法一致
+func scaledQuant(quality int) [64]int {
+	if quality < 1 {
+		quality = 1
+	}
+	if quality > 100 {
+		quality = 100
+	}
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var q [64]int
+	for i, v := range jpegLumaQuant {
+		x := (int(v)*scale + 50) / 100
+		if x < 1 {
+			x = 1
+		}
+		if x > 255 {
+			x = 255
+		}
+		q[i] = x
+	}
+	return q
+}
+
+var jpegCosTable = func() [8][8]float64 {
+	var t [8][8]float64
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			c := 1.0
+			if u == 0 {
+				c = 1 / math.Sqrt2
+			}
+			t[x][u] = c * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16) / 2
+		}
+	}
+	return t
+}()
+
+// fdct 二维离散余弦变换，先按行再按列
+func fdct(block *[64]float64) {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			s := 0.0
+			for x := 0; x < 8; x++ {
+				s += block[y*8+x] * jpegCosTable[x][u]
+			}
+			tmp[y*8+u] = s
+		}
+	}
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			s := 0.0
+			for y := 0; y < 8; y++ {
+				s += tmp[y*8+u] * jpegCosTable[y][v]
+			}
+			block[v*8+u] = s
+		}
+	}
+}
+
+// encodeCMYKJPEG 把 CMYK 图像编码为 4 分量的 baseline JPEG。
+// 按 Adobe 的习惯写入 APP14 并保存反转后的值，PDF 中需要配合 /Decode [1 0 1 0 1 0 1 0] 使用
+func encodeCMYKJPEG(w io.Writer, img *image.CMYK, quality int) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= 0 || height <= 0 || width > 65535 || height > 65535 {
+		return errors.New("invalid jpeg size")
+	}
+	quant := scaledQuant(quality)
+	bw := bufio.NewWriter(w)
+
+	bw.Write([]byte{0xff, jpegSOI})
+	bw.Write(adobeSegment(0))
+	// DQT
+	bw.Write([]byte{0xff, 0xdb, 0, 67, 0})
+	for _, q := range quant {
+		bw.WriteByte(byte(q))
+	}
+	// SOF0, 4 个分量都不做采样，使用同一个量化表
+	bw.Write([]byte{0xff, 0xc0, 0, 8 + 3*4, 8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), 4})
+	for i := 1; i <= 4; i++ {
+		bw.Write([]byte{byte(i), 0x11, 0})
+	}
+	// DHT
+	for _, t := range []struct {
+		class byte
+		spec  *jpegHuffmanSpec
+	}{{0x00, &jpegLumaDC}, {0x10, &jpegLumaAC}} {
+		size := 2 + 1 + 16 + len(t.spec.values)
+		bw.Write([]byte{0xff, 0xc4, byte(size >> 8), byte(size), t.class})
+		bw.Write(t.spec.counts[:])
+		bw.Write(t.spec.values)
+	}
+	// SOS
+	bw.Write([]byte{0xff, jpegSOS, 0, 6 + 2*4, 4})
+	for i := 1; i <= 4; i++ {
+		bw.Write([]byte{byte(i), 0x00})
+	}
+	bw.Write([]byte{0, 63, 0})
+
+	dcCodes := jpegLumaDC.codes()
+	acCodes := jpegLumaAC.codes()
+	ew := &jpegBitWriter{w: bw}
+	var prevDC [4]int
+	var block [64]float64
+	for by := 0; by < height; by += 8 {
+		for bx := 0; bx < width; bx += 8 {
+			for c := 0; c < 4; c++ {
+				for y := 0; y < 8; y++ {
+					sy := by + y
+					if sy >= height {
+						sy = height - 1
+					}
+					for x := 0; x < 8; x++ {
+						sx := bx + x
+						if sx >= width {
+							sx = width - 1
+						}
+						v := img.Pix[img.PixOffset(b.Min.X+sx, b.Min.Y+sy)+c]
+						block[y*8+x] = float64(255-v) - 128
+					}
+				}
+				fdct(&block)
+				// 量化，按 zigzag 顺序
+				var coef [64]int
+				for i := 0; i < 64; i++ {
+					coef[i] = int(math.Round(block[jpegZigzag[i]] / float64(quant[i])))
+				}
+				// DC
+				diff := coef[0] - prevDC[c]
+				prevDC[c] = coef[0]
+				n, bits := jpegCategory(diff)
+				code := dcCodes[byte(n)]
+				ew.emit(code.code, code.size)
+				ew.emit(bits, n)
+				// AC
+				run := 0
+				for i := 1; i < 64; i++ {
+					if coef[i] == 0 {
+						run++
+						continue
+					}
+					for run > 15 {
+						code := acCodes[0xf0]
+						ew.emit(code.code, code.size)
+						run -= 16
+					}
+					n, bits := jpegCategory(coef[i])
+					code := acCodes[byte(run<<4)|byte(n)]
+					ew.emit(code.code, code.size)
+					ew.emit(bits, n)
+					run = 0
+				}
+				if run > 0 {
+					code := acCodes[0x00]
+					ew.emit(code.code, code.size)
+				}
+			}
+		}
+	}
+	ew.flush()
+	bw.Write([]byte{0xff, jpegEOI})
+	return bw.Flush()
+}
@@ -0,0 +1,887 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// JPEG 的无损优化: 只解出量化后的 DCT 系数，去掉多余的 APP 标记段，
+// 用统计出来的最优 Huffman 表重新做熵编码，可以输出为渐进式。图像数据完全不变。
+// 参考 ITU-T T.81 附录 F、G 和 K.2
+
+// jpegComponent 一个颜色分量，系数按 zigzag 顺序保存，块数按 MCU 补齐
+type jpegComponent struct {
+	id, h, v, tq int
+	bw, bh       int // 补齐后每行、每列的块数
+	blocks       [][64]int32
+}
+
+// jpegCoeffs 解出的 JPEG 系数以及需要原样保留的标记段
+type jpegCoeffs struct {
+	sof           byte
+	precision     int
+	width, height int
+	comps         []*jpegComponent
+	hmax, vmax    int
+	mcusX, mcusY  int
+	dqt           [][]byte // 完整的 DQT 标记段
+	keep          [][]byte // 需要保留的 APP 标记段
+}
+
+// jpegHuffmanDecoder 规范 F.2.2.3 的 Huffman 解码表
+type jpegHuffmanDecoder struct {
+	maxcode [17]int
+	valptr  [17]int
+	mincode [17]int
+	values  []byte
+}
+
+func newJPEGHuffmanDecoder(counts []byte, values []byte) *jpegHuffmanDecoder {
+	d := &jpegHuffmanDecoder{values: values}
+	code, k := 0, 0
+	for l := 1; l <= 16; l++ {
+		n := int(counts[l-1])
+		d.valptr[l] = k
+		d.mincode[l] = code
+		code += n
+		k += n
+		d.maxcode[l] = code - 1
+		if n == 0 {
+			d.maxcode[l] = -1
+		}
+		code <<= 1
+	}
+	return d
+}
+
+// jpegBitReader 读熵编码数据，处理 0xff00 以及遇到标记时补0
+type jpegBitReader struct {
+	data   []byte
+	pos    int
+	bits   uint32
+	nbits  uint
+	marker bool
+}
+
+func (r *jpegBitReader) readBit() (int, error) {
+	if r.nbits == 0 {
+		b := byte(0)
+		if !r.marker {
+			if r.pos >= len(r.data) {
+				return 0, errors.New("unexpected end of jpeg data")
+			}
+			b = r.data[r.pos]
+			if b == 0xff {
+				if r.pos+1 < len(r.data) && r.data[r.pos+1] == 0 {
+					r.pos += 2
+				} else {
+					r.marker = true
+					b = 0
+				}
+			} else {
+				r.pos++
+			}
+		}
+		r.bits, r.nbits = uint32(b), 8
+	}
+	r.nbits--
+	return int(r.bits>>r.nbits) & 1, nil
+}
+
+func (r *jpegBitReader) receive(n int) (int, error) {
+	v := 0
+	for i := 0; i < n; i++ {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | b
+	}
+	return v, nil
+}
+
+// receiveExtend 读 n 位附加位并按规范 F.2.2.1 还原符号
+func (r *jpegBitReader) receiveExtend(n int) (int, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	v, err := r.receive(n)
+	if err != nil {
+		return 0, err
+	}
+	if v < 1<<uint(n-1) {
+		v += -1<<uint(n) + 1
+	}
+	return v, nil
+}
+
+func (r *jpegBitReader) decode(d *jpegHuffmanDecoder) (byte, error) {
+	if d == nil {
+		return 0, errors.New("jpeg huffman table not defined")
+	}
+	code := 0
+	for l := 1; l <= 16; l++ {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		code = code<<1 | b
+		if code <= d.maxcode[l] {
+			i := d.valptr[l] + code - d.mincode[l]
+			if i >= len(d.values) {
+				break
+			}
+			return d.values[i], nil
+		}
+	}
+	return 0, errors.New("invalid jpeg huffman code")
+}
+
+// restart 跳过 RSTn 标记，丢掉不足一个字节的位
+func (r *jpegBitReader) restart() error {
+	r.nbits = 0
+	r.marker = false
+	for r.pos+1 < len(r.data) && !(r.data[r.pos] == 0xff && r.data[r.pos+1] >= 0xd0 && r.data[r.pos+1] <= 0xd7) {
+		r.pos++
+	}
+	if r.pos+1 >= len(r.data) {
+		return errors.New("jpeg RST marker not found")
+	}
+	r.pos += 2
+	return nil
+}
+
+// end 返回熵编码数据之后下一个标记的位置
+func (r *jpegBitReader) end() int {
+	pos := r.pos
+	for pos+1 < len(r.data) {
+		if r.data[pos] == 0xff && r.data[pos+1] != 0 && !(r.data[pos+1] >= 0xd0 && r.data[pos+1] <= 0xd7) {
+			return pos
+		}
+		pos++
+	}
+	return len(r.data)
+}
+
+// readJPEGCoeffs 解析 JPEG，解出所有分量的 DCT 系数。
+// 只支持 Huffman 编码的顺序式和渐进式，keepICC 为 false 时去掉 APP2 中的 ICC profile
+func readJPEGCoeffs(data []byte, keepICC bool) (*jpegCoeffs, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != jpegSOI {
+		return nil, errors.New("expect jpeg SOI")
+	}
+	jc := &jpegCoeffs{}
+	var dc, ac [4]*jpegHuffmanDecoder
+	restartInterval := 0
+	pos := 2
+	for pos+2 <= len(data) {
+		if data[pos] != 0xff {
+			return nil, errors.New("expect jpeg marker")
+		}
+		marker := data[pos+1]
+		if marker == 0xff {
+			pos++
+			continue
+		}
+		if marker == jpegEOI {
+			break
+		}
+		if pos+4 > len(data) {
+			return nil, errors.New("invalid jpeg segment")
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if size < 2 || pos+2+size > len(data) {
+			return nil, errors.New("invalid jpeg segment")
+		}
+		full := data[pos : pos+2+size]
+		seg := full[4:]
+		pos += 2 + size
+		switch {
+		case marker == 0xc0 || marker == 0xc1 || marker == 0xc2:
+			if err := jc.parseSOF(marker, seg); err != nil {
+				return nil, err
+			}
+		case marker >= 0xc3 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc:
+			return nil, fmt.Errorf("unsupported jpeg SOF marker: %#x", marker)
+		case marker == 0xc4:
+			for len(seg) >= 17 {
+				class, id := seg[0]>>4, seg[0]&3
+				n := 0
+				for _, c := range seg[1:17] {
+					n += int(c)
+				}
+				if len(seg) < 17+n {
+					return nil, errors.New("invalid jpeg DHT")
+				}
+				d := newJPEGHuffmanDecoder(seg[1:17], seg[17:17+n])
+				if class == 0 {
+					dc[id] = d
+				} else {
+					ac[id] = d
+				}
+				seg = seg[17+n:]
+			}
+		case marker == 0xdb:
+			jc.dqt = append(jc.dqt, full)
+		case marker == 0xdd:
+			if len(seg) < 2 {
+				return nil, errors.New("invalid jpeg DRI")
+			}
+			restartInterval = int(binary.BigEndian.Uint16(seg))
+		case marker == jpegAPP14 && bytes.HasPrefix(seg, []byte("Adobe")):
+			jc.keep = append(jc.keep, full)
+		case marker == 0xe2 && bytes.HasPrefix(seg, []byte("ICC_PROFILE\x00")):
+			if keepICC {
+				jc.keep = append(jc.keep, full)
+			}
+		case marker == jpegSOS:
+			if jc.comps == nil {
+				return nil, errors.New("jpeg SOS before SOF")
+			}
+			r := &jpegBitReader{data: data, pos: pos}
+			if err := jc.decodeScan(seg, r, dc, ac, restartInterval); err != nil {
+				return nil, err
+			}
+			pos = r.end()
+		}
+		// 其他 APP、COM 等标记段丢掉
+	}
+	if jc.comps == nil {
+		return nil, errors.New("jpeg SOF not found")
+	}
+	return jc, nil
+}
+
+func (jc *jpegCoeffs) parseSOF(marker byte, seg []byte) error {
+	if len(seg) < 6 {
+		return errors.New("invalid jpeg SOF")
+	}
+	jc.sof = marker
+	jc.precision = int(seg[0])
+	jc.height = int(binary.BigEndian.Uint16(seg[1:]))
+	jc.width = int(binary.BigEndian.Uint16(seg[3:]))
+	n := int(seg[5])
+	if len(seg) < 6+3*n || n == 0 || n > 4 || jc.width == 0 || jc.height == 0 {
+		return errors.New("invalid jpeg SOF")
+	}
+	jc.hmax, jc.vmax = 1, 1
+	for i := 0; i < n; i++ {
+		b := seg[6+3*i:]
+		c := &jpegComponent{id: int(b[0]), h: int(b[1] >> 4), v: int(b[1] & 15), tq: int(b[2])}
+		if c.h < 1 || c.h > 4 || c.v < 1 || c.v > 4 {
+			return errors.New("invalid jpeg sampling factor")
+		}
+		jc.hmax = maxInt(jc.hmax, c.h)
+		jc.vmax = maxInt(jc.vmax, c.v)
+		jc.comps = append(jc.comps, c)
+	}
+	jc.mcusX = ceilDiv(jc.width, 8*jc.hmax)
+	jc.mcusY = ceilDiv(jc.height, 8*jc.vmax)
+	for _, c := range jc.comps {
+		c.bw, c.bh = jc.mcusX*c.h, jc.mcusY*c.v
+		c.blocks = make([][64]int32, c.bw*c.bh)
+	}
+	return nil
+}
+
+// scanBlocks 非交错扫描时分量实际的块数
+func (jc *jpegCoeffs) scanBlocks(c *jpegComponent) (int, int) {
+	w := ceilDiv(jc.width*c.h, jc.hmax)
+	h := ceilDiv(jc.height*c.v, jc.vmax)
+	return ceilDiv(w, 8), ceilDiv(h, 8)
+}
+
+// jpegScan 一次扫描的参数
+type jpegScan struct {
+	comps          []int // 分量下标
+	dc, ac         []int // 每个分量使用的 Huffman 表
+	ss, se, ah, al int
+}
+
+// eachBlock 按扫描的顺序遍历块，fn 的参数为分量在扫描中的序号和块，
+// mcu 在每个 MCU 开始前调用，用于处理 restart
+func (jc *jpegCoeffs) eachBlock(scan *jpegScan, mcu func(n int) error, fn func(i int, blk *[64]int32) error) error {
+	if len(scan.comps) == 1 {
+		c := jc.comps[scan.comps[0]]
+		w, h := jc.scanBlocks(c)
+		n := 0
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if err := mcu(n); err != nil {
+					return err
+				}
+				n++
+				if err := fn(0, &c.blocks[y*c.bw+x]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	n := 0
+	for my := 0; my < jc.mcusY; my++ {
+		for mx := 0; mx < jc.mcusX; mx++ {
+			if err := mcu(n); err != nil {
+				return err
+			}
+			n++
+			for i, ci := range scan.comps {
+				c := jc.comps[ci]
+				for v := 0; v < c.v; v++ {
+					for h := 0; h < c.h; h++ {
+						if err := fn(i, &c.blocks[(my*c.v+v)*c.bw+mx*c.h+h]); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (jc *jpegCoeffs) parseSOS(seg []byte) (*jpegScan, error) {
+	if len(seg) < 1 {
+		return nil, errors.New("invalid jpeg SOS")
+	}
+	n := int(seg[0])
+	if n == 0 || n > 4 || len(seg) < 1+2*n+3 {
+		return nil, errors.New("invalid jpeg SOS")
+	}
+	scan := &jpegScan{}
+	for i := 0; i < n; i++ {
+		id := int(seg[1+2*i])
+		ci := -1
+		for j, c := range jc.comps {
+			if c.id == id {
+				ci = j
+			}
+		}
+		if ci < 0 {
+			return nil, fmt.Errorf("unknown jpeg component %d", id)
+		}
+		scan.comps = append(scan.comps, ci)
+		scan.dc = append(scan.dc, int(seg[2+2*i]>>4)&3)
+		scan.ac = append(scan.ac, int(seg[2+2*i]&3))
+	}
+	b := seg[1+2*n:]
+	scan.ss, scan.se, scan.ah, scan.al = int(b[0]), int(b[1]), int(b[2]>>4), int(b[2]&15)
+	if jc.sof != 0xc2 {
+		scan.ss, scan.se, scan.ah, scan.al = 0, 63, 0, 0
+	}
+	if scan.ss > scan.se || scan.se > 63 {
+		return nil, errors.New("invalid jpeg spectral selection")
+	}
+	return scan, nil
+}
+
+// decodeScan 解码一次扫描的熵编码数据
+func (jc *jpegCoeffs) decodeScan(seg []byte, r *jpegBitReader, dc, ac [4]*jpegHuffmanDecoder, restartInterval int) error {
+	scan, err := jc.parseSOS(seg)
+	if err != nil {
+		return err
+	}
+	preds := make([]int, len(scan.comps))
+	eobrun := 0
+	mcu := func(n int) error {
+		if restartInterval == 0 || n == 0 || n%restartInterval != 0 {
+			return nil
+		}
+		for i := range preds {
+			preds[i] = 0
+		}
+		eobrun = 0
+		return r.restart()
+	}
+	return jc.eachBlock(scan, mcu, func(i int, blk *[64]int32) error {
+		var err error
+		switch {
+		case jc.sof != 0xc2:
+			err = decodeJPEGBlock(r, blk, dc[scan.dc[i]], ac[scan.ac[i]], &preds[i])
+		case scan.ss == 0 && scan.ah == 0:
+			var diff int
+			t, e := r.decode(dc[scan.dc[i]])
+			if e != nil {
+				return e
+			}
+			diff, err = r.receiveExtend(int(t))
+			preds[i] += diff
+			blk[0] = int32(preds[i] << uint(scan.al))
+		case scan.ss == 0:
+			var bit int
+			bit, err = r.readBit()
+			if bit == 1 {
+				blk[0] |= 1 << uint(scan.al)
+			}
+		case scan.ah == 0:
+			err = decodeJPEGACFirst(r, blk, ac[scan.ac[i]], scan, &eobrun)
+		default:
+			err = decodeJPEGACRefine(r, blk, ac[scan.ac[i]], scan, &eobrun)
+		}
+		return err
+	})
+}
+
+// decodeJPEGBlock 顺序式的一个块
+func decodeJPEGBlock(r *jpegBitReader, blk *[64]int32, dc, ac *jpegHuffmanDecoder, pred *int) error {
+	t, err := r.decode(dc)
+	if err != nil {
+		return err
+	}
+	diff, err := r.receiveExtend(int(t))
+	if err != nil {
+		return err
+	}
+	*pred += diff
+	blk[0] = int32(*pred)
+	for k := 1; k < 64; k++ {
+		rs, err := r.decode(ac)
+		if err != nil {
+			return err
+		}
+		run, s := int(rs>>4), int(rs&15)
+		if s == 0 {
+			if run != 15 {
+				break
+			}
+			k += 15
+			continue
+		}
+		k += run
+		if k > 63 {
+			return errors.New("invalid jpeg AC run")
+		}
+		v, err := r.receiveExtend(s)
+		if err != nil {
+			return err
+		}
+		blk[k] = int32(v)
+	}
+	return nil
+}
+
+// decodeJPEGACFirst 渐进式 AC 的第一次扫描 (G.1.2.2)
+func decodeJPEGACFirst(r *jpegBitReader, blk *[64]int32, ac *jpegHuffmanDecoder, scan *jpegScan, eobrun *int) error {
+	if *eobrun > 0 {
+		*eobrun--
+		return nil
+	}
+	for k := scan.ss; k <= scan.se; k++ {
+		rs, err := r.decode(ac)
+		if err != nil {
+			return err
+		}
+		run, s := int(rs>>4), int(rs&15)
+		if s == 0 {
+			if run != 15 {
+				*eobrun = 1<<uint(run) - 1
+				if run > 0 {
+					v, err := r.receive(run)
+					if err != nil {
+						return err
+					}
+					*eobrun += v
+				}
+				break
+			}
+			k += 15
+			continue
+		}
+		k += run
+		if k > 63 {
+			return errors.New("invalid jpeg AC run")
+		}
+		v, err := r.receiveExtend(s)
+		if err != nil {
+			return err
+		}
+		blk[k] = int32(v << uint(scan.al))
+	}
+	return nil
+}
+
+// decodeJPEGACRefine 渐进式 AC 的细化扫描 (G.1.2.3)，和 libjpeg 的 decode_mcu_AC_refine 一致
+func decodeJPEGACRefine(r *jpegBitReader, blk *[64]int32, ac *jpegHuffmanDecoder, scan *jpegScan, eobrun *int) error {
+	p1 := int32(1) << uint(scan.al)
+	m1 := int32(-1) << uint(scan.al)
+	refine := func(coef *int32) error {
+		bit, err := r.readBit()
+		if err != nil {
+			return err
+		}
+		if bit == 1 && *coef&p1 == 0 {
+			if *coef >= 0 {
+				*coef += p1
+			} else {
+				*coef += m1
+			}
+		}
+		return nil
+	}
+	k := scan.ss
+	if *eobrun == 0 {
+		for ; k <= scan.se; k++ {
+			rs, err := r.decode(ac)
+			if err != nil {
+				return err
+			}
+			run, s := int(rs>>4), int32(rs&15)
+			if s != 0 {
+				bit, err := r.readBit()
+				if err != nil {
+					return err
+				}
+				if bit == 1 {
+					s = p1
+				} else {
+					s = m1
+				}
+			} else if run != 15 {
+				*eobrun = 1 << uint(run)
+				if run > 0 {
+					v, err := r.receive(run)
+					if err != nil {
+						return err
+					}
+					*eobrun += v
+				}
+				break
+			}
+			// 跳过 run 个值为0的系数，其间已经非0的系数读一位细化
+			for ; k <= scan.se; k++ {
+				if blk[k] != 0 {
+					if err := refine(&blk[k]); err != nil {
+						return err
+					}
+				} else {
+					run--
+					if run < 0 {
+						break
+					}
+				}
+			}
+			if s != 0 && k <= scan.se {
+				blk[k] = s
+			}
+		}
+	}
+	if *eobrun > 0 {
+		for ; k <= scan.se; k++ {
+			if blk[k] != 0 {
+				if err := refine(&blk[k]); err != nil {
+					return err
+				}
+			}
+		}
+		*eobrun--
+	}
+	return nil
+}
+
+// jpegSymbolSink 熵编码的输出，统计频率和真正写数据共用同一套编码流程
+type jpegSymbolSink interface {
+	symbol(table int, sym byte)
+	bits(v uint32, n uint)
+}
+
+// jpegFreqCounter 统计每个 Huffman 表中符号的频率
+type jpegFreqCounter struct {
+	freq [][257]int
+}
+
+func (c *jpegFreqCounter) symbol(table int, sym byte) {
+	c.freq[table][sym]++
+}
+
+func (c *jpegFreqCounter) bits(v uint32, n uint) {}
+
+// jpegSymbolWriter 用生成的码表写熵编码数据
+type jpegSymbolWriter struct {
+	codes []map[byte]jpegCode
+	w     *jpegBitWriter
+}
+
+func (s *jpegSymbolWriter) symbol(table int, sym byte) {
+	code := s.codes[table][sym]
+	s.w.emit(code.code, code.size)
+}
+
+func (s *jpegSymbolWriter) bits(v uint32, n uint) {
+	s.w.emit(v, n)
+}
+
+// optimalHuffman 按规范 K.2 由频率生成码长不超过 16 的 Huffman 表
+func optimalHuffman(freq [257]int) *jpegHuffmanSpec {
+	// 保留一个频率为1的符号，保证不会出现全1的码字
+	freq[256] = 1
+	var codesize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+	for {
+		// 频率最小的两个，频率相同时取值较大的
+		v1, v2 := -1, -1
+		for i := 0; i < 257; i++ {
+			if freq[i] > 0 && (v1 < 0 || freq[i] <= freq[v1]) {
+				v1 = i
+			}
+		}
+		for i := 0; i < 257; i++ {
+			if freq[i] > 0 && i != v1 && (v2 < 0 || freq[i] <= freq[v2]) {
+				v2 = i
+			}
+		}
+		if v2 < 0 {
+			break
+		}
+		freq[v1] += freq[v2]
+		freq[v2] = 0
+		codesize[v1]++
+		for others[v1] >= 0 {
+			v1 = others[v1]
+			codesize[v1]++
+		}
+		others[v1] = v2
+		codesize[v2]++
+		for others[v2] >= 0 {
+			v2 = others[v2]
+			codesize[v2]++
+		}
+	}
+	var bits [33]int
+	for _, n := range codesize {
+		if n > 0 {
+			bits[minInt(n, 32)]++
+		}
+	}
+	// 码长限制在 16 以内
+	for i := 32; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+	// 去掉保留的符号
+	i := 16
+	for bits[i] == 0 {
+		i--
+	}
+	bits[i]--
+	spec := &jpegHuffmanSpec{}
+	for l := 1; l <= 16; l++ {
+		spec.counts[l-1] = byte(bits[l])
+	}
+	for l := 1; l <= 32; l++ {
+		for sym := 0; sym < 256; sym++ {
+			if codesize[sym] == l {
+				spec.values = append(spec.values, byte(sym))
+			}
+		}
+	}
+	return spec
+}
+
+// encodeJPEGDC DC 差值的编码
+func encodeJPEGDC(sink jpegSymbolSink, table int, diff int) {
+	n, bits := jpegCategory(diff)
+	sink.symbol(table, byte(n))
+	sink.bits(bits, n)
+}
+
+// encodeJPEGAC 顺序式一个块的 AC 系数
+func encodeJPEGAC(sink jpegSymbolSink, table int, blk *[64]int32) {
+	run := 0
+	for k := 1; k < 64; k++ {
+		if blk[k] == 0 {
+			run++
+			continue
+		}
+		for run > 15 {
+			sink.symbol(table, 0xf0)
+			run -= 16
+		}
+		n, bits := jpegCategory(int(blk[k]))
+		sink.symbol(table, byte(run<<4)|byte(n))
+		sink.bits(bits, n)
+		run = 0
+	}
+	if run > 0 {
+		sink.symbol(table, 0x00)
+	}
+}
+
+// encodeScan 对一次扫描做熵编码，渐进式只用 spectral selection，al 总是 0
+func (jc *jpegCoeffs) encodeScan(sink jpegSymbolSink, scan *jpegScan, progressive bool) {
+	preds := make([]int, len(scan.comps))
+	eobrun := 0
+	flushEOB := func() {
+		if eobrun == 0 {
+			return
+		}
+		n := uint(floorLog2(eobrun))
+		sink.symbol(scan.ac[0], byte(n<<4))
+		sink.bits(uint32(eobrun), n)
+		eobrun = 0
+	}
+	noRestart := func(int) error { return nil }
+	jc.eachBlock(scan, noRestart, func(i int, blk *[64]int32) error {
+		if scan.ss == 0 {
+			diff := int(blk[0]) - preds[i]
+			preds[i] = int(blk[0])
+			encodeJPEGDC(sink, scan.dc[i], diff)
+			if !progressive {
+				encodeJPEGAC(sink, scan.ac[i], blk)
+			}
+			return nil
+		}
+		run := 0
+		for k := scan.ss; k <= scan.se; k++ {
+			if blk[k] == 0 {
+				run++
+				continue
+			}
+			flushEOB()
+			for run > 15 {
+				sink.symbol(scan.ac[i], 0xf0)
+				run -= 16
+			}
+			n, bits := jpegCategory(int(blk[k]))
+			sink.symbol(scan.ac[i], byte(run<<4)|byte(n))
+			sink.bits(bits, n)
+			run = 0
+		}
+		if run > 0 {
+			eobrun++
+			if eobrun == 0x7fff {
+				flushEOB()
+			}
+		}
+		return nil
+	})
+	flushEOB()
+}
+
+// scans 输出时的扫描顺序。顺序式为一次交错扫描；渐进式先是所有分量的 DC，
+// 然后每个分量分 1-5 和 6-63 两段 AC，和 libjpeg 的 jpeg_simple_progression 类似
+func (jc *jpegCoeffs) scans(progressive bool) []*jpegScan {
+	all := &jpegScan{se: 63}
+	for i := range jc.comps {
+		all.comps = append(all.comps, i)
+		// 第一个分量用表 0，其他分量共用表 1
+		t := minInt(i, 1)
+		all.dc = append(all.dc, t)
+		all.ac = append(all.ac, t)
+	}
+	if !progressive {
+		return []*jpegScan{all}
+	}
+	all.se = 0
+	scans := []*jpegScan{all}
+	for i := range jc.comps {
+		for _, band := range [][2]int{{1, 5}, {6, 63}} {
+			scans = append(scans, &jpegScan{comps: []int{i}, dc: []int{0}, ac: []int{0}, ss: band[0], se: band[1]})
+		}
+	}
+	return scans
+}
+
+// write 输出优化后的 JPEG
+func (jc *jpegCoeffs) write(progressive bool) ([]byte, error) {
+	out := &bytes.Buffer{}
+	bw := bufio.NewWriter(out)
+	bw.Write([]byte{0xff, jpegSOI})
+	for _, seg := range jc.keep {
+		bw.Write(seg)
+	}
+	for _, seg := range jc.dqt {
+		bw.Write(seg)
+	}
+	sof := jc.sof
+	switch {
+	case progressive:
+		sof = 0xc2
+	case sof == 0xc2 && jc.precision == 8:
+		sof = 0xc0
+	case sof == 0xc2:
+		sof = 0xc1
+	}
+	n := len(jc.comps)
+	bw.Write([]byte{0xff, sof, 0, byte(8 + 3*n), byte(jc.precision),
+		byte(jc.height >> 8), byte(jc.height), byte(jc.width >> 8), byte(jc.width), byte(n)})
+	for _, c := range jc.comps {
+		bw.Write([]byte{byte(c.id), byte(c.h<<4 | c.v), byte(c.tq)})
+	}
+	for _, scan := range jc.scans(progressive) {
+		// AC 表的序号加 2，和 DC 表区分开
+		acScan := *scan
+		acScan.ac = make([]int, len(scan.ac))
+		for i, t := range scan.ac {
+			acScan.ac[i] = t + 2
+		}
+		// 第一遍统计频率，生成最优的 Huffman 表
+		counter := &jpegFreqCounter{freq: make([][257]int, 4)}
+		jc.encodeScan(counter, &acScan, progressive)
+		writer := &jpegSymbolWriter{codes: make([]map[byte]jpegCode, 4), w: &jpegBitWriter{w: bw}}
+		for t := 0; t < 2; t++ {
+			for class := 0; class < 2; class++ {
+				if class == 0 && scan.ss != 0 || class == 1 && scan.se == 0 {
+					continue
+				}
+				table := t
+				if class == 1 {
+					table = t + 2
+				}
+				freq := counter.freq[table]
+				used := false
+				for _, f := range freq {
+					if f > 0 {
+						used = true
+						break
+					}
+				}
+				if !used {
+					continue
+				}
+				spec := optimalHuffman(freq)
+				writer.codes[table] = spec.codes()
+				size := 2 + 1 + 16 + len(spec.values)
+				bw.Write([]byte{0xff, 0xc4, byte(size >> 8), byte(size), byte(class<<4 | t)})
+				bw.Write(spec.counts[:])
+				bw.Write(spec.values)
+			}
+		}
+		bw.Write([]byte{0xff, jpegSOS, 0, byte(6 + 2*len(scan.comps)), byte(len(scan.comps))})
+		for i, ci := range scan.comps {
+			bw.Write([]byte{byte(jc.comps[ci].id), byte(scan.dc[i]<<4 | scan.ac[i])})
+		}
+		bw.Write([]byte{byte(scan.ss), byte(scan.se), 0})
+		jc.encodeScan(writer, &acScan, progressive)
+		writer.w.flush()
+	}
+	bw.Write([]byte{0xff, jpegEOI})
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// OptimizeJPEG 无损优化 JPEG: 去掉 EXIF、缩略图、XMP 等 APP 标记段和注释，
+// 重新生成最优的 Huffman 表，DCT 系数不变，解码出来的图像和原来完全一样。
+// progressive 为 true 时输出渐进式，keepICC 为 false 时同时去掉 ICC profile。
+// 保留 Adobe APP14，它决定了颜色变换
+func OptimizeJPEG(data []byte, progressive, keepICC bool) ([]byte, error) {
+	jc, err := readJPEGCoeffs(data, keepICC)
+	if err != nil {
+		return nil, err
+	}
+	return jc.write(progressive)
+}
@@ -0,0 +1,164 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"path/filepath"
+	"testing"
+)
+
+// testJPEG 生成一个 JPEG，在 SOI 后面插入 extra 中的标记段
+func testJPEG(t *testing.T, img image.Image, quality int, extra ...[]byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	out := append([]byte{}, data[:2]...)
+	for _, seg := range extra {
+		out = append(out, seg...)
+	}
+	return append(out, data[2:]...)
+}
+
+// jpegSegment 一个 APPn 标记段
+func jpegSegment(marker byte, body string) []byte {
+	n := len(body) + 2
+	return append([]byte{0xff, marker, byte(n >> 8), byte(n)}, body...)
+}
+
+func sameJPEGPixels(t *testing.T, a, b []byte) {
+	t.Helper()
+	ia, err := jpeg.Decode(bytes.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ib, err := jpeg.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ia.Bounds() != ib.Bounds() {
+		t.Fatalf("bounds %v, want %v", ib.Bounds(), ia.Bounds())
+	}
+	bd := ia.Bounds()
+	for y := bd.Min.Y; y < bd.Max.Y; y++ {
+		for x := bd.Min.X; x < bd.Max.X; x++ {
+			if ia.At(x, y) != ib.At(x, y) {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, ib.At(x, y), ia.At(x, y))
+			}
+		}
+	}
+}
+
+func TestOptimizeJPEG(t *testing.T) {
+	rgb := image.NewRGBA(image.Rect(0, 0, 101, 67))
+	for y := 0; y < 67; y++ {
+		for x := 0; x < 101; x++ {
+			rgb.Set(x, y, color.RGBA{uint8(x * 3), uint8(y*5 + x), uint8(x ^ y), 255})
+		}
+	}
+	gray := image.NewGray(image.Rect(0, 0, 9, 17))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 7)
+	}
+	exif := jpegSegment(0xe1, "Exif\x00\x00"+string(make([]byte, 300)))
+	xmp := jpegSegment(0xe1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")
+	icc := jpegSegment(0xe2, "ICC_PROFILE\x00\x01\x01"+string(make([]byte, 200)))
+	for _, in := range [][]byte{
+		testJPEG(t, rgb, 85, exif, xmp, icc),
+		testJPEG(t, gray, 60, exif),
+	} {
+		for _, progressive := range []bool{false, true} {
+			for _, keepICC := range []bool{false, true} {
+				out, err := OptimizeJPEG(in, progressive, keepICC)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(out) >= len(in) {
+					t.Errorf("progressive %v: %d bytes, input %d", progressive, len(out), len(in))
+				}
+				sameJPEGPixels(t, in, out)
+				if bytes.Contains(out, []byte("Exif")) || bytes.Contains(out, []byte("xmpmeta")) {
+					t.Error("APP1 segments are not removed")
+				}
+				if hasICC := bytes.Contains(out, []byte("ICC_PROFILE")); hasICC != (keepICC && bytes.Contains(in, []byte("ICC_PROFILE"))) {
+					t.Errorf("keepICC %v: ICC profile present %v", keepICC, hasICC)
+				}
+				if isProgressive := bytes.Contains(out, []byte{0xff, 0xc2}); isProgressive != progressive {
+					t.Errorf("progressive %v: output has SOF2 %v", progressive, isProgressive)
+				}
+			}
+		}
+	}
+}
+
+func TestCompressDCTDefaultLossless(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), 128, 255})
+		}
+	}
+	data := testJPEG(t, img, 95, jpegSegment(0xe1, "Exif\x00\x00"+string(make([]byte, 300))))
+	for _, c := range []struct {
+		opts  *CompressOptions
+		lossy bool
+	}{
+		{nil, false},
+		{&CompressOptions{Quality: 10}, false},
+		{&CompressOptions{Quality: 10, Lossy: true}, true},
+	} {
+		p := &PDF{}
+		obj := p.newStreamObj([]*Pair{
+			{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/XObject"}},
+			{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Image"}},
+			{Key: &NameObj{Name: "/Width"}, Value: 64},
+			{Key: &NameObj{Name: "/Height"}, Value: 48},
+			{Key: &NameObj{Name: "/ColorSpace"}, Value: &NameObj{Name: "/DeviceRGB"}},
+			{Key: &NameObj{Name: "/BitsPerComponent"}, Value: 8},
+			{Key: &NameObj{Name: "/Filter"}, Value: &NameObj{Name: "/DCTDecode"}},
+		}, data)
+		if reason := p.compressOneImage(obj, c.opts); reason != "" {
+			t.Fatalf("lossy %v: skipped %v", c.lossy, reason)
+		}
+		out := obj.Stream.data()
+		if len(out) >= len(data) {
+			t.Fatalf("lossy %v: %d bytes, input %d", c.lossy, len(out), len(data))
+		}
+		if !c.lossy {
+			sameJPEGPixels(t, data, out)
+		}
+	}
+}
+
+func TestSaveFileWithReport(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), 128, 255})
+		}
+	}
+	data := testJPEG(t, img, 95, jpegSegment(0xe1, "Exif\x00\x00"+string(make([]byte, 300))))
+	p := testPDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 64 48] /Resources << /XObject << /Im1 4 0 R >> >> >>",
+		testStream("/Type /XObject /Subtype /Image /Width 64 /Height 48 /ColorSpace /DeviceRGB "+
+			"/BitsPerComponent 8 /Filter /DCTDecode", string(data)),
+	})
+	report, err := p.SaveFileWithReport(filepath.Join(t.TempDir(), "out.pdf"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report == nil || len(report.Images) != 1 || report.NewSize >= report.OldSize {
+		t.Fatalf("report %+v", report)
+	}
+	if r := report.Images[0]; r.ID != 4 || r.Skipped != "" {
+		t.Errorf("image report %+v", r)
+	}
+	// 默认不重新编码，像素不变
+	sameJPEGPixels(t, data, p.getObj(&Obj{ID: 4}).Stream.data())
+}
@@ -0,0 +1,1356 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// JPEG 2000 (JPXDecode) 的解码，参考 ITU-T T.800。
+// 支持 JP2 文件格式和裸码流、多个 tile、五种渐进顺序、5/3 和 9/7 小波、RCT 和 ICT 分量变换。
+// 不支持 ROI、PPM/PPT 打包的包头以及 selective arithmetic coding bypass
+
+const (
+	jpxSOC = 0xff4f
+	jpxSIZ = 0xff51
+	jpxCOD = 0xff52
+	jpxCOC = 0xff53
+	jpxQCD = 0xff5c
+	jpxQCC = 0xff5d
+	jpxSOT = 0xff90
+	jpxSOP = 0xff91
+	jpxEPH = 0xff92
+	jpxSOD = 0xff93
+	jpxEOC = 0xffd9
+	jpxPPM = 0xff60
+	jpxPPT = 0xff61
+)
+
+// 渐进顺序
+const (
+	jpxLRCP = iota
+	jpxRLCP
+	jpxRPCL
+	jpxPCRL
+	jpxCPRL
+)
+
+type jpxComponent struct {
+	precision int
+	signed    bool
+	dx, dy    int
+}
+
+// jpxCoding COD 或 COC 中的编码参数
+type jpxCoding struct {
+	levels     int
+	cbw, cbh   int // 码块大小的指数
+	style      int
+	reversible bool
+	precincts  []int // 每个分辨率的 PPx | PPy<<4，nil 表示最大
+}
+
+// jpxQuant QCD 或 QCC 中的量化参数
+type jpxQuant struct {
+	style int // 0 不量化, 1 scalar derived, 2 scalar expounded
+	guard int
+	steps [][2]int // 指数和尾数
+}
+
+// jpxCodingStyle COD 中和分量无关的部分
+type jpxCodingStyle struct {
+	progression int
+	layers      int
+	mct         bool
+	sop         bool
+	eph         bool
+}
+
+// jpxHeader 主头或者 tile 头中的参数，tile 头中没有的使用主头的
+type jpxHeader struct {
+	style  *jpxCodingStyle
+	coding *jpxCoding
+	coc    map[int]*jpxCoding
+	quant  *jpxQuant
+	qcc    map[int]*jpxQuant
+}
+
+type jpxTile struct {
+	header jpxHeader
+	data   []byte // 所有 tile-part 的数据
+}
+
+type jpxCodestream struct {
+	x0, y0, x1, y1 int
+	tileW, tileH   int
+	tx0, ty0       int
+	comps          []jpxComponent
+	header         jpxHeader
+	tiles          map[int]*jpxTile
+}
+
+// jpxImage 解码结果，每个分量已经还原到整幅图像的大小
+type jpxImage struct {
+	width, height int
+	comps         []jpxComponent
+	samples       [][]float64 // 已经做了电平位移，范围为 0 到 2^precision-1
+	colorSpace    int         // JP2 colr 中的枚举值，没有时为 0
+}
+
+// decodeJPX 解码 JP2 文件或者 JPEG 2000 码流
+func decodeJPX(data []byte) (*jpxImage, error) {
+	colorSpace := 0
+	if len(data) >= 2 && binary.BigEndian.Uint16(data) != jpxSOC {
+		var err error
+		data, colorSpace, err = parseJP2(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cs, err := parseJPXCodestream(data)
+	if err != nil {
+		return nil, err
+	}
+	img, err := cs.decode()
+	if err != nil {
+		return nil, err
+	}
+	img.colorSpace = colorSpace
+	return img, nil
+}
+
+// parseJP2 遍历 JP2 的 box，返回 jp2c 中的码流以及 colr 中的颜色空间
+func parseJP2(data []byte) ([]byte, int, error) {
+	colorSpace := 0
+	var walk func(data []byte) ([]byte, error)
+	walk = func(data []byte) ([]byte, error) {
+		for len(data) >= 8 {
+			size := uint64(binary.BigEndian.Uint32(data))
+			typ := string(data[4:8])
+			header := uint64(8)
+			switch size {
+			case 0:
+				size = uint64(len(data))
+			case 1:
+				if len(data) < 16 {
+					return nil, errors.New("jpx: invalid box")
+				}
+				size = binary.BigEndian.Uint64(data[8:])
+				header = 16
+			}
+			if size < header || size > uint64(len(data)) {
+				return nil, errors.New("jpx: invalid box size")
+			}
+			body := data[header:size]
+			switch typ {
+			case "jp2c":
+				return body, nil
+			case "jp2h":
+				if _, err := walk(body); err != nil && err != errJP2NoCodestream {
+					return nil, err
+				}
+			case "colr":
+				if len(body) >= 7 && body[0] == 1 && colorSpace == 0 {
+					colorSpace = int(binary.BigEndian.Uint32(body[3:]))
+				}
+			case "pclr":
+				return nil, errors.New("jpx: palette not supported")
+			}
+			data = data[size:]
+		}
+		return nil, errJP2NoCodestream
+	}
+	codestream, err := walk(data)
+	return codestream, colorSpace, err
+}
+
+var errJP2NoCodestream = errors.New("jpx: codestream not found")
+
+func parseJPXCodestream(data []byte) (*jpxCodestream, error) {
+	cs := &jpxCodestream{tiles: make(map[int]*jpxTile)}
+	cs.header.coc = make(map[int]*jpxCoding)
+	cs.header.qcc = make(map[int]*jpxQuant)
+	pos := 2
+	for pos+2 <= len(data) {
+		marker := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if marker == jpxEOC {
+			break
+		}
+		if marker == jpxSOD {
+			return nil, errors.New("jpx: unexpected SOD")
+		}
+		if pos+2 > len(data) {
+			return nil, errors.New("jpx: truncated marker")
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return nil, fmt.Errorf("jpx: invalid marker segment %x", marker)
+		}
+		seg := data[pos+2 : pos+length]
+		switch marker {
+		case jpxSIZ:
+			if err := cs.parseSIZ(seg); err != nil {
+				return nil, err
+			}
+		case jpxSOT:
+			if len(seg) < 8 {
+				return nil, errors.New("jpx: invalid SOT")
+			}
+			index := int(binary.BigEndian.Uint16(seg))
+			psot := int(binary.BigEndian.Uint32(seg[2:]))
+			start := pos - 2
+			tile := cs.tiles[index]
+			if tile == nil {
+				tile = &jpxTile{}
+				tile.header.coc = make(map[int]*jpxCoding)
+				tile.header.qcc = make(map[int]*jpxQuant)
+				cs.tiles[index] = tile
+			}
+			end := start + psot
+			if psot == 0 || end > len(data) {
+				end = len(data)
+			}
+			// tile-part 头一直到 SOD
+			pos += length
+			for pos+4 <= end {
+				m := int(binary.BigEndian.Uint16(data[pos:]))
+				if m == jpxSOD {
+					pos += 2
+					break
+				}
+				l := int(binary.BigEndian.Uint16(data[pos+2:]))
+				if l < 2 || pos+2+l > end {
+					return nil, errors.New("jpx: invalid tile-part header")
+				}
+				if err := cs.parseHeaderMarker(&tile.header, m, data[pos+4:pos+2+l]); err != nil {
+					return nil, err
+				}
+				pos += 2 + l
+			}
+			if psot == 0 {
+				// 最后一个 tile-part 一直到 EOC
+				end = len(data)
+				if end-2 >= pos && binary.BigEndian.Uint16(data[end-2:]) == jpxEOC {
+					end -= 2
+				}
+			}
+			if pos < end {
+				tile.data = append(tile.data, data[pos:end]...)
+			}
+			pos = end
+			continue
+		default:
+			if err := cs.parseHeaderMarker(&cs.header, marker, seg); err != nil {
+				return nil, err
+			}
+		}
+		pos += length
+	}
+	if len(cs.comps) == 0 {
+		return nil, errors.New("jpx: SIZ not found")
+	}
+	if cs.header.style == nil || cs.header.coding == nil || cs.header.quant == nil {
+		return nil, errors.New("jpx: COD or QCD not found")
+	}
+	return cs, nil
+}
+
+// parseHeaderMarker 解析主头或者 tile-part 头中的编码和量化参数
+func (cs *jpxCodestream) parseHeaderMarker(header *jpxHeader, marker int, seg []byte) error {
+	var err error
+	switch marker {
+	case jpxCOD:
+		header.style, header.coding, err = parseJPXCOD(seg)
+	case jpxCOC:
+		var c int
+		var coding *jpxCoding
+		c, coding, err = cs.parseCOC(seg)
+		if err == nil {
+			header.coc[c] = coding
+		}
+	case jpxQCD:
+		header.quant, err = parseJPXQuant(seg)
+	case jpxQCC:
+		c, n := cs.componentIndex(seg)
+		if len(seg) > n {
+			var quant *jpxQuant
+			quant, err = parseJPXQuant(seg[n:])
+			header.qcc[c] = quant
+		}
+	case jpxPPM, jpxPPT:
+		err = errors.New("jpx: packed packet headers not supported")
+	}
+	return err
+}
+
+func (cs *jpxCodestream) parseSIZ(seg []byte) error {
+	if len(seg) < 36 {
+		return errors.New("jpx: invalid SIZ")
+	}
+	u32 := func(i int) int { return int(binary.BigEndian.Uint32(seg[i:])) }
+	cs.x1, cs.y1 = u32(2), u32(6)
+	cs.x0, cs.y0 = u32(10), u32(14)
+	cs.tileW, cs.tileH = u32(18), u32(22)
+	cs.tx0, cs.ty0 = u32(26), u32(30)
+	n := int(binary.BigEndian.Uint16(seg[34:]))
+	if n == 0 || len(seg) < 36+3*n || cs.x1 <= cs.x0 || cs.y1 <= cs.y0 || cs.tileW <= 0 || cs.tileH <= 0 {
+		return errors.New("jpx: invalid SIZ")
+	}
+	for i := 0; i < n; i++ {
+		s := seg[36+3*i:]
+		c := jpxComponent{
+			precision: int(s[0]&0x7f) + 1,
+			signed:    s[0]&0x80 != 0,
+			dx:        int(s[1]),
+			dy:        int(s[2]),
+		}
+		if c.dx == 0 || c.dy == 0 {
+			return errors.New("jpx: invalid component subsampling")
+		}
+		cs.comps = append(cs.comps, c)
+	}
+	return nil
+}
+
+// componentIndex 分量数不少于257时分量序号占两个字节
+func (cs *jpxCodestream) componentIndex(seg []byte) (int, int) {
+	if len(cs.comps) >= 257 {
+		if len(seg) < 2 {
+			return 0, 2
+		}
+		return int(binary.BigEndian.Uint16(seg)), 2
+	}
+	if len(seg) < 1 {
+		return 0, 1
+	}
+	return int(seg[0]), 1
+}
+
+func parseJPXCOD(seg []byte) (*jpxCodingStyle, *jpxCoding, error) {
+	if len(seg) < 5 {
+		return nil, nil, errors.New("jpx: invalid COD")
+	}
+	scod := seg[0]
+	style := &jpxCodingStyle{
+		progression: int(seg[1]),
+		layers:      int(binary.BigEndian.Uint16(seg[2:])),
+		mct:         seg[4] != 0,
+		sop:         scod&0x02 != 0,
+		eph:         scod&0x04 != 0,
+	}
+	coding, err := parseJPXCoding(seg[5:], scod&0x01 != 0)
+	return style, coding, err
+}
+
+func (cs *jpxCodestream) parseCOC(seg []byte) (int, *jpxCoding, error) {
+	c, n := cs.componentIndex(seg)
+	if len(seg) < n+1 {
+		return 0, nil, errors.New("jpx: invalid COC")
+	}
+	coding, err := parseJPXCoding(seg[n+1:], seg[n]&0x01 != 0)
+	return c, coding, err
+}
+
+func parseJPXCoding(seg []byte, precincts bool) (*jpxCoding, error) {
+	if len(seg) < 5 {
+		return nil, errors.New("jpx: invalid coding style")
+	}
+	coding := &jpxCoding{
+		levels:     int(seg[0]),
+		cbw:        int(seg[1]&0x0f) + 2,
+		cbh:        int(seg[2]&0x0f) + 2,
+		style:      int(seg[3]),
+		reversible: seg[4] == 1,
+	}
+	if coding.levels > 32 || coding.cbw+coding.cbh > 12 {
+		return nil, errors.New("jpx: invalid coding style")
+	}
+	if precincts {
+		if len(seg) < 5+coding.levels+1 {
+			return nil, errors.New("jpx: invalid precinct sizes")
+		}
+		for i := 0; i <= coding.levels; i++ {
+			coding.precincts = append(coding.precincts, int(seg[5+i]))
+		}
+	}
+	return coding, nil
+}
+
+func parseJPXQuant(seg []byte) (*jpxQuant, error) {
+	if len(seg) < 1 {
+		return nil, errors.New("jpx: invalid QCD")
+	}
+	q := &jpxQuant{style: int(seg[0] & 0x1f), guard: int(seg[0] >> 5)}
+	seg = seg[1:]
+	switch q.style {
+	case 0:
+		for _, b := range seg {
+			q.steps = append(q.steps, [2]int{int(b >> 3), 0})
+		}
+	case 1, 2:
+		for i := 0; i+1 < len(seg); i += 2 {
+			v := int(binary.BigEndian.Uint16(seg[i:]))
+			q.steps = append(q.steps, [2]int{v >> 11, v & 0x7ff})
+		}
+	default:
+		return nil, errors.New("jpx: invalid quantization style")
+	}
+	if len(q.steps) == 0 {
+		return nil, errors.New("jpx: empty quantization")
+	}
+	return q, nil
+}
+
+// tile 中分量 c 使用的参数，优先级为 tile COC > tile COD > 主头 COC > 主头 COD
+func (cs *jpxCodestream) coding(t *jpxTile, c int) *jpxCoding {
+	if v := t.header.coc[c]; v != nil {
+		return v
+	}
+	if t.header.coding != nil {
+		return t.header.coding
+	}
+	if v := cs.header.coc[c]; v != nil {
+		return v
+	}
+	return cs.header.coding
+}
+
+func (cs *jpxCodestream) quant(t *jpxTile, c int) *jpxQuant {
+	if v := t.header.qcc[c]; v != nil {
+		return v
+	}
+	if t.header.quant != nil {
+		return t.header.quant
+	}
+	if v := cs.header.qcc[c]; v != nil {
+		return v
+	}
+	return cs.header.quant
+}
+
+func (cs *jpxCodestream) style(t *jpxTile) *jpxCodingStyle {
+	if t.header.style != nil {
+		return t.header.style
+	}
+	return cs.header.style
+}
+
+func ceilDiv(a, b int) int {
+	if a >= 0 {
+		return (a + b - 1) / b
+	}
+	return -((-a) / b)
+}
+
+func floorDiv(a, b int) int {
+	if a >= 0 {
+		return a / b
+	}
+	return -((-a + b - 1) / b)
+}
+
+// 下面是 tile 的解码
+
+type jpxCodeBlock struct {
+	x0, y0, x1, y1 int
+	included       bool
+	lblock         int
+	zeroBP         int
+	passes         int
+	segments       []jpxSegment
+}
+
+// jpxPrecinctBand 一个 precinct 在某个子带中的码块
+type jpxPrecinctBand struct {
+	band   *jpxBand
+	nw, nh int
+	blocks []*jpxCodeBlock
+	incl   *tagTree
+	zbp    *tagTree
+}
+
+type jpxPrecinct struct {
+	bands []*jpxPrecinctBand
+}
+
+type jpxBand struct {
+	orient         int
+	x0, y0, x1, y1 int
+	level          int // 分解的层数 nb
+	coeffs         []float64
+}
+
+type jpxResolution struct {
+	x0, y0, x1, y1 int
+	ppx, ppy       int
+	pw, ph         int // precinct 的列数和行数
+	bands          []*jpxBand
+	precincts      []*jpxPrecinct
+}
+
+type jpxTileComp struct {
+	x0, y0, x1, y1 int
+	coding         *jpxCoding
+	quant          *jpxQuant
+	resolutions    []*jpxResolution
+	samples        []float64
+}
+
+func (cs *jpxCodestream) decode() (*jpxImage, error) {
+	numX := ceilDiv(cs.x1-cs.tx0, cs.tileW)
+	numY := ceilDiv(cs.y1-cs.ty0, cs.tileH)
+	img := &jpxImage{width: cs.x1 - cs.x0, height: cs.y1 - cs.y0, comps: cs.comps}
+	for range cs.comps {
+		img.samples = append(img.samples, make([]float64, img.width*img.height))
+	}
+	for index := 0; index < numX*numY; index++ {
+		t := cs.tiles[index]
+		if t == nil {
+			continue
+		}
+		p, q := index%numX, index/numX
+		tx0 := maxInt(cs.tx0+p*cs.tileW, cs.x0)
+		ty0 := maxInt(cs.ty0+q*cs.tileH, cs.y0)
+		tx1 := minInt(cs.tx0+(p+1)*cs.tileW, cs.x1)
+		ty1 := minInt(cs.ty0+(q+1)*cs.tileH, cs.y1)
+		comps, err := cs.decodeTile(t, tx0, ty0, tx1, ty1)
+		if err != nil {
+			return nil, err
+		}
+		cs.composeTile(img, comps, tx0, ty0, tx1, ty1)
+	}
+	return img, nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (cs *jpxCodestream) decodeTile(t *jpxTile, tx0, ty0, tx1, ty1 int) ([]*jpxTileComp, error) {
+	style := cs.style(t)
+	comps := make([]*jpxTileComp, len(cs.comps))
+	for c, comp := range cs.comps {
+		tc := &jpxTileComp{
+			x0: ceilDiv(tx0, comp.dx), y0: ceilDiv(ty0, comp.dy),
+			x1: ceilDiv(tx1, comp.dx), y1: ceilDiv(ty1, comp.dy),
+			coding: cs.coding(t, c),
+			quant:  cs.quant(t, c),
+		}
+		if tc.coding.style&jpxBypass != 0 {
+			return nil, errors.New("jpx: selective arithmetic coding bypass not supported")
+		}
+		tc.build()
+		comps[c] = tc
+	}
+	if err := cs.readPackets(t, style, comps, tx0, ty0, tx1, ty1); err != nil {
+		return nil, err
+	}
+	for c, tc := range comps {
+		if err := tc.decodeBlocks(cs.comps[c].precision); err != nil {
+			return nil, err
+		}
+		tc.inverseDWT()
+	}
+	if style.mct && len(comps) >= 3 {
+		jpxInverseMCT(comps, comps[0].coding.reversible)
+	}
+	return comps, nil
+}
+
+// build 计算各个分辨率、子带、precinct 和码块的位置 (T.800 B.5 到 B.7)
+func (tc *jpxTileComp) build() {
+	levels := tc.coding.levels
+	for r := 0; r <= levels; r++ {
+		scale := 1 << uint(levels-r)
+		res := &jpxResolution{
+			x0: ceilDiv(tc.x0, scale), y0: ceilDiv(tc.y0, scale),
+			x1: ceilDiv(tc.x1, scale), y1: ceilDiv(tc.y1, scale),
+			ppx: 15, ppy: 15,
+		}
+		if r < len(tc.coding.precincts) {
+			res.ppx = tc.coding.precincts[r] & 0x0f
+			res.ppy = tc.coding.precincts[r] >> 4
+		}
+		if res.x1 > res.x0 {
+			res.pw = ceilDiv(res.x1, 1<<uint(res.ppx)) - floorDiv(res.x0, 1<<uint(res.ppx))
+		}
+		if res.y1 > res.y0 {
+			res.ph = ceilDiv(res.y1, 1<<uint(res.ppy)) - floorDiv(res.y0, 1<<uint(res.ppy))
+		}
+		if r == 0 {
+			res.bands = []*jpxBand{tc.newBand(jpxOrientLL, levels)}
+		} else {
+			nb := levels - r + 1
+			res.bands = []*jpxBand{tc.newBand(jpxOrientHL, nb), tc.newBand(jpxOrientLH, nb), tc.newBand(jpxOrientHH, nb)}
+		}
+		// precinct 在子带中的大小减半，码块不能大于 precinct
+		pbx, pby := res.ppx, res.ppy
+		if r > 0 {
+			pbx, pby = pbx-1, pby-1
+		}
+		cbw := minInt(tc.coding.cbw, pbx)
+		cbh := minInt(tc.coding.cbh, pby)
+		px0 := floorDiv(res.x0, 1<<uint(res.ppx))
+		py0 := floorDiv(res.y0, 1<<uint(res.ppy))
+		for j := 0; j < res.ph; j++ {
+			for i := 0; i < res.pw; i++ {
+				prec := &jpxPrecinct{}
+				for _, band := range res.bands {
+					// precinct 在子带中的范围
+					bx0 := maxInt((px0+i)<<uint(pbx), band.x0)
+					bx1 := minInt((px0+i+1)<<uint(pbx), band.x1)
+					by0 := maxInt((py0+j)<<uint(pby), band.y0)
+					by1 := minInt((py0+j+1)<<uint(pby), band.y1)
+					pb := &jpxPrecinctBand{band: band}
+					if bx1 > bx0 && by1 > by0 {
+						cx0, cx1 := floorDiv(bx0, 1<<uint(cbw)), ceilDiv(bx1, 1<<uint(cbw))
+						cy0, cy1 := floorDiv(by0, 1<<uint(cbh)), ceilDiv(by1, 1<<uint(cbh))
+						pb.nw, pb.nh = cx1-cx0, cy1-cy0
+						for cy := cy0; cy < cy1; cy++ {
+							for cx := cx0; cx < cx1; cx++ {
+								pb.blocks = append(pb.blocks, &jpxCodeBlock{
+									x0: maxInt(cx<<uint(cbw), bx0), x1: minInt((cx+1)<<uint(cbw), bx1),
+									y0: maxInt(cy<<uint(cbh), by0), y1: minInt((cy+1)<<uint(cbh), by1),
+									lblock: 3,
+								})
+							}
+						}
+						pb.incl = newTagTree(pb.nw, pb.nh)
+						pb.zbp = newTagTree(pb.nw, pb.nh)
+					}
+					prec.bands = append(prec.bands, pb)
+				}
+				res.precincts = append(res.precincts, prec)
+			}
+		}
+		tc.resolutions = append(tc.resolutions, res)
+	}
+}
+
+func (tc *jpxTileComp) newBand(orient, nb int) *jpxBand {
+	xob, yob := 0, 0
+	if orient == jpxOrientHL || orient == jpxOrientHH {
+		xob = 1
+	}
+	if orient == jpxOrientLH || orient == jpxOrientHH {
+		yob = 1
+	}
+	scale := 1 << uint(nb)
+	half := 0
+	if nb > 0 {
+		half = 1 << uint(nb-1)
+	}
+	b := &jpxBand{
+		orient: orient,
+		level:  nb,
+		x0:     ceilDiv(tc.x0-half*xob, scale),
+		y0:     ceilDiv(tc.y0-half*yob, scale),
+		x1:     ceilDiv(tc.x1-half*xob, scale),
+		y1:     ceilDiv(tc.y1-half*yob, scale),
+	}
+	if b.x1 > b.x0 && b.y1 > b.y0 {
+		b.coeffs = make([]float64, (b.x1-b.x0)*(b.y1-b.y0))
+	}
+	return b
+}
+
+// jpxPacket 渐进顺序中的一个包
+type jpxPacket struct {
+	layer, res, comp, precinct int
+}
+
+// packets 按渐进顺序列出 tile 中所有的包 (T.800 B.12)
+func (cs *jpxCodestream) packets(style *jpxCodingStyle, comps []*jpxTileComp, tx0, ty0, tx1, ty1 int) []jpxPacket {
+	list := make([]jpxPacket, 0)
+	maxRes := 0
+	for _, tc := range comps {
+		maxRes = maxInt(maxRes, len(tc.resolutions))
+	}
+	layers := style.layers
+	switch style.progression {
+	case jpxLRCP:
+		for l := 0; l < layers; l++ {
+			for r := 0; r < maxRes; r++ {
+				for c, tc := range comps {
+					if r < len(tc.resolutions) {
+						for p := range tc.resolutions[r].precincts {
+							list = append(list, jpxPacket{l, r, c, p})
+						}
+					}
+				}
+			}
+		}
+		return list
+	case jpxRLCP:
+		for r := 0; r < maxRes; r++ {
+			for l := 0; l < layers; l++ {
+				for c, tc := range comps {
+					if r < len(tc.resolutions) {
+						for p := range tc.resolutions[r].precincts {
+							list = append(list, jpxPacket{l, r, c, p})
+						}
+					}
+				}
+			}
+		}
+		return list
+	}
+	// 和位置相关的顺序，按 precinct 在参考网格上的位置遍历
+	stepX, stepY := 0, 0
+	for c, tc := range comps {
+		comp := cs.comps[c]
+		for r, res := range tc.resolutions {
+			level := uint(len(tc.resolutions) - 1 - r)
+			sx := comp.dx << (uint(res.ppx) + level)
+			sy := comp.dy << (uint(res.ppy) + level)
+			if stepX == 0 || sx < stepX {
+				stepX = sx
+			}
+			if stepY == 0 || sy < stepY {
+				stepY = sy
+			}
+		}
+	}
+	// 返回位置 (x, y) 处分量 c 分辨率 r 的 precinct 序号，没有时返回 -1
+	precinctAt := func(c, r, x, y int) int {
+		tc := comps[c]
+		if r >= len(tc.resolutions) {
+			return -1
+		}
+		comp := cs.comps[c]
+		res := tc.resolutions[r]
+		if res.pw == 0 || res.ph == 0 {
+			return -1
+		}
+		level := uint(len(tc.resolutions) - 1 - r)
+		rpx, rpy := uint(res.ppx)+level, uint(res.ppy)+level
+		if !(y%(comp.dy<<rpy) == 0 || (y == ty0 && (res.y0<<level)%(1<<rpy) != 0)) {
+			return -1
+		}
+		if !(x%(comp.dx<<rpx) == 0 || (x == tx0 && (res.x0<<level)%(1<<rpx) != 0)) {
+			return -1
+		}
+		pi := floorDiv(ceilDiv(x, comp.dx<<level), 1<<uint(res.ppx)) - floorDiv(res.x0, 1<<uint(res.ppx))
+		pj := floorDiv(ceilDiv(y, comp.dy<<level), 1<<uint(res.ppy)) - floorDiv(res.y0, 1<<uint(res.ppy))
+		if pi < 0 || pj < 0 || pi >= res.pw || pj >= res.ph {
+			return -1
+		}
+		return pi + pj*res.pw
+	}
+	positions := func(fn func(x, y int)) {
+		for y := ty0; y < ty1; y += stepY - y%stepY {
+			for x := tx0; x < tx1; x += stepX - x%stepX {
+				fn(x, y)
+			}
+		}
+	}
+	addLayers := func(r, c, p int) {
+		for l := 0; l < layers; l++ {
+			list = append(list, jpxPacket{l, r, c, p})
+		}
+	}
+	switch style.progression {
+	case jpxRPCL:
+		for r := 0; r < maxRes; r++ {
+			positions(func(x, y int) {
+				for c := range comps {
+					if p := precinctAt(c, r, x, y); p >= 0 {
+						addLayers(r, c, p)
+					}
+				}
+			})
+		}
+	case jpxPCRL:
+		positions(func(x, y int) {
+			for c := range comps {
+				for r := 0; r < maxRes; r++ {
+					if p := precinctAt(c, r, x, y); p >= 0 {
+						addLayers(r, c, p)
+					}
+				}
+			}
+		})
+	case jpxCPRL:
+		for c := range comps {
+			positions(func(x, y int) {
+				for r := 0; r < maxRes; r++ {
+					if p := precinctAt(c, r, x, y); p >= 0 {
+						addLayers(r, c, p)
+					}
+				}
+			})
+		}
+	}
+	return list
+}
+
+func (cs *jpxCodestream) readPackets(t *jpxTile, style *jpxCodingStyle, comps []*jpxTileComp, tx0, ty0, tx1, ty1 int) error {
+	data := t.data
+	pos := 0
+	seen := make(map[jpxPacket]bool)
+	for _, pkt := range cs.packets(style, comps, tx0, ty0, tx1, ty1) {
+		if seen[pkt] {
+			continue
+		}
+		seen[pkt] = true
+		if pos >= len(data) {
+			// 数据被截断，已有的部分仍然可以解码
+			return nil
+		}
+		prec := comps[pkt.comp].resolutions[pkt.res].precincts[pkt.precinct]
+		n, err := readJPXPacket(data[pos:], pkt.layer, prec, comps[pkt.comp].coding.style, style)
+		if err != nil {
+			return err
+		}
+		pos += n
+	}
+	return nil
+}
+
+// readJPXPacket 读取一个包的包头和包体，返回读取的字节数
+func readJPXPacket(data []byte, layer int, prec *jpxPrecinct, cbStyle int, style *jpxCodingStyle) (int, error) {
+	pos := 0
+	if style.sop && len(data) >= 6 && binary.BigEndian.Uint16(data) == jpxSOP {
+		pos = 6
+	}
+	br := &jpxBitReader{data: data, pos: pos}
+	type contribution struct {
+		block   *jpxCodeBlock
+		lengths []int
+		passes  []int
+	}
+	list := make([]contribution, 0)
+	present, err := br.readBit()
+	if err != nil {
+		return 0, err
+	}
+	if present == 1 {
+		for _, pb := range prec.bands {
+			for idx, cb := range pb.blocks {
+				x, y := idx%pb.nw, idx/pb.nw
+				var included bool
+				if !cb.included {
+					included, err = pb.incl.decode(br, x, y, layer+1)
+				} else {
+					var bit int
+					bit, err = br.readBit()
+					included = bit == 1
+				}
+				if err != nil {
+					return 0, err
+				}
+				if !included {
+					continue
+				}
+				if !cb.included {
+					i := 0
+					for {
+						ok, err := pb.zbp.decode(br, x, y, i)
+						if err != nil {
+							return 0, err
+						}
+						if ok {
+							break
+						}
+						i++
+					}
+					cb.zeroBP = i - 1
+					cb.included = true
+				}
+				passes, err := br.readPasses()
+				if err != nil {
+					return 0, err
+				}
+				for {
+					bit, err := br.readBit()
+					if err != nil {
+						return 0, err
+					}
+					if bit == 0 {
+						break
+					}
+					cb.lblock++
+				}
+				ctr := contribution{block: cb}
+				if cbStyle&jpxTermAll != 0 {
+					// 每个编码通道单独结束，各有一个长度
+					for i := 0; i < passes; i++ {
+						n, err := br.readBits(cb.lblock)
+						if err != nil {
+							return 0, err
+						}
+						ctr.lengths = append(ctr.lengths, n)
+						ctr.passes = append(ctr.passes, 1)
+					}
+				} else {
+					n, err := br.readBits(cb.lblock + floorLog2(passes))
+					if err != nil {
+						return 0, err
+					}
+					ctr.lengths = append(ctr.lengths, n)
+					ctr.passes = append(ctr.passes, passes)
+				}
+				list = append(list, ctr)
+			}
+		}
+	}
+	pos = br.align()
+	if style.eph && pos+2 <= len(data) && binary.BigEndian.Uint16(data[pos:]) == jpxEPH {
+		pos += 2
+	}
+	for _, ctr := range list {
+		cb := ctr.block
+		for i, n := range ctr.lengths {
+			end := pos + n
+			if end > len(data) {
+				end = len(data)
+			}
+			chunk := data[pos:end]
+			pos = end
+			if cbStyle&jpxTermAll == 0 && len(cb.segments) > 0 {
+				seg := &cb.segments[len(cb.segments)-1]
+				seg.data = append(seg.data, chunk...)
+				seg.passes += ctr.passes[i]
+			} else {
+				cb.segments = append(cb.segments, jpxSegment{data: append([]byte{}, chunk...), passes: ctr.passes[i]})
+			}
+			cb.passes += ctr.passes[i]
+		}
+	}
+	return pos, nil
+}
+
+func floorLog2(n int) int {
+	r := 0
+	for n > 1 {
+		n >>= 1
+		r++
+	}
+	return r
+}
+
+// jpxBitReader 读取包头，0xff 后面的字节只有7位
+type jpxBitReader struct {
+	data []byte
+	pos  int
+	buf  byte
+	bits int
+	last byte
+}
+
+func (r *jpxBitReader) readBit() (int, error) {
+	if r.bits == 0 {
+		if r.pos >= len(r.data) {
+			return 0, errors.New("jpx: truncated packet header")
+		}
+		r.bits = 8
+		if r.last == 0xff {
+			r.bits = 7
+		}
+		r.buf = r.data[r.pos]
+		r.last = r.buf
+		r.pos++
+	}
+	r.bits--
+	return int(r.buf>>uint(r.bits)) & 1, nil
+}
+
+func (r *jpxBitReader) readBits(n int) (int, error) {
+	v := 0
+	for i := 0; i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | bit
+	}
+	return v, nil
+}
+
+// readPasses 编码通道数 (表 B.4)
+func (r *jpxBitReader) readPasses() (int, error) {
+	if bit, err := r.readBit(); err != nil || bit == 0 {
+		return 1, err
+	}
+	if bit, err := r.readBit(); err != nil || bit == 0 {
+		return 2, err
+	}
+	n, err := r.readBits(2)
+	if err != nil || n != 3 {
+		return 3 + n, err
+	}
+	n, err = r.readBits(5)
+	if err != nil || n != 31 {
+		return 6 + n, err
+	}
+	n, err = r.readBits(7)
+	return 37 + n, err
+}
+
+// align 包头结束，如果最后一个字节是 0xff，跳过后面填充的字节
+func (r *jpxBitReader) align() int {
+	r.bits = 0
+	if r.last == 0xff && r.pos < len(r.data) {
+		r.pos++
+		r.last = 0
+	}
+	return r.pos
+}
+
+// tagTree 标签树 (T.800 B.10.2)
+type tagTree struct {
+	levels []tagLevel
+}
+
+type tagLevel struct {
+	w, h  int
+	value []int
+	low   []int
+}
+
+const tagTreeUnknown = 1 << 30
+
+func newTagTree(w, h int) *tagTree {
+	t := &tagTree{}
+	for {
+		level := tagLevel{w: w, h: h, value: make([]int, w*h), low: make([]int, w*h)}
+		for i := range level.value {
+			level.value[i] = tagTreeUnknown
+		}
+		t.levels = append(t.levels, level)
+		if w <= 1 && h <= 1 {
+			return t
+		}
+		w, h = (w+1)/2, (h+1)/2
+	}
+}
+
+// decode 读取叶子 (x, y) 的值直到 threshold，返回值是否小于 threshold
+func (t *tagTree) decode(r *jpxBitReader, x, y, threshold int) (bool, error) {
+	low := 0
+	var node *int
+	for k := len(t.levels) - 1; k >= 0; k-- {
+		level := &t.levels[k]
+		i := (y>>uint(k))*level.w + x>>uint(k)
+		if low > level.low[i] {
+			level.low[i] = low
+		} else {
+			low = level.low[i]
+		}
+		for low < threshold && low < level.value[i] {
+			bit, err := r.readBit()
+			if err != nil {
+				return false, err
+			}
+			if bit == 1 {
+				level.value[i] = low
+			} else {
+				low++
+			}
+		}
+		level.low[i] = low
+		node = &level.value[i]
+	}
+	return *node < threshold, nil
+}
+
+// decodeBlocks 解码所有码块并反量化
+func (tc *jpxTileComp) decodeBlocks(precision int) error {
+	for r, res := range tc.resolutions {
+		for _, prec := range res.precincts {
+			for _, pb := range prec.bands {
+				band := pb.band
+				step, mb := tc.bandQuant(r, band, precision)
+				bw := band.x1 - band.x0
+				for _, cb := range pb.blocks {
+					if len(cb.segments) == 0 {
+						continue
+					}
+					w, h := cb.x1-cb.x0, cb.y1-cb.y0
+					coeffs, err := decodeCodeBlock(cb.segments, w, h, band.orient, tc.coding.style, mb-cb.zeroBP)
+					if err != nil {
+						return err
+					}
+					for y := 0; y < h; y++ {
+						row := band.coeffs[(cb.y0-band.y0+y)*bw+cb.x0-band.x0:]
+						for x := 0; x < w; x++ {
+							row[x] = coeffs[y*w+x] * step
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// bandQuant 返回子带的量化步长和幅度位平面数 Mb (T.800 E.1)
+func (tc *jpxTileComp) bandQuant(r int, band *jpxBand, precision int) (float64, int) {
+	q := tc.quant
+	idx := 0
+	if r > 0 {
+		idx = 3*(r-1) + band.orient
+	}
+	var exp, mant int
+	switch {
+	case q.style == 1:
+		exp = q.steps[0][0] - r
+		if r > 0 {
+			exp++
+		}
+		mant = q.steps[0][1]
+	case idx < len(q.steps):
+		exp, mant = q.steps[idx][0], q.steps[idx][1]
+	default:
+		exp, mant = q.steps[len(q.steps)-1][0], q.steps[len(q.steps)-1][1]
+	}
+	mb := q.guard + exp - 1
+	if q.style == 0 || tc.coding.reversible {
+		return 1, mb
+	}
+	gain := 0
+	switch band.orient {
+	case jpxOrientHL, jpxOrientLH:
+		gain = 1
+	case jpxOrientHH:
+		gain = 2
+	}
+	step := math.Pow(2, float64(precision+gain-exp)) * (1 + float64(mant)/2048)
+	return step, mb
+}
+
+// inverseDWT 逐级做小波逆变换 (T.800 F.3)
+func (tc *jpxTileComp) inverseDWT() {
+	res := tc.resolutions[0]
+	cur := res.bands[0].coeffs
+	for r := 1; r < len(tc.resolutions); r++ {
+		res = tc.resolutions[r]
+		w, h := res.x1-res.x0, res.y1-res.y0
+		next := make([]float64, w*h)
+		if w > 0 && h > 0 {
+			hl, lh, hh := res.bands[0], res.bands[1], res.bands[2]
+			lw := ceilDiv(res.x1, 2) - ceilDiv(res.x0, 2)
+			hw := hl.x1 - hl.x0
+			ly := 0
+			hy := 0
+			for y := 0; y < h; y++ {
+				lowRow := (res.y0+y)%2 == 0
+				lx, hx := 0, 0
+				for x := 0; x < w; x++ {
+					lowCol := (res.x0+x)%2 == 0
+					var v float64
+					switch {
+					case lowRow && lowCol:
+						v = cur[ly*lw+lx]
+					case lowRow:
+						v = hl.coeffs[ly*hw+hx]
+					case lowCol:
+						v = lh.coeffs[hy*lw+lx]
+					default:
+						v = hh.coeffs[hy*hw+hx]
+					}
+					next[y*w+x] = v
+					if lowCol {
+						lx++
+					} else {
+						hx++
+					}
+				}
+				if lowRow {
+					ly++
+				} else {
+					hy++
+				}
+			}
+			line := make([]float64, maxInt(w, h))
+			for y := 0; y < h; y++ {
+				jpxSynthesis(next[y*w:(y+1)*w], res.x0, tc.coding.reversible)
+			}
+			for x := 0; x < w; x++ {
+				col := line[:h]
+				for y := 0; y < h; y++ {
+					col[y] = next[y*w+x]
+				}
+				jpxSynthesis(col, res.y0, tc.coding.reversible)
+				for y := 0; y < h; y++ {
+					next[y*w+x] = col[y]
+				}
+			}
+		}
+		cur = next
+	}
+	tc.samples = cur
+}
+
+// 9/7 小波的提升系数
+const (
+	jpxAlpha = -1.586134342059924
+	jpxBeta  = -0.052980118572961
+	jpxGamma = 0.882911075530934
+	jpxDelta = 0.443506852043971
+	jpxK     = 1.230174104914001
+)
+
+// jpxSynthesis 一维小波逆变换，i0 为第一个样本的坐标，偶数坐标为低通系数
+func jpxSynthesis(x []float64, i0 int, reversible bool) {
+	n := len(x)
+	if n == 0 {
+		return
+	}
+	if n == 1 {
+		if i0%2 != 0 {
+			x[0] /= 2
+		}
+		return
+	}
+	// 两边按对称方式延拓
+	const pad = 4
+	ext := make([]float64, n+2*pad)
+	period := 2 * (n - 1)
+	for k := -pad; k < n+pad; k++ {
+		m := k % period
+		if m < 0 {
+			m += period
+		}
+		if m >= n {
+			m = period - m
+		}
+		ext[k+pad] = x[m]
+	}
+	even := func(k int) bool { return (i0+k-pad)%2 == 0 }
+	lift := func(low bool, fn func(k int)) {
+		for k := 1; k < len(ext)-1; k++ {
+			if even(k) == low {
+				fn(k)
+			}
+		}
+	}
+	if reversible {
+		lift(true, func(k int) { ext[k] -= math.Floor((ext[k-1] + ext[k+1] + 2) / 4) })
+		lift(false, func(k int) { ext[k] += math.Floor((ext[k-1] + ext[k+1]) / 2) })
+	} else {
+		lift(true, func(k int) { ext[k] *= jpxK })
+		lift(false, func(k int) { ext[k] /= jpxK })
+		lift(true, func(k int) { ext[k] -= jpxDelta * (ext[k-1] + ext[k+1]) })
+		lift(false, func(k int) { ext[k] -= jpxGamma * (ext[k-1] + ext[k+1]) })
+		lift(true, func(k int) { ext[k] -= jpxBeta * (ext[k-1] + ext[k+1]) })
+		lift(false, func(k int) { ext[k] -= jpxAlpha * (ext[k-1] + ext[k+1]) })
+	}
+	copy(x, ext[pad:pad+n])
+}
+
+// jpxInverseMCT 分量逆变换，可逆的为 RCT，不可逆的为 ICT
+func jpxInverseMCT(comps []*jpxTileComp, reversible bool) {
+	y0, y1, y2 := comps[0].samples, comps[1].samples, comps[2].samples
+	if len(y1) != len(y0) || len(y2) != len(y0) {
+		return
+	}
+	for i := range y0 {
+		if reversible {
+			g := y0[i] - math.Floor((y1[i]+y2[i])/4)
+			r := y2[i] + g
+			b := y1[i] + g
+			y0[i], y1[i], y2[i] = r, g, b
+		} else {
+			y, cb, cr := y0[i], y1[i], y2[i]
+			y0[i] = y + 1.402*cr
+			y1[i] = y - 0.34413*cb - 0.71414*cr
+			y2[i] = y + 1.772*cb
+		}
+	}
+}
+
+// composeTile 把 tile 的分量放到整幅图像中，做电平位移，采样的分量按最近邻放大
+func (cs *jpxCodestream) composeTile(img *jpxImage, comps []*jpxTileComp, tx0, ty0, tx1, ty1 int) {
+	for c, tc := range comps {
+		comp := cs.comps[c]
+		w := tc.x1 - tc.x0
+		if w <= 0 || tc.y1 <= tc.y0 || len(tc.samples) < w*(tc.y1-tc.y0) {
+			continue
+		}
+		// 有符号的分量也平移到非负的范围
+		shift := float64(int(1) << uint(comp.precision-1))
+		maxVal := float64(int(1)<<uint(comp.precision) - 1)
+		dst := img.samples[c]
+		for y := ty0; y < ty1; y++ {
+			sy := minInt(floorDiv(y, comp.dy)-tc.y0, tc.y1-tc.y0-1)
+			for x := tx0; x < tx1; x++ {
+				sx := minInt(floorDiv(x, comp.dx)-tc.x0, w-1)
+				if sx < 0 || sy < 0 {
+					continue
+				}
+				v := tc.samples[sy*w+sx] + shift
+				if v < 0 {
+					v = 0
+				} else if v > maxVal {
+					v = maxVal
+				}
+				dst[(y-cs.y0)*img.width+x-cs.x0] = v
+			}
+		}
+	}
+}
+
+// pixels 返回前 n 个分量交错排列的 8 bit 采样，scale 为 false 时不缩放 (用于 Indexed)
+func (img *jpxImage) pixels(n int, scale bool) []byte {
+	if n > len(img.comps) {
+		n = len(img.comps)
+	}
+	data := make([]byte, img.width*img.height*n)
+	for c := 0; c < n; c++ {
+		for i, v := range img.componentBytes(c, scale) {
+			data[i*n+c] = v
+		}
+	}
+	return data
+}
+
+// componentBytes 取单个分量的 8 bit 采样
+func (img *jpxImage) componentBytes(c int, scale bool) []byte {
+	factor := 1.0
+	if scale {
+		factor = 255 / float64(int(1)<<uint(img.comps[c].precision)-1)
+	}
+	data := make([]byte, len(img.samples[c]))
+	for i, v := range img.samples[c] {
+		v = math.Round(v * factor)
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+		data[i] = byte(v)
+	}
+	return data
+}
+
+// deviceColorSpace 图像字典没有 /ColorSpace 时，按 colr 或者分量数推断
+func (img *jpxImage) deviceColorSpace() *colorSpace {
+	switch img.colorSpace {
+	case 17:
+		return &colorSpace{Name: "/DeviceGray", N: 1}
+	case 12:
+		return &colorSpace{Name: "/DeviceCMYK", N: 4}
+	case 16, 18:
+		return &colorSpace{Name: "/DeviceRGB", N: 3}
+	}
+	switch {
+	case len(img.comps) >= 4:
+		return &colorSpace{Name: "/DeviceCMYK", N: 4}
+	case len(img.comps) >= 3:
+		return &colorSpace{Name: "/DeviceRGB", N: 3}
+	}
+	return &colorSpace{Name: "/DeviceGray", N: 1}
+}
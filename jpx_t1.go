@@ -0,0 +1,491 @@
+package pdf
+
+import "errors"
+
+// JPEG 2000 的 Tier-1 解码: MQ 算术解码器 (T.800 附录 C) 以及码块的位平面解码 (附录 D)
+
+// mqState Qe 概率估计表中的一项
+type mqState struct {
+	qe        uint32
+	nmps      uint8
+	nlps      uint8
+	switchMPS bool
+}
+
+var mqTable = [47]mqState{
+	{0x5601, 1, 1, true}, {0x3401, 2, 6, false}, {0x1801, 3, 9, false}, {0x0ac1, 4, 12, false},
+	{0x0521, 5, 29, false}, {0x0221, 38, 33, false}, {0x5601, 7, 6, true}, {0x5401, 8, 14, false},
+	{0x4801, 9, 14, false}, {0x3801, 10, 14, false}, {0x3001, 11, 17, false}, {0x2401, 12, 18, false},
+	{0x1c01, 13, 20, false}, {0x1601, 29, 21, false}, {0x5601, 15, 14, true}, {0x5401, 16, 14, false},
+	{0x5101, 17, 15, false}, {0x4801, 18, 16, false}, {0x3801, 19, 17, false}, {0x3401, 20, 18, false},
+	{0x3001, 21, 19, false}, {0x2801, 22, 19, false}, {0x2401, 23, 20, false}, {0x2201, 24, 21, false},
+	{0x1c01, 25, 22, false}, {0x1801, 26, 23, false}, {0x1601, 27, 24, false}, {0x1401, 28, 25, false},
+	{0x1201, 29, 26, false}, {0x1101, 30, 27, false}, {0x0ac1, 31, 28, false}, {0x09c1, 32, 29, false},
+	{0x08a1, 33, 30, false}, {0x0521, 34, 31, false}, {0x0441, 35, 32, false}, {0x02a1, 36, 33, false},
+	{0x0221, 37, 34, false}, {0x0141, 38, 35, false}, {0x0111, 39, 36, false}, {0x0085, 40, 37, false},
+	{0x0049, 41, 38, false}, {0x0025, 42, 39, false}, {0x0015, 43, 40, false}, {0x0009, 44, 41, false},
+	{0x0005, 45, 42, false}, {0x0001, 45, 43, false}, {0x5601, 46, 46, false},
+}
+
+// mqDecoder MQ 算术解码器，上下文保存为 状态序号<<1 | MPS
+type mqDecoder struct {
+	data  []byte
+	pos   int
+	chigh uint32
+	clow  uint32
+	a     uint32
+	ct    int
+}
+
+func newMQDecoder(data []byte) *mqDecoder {
+	d := &mqDecoder{data: data}
+	d.chigh = d.byteAt(0)
+	d.byteIn()
+	d.chigh = (d.chigh<<7)&0xffff | (d.clow>>9)&0x7f
+	d.clow = (d.clow << 7) & 0xffff
+	d.ct -= 7
+	d.a = 0x8000
+	return d
+}
+
+// byteAt 数据结束后当作 0xff
+func (d *mqDecoder) byteAt(i int) uint32 {
+	if i < len(d.data) {
+		return uint32(d.data[i])
+	}
+	return 0xff
+}
+
+func (d *mqDecoder) byteIn() {
+	if d.byteAt(d.pos) == 0xff {
+		if d.byteAt(d.pos+1) > 0x8f {
+			d.clow += 0xff00
+			d.ct = 8
+		} else {
+			d.pos++
+			d.clow += d.byteAt(d.pos) << 9
+			d.ct = 7
+		}
+	} else {
+		d.pos++
+		d.clow += d.byteAt(d.pos) << 8
+		d.ct = 8
+	}
+	if d.clow > 0xffff {
+		d.chigh += d.clow >> 16
+		d.clow &= 0xffff
+	}
+}
+
+func (d *mqDecoder) decode(cx *uint8) int {
+	idx := *cx >> 1
+	mps := int(*cx & 1)
+	state := &mqTable[idx]
+	qe := state.qe
+	a := d.a - qe
+	var bit int
+	if d.chigh < qe {
+		// LPS 交换
+		if a < qe {
+			a = qe
+			bit = mps
+			idx = state.nmps
+		} else {
+			a = qe
+			bit = 1 ^ mps
+			if state.switchMPS {
+				mps = bit
+			}
+			idx = state.nlps
+		}
+	} else {
+		d.chigh -= qe
+		if a&0x8000 != 0 {
+			d.a = a
+			return mps
+		}
+		// MPS 交换
+		if a < qe {
+			bit = 1 ^ mps
+			if state.switchMPS {
+				mps = bit
+			}
+			idx = state.nlps
+		} else {
+			bit = mps
+			idx = state.nmps
+		}
+	}
+	for {
+		if d.ct == 0 {
+			d.byteIn()
+		}
+		a <<= 1
+		d.chigh = (d.chigh<<1)&0xffff | (d.clow>>15)&1
+		d.clow = (d.clow << 1) & 0xffff
+		d.ct--
+		if a&0x8000 != 0 {
+			break
+		}
+	}
+	d.a = a
+	*cx = idx<<1 | uint8(mps)
+	return bit
+}
+
+// 码块编码方式 (COD 中的 code-block style)
+const (
+	jpxBypass   = 0x01
+	jpxReset    = 0x02
+	jpxTermAll  = 0x04
+	jpxCausal   = 0x08
+	jpxSegSym   = 0x20
+	jpxCtxRL    = 17
+	jpxCtxUni   = 18
+	jpxOrientLL = 0
+	jpxOrientHL = 1
+	jpxOrientLH = 2
+	jpxOrientHH = 3
+)
+
+// jpxSegment 码块的一个码字段，以及其中的编码通道数
+type jpxSegment struct {
+	data   []byte
+	passes int
+}
+
+// t1Decoder 一个码块的位平面解码
+type t1Decoder struct {
+	w, h    int
+	stride  int // 四周各留一个像素，避免边界判断
+	orient  int
+	style   int
+	mq      *mqDecoder
+	ctx     [19]uint8
+	sig     []bool
+	neg     []bool
+	visited []bool // 当前位平面中已经在显著性传播通道中处理
+	refined []bool // 已经做过细化
+	mag     []uint32
+	plane   []int8 // 最后处理的位平面，用于重建
+}
+
+func (t *t1Decoder) resetContexts() {
+	for i := range t.ctx {
+		t.ctx[i] = 0
+	}
+	t.ctx[0] = 4 << 1
+	t.ctx[jpxCtxRL] = 3 << 1
+	t.ctx[jpxCtxUni] = 46 << 1
+}
+
+// decodeCodeBlock 解码码块，bitplanes 为码块需要解码的位平面数。
+// 返回每个系数的值，已经按最后解码的位平面做了中点重建
+func decodeCodeBlock(segments []jpxSegment, w, h, orient, style, bitplanes int) ([]float64, error) {
+	out := make([]float64, w*h)
+	if w <= 0 || h <= 0 || bitplanes <= 0 || len(segments) == 0 {
+		return out, nil
+	}
+	if style&jpxBypass != 0 {
+		return nil, errors.New("jpx: selective arithmetic coding bypass not supported")
+	}
+	if bitplanes > 31 {
+		bitplanes = 31
+	}
+	stride := w + 2
+	size := stride * (h + 2)
+	t := &t1Decoder{
+		w: w, h: h, stride: stride, orient: orient, style: style,
+		sig:     make([]bool, size),
+		neg:     make([]bool, size),
+		visited: make([]bool, size),
+		refined: make([]bool, size),
+		mag:     make([]uint32, size),
+		plane:   make([]int8, size),
+	}
+	t.resetContexts()
+	plane := bitplanes - 1
+	pass := 2 // 第一个位平面只有清除通道
+	for _, seg := range segments {
+		t.mq = newMQDecoder(seg.data)
+		for i := 0; i < seg.passes && plane >= 0; i++ {
+			switch pass {
+			case 0:
+				t.significancePass(plane)
+			case 1:
+				t.refinementPass(plane)
+			case 2:
+				t.cleanupPass(plane)
+			}
+			if style&jpxReset != 0 {
+				t.resetContexts()
+			}
+			pass++
+			if pass == 3 {
+				pass = 0
+				plane--
+				for j := range t.visited {
+					t.visited[j] = false
+				}
+			}
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := (y+1)*stride + x + 1
+			if !t.sig[i] {
+				continue
+			}
+			v := float64(t.mag[i])
+			if p := t.plane[i]; p > 0 {
+				v += float64(uint32(1)<<uint(p)) / 2
+			}
+			if t.neg[i] {
+				v = -v
+			}
+			out[y*w+x] = v
+		}
+	}
+	return out, nil
+}
+
+// belowVisible 竖直因果模式下，条带最后一行不参考下一个条带
+func (t *t1Decoder) belowVisible(y int) bool {
+	return t.style&jpxCausal == 0 || y%4 != 3
+}
+
+// neighbors 返回水平、竖直、对角方向显著的邻居个数
+func (t *t1Decoder) neighbors(i, y int) (h, v, d int) {
+	s := t.stride
+	if t.sig[i-1] {
+		h++
+	}
+	if t.sig[i+1] {
+		h++
+	}
+	if t.sig[i-s] {
+		v++
+	}
+	if t.sig[i-s-1] {
+		d++
+	}
+	if t.sig[i-s+1] {
+		d++
+	}
+	if t.belowVisible(y) {
+		if t.sig[i+s] {
+			v++
+		}
+		if t.sig[i+s-1] {
+			d++
+		}
+		if t.sig[i+s+1] {
+			d++
+		}
+	}
+	return
+}
+
+// zeroContext 零编码的上下文 (表 D.1)
+func (t *t1Decoder) zeroContext(i, y int) int {
+	h, v, d := t.neighbors(i, y)
+	switch t.orient {
+	case jpxOrientHL:
+		h, v = v, h
+	case jpxOrientHH:
+		hv := h + v
+		switch {
+		case d >= 3:
+			return 8
+		case d == 2:
+			if hv >= 1 {
+				return 7
+			}
+			return 6
+		case d == 1:
+			if hv >= 2 {
+				return 5
+			}
+			if hv == 1 {
+				return 4
+			}
+			return 3
+		}
+		if hv >= 2 {
+			return 2
+		}
+		return hv
+	}
+	switch h {
+	case 2:
+		return 8
+	case 1:
+		if v >= 1 {
+			return 7
+		}
+		if d >= 1 {
+			return 6
+		}
+		return 5
+	}
+	switch {
+	case v == 2:
+		return 4
+	case v == 1:
+		return 3
+	case d >= 2:
+		return 2
+	}
+	return d
+}
+
+func (t *t1Decoder) contribution(i int) int {
+	if !t.sig[i] {
+		return 0
+	}
+	if t.neg[i] {
+		return -1
+	}
+	return 1
+}
+
+// decodeSign 符号编码 (表 D.2 和 D.3)
+func (t *t1Decoder) decodeSign(i, y int) bool {
+	s := t.stride
+	h := t.contribution(i-1) + t.contribution(i+1)
+	v := t.contribution(i - s)
+	if t.belowVisible(y) {
+		v += t.contribution(i + s)
+	}
+	if h > 1 {
+		h = 1
+	} else if h < -1 {
+		h = -1
+	}
+	if v > 1 {
+		v = 1
+	} else if v < -1 {
+		v = -1
+	}
+	// H 为 -1 (或者 H 为 0、V 为 -1) 时和对称的情况使用同一个上下文，结果取反
+	xor := 0
+	if h < 0 {
+		h, v, xor = -h, -v, 1
+	} else if h == 0 && v < 0 {
+		v, xor = -v, 1
+	}
+	ctx := 9 + v
+	if h == 1 {
+		ctx = 12 + v
+	}
+	return t.mq.decode(&t.ctx[ctx])^xor == 1
+}
+
+func (t *t1Decoder) setSignificant(i, y, plane int) {
+	t.sig[i] = true
+	t.neg[i] = t.decodeSign(i, y)
+	t.mag[i] |= 1 << uint(plane)
+	t.plane[i] = int8(plane)
+}
+
+// significancePass 显著性传播通道
+func (t *t1Decoder) significancePass(plane int) {
+	for y0 := 0; y0 < t.h; y0 += 4 {
+		for x := 0; x < t.w; x++ {
+			for y := y0; y < y0+4 && y < t.h; y++ {
+				i := (y+1)*t.stride + x + 1
+				if t.sig[i] {
+					continue
+				}
+				h, v, d := t.neighbors(i, y)
+				if h+v+d == 0 {
+					continue
+				}
+				t.visited[i] = true
+				t.plane[i] = int8(plane)
+				if t.mq.decode(&t.ctx[t.zeroContext(i, y)]) == 1 {
+					t.setSignificant(i, y, plane)
+				}
+			}
+		}
+	}
+}
+
+// refinementPass 幅度细化通道
+func (t *t1Decoder) refinementPass(plane int) {
+	for y0 := 0; y0 < t.h; y0 += 4 {
+		for x := 0; x < t.w; x++ {
+			for y := y0; y < y0+4 && y < t.h; y++ {
+				i := (y+1)*t.stride + x + 1
+				if !t.sig[i] || t.visited[i] {
+					continue
+				}
+				ctx := 16
+				if !t.refined[i] {
+					ctx = 14
+					if h, v, d := t.neighbors(i, y); h+v+d > 0 {
+						ctx = 15
+					}
+					t.refined[i] = true
+				}
+				if t.mq.decode(&t.ctx[ctx]) == 1 {
+					t.mag[i] |= 1 << uint(plane)
+				}
+				t.plane[i] = int8(plane)
+			}
+		}
+	}
+}
+
+// cleanupPass 清除通道，条带中一整列都没有显著邻居时使用游程编码
+func (t *t1Decoder) cleanupPass(plane int) {
+	for y0 := 0; y0 < t.h; y0 += 4 {
+		for x := 0; x < t.w; x++ {
+			start := y0
+			if y0+4 <= t.h && t.runLengthColumn(x, y0) {
+				if t.mq.decode(&t.ctx[jpxCtxRL]) == 0 {
+					for y := y0; y < y0+4; y++ {
+						t.plane[(y+1)*t.stride+x+1] = int8(plane)
+					}
+					continue
+				}
+				r := t.mq.decode(&t.ctx[jpxCtxUni])<<1 | t.mq.decode(&t.ctx[jpxCtxUni])
+				for y := y0; y < y0+r; y++ {
+					t.plane[(y+1)*t.stride+x+1] = int8(plane)
+				}
+				y := y0 + r
+				t.setSignificant((y+1)*t.stride+x+1, y, plane)
+				start = y + 1
+			}
+			for y := start; y < y0+4 && y < t.h; y++ {
+				i := (y+1)*t.stride + x + 1
+				if t.sig[i] || t.visited[i] {
+					continue
+				}
+				t.plane[i] = int8(plane)
+				if t.mq.decode(&t.ctx[t.zeroContext(i, y)]) == 1 {
+					t.setSignificant(i, y, plane)
+				}
+			}
+		}
+	}
+	if t.style&jpxSegSym != 0 {
+		for i := 0; i < 4; i++ {
+			t.mq.decode(&t.ctx[jpxCtxUni])
+		}
+	}
+}
+
+// runLengthColumn 条带中的一列四个系数都不显著、没有处理过并且没有显著的邻居
+func (t *t1Decoder) runLengthColumn(x, y0 int) bool {
+	for y := y0; y < y0+4; y++ {
+		i := (y+1)*t.stride + x + 1
+		if t.sig[i] || t.visited[i] {
+			return false
+		}
+		if h, v, d := t.neighbors(i, y); h+v+d > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package pdf
+
+import (
+	"os"
+	"testing"
+)
+
+// testdata 中的 JPEG 2000 文件都是无损 (5/3 小波) 编码的，解码结果应和原来的采样值完全相同:
+// gray8x8.j2k 为单分量的码流，一级小波分解，一个 64x64 的码块；
+// rgb16x8.jp2 为 JP2 文件，三个分量，使用可逆的分量变换，两级小波分解，16x16 的码块
+func jpxTestSample(x, y, c int) float64 {
+	return float64((x*37 + y*11 + c*60 + (x*y)%7*9) % 256)
+}
+
+func TestDecodeJPX(t *testing.T) {
+	for _, c := range []struct {
+		file       string
+		w, h       int
+		comps      int
+		colorSpace int
+	}{
+		{"gray8x8.j2k", 8, 8, 1, 0},
+		{"rgb16x8.jp2", 16, 8, 3, 16},
+	} {
+		data, err := os.ReadFile("testdata/" + c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := decodeJPX(data)
+		if err != nil {
+			t.Fatalf("%s: %v", c.file, err)
+		}
+		if img.width != c.w || img.height != c.h || len(img.comps) != c.comps || img.colorSpace != c.colorSpace {
+			t.Fatalf("%s: %dx%d %d comps colorspace %d", c.file, img.width, img.height, len(img.comps), img.colorSpace)
+		}
+		for comp := 0; comp < c.comps; comp++ {
+			for y := 0; y < c.h; y++ {
+				for x := 0; x < c.w; x++ {
+					if got, want := img.samples[comp][y*c.w+x], jpxTestSample(x, y, comp); got != want {
+						t.Fatalf("%s: component %d (%d, %d) = %v, want %v", c.file, comp, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeJPXTruncated(t *testing.T) {
+	data, err := os.ReadFile("testdata/gray8x8.j2k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 截断的码流 (PDF 中常见) 不能 panic
+	for n := 0; n < len(data); n++ {
+		decodeJPX(data[:n])
+	}
+}
@@ -0,0 +1,266 @@
+package pdf
+
+import (
+	"errors"
+	"strconv"
+)
+
+// lexer 对一段字节做词法分析，解析出 PDF 的基本对象。
+// 值的表示和对象解析保持一致: 名字为 *NameObj，整数为 int，实数为 float64，
+// 字符串保留原始形式 (...) 或 <...>，数组为 []interface{}，字典为 []*Pair，对象引用为 *Obj
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+const (
+	tokenEOF = iota
+	tokenName
+	tokenInt
+	tokenReal
+	tokenString
+	tokenBool
+	tokenNull
+	tokenArrayStart
+	tokenArrayEnd
+	tokenDictStart
+	tokenDictEnd
+	tokenKeyword // 内容流中的操作符，以及 obj、R 等关键字
+)
+
+type token struct {
+	typ   int
+	value interface{}
+	start int // token 在数据中的开始位置
+}
+
+func newLexer(data []byte) *lexer {
+	return &lexer{data: data}
+}
+
+func isWhiteSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\f' || b == 0
+}
+
+func isDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace 跳过空白和注释
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		if isWhiteSpace(b) {
+			l.pos++
+			continue
+		}
+		if b == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		break
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipSpace()
+	start := l.pos
+	if l.pos >= len(l.data) {
+		return token{typ: tokenEOF, start: start}, nil
+	}
+	b := l.data[l.pos]
+	switch b {
+	case '/':
+		l.pos++
+		for l.pos < len(l.data) && !isWhiteSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return token{typ: tokenName, value: &NameObj{Name: string(l.data[start:l.pos])}, start: start}, nil
+	case '(':
+		str, err := l.readLiteralString()
+		return token{typ: tokenString, value: str, start: start}, err
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return token{typ: tokenDictStart, start: start}, nil
+		}
+		for l.pos < len(l.data) && l.data[l.pos] != '>' {
+			l.pos++
+		}
+		if l.pos >= len(l.data) {
+			return token{}, errors.New("expect >")
+		}
+		l.pos++
+		return token{typ: tokenString, value: string(l.data[start:l.pos]), start: start}, nil
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return token{typ: tokenDictEnd, start: start}, nil
+		}
+		return token{}, errors.New("unexpected >")
+	case '[':
+		l.pos++
+		return token{typ: tokenArrayStart, start: start}, nil
+	case ']':
+		l.pos++
+		return token{typ: tokenArrayEnd, start: start}, nil
+	case '{', '}':
+		// PostScript 函数中的括号，当作关键字
+		l.pos++
+		return token{typ: tokenKeyword, value: string(b), start: start}, nil
+	case ')':
+		return token{}, errors.New("unexpected )")
+	}
+	for l.pos < len(l.data) && !isWhiteSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	switch word {
+	case "true", "false":
+		return token{typ: tokenBool, value: word == "true", start: start}, nil
+	case "null":
+		return token{typ: tokenNull, start: start}, nil
+	}
+	if v, err := strconv.Atoi(word); err == nil {
+		return token{typ: tokenInt, value: v, start: start}, nil
+	}
+	if isRealNumber(word) {
+		v, _ := strconv.ParseFloat(word, 64)
+		return token{typ: tokenReal, value: v, start: start}, nil
+	}
+	return token{typ: tokenKeyword, value: word, start: start}, nil
+}
+
+// isRealNumber 判断是否为 PDF 的实数，如 -.5 、3. 、+1.25
+func isRealNumber(word string) bool {
+	if len(word) > 0 && (word[0] == '-' || word[0] == '+') {
+		word = word[1:]
+	}
+	digits, dots := 0, 0
+	for i := 0; i < len(word); i++ {
+		switch {
+		case word[i] >= '0' && word[i] <= '9':
+			digits++
+		case word[i] == '.':
+			dots++
+		default:
+			return false
+		}
+	}
+	return digits > 0 && dots <= 1
+}
+
+// readLiteralString 读取 (...) 字符串，处理嵌套的括号和转义，返回包括括号在内的原始内容
+func (l *lexer) readLiteralString() (string, error) {
+	start := l.pos
+	depth := 0
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+		switch b {
+		case '\\':
+			l.pos++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(l.data[start:l.pos]), nil
+			}
+		}
+	}
+	return "", errors.New("expect )")
+}
+
+// readObject 读取一个完整的对象，数组和字典会递归读取。
+// 遇到操作符时返回 errNotObject
+func (l *lexer) readObject() (interface{}, error) {
+	tok, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+	return l.readObjectFrom(tok)
+}
+
+var errNotObject = errors.New("not an object")
+
+func (l *lexer) readObjectFrom(tok token) (interface{}, error) {
+	switch tok.typ {
+	case tokenName, tokenString, tokenBool, tokenReal:
+		return tok.value, nil
+	case tokenNull:
+		return nil, nil
+	case tokenInt:
+		// 可能是对象引用: id gen R
+		pos := l.pos
+		gen, err := l.next()
+		if err == nil && gen.typ == tokenInt {
+			r, err := l.next()
+			if err == nil && r.typ == tokenKeyword && r.value == "R" {
+				return &Obj{ID: tok.value.(int), GenID: gen.value.(int)}, nil
+			}
+		}
+		l.pos = pos
+		return tok.value, nil
+	case tokenArrayStart:
+		list := make([]interface{}, 0)
+		for {
+			item, err := l.next()
+			if err != nil {
+				return nil, err
+			}
+			if item.typ == tokenArrayEnd {
+				return list, nil
+			}
+			if item.typ == tokenEOF {
+				return nil, errors.New("expect ]")
+			}
+			v, err := l.readObjectFrom(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case tokenDictStart:
+		return l.readDictBody(tokenDictEnd)
+	case tokenEOF:
+		return nil, errors.New("unexpected EOF")
+	}
+	return nil, errNotObject
+}
+
+// readDictBody 读取字典的键值对，直到遇到结束 token (>> 或者内嵌图像的 ID)
+func (l *lexer) readDictBody(end int) ([]*Pair, error) {
+	dict := make([]*Pair, 0)
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.typ == end {
+			// 关键字结束时留给调用者读取
+			if end == tokenKeyword {
+				l.pos = tok.start
+			}
+			return dict, nil
+		}
+		if tok.typ != tokenName {
+			return nil, errors.New("expect /Name object")
+		}
+		value, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			// 值为 null 和没有这一项相同
+			continue
+		}
+		dict = append(dict, &Pair{Key: tok.value.(*NameObj), Value: value})
+	}
+}
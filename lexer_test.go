@@ -0,0 +1,142 @@
+package pdf
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadArray(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want []interface{}
+		rest string
+	}{
+		{"[1 0 R 2 0 R] x", []interface{}{&Obj{ID: 1}, &Obj{ID: 2, GenID: 0}}, " x"},
+		{"[5 1 R]", []interface{}{&Obj{ID: 5, GenID: 1}}, ""},
+		{"[true false true]", []interface{}{true, false, true}, ""},
+		{"[null /A/B]/C", []interface{}{nil, &NameObj{Name: "/A"}, &NameObj{Name: "/B"}}, "/C"},
+		{"[0 0 612.5 .5]", []interface{}{0, 0, 612.5, 0.5}, ""},
+		{"[-1.25 +3]", []interface{}{-1.25, 3}, ""},
+		{"[<48656C6C6F><4142>]", []interface{}{"<48656C6C6F>", "<4142>"}, ""},
+		{"[(a]b) (c\\)d)]", []interface{}{"(a]b)", "(c\\)d)"}, ""},
+		{"[[1 2][/X]<</K 1>>]", []interface{}{
+			[]interface{}{1, 2},
+			[]interface{}{&NameObj{Name: "/X"}},
+			[]*Pair{{Key: &NameObj{Name: "/K"}, Value: 1}},
+		}, ""},
+	} {
+		p := &PDF{bytes: []byte(c.in)}
+		list, err := p.readArray()
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(list, c.want) {
+			t.Errorf("%q: got %#v, want %#v", c.in, list, c.want)
+		}
+		if string(p.bytes) != c.rest {
+			t.Errorf("%q: rest %q, want %q", c.in, p.bytes, c.rest)
+		}
+	}
+}
+
+func TestReadDict(t *testing.T) {
+	p := &PDF{bytes: []byte("<</Type/Page/Parent 2 0 R/Kids[3 0 R]/Open true/Name/X/W 1.5" +
+		"/Null null/ID[<01AB>]/S<</N(x)>>>>\nstream")}
+	dict, err := p.readDict()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/Page"}},
+		{Key: &NameObj{Name: "/Parent"}, Value: &Obj{ID: 2}},
+		{Key: &NameObj{Name: "/Kids"}, Value: []interface{}{&Obj{ID: 3}}},
+		{Key: &NameObj{Name: "/Open"}, Value: true},
+		{Key: &NameObj{Name: "/Name"}, Value: &NameObj{Name: "/X"}},
+		{Key: &NameObj{Name: "/W"}, Value: 1.5},
+		{Key: &NameObj{Name: "/ID"}, Value: []interface{}{"<01AB>"}},
+		{Key: &NameObj{Name: "/S"}, Value: []*Pair{{Key: &NameObj{Name: "/N"}, Value: "(x)"}}},
+	}
+	if !reflect.DeepEqual(dict, want) {
+		t.Errorf("got %#v", dict)
+	}
+	if string(p.bytes) != "\nstream" {
+		t.Errorf("rest %q", p.bytes)
+	}
+	for _, in := range []string{"[1 2", "<</A 1", "<<1 2>>", "(abc"} {
+		p := &PDF{bytes: []byte(in)}
+		if _, err := p.readLexerObject(); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+}
+
+func TestContentRoundTrip(t *testing.T) {
+	src := "q 1 0 0 1 72 720 cm BT /F1 12 Tf (Hello \\(x\\)) Tj [(A) -120 <0041>] TJ ET\n" +
+		"0 0 10 10.5 re f /P <</MCID 3>> BDC EMC BI /W 2 /H 1 /CS /G /BPC 8 ID \x00\xff\nEI Q"
+	ops, err := ParseContent([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(ops))
+	for _, op := range ops {
+		names = append(names, op.Name)
+	}
+	want := []string{"q", "cm", "BT", "Tf", "Tj", "TJ", "ET", "re", "f", "BDC", "EMC", "BI", "Q"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("operators %v, want %v", names, want)
+	}
+	if got := ops[5].Operands[0]; !reflect.DeepEqual(got, []interface{}{"(A)", -120, "<0041>"}) {
+		t.Errorf("TJ operand %#v", got)
+	}
+	if got := ops[7].Operands[3]; got != 10.5 {
+		t.Errorf("re operand %#v", got)
+	}
+	if img := ops[11].Image; img == nil || string(img.Data) != "\x00\xff" {
+		t.Errorf("inline image %#v", img)
+	}
+	again, err := ParseContent(WriteContent(ops))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内嵌图像的位置不同，比较输出
+	if out := WriteContent(again); string(out) != string(WriteContent(ops)) {
+		t.Errorf("round trip changed operators:\n%s", out)
+	}
+}
+
+func TestReadObjectBodies(t *testing.T) {
+	bodies := []string{"0.5", "true", "false", "(a b)", "<00FF>", "/Name", "42", "-3", "[1 0.5]", "null"}
+	want := []interface{}{0.5, true, false, "(a b)", "<00FF>", &NameObj{Name: "/Name"}, 42, -3, []interface{}{1, 0.5}, nil}
+	objs := []string{"<< /Type /Catalog >>"}
+	for _, body := range bodies {
+		objs = append(objs, body)
+	}
+	p := testPDF(t, objs)
+	check := func(p *PDF) {
+		t.Helper()
+		for i, body := range bodies {
+			got := p.resolve(&Obj{ID: i + 2})
+			if want[i] == nil {
+				if obj, ok := got.(*Obj); !ok || obj.Dict != nil || obj.Array != nil {
+					t.Errorf("%s: got %#v", body, got)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(got, want[i]) {
+				t.Errorf("%s: got %#v, want %#v", body, got, want[i])
+			}
+		}
+	}
+	check(p)
+	file := filepath.Join(t.TempDir(), "objects.pdf")
+	if err := p.SaveFile(file, false); err != nil {
+		t.Fatal(err)
+	}
+	q, err := ReadFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(q)
+}
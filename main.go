@@ -22,7 +22,7 @@ func main() {
 			panic(err)
 		}
 		log.Default().Printf("read pdf file: %v\n", f.Header)
-		//	f.ExportJPEG()
+		//	f.ExportImages("./test-data")
 		f.SaveFile("./test-data/cf-test.pdf", true)
 	*/
 	f, err := pdf.ReadFromFile("./test-data/test1.pdf")
@@ -30,7 +30,7 @@ func main() {
 		panic(err)
 	}
 	log.Default().Printf("read pdf file: %v\n", f.Header)
-	//	f.ExportJPEG()
+	//	f.ExportImages("./test-data")
 	f.SaveFile("./test-data/cf-test1.pdf", true)
 	testTIFF()
 }
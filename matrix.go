@@ -0,0 +1,98 @@
+package pdf
+
+import (
+	"math"
+	"strings"
+)
+
+// matrix PDF 的变换矩阵 [a b c d e f]，点 (x, y) 变换为 (a*x + c*y + e, b*x + d*y + f)
+type matrix [6]float64
+
+var identityMatrix = matrix{1, 0, 0, 1, 0, 0}
+
+// multiply 返回先做 m 变换再做 n 变换的矩阵
+func (m matrix) multiply(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) transform(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// transformRect 返回矩形四个角变换后的外接矩形
+func (m matrix) transformRect(r Rect) Rect {
+	x0, y0 := m.transform(r.LLX, r.LLY)
+	out := Rect{x0, y0, x0, y0}
+	for _, pt := range [][2]float64{{r.URX, r.LLY}, {r.LLX, r.URY}, {r.URX, r.URY}} {
+		x, y := m.transform(pt[0], pt[1])
+		out.LLX, out.LLY = math.Min(out.LLX, x), math.Min(out.LLY, y)
+		out.URX, out.URY = math.Max(out.URX, x), math.Max(out.URY, y)
+	}
+	return out
+}
+
+// scale 矩阵大致的缩放比例，用于线宽等
+func (m matrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+// invert 逆矩阵，不可逆时返回 false
+func (m matrix) invert() (matrix, bool) {
+	det := m[0]*m[3] - m[1]*m[2]
+	if math.Abs(det) < 1e-12 {
+		return m, false
+	}
+	a, b, c, d := m[3]/det, -m[1]/det, -m[2]/det, m[0]/det
+	return matrix{a, b, c, d, -(m[4]*a + m[5]*c), -(m[4]*b + m[5]*d)}, true
+}
+
+// String 按 cm 操作符的参数格式输出
+func (m matrix) String() string {
+	list := make([]string, 0, 6)
+	for _, v := range m.operands() {
+		list = append(list, formatFloat(v.(float64)))
+	}
+	return strings.Join(list, " ")
+}
+
+// operands 作为 cm 操作符的操作数
+func (m matrix) operands() []interface{} {
+	list := make([]interface{}, 0, 6)
+	for _, v := range m {
+		v = roundFloat(v)
+		if v == 0 {
+			// 不输出 -0
+			v = 0
+		}
+		list = append(list, v)
+	}
+	return list
+}
+
+// roundFloat 保留 4 位小数，避免输出很长的浮点数
+func roundFloat(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// toMatrix 把 6 个数的数组转为矩阵
+func toMatrix(list []interface{}) (matrix, bool) {
+	var m matrix
+	if len(list) != 6 {
+		return m, false
+	}
+	for i, item := range list {
+		v, ok := toFloat(item)
+		if !ok {
+			return m, false
+		}
+		m[i] = v
+	}
+	return m, true
+}
@@ -0,0 +1,251 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Merge 按顺序合并多个文档。对象重新编号，页面树依次连接；
+// 每个文档的书签放到一个以文档标题命名的书签下面；
+// 表单域合并到一个 /AcroForm 中，重名的顶层域加上 _2、_3 等后缀；
+// 命名目标也合并，重名的同样加上后缀，并更新引用它们的链接、书签和动作
+func Merge(docs ...*PDF) (*PDF, error) {
+	if len(docs) == 0 {
+		return nil, errors.New("no document to merge")
+	}
+	var header []byte
+	for i, doc := range docs {
+		if doc == nil || doc.Trailer == nil {
+			return nil, fmt.Errorf("document %d is empty", i+1)
+		}
+		// 使用最高的版本号
+		if bytes.Compare(doc.Header, header) > 0 {
+			header = doc.Header
+		}
+	}
+	dst := newDocument(header)
+	m := &merger{dst: dst, names: make(map[string]bool), destNames: make(map[string]bool), destKeys: make(map[string]bool)}
+	m.catalog, m.pages = newObjCopier(docs[0], dst).newPageTree()
+	for i, doc := range docs {
+		m.add(doc, i+1)
+	}
+	m.finishOutlines()
+	m.finishAcroForm()
+	setDests(m.catalog, m.destTree, m.destDict)
+	dst.finishDocument(m.catalog, m.info)
+	log.Default().Printf("merge %d documents, %d pages", len(docs), dst.getIntByKey(m.pages.Dict, "/Count"))
+	return dst, nil
+}
+
+// merger 合并过程中的状态
+type merger struct {
+	dst      *PDF
+	catalog  *Obj
+	pages    *Obj
+	outlines []*Obj // 每个文档的书签
+	info     interface{}
+
+	fields   []interface{}   // 合并后的顶层表单域
+	names    map[string]bool // 已经使用的顶层域名
+	formDict []*Pair         // 合并后的 /AcroForm，除了 /Fields
+
+	destTree  []namedDest     // 合并后的 /Names /Dests
+	destDict  []namedDest     // 合并后的 /Dests
+	destNames map[string]bool // 已经使用的字符串目标名
+	destKeys  map[string]bool // 已经使用的 /Dests 中的名字
+}
+
+// add 把一个文档的页面、书签和表单域复制到结果中
+func (m *merger) add(doc *PDF, index int) {
+	c := newObjCopier(doc, m.dst)
+	c.skipPageTree()
+	pages := make([]*Obj, 0)
+	doc.walkPages(func(page *Obj, resources []*Pair) {
+		pages = append(pages, page)
+	})
+	for _, page := range pages {
+		c.reserve(page)
+	}
+	for _, page := range pages {
+		m.dst.appendKid(m.pages, c.copyPage(page, m.pages))
+	}
+	if index == 1 {
+		// 文档信息使用第一个文档的
+		m.info = c.copyValue(doc.getValueByKey(doc.Trailer.Dict, "/Info"))
+	}
+
+	root, _ := doc.resolve(doc.getValueByKey(doc.Trailer.Dict, "/Root")).(*Obj)
+	if root == nil {
+		return
+	}
+	var first *Obj
+	if len(pages) > 0 {
+		first = c.ids[pages[0]]
+	}
+	m.addOutline(c, root, first, doc.documentTitle(index))
+	m.addAcroForm(c, root)
+	m.addDests(c, root)
+}
+
+// addDests 复制文档的命名目标，重名时改名，并更新这个文档中复制过来的引用
+func (m *merger) addDests(c *objCopier, root *Obj) {
+	tree, dict := c.copyDests(root)
+	treeRenames := uniqueDests(tree, m.destNames)
+	dictRenames := uniqueDests(dict, m.destKeys)
+	m.destTree = append(m.destTree, tree...)
+	m.destDict = append(m.destDict, dict...)
+	if len(treeRenames) == 0 && len(dictRenames) == 0 {
+		return
+	}
+	for _, obj := range c.ids {
+		m.dst.renameDestRefs(obj.Dict, treeRenames, dictRenames)
+		m.dst.renameDestRefs(obj.Array, treeRenames, dictRenames)
+	}
+}
+
+// documentTitle 文档信息中的 /Title，没有时为 "Document n"
+func (p *PDF) documentTitle(index int) string {
+	info, _ := p.resolve(p.getValueByKey(p.Trailer.Dict, "/Info")).(*Obj)
+	if info != nil {
+		if title, ok := p.resolve(p.getValueByKey(info.Dict, "/Title")).(string); ok {
+			if s := decodeTextString(title); s != "" {
+				return s
+			}
+		}
+	}
+	return fmt.Sprintf("Document %d", index)
+}
+
+// addOutline 为文档创建一个书签，原来的书签作为它的子节点
+func (m *merger) addOutline(c *objCopier, root, firstPage *Obj, title string) {
+	item := c.newObj()
+	item.Dict = []*Pair{{Key: &NameObj{Name: "/Title"}, Value: encodeTextString(title)}}
+	if firstPage != nil {
+		setPairValue(&item.Dict, "/Dest", []interface{}{objRef(firstPage), &NameObj{Name: "/Fit"}})
+	}
+	src := c.src
+	outlines, _ := src.resolve(src.getValueByKey(root.Dict, "/Outlines")).(*Obj)
+	if outlines != nil {
+		// 原来的书签根节点对应新建的书签，子节点的 /Parent 会指向它
+		c.ids[outlines] = item
+		first := c.copyValue(src.getValueByKey(outlines.Dict, "/First"))
+		last := c.copyValue(src.getValueByKey(outlines.Dict, "/Last"))
+		if first != nil && last != nil {
+			setPairValue(&item.Dict, "/First", first)
+			setPairValue(&item.Dict, "/Last", last)
+			// 默认折叠
+			setPairValue(&item.Dict, "/Count", -src.outlineCount(outlines))
+		}
+	}
+	m.outlines = append(m.outlines, item)
+}
+
+// outlineCount 书签节点展开后可见的子孙节点个数
+func (p *PDF) outlineCount(node *Obj) int {
+	cnt := 0
+	seen := make(map[*Obj]bool)
+	child, _ := p.resolve(p.getValueByKey(node.Dict, "/First")).(*Obj)
+	for child != nil && !seen[child] {
+		seen[child] = true
+		cnt++
+		if n := p.getIntByKey(child.Dict, "/Count"); n > 0 {
+			cnt += n
+		}
+		child, _ = p.resolve(p.getValueByKey(child.Dict, "/Next")).(*Obj)
+	}
+	return cnt
+}
+
+// finishOutlines 把每个文档的书签连接起来，放到新的 /Outlines 下
+func (m *merger) finishOutlines() {
+	if len(m.outlines) == 0 {
+		// 没有文档有目录时也就没有书签
+		return
+	}
+	root := m.dst.addObj(&Obj{Dict: []*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/Outlines"}},
+		{Key: &NameObj{Name: "/First"}, Value: objRef(m.outlines[0])},
+		{Key: &NameObj{Name: "/Last"}, Value: objRef(m.outlines[len(m.outlines)-1])},
+		{Key: &NameObj{Name: "/Count"}, Value: len(m.outlines)},
+	}})
+	for i, item := range m.outlines {
+		setPairValue(&item.Dict, "/Parent", objRef(root))
+		if i > 0 {
+			setPairValue(&item.Dict, "/Prev", objRef(m.outlines[i-1]))
+		}
+		if i+1 < len(m.outlines) {
+			setPairValue(&item.Dict, "/Next", objRef(m.outlines[i+1]))
+		}
+	}
+	setPairValue(&m.catalog.Dict, "/Outlines", objRef(root))
+	setPairValue(&m.catalog.Dict, "/PageMode", &NameObj{Name: "/UseOutlines"})
+}
+
+// addAcroForm 复制文档的表单域，顶层域重名时改名
+func (m *merger) addAcroForm(c *objCopier, root *Obj) {
+	src := c.src
+	form := src.getResolvedDict(root.Dict, "/AcroForm")
+	if form == nil {
+		return
+	}
+	fields, _ := src.resolve(src.getValueByKey(form, "/Fields")).([]interface{})
+	for _, item := range fields {
+		ref := c.copyValue(item)
+		field, _ := m.dst.resolve(ref).(*Obj)
+		if field == nil {
+			continue
+		}
+		if t, ok := m.dst.getValueByKey(field.Dict, "/T").(string); ok {
+			name := decodeTextString(t)
+			unique := name
+			for i := 2; m.names[unique]; i++ {
+				unique = fmt.Sprintf("%s_%d", name, i)
+			}
+			if unique != name {
+				log.Default().Printf("rename form field %s to %s", name, unique)
+				setPairValue(&field.Dict, "/T", encodeTextString(unique))
+			}
+			m.names[unique] = true
+		}
+		m.fields = append(m.fields, ref)
+	}
+	// 其他项以第一个文档为准，默认资源中的字体等合并
+	for _, pair := range form {
+		switch pair.Key.Name {
+		case "/Fields":
+		case "/DR":
+			m.mergeResources(c, src.resolveDict(pair.Value))
+		case "/NeedAppearances":
+			if v, _ := pair.Value.(bool); v {
+				setPairValue(&m.formDict, "/NeedAppearances", true)
+			}
+		default:
+			if m.dst.getValueByKey(m.formDict, pair.Key.Name) == nil {
+				m.formDict = append(m.formDict, &Pair{Key: pair.Key, Value: c.copyValue(pair.Value)})
+			}
+		}
+	}
+}
+
+// mergeResources 把源文档的 dr 合并到 /AcroForm 的 /DR 中，同名的以先出现的为准
+func (m *merger) mergeResources(c *objCopier, dr []*Pair) {
+	for _, pair := range dr {
+		for _, item := range c.src.resolveDict(pair.Value) {
+			exist := m.dst.getResolvedDict(m.dst.getResolvedDict(m.formDict, "/DR"), pair.Key.Name)
+			if m.dst.getValueByKey(exist, item.Key.Name) == nil {
+				m.dst.setDictPath(&m.formDict, []string{"/DR", pair.Key.Name, item.Key.Name}, c.copyValue(item.Value))
+			}
+		}
+	}
+}
+
+// finishAcroForm 把合并后的表单域写到目录中
+func (m *merger) finishAcroForm() {
+	if len(m.fields) == 0 {
+		return
+	}
+	form := append([]*Pair{{Key: &NameObj{Name: "/Fields"}, Value: m.fields}}, m.formDict...)
+	setPairValue(&m.catalog.Dict, "/AcroForm", form)
+}
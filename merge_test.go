@@ -0,0 +1,132 @@
+package pdf
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// testCatalog 文档的目录对象
+func testCatalog(t *testing.T, p *PDF) *Obj {
+	t.Helper()
+	root, _ := p.resolve(p.getValueByKey(p.Trailer.Dict, "/Root")).(*Obj)
+	if root == nil {
+		t.Fatal("no /Root")
+	}
+	return root
+}
+
+// reload 保存后重新读取，检查写出的文档能够解析
+func reload(t *testing.T, p *PDF) *PDF {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "out.pdf")
+	if err := p.SaveFile(file, false); err != nil {
+		t.Fatal(err)
+	}
+	q, err := ReadFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// mergeDoc 两页的文档，有一个书签、一个表单域、一个命名目标和使用它的链接
+func mergeDoc(t *testing.T) *PDF {
+	return testPDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R /Outlines 3 0 R /AcroForm << /Fields [4 0 R] >> /Names << /Dests 5 0 R >> >>",
+		"<< /Type /Pages /Kids [6 0 R 7 0 R] /Count 2 >>",
+		"<< /Type /Outlines /First 8 0 R /Last 8 0 R /Count 1 >>",
+		"<< /FT /Tx /T (name) /Type /Annot /Subtype /Widget /P 6 0 R /Rect [0 0 10 10] >>",
+		"<< /Names [(intro) [6 0 R /Fit]] >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 300] /Annots [4 0 R 9 0 R] /Contents 10 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 300] >>",
+		"<< /Title (Chapter) /Parent 3 0 R /Dest [7 0 R /Fit] >>",
+		"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest (intro) >>",
+		testStream("", "0 0 10 10 re f"),
+	})
+}
+
+func TestMerge(t *testing.T) {
+	p, err := Merge(mergeDoc(t), mergeDoc(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = reload(t, p)
+	pages := p.Pages()
+	if len(pages) != 4 {
+		t.Fatalf("%d pages, want 4", len(pages))
+	}
+	ids := make(map[int]bool)
+	for _, obj := range p.Objects {
+		if ids[obj.ID] {
+			t.Errorf("object %d is used twice", obj.ID)
+		}
+		ids[obj.ID] = true
+	}
+	root := testCatalog(t, p)
+
+	// 每个文档一个书签，原来的书签在它下面，指向这个文档的页面
+	outlines, _ := p.resolve(p.getValueByKey(root.Dict, "/Outlines")).(*Obj)
+	if outlines == nil || p.getIntByKey(outlines.Dict, "/Count") != 2 {
+		t.Fatalf("outlines %v", outlines)
+	}
+	item, _ := p.resolve(p.getValueByKey(outlines.Dict, "/First")).(*Obj)
+	for i := 0; i < 2; i++ {
+		if item == nil {
+			t.Fatalf("outline item %d missing", i+1)
+		}
+		if title := decodeTextString(p.getValueByKey(item.Dict, "/Title").(string)); title != []string{"Document 1", "Document 2"}[i] {
+			t.Errorf("outline item %d title %q", i+1, title)
+		}
+		if page := p.destPage(p.getValueByKey(item.Dict, "/Dest")); page == nil || page.ID != pages[i*2].ID {
+			t.Errorf("outline item %d points to %v", i+1, page)
+		}
+		child, _ := p.resolve(p.getValueByKey(item.Dict, "/First")).(*Obj)
+		if child == nil {
+			t.Fatalf("outline item %d has no child", i+1)
+		}
+		if page := p.destPage(p.getValueByKey(child.Dict, "/Dest")); page == nil || page.ID != pages[i*2+1].ID {
+			t.Errorf("chapter %d points to %v", i+1, page)
+		}
+		item, _ = p.resolve(p.getValueByKey(item.Dict, "/Next")).(*Obj)
+	}
+
+	// 重名的表单域和命名目标加上后缀
+	fields, _ := p.resolve(p.getValueByKey(p.getResolvedDict(root.Dict, "/AcroForm"), "/Fields")).([]interface{})
+	names := make([]string, 0)
+	for _, item := range fields {
+		field, _ := p.resolve(item).(*Obj)
+		names = append(names, decodeTextString(p.getValueByKey(field.Dict, "/T").(string)))
+	}
+	if len(names) != 2 || names[0] != "name" || names[1] != "name_2" {
+		t.Errorf("fields %v", names)
+	}
+	dests := make(map[string]int)
+	p.walkNameTree(p.getResolvedDict(p.getResolvedDict(root.Dict, "/Names"), "/Dests"), func(key string, value interface{}) {
+		if page := p.destPage(value); page != nil {
+			dests[key] = page.ID
+		}
+	})
+	if len(dests) != 2 || dests["intro"] != pages[0].ID || dests["intro_2"] != pages[2].ID {
+		t.Errorf("dests %v", dests)
+	}
+	for i, page := range []*Page{pages[0], pages[2]} {
+		annots, _ := p.resolve(p.getValueByKey(page.obj.Dict, "/Annots")).([]interface{})
+		link, _ := p.resolve(annots[1]).(*Obj)
+		want := []string{"intro", "intro_2"}[i]
+		if dest, _ := p.getValueByKey(link.Dict, "/Dest").(string); string(decodePDFString(dest)) != want {
+			t.Errorf("link %d dest %q, want %q", i+1, dest, want)
+		}
+	}
+}
+
+func TestMergeWithoutRoot(t *testing.T) {
+	doc := mergeDoc(t)
+	doc.Trailer.Dict = nil
+	p, err := Merge(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.getValueByKey(testCatalog(t, p).Dict, "/Outlines") != nil {
+		t.Error("outlines written without outline items")
+	}
+}
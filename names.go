@@ -0,0 +1,247 @@
+package pdf
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// 命名目标: 链接、书签和 GoTo 动作可以用名字指定目标。
+// 字符串名字在目录的 /Names /Dests 名字树中查找，名字对象在目录的 /Dests 字典中查找 (PDF 1.1)
+
+// namedDest 一个命名目标，value 为目标数组或者 << /D [...] >> 字典
+type namedDest struct {
+	name  string // 名字树中为解码后的字符串，/Dests 字典中为带 / 的名字
+	value interface{}
+}
+
+// walkNameTree 按顺序遍历名字树的叶子节点中的每一项，key 为解码后的字符串
+func (p *PDF) walkNameTree(node []*Pair, fn func(key string, value interface{})) {
+	seen := make(map[*Obj]bool)
+	var walk func(node []*Pair, depth int)
+	walk = func(node []*Pair, depth int) {
+		if depth > 32 {
+			return
+		}
+		names, _ := p.resolve(p.getValueByKey(node, "/Names")).([]interface{})
+		for i := 0; i+1 < len(names); i += 2 {
+			if key, ok := p.resolve(names[i]).(string); ok {
+				fn(string(decodePDFString(key)), names[i+1])
+			}
+		}
+		kids, _ := p.resolve(p.getValueByKey(node, "/Kids")).([]interface{})
+		for _, kid := range kids {
+			obj, _ := p.resolve(kid).(*Obj)
+			if obj == nil || seen[obj] {
+				continue
+			}
+			seen[obj] = true
+			walk(obj.Dict, depth+1)
+		}
+	}
+	walk(node, 0)
+}
+
+// newNameTree 生成只有根节点的名字树，名字按字节排序
+func newNameTree(entries []namedDest) []*Pair {
+	sorted := append([]namedDest{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+	names := make([]interface{}, 0, len(sorted)*2)
+	for _, e := range sorted {
+		names = append(names, encodePDFString([]byte(e.name)), e.value)
+	}
+	return []*Pair{{Key: &NameObj{Name: "/Names"}, Value: names}}
+}
+
+// destPage 目标指向的页面对象，不是指向本文档页面的目标返回 nil
+func (p *PDF) destPage(value interface{}) *Obj {
+	if dict := p.resolveDict(value); dict != nil {
+		value = p.getValueByKey(dict, "/D")
+	}
+	dest, _ := p.resolve(value).([]interface{})
+	if len(dest) == 0 {
+		return nil
+	}
+	ref, _ := dest[0].(*Obj)
+	return p.getObj(ref)
+}
+
+// copyDests 复制源文档目录中的命名目标，只保留指向已经复制的页面的。
+// tree 为 /Names /Dests 中的，dict 为 /Dests 字典中的
+func (c *objCopier) copyDests(root *Obj) (tree, dict []namedDest) {
+	src := c.src
+	keep := func(value interface{}) bool {
+		page := src.destPage(value)
+		return page != nil && c.ids[page] != nil
+	}
+	if node := src.getResolvedDict(src.getResolvedDict(root.Dict, "/Names"), "/Dests"); node != nil {
+		src.walkNameTree(node, func(key string, value interface{}) {
+			if keep(value) {
+				tree = append(tree, namedDest{name: key, value: c.copyValue(value)})
+			}
+		})
+	}
+	for _, pair := range src.getResolvedDict(root.Dict, "/Dests") {
+		if keep(pair.Value) {
+			dict = append(dict, namedDest{name: pair.Key.Name, value: c.copyValue(pair.Value)})
+		}
+	}
+	return tree, dict
+}
+
+// setDests 把命名目标写到目录中
+func setDests(catalog *Obj, tree, dict []namedDest) {
+	if len(tree) > 0 {
+		setPairValue(&catalog.Dict, "/Names", []*Pair{{Key: &NameObj{Name: "/Dests"}, Value: newNameTree(tree)}})
+	}
+	if len(dict) > 0 {
+		dests := make([]*Pair, 0, len(dict))
+		for _, e := range dict {
+			dests = append(dests, &Pair{Key: &NameObj{Name: e.name}, Value: e.value})
+		}
+		setPairValue(&catalog.Dict, "/Dests", dests)
+	}
+}
+
+// uniqueDests 重名的命名目标加上 _2、_3 等后缀，返回改过的名字
+func uniqueDests(entries []namedDest, used map[string]bool) map[string]string {
+	renames := make(map[string]string)
+	for i, e := range entries {
+		unique := e.name
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%s_%d", e.name, n)
+		}
+		if unique != e.name {
+			log.Default().Printf("rename destination %s to %s", e.name, unique)
+			renames[e.name] = unique
+			entries[i].name = unique
+		}
+		used[unique] = true
+	}
+	return renames
+}
+
+// renameDestRefs 按改过的名字更新 value 中链接、书签的 /Dest 和 GoTo 动作的 /D。
+// tree 为字符串名字的改动，dict 为名字对象的改动
+func (p *PDF) renameDestRefs(value interface{}, tree, dict map[string]string) {
+	rename := func(dest interface{}) interface{} {
+		switch v := dest.(type) {
+		case string:
+			if name, ok := tree[string(decodePDFString(v))]; ok {
+				return encodePDFString([]byte(name))
+			}
+		case *NameObj:
+			if name, ok := dict[v.Name]; ok {
+				return &NameObj{Name: name}
+			}
+		}
+		return dest
+	}
+	switch v := value.(type) {
+	case []*Pair:
+		isGoTo := false
+		if s := p.getNameObjByKey(v, "/S"); s != nil && s.Name == "/GoTo" {
+			isGoTo = true
+		}
+		for _, pair := range v {
+			switch {
+			case pair.Key.Name == "/Dest", pair.Key.Name == "/D" && isGoTo:
+				pair.Value = rename(pair.Value)
+			default:
+				p.renameDestRefs(pair.Value, tree, dict)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			p.renameDestRefs(item, tree, dict)
+		}
+	}
+}
+
+// removeDests 删除目录中 drop 返回 true 的命名目标，没有项的名字树节点也删除。
+// 返回删除的名字，tree 为字符串名字，dict 为 /Dests 字典中的名字
+func (p *PDF) removeDests(root *Obj, drop func(value interface{}) bool) (tree, dict map[string]bool) {
+	tree = make(map[string]bool)
+	dict = make(map[string]bool)
+	if node := p.getResolvedDict(p.getResolvedDict(root.Dict, "/Names"), "/Dests"); node != nil {
+		kids := make([]*Obj, 0)
+		p.pruneNameTree(node, func(key string, value interface{}) bool {
+			if drop(value) {
+				tree[key] = true
+				return true
+			}
+			return false
+		}, &kids, 0)
+		p.removeUnreferenced(kids)
+	}
+	if dests := p.getResolvedDict(root.Dict, "/Dests"); dests != nil {
+		list := make([]*Pair, 0, len(dests))
+		for _, pair := range dests {
+			if drop(pair.Value) {
+				dict[pair.Key.Name] = true
+			} else {
+				list = append(list, pair)
+			}
+		}
+		if len(list) != len(dests) {
+			p.setDictPath(&root.Dict, []string{"/Dests"}, list)
+		}
+	}
+	return tree, dict
+}
+
+// pruneNameTree 删除名字树中 drop 返回 true 的项，没有项的子节点从 /Kids 中去掉并放到 removed 中，
+// 更新子节点的 /Limits。返回剩下的最小和最大的名字，没有剩下的项时 ok 为 false
+func (p *PDF) pruneNameTree(node []*Pair, drop func(key string, value interface{}) bool, removed *[]*Obj, depth int) (first, last string, ok bool) {
+	keep := func(key string) {
+		if !ok || key < first {
+			first = key
+		}
+		if !ok || key > last {
+			last = key
+		}
+		ok = true
+	}
+	for _, pair := range node {
+		list, _ := p.resolve(pair.Value).([]interface{})
+		switch pair.Key.Name {
+		case "/Names":
+			rest := make([]interface{}, 0, len(list))
+			for i := 0; i+1 < len(list); i += 2 {
+				if s, isKey := p.resolve(list[i]).(string); isKey {
+					key := string(decodePDFString(s))
+					if drop(key, list[i+1]) {
+						continue
+					}
+					keep(key)
+				}
+				rest = append(rest, list[i], list[i+1])
+			}
+			pair.Value = rest
+		case "/Kids":
+			if depth > 32 {
+				continue
+			}
+			rest := make([]interface{}, 0, len(list))
+			for _, item := range list {
+				kid, _ := p.resolve(item).(*Obj)
+				if kid == nil {
+					continue
+				}
+				lo, hi, found := p.pruneNameTree(kid.Dict, drop, removed, depth+1)
+				if !found {
+					*removed = append(*removed, kid)
+					continue
+				}
+				setPairValue(&kid.Dict, "/Limits", []interface{}{encodePDFString([]byte(lo)), encodePDFString([]byte(hi))})
+				keep(lo)
+				keep(hi)
+				rest = append(rest, item)
+			}
+			pair.Value = rest
+		}
+	}
+	return first, last, ok
+}
@@ -0,0 +1,319 @@
+package pdf
+
+import (
+	"fmt"
+	"math"
+)
+
+// walkPages 按顺序遍历页面树 /Root -> /Pages -> /Kids，
+// fn 的参数为页面对象以及它的 /Resources (包括从父节点继承的)
+func (p *PDF) walkPages(fn func(page *Obj, resources []*Pair)) {
+	if p.Trailer == nil {
+		return
+	}
+	root, _ := p.resolve(p.getValueByKey(p.Trailer.Dict, "/Root")).(*Obj)
+	if root == nil {
+		return
+	}
+	pages, _ := p.resolve(p.getValueByKey(root.Dict, "/Pages")).(*Obj)
+	p.walkPageNode(pages, nil, map[*Obj]bool{}, fn)
+}
+
+func (p *PDF) walkPageNode(node *Obj, resources []*Pair, visited map[*Obj]bool, fn func(page *Obj, resources []*Pair)) {
+	// 防止页面树里有环
+	if node == nil || visited[node] {
+		return
+	}
+	visited[node] = true
+	if res := p.getResolvedDict(node.Dict, "/Resources"); res != nil {
+		resources = res
+	}
+	kids, ok := p.resolve(p.getValueByKey(node.Dict, "/Kids")).([]interface{})
+	typ := p.getNameObjByKey(node.Dict, "/Type")
+	if !ok || (typ != nil && typ.Name == "/Page") {
+		fn(node, resources)
+		return
+	}
+	for _, kid := range kids {
+		obj, _ := p.resolve(kid).(*Obj)
+		p.walkPageNode(obj, resources, visited, fn)
+	}
+}
+
+// pageContents 返回页面的内容流对象，/Contents 可能是单个引用也可能是数组
+func (p *PDF) pageContents(page *Obj) []*Obj {
+	list := make([]*Obj, 0)
+	switch v := p.resolve(p.getValueByKey(page.Dict, "/Contents")).(type) {
+	case *Obj:
+		if v.Stream != nil {
+			list = append(list, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			obj, _ := p.resolve(item).(*Obj)
+			if obj != nil && obj.Stream != nil {
+				list = append(list, obj)
+			}
+		}
+	}
+	return list
+}
+
+// resourcesOwner 返回页面 /Resources 实际所在的节点，可能是从父节点继承的
+func (p *PDF) resourcesOwner(page *Obj) *Obj {
+	node := page
+	for i := 0; node != nil && i < 64; i++ {
+		if p.getValueByKey(node.Dict, "/Resources") != nil {
+			return node
+		}
+		node, _ = p.resolve(p.getValueByKey(node.Dict, "/Parent")).(*Obj)
+	}
+	return page
+}
+
+// contentStream 内容流对象，以及它所属的页面或 Form XObject
+type contentStream struct {
+	obj       *Obj
+	owner     *Obj // /Resources 所在的对象
+	resources []*Pair
+	page      int // 页码，从1开始
+}
+
+// walkContentStreams 遍历所有页面的内容流，以及页面上用到的 Form XObject
+func (p *PDF) walkContentStreams(fn func(cs *contentStream)) {
+	num := 0
+	p.walkPages(func(page *Obj, resources []*Pair) {
+		num++
+		for _, obj := range p.pageContents(page) {
+			fn(&contentStream{obj: obj, owner: p.resourcesOwner(page), resources: resources, page: num})
+		}
+		p.walkForms(resources, make(map[*Obj]bool), func(form *Obj) {
+			f := p.openForm(form, resources, 0)
+			owner := form
+			if f.inherited {
+				owner = p.resourcesOwner(page)
+			}
+			fn(&contentStream{obj: form, owner: owner, resources: f.resources, page: num})
+		})
+	})
+}
+
+// walkForms 遍历资源字典中的 Form XObject，包括嵌套的
+func (p *PDF) walkForms(resources []*Pair, seen map[*Obj]bool, fn func(form *Obj)) {
+	for _, pair := range p.getResolvedDict(resources, "/XObject") {
+		obj, _ := p.resolve(pair.Value).(*Obj)
+		if obj == nil || seen[obj] || obj.Stream == nil {
+			continue
+		}
+		seen[obj] = true
+		subtype := p.getNameObjByKey(obj.Dict, "/Subtype")
+		if subtype != nil && subtype.Name == "/Form" {
+			fn(obj)
+			p.walkForms(p.getResolvedDict(obj.Dict, "/Resources"), seen, fn)
+		}
+	}
+}
+
+// maxFormDepth Form XObject 嵌套的最大层数
+const maxFormDepth = 16
+
+// formXObject 画出 Form XObject 时使用的矩阵和资源
+type formXObject struct {
+	matrix    matrix  // /Matrix，没有时为单位矩阵
+	resources []*Pair // Form 的资源
+	inherited bool    // Form 没有自己的资源，resources 为调用它的内容流的
+}
+
+// openForm obj 为 Form XObject 并且嵌套不超过 maxFormDepth 层时返回它的矩阵和资源，否则返回 nil。
+// 老的文件中 Form 可以没有自己的资源，使用调用它的内容流的 resources
+func (p *PDF) openForm(obj *Obj, resources []*Pair, depth int) *formXObject {
+	if obj == nil || obj.Stream == nil || depth > maxFormDepth {
+		return nil
+	}
+	if subtype := p.getNameObjByKey(obj.Dict, "/Subtype"); subtype == nil || subtype.Name != "/Form" {
+		return nil
+	}
+	f := &formXObject{matrix: identityMatrix, resources: p.getResolvedDict(obj.Dict, "/Resources")}
+	if list, ok := p.resolve(p.getValueByKey(obj.Dict, "/Matrix")).([]interface{}); ok {
+		if m, ok := toMatrix(list); ok {
+			f.matrix = m
+		}
+	}
+	if f.resources == nil {
+		f.resources, f.inherited = resources, true
+	}
+	return f
+}
+
+// Rect 矩形，单位为点 (1/72 英寸)
+type Rect struct {
+	LLX float64 `json:"llx"`
+	LLY float64 `json:"lly"`
+	URX float64 `json:"urx"`
+	URY float64 `json:"ury"`
+}
+
+func (r Rect) Width() float64 {
+	return r.URX - r.LLX
+}
+
+func (r Rect) Height() float64 {
+	return r.URY - r.LLY
+}
+
+// normalize 保证左下角在右上角的左下方
+func (r Rect) normalize() Rect {
+	if r.LLX > r.URX {
+		r.LLX, r.URX = r.URX, r.LLX
+	}
+	if r.LLY > r.URY {
+		r.LLY, r.URY = r.URY, r.LLY
+	}
+	return r
+}
+
+// intersect 两个矩形的交集，不相交时返回空矩形
+func (r Rect) intersect(o Rect) Rect {
+	r.LLX, r.LLY = math.Max(r.LLX, o.LLX), math.Max(r.LLY, o.LLY)
+	r.URX, r.URY = math.Min(r.URX, o.URX), math.Min(r.URY, o.URY)
+	if r.LLX >= r.URX || r.LLY >= r.URY {
+		return Rect{}
+	}
+	return r
+}
+
+// union 包含两个矩形的最小矩形，空矩形不参与计算
+func (r Rect) union(o Rect) Rect {
+	if r.isEmpty() {
+		return o
+	}
+	if o.isEmpty() {
+		return r
+	}
+	r.LLX, r.LLY = math.Min(r.LLX, o.LLX), math.Min(r.LLY, o.LLY)
+	r.URX, r.URY = math.Max(r.URX, o.URX), math.Max(r.URY, o.URY)
+	return r
+}
+
+// isEmpty 宽或者高为0
+func (r Rect) isEmpty() bool {
+	return r.LLX >= r.URX || r.LLY >= r.URY
+}
+
+// array 转为 PDF 数组
+func (r Rect) array() []interface{} {
+	return []interface{}{roundFloat(r.LLX), roundFloat(r.LLY), roundFloat(r.URX), roundFloat(r.URY)}
+}
+
+// letterBox 没有 /MediaBox 时使用的默认页面大小
+var letterBox = Rect{0, 0, 612, 792}
+
+// Page 文档中的一页，MediaBox、CropBox、Rotate 和 Resources 已经处理了从父节点的继承
+type Page struct {
+	Number    int // 页码，从1开始
+	ID        int // 页面对象的序号
+	GenID     int
+	MediaBox  Rect
+	CropBox   Rect // 没有时和 MediaBox 相同
+	Rotate    int  // 顺时针旋转的角度，0、90、180 或 270
+	Resources []*Pair
+
+	pdf *PDF
+	obj *Obj
+}
+
+// Size 页面显示的宽和高，按 CropBox 计算，旋转 90 或 270 度时交换宽高
+func (pg *Page) Size() (width, height float64) {
+	width, height = pg.CropBox.Width(), pg.CropBox.Height()
+	if pg.Rotate%180 != 0 {
+		width, height = height, width
+	}
+	return width, height
+}
+
+// Pages 按顺序返回文档中的所有页面
+func (p *PDF) Pages() []*Page {
+	list := make([]*Page, 0)
+	p.walkPages(func(page *Obj, resources []*Pair) {
+		list = append(list, p.newPage(page, resources, len(list)+1))
+	})
+	return list
+}
+
+// NumPages 返回页数
+func (p *PDF) NumPages() int {
+	cnt := 0
+	p.walkPages(func(page *Obj, resources []*Pair) {
+		cnt++
+	})
+	return cnt
+}
+
+// Page 返回第 n 页，n 从1开始
+func (p *PDF) Page(n int) (*Page, error) {
+	var found *Page
+	num := 0
+	p.walkPages(func(page *Obj, resources []*Pair) {
+		num++
+		if num == n {
+			found = p.newPage(page, resources, n)
+		}
+	})
+	if found == nil {
+		return nil, fmt.Errorf("page %d not found", n)
+	}
+	return found, nil
+}
+
+func (p *PDF) newPage(page *Obj, resources []*Pair, num int) *Page {
+	pg := &Page{
+		Number:    num,
+		ID:        page.ID,
+		GenID:     page.GenID,
+		MediaBox:  letterBox,
+		Resources: resources,
+		pdf:       p,
+		obj:       page,
+	}
+	if box, ok := p.getRect(p.inheritedValue(page, "/MediaBox")); ok {
+		pg.MediaBox = box
+	}
+	pg.CropBox = pg.MediaBox
+	if box, ok := p.getRect(p.inheritedValue(page, "/CropBox")); ok {
+		if box = box.intersect(pg.MediaBox); box.Width() > 0 {
+			pg.CropBox = box
+		}
+	}
+	if rotate, ok := toFloat(p.resolve(p.inheritedValue(page, "/Rotate"))); ok {
+		// 只能是 90 的倍数，也可能是负数
+		pg.Rotate = ((int(rotate)/90*90)%360 + 360) % 360
+	}
+	return pg
+}
+
+// inheritedValue 返回页面的属性，页面中没有时从父节点继承
+func (p *PDF) inheritedValue(page *Obj, key string) interface{} {
+	node := page
+	for i := 0; node != nil && i < 64; i++ {
+		if v := p.getValueByKey(node.Dict, key); v != nil {
+			return v
+		}
+		node, _ = p.resolve(p.getValueByKey(node.Dict, "/Parent")).(*Obj)
+	}
+	return nil
+}
+
+// getRect 把 [llx lly urx ury] 数组转为 Rect
+func (p *PDF) getRect(value interface{}) (Rect, bool) {
+	list, ok := p.resolve(value).([]interface{})
+	if !ok || len(list) != 4 {
+		return Rect{}, false
+	}
+	var v [4]float64
+	for i, item := range list {
+		if v[i], ok = toFloat(p.resolve(item)); !ok {
+			return Rect{}, false
+		}
+	}
+	return Rect{v[0], v[1], v[2], v[3]}.normalize(), true
+}
@@ -0,0 +1,60 @@
+package pdf
+
+import "testing"
+
+func TestPageInheritance(t *testing.T) {
+	p := testPDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 3 /MediaBox [0 0 612 792] /Rotate 90 /Resources << /Font << /F1 7 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [200 300 0 0] /Rotate -90 >>",
+		"<< /Type /Pages /Parent 2 0 R /Kids [5 0 R 6 0 R] /Count 2 /Rotate 180 /CropBox [10 10 100 200] /Resources 8 0 R >>",
+		"<< /Type /Page /Parent 4 0 R >>",
+		"<< /Type /Page /Parent 4 0 R /Rotate 450 /CropBox [0 0 1000 1000] /Resources << >> >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Font << /F2 7 0 R >> >>",
+	})
+	if n := p.NumPages(); n != 3 {
+		t.Fatalf("%d pages, want 3", n)
+	}
+	pages := p.Pages()
+	for i, tc := range []struct {
+		id                int
+		mediaBox, cropBox Rect
+		rotate            int
+		width, height     float64
+		font              string // 资源中的字体，空串表示没有字体
+	}{
+		// 自己的 /MediaBox 规范化，负的 /Rotate 转为 0 到 270，从根节点继承 /Resources
+		{3, Rect{0, 0, 200, 300}, Rect{0, 0, 200, 300}, 270, 300, 200, "/F1"},
+		// 从中间节点继承 /CropBox、/Rotate 和间接引用的 /Resources，从根节点继承 /MediaBox
+		{5, Rect{0, 0, 612, 792}, Rect{10, 10, 100, 200}, 180, 90, 190, "/F2"},
+		// 自己的属性优先，/CropBox 不超出 /MediaBox
+		{6, Rect{0, 0, 612, 792}, Rect{0, 0, 612, 792}, 90, 792, 612, ""},
+	} {
+		pg := pages[i]
+		if pg.Number != i+1 || pg.ID != tc.id {
+			t.Errorf("page %d: number %d, id %d", i+1, pg.Number, pg.ID)
+		}
+		if pg.MediaBox != tc.mediaBox || pg.CropBox != tc.cropBox || pg.Rotate != tc.rotate {
+			t.Errorf("page %d: media box %v, crop box %v, rotate %d", i+1, pg.MediaBox, pg.CropBox, pg.Rotate)
+		}
+		if w, h := pg.Size(); w != tc.width || h != tc.height {
+			t.Errorf("page %d: size %v x %v, want %v x %v", i+1, w, h, tc.width, tc.height)
+		}
+		font := ""
+		for _, pair := range p.getResolvedDict(pg.Resources, "/Font") {
+			font = pair.Key.Name
+		}
+		if font != tc.font {
+			t.Errorf("page %d: font %q, want %q", i+1, font, tc.font)
+		}
+	}
+	// Page 和 Pages 的结果一致
+	pg, err := p.Page(2)
+	if err != nil || pg.ID != 5 || pg.CropBox != pages[1].CropBox {
+		t.Errorf("page 2: %+v, %v", pg, err)
+	}
+	if _, err := p.Page(4); err == nil {
+		t.Error("page 4 found")
+	}
+}
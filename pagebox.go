@@ -0,0 +1,134 @@
+package pdf
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// BoxType 页面的边界框
+type BoxType string
+
+const (
+	BoxMedia BoxType = "/MediaBox"
+	BoxCrop  BoxType = "/CropBox"
+	BoxBleed BoxType = "/BleedBox"
+	BoxTrim  BoxType = "/TrimBox"
+	BoxArt   BoxType = "/ArtBox"
+)
+
+// 常用的纸张大小，单位为点
+var (
+	PaperA3     = Rect{0, 0, 841.89, 1190.55}
+	PaperA4     = Rect{0, 0, 595.28, 841.89}
+	PaperA5     = Rect{0, 0, 419.53, 595.28}
+	PaperLetter = Rect{0, 0, 612, 792}
+	PaperLegal  = Rect{0, 0, 612, 1008}
+)
+
+// SetPageBox 设置第 n 页的边界框
+func (p *PDF) SetPageBox(n int, box BoxType, r Rect) error {
+	switch box {
+	case BoxMedia, BoxCrop, BoxBleed, BoxTrim, BoxArt:
+	default:
+		return fmt.Errorf("unknown page box %s", box)
+	}
+	r = r.normalize()
+	if r.isEmpty() {
+		return fmt.Errorf("empty page box %+v", r)
+	}
+	page, err := p.pageObj(n)
+	if err != nil {
+		return err
+	}
+	p.setDictValue(page, string(box), r.array())
+	return nil
+}
+
+// ScalePage 把第 n 页缩放到 width x height 点的纸张上，例如 A4 和 Letter 互转。
+// 按比例缩放后居中，内容用 cm 变换包起来，注释的位置也一起变换。
+// 宽高按页面显示的方向，旋转了 90 或 270 度的页面会交换宽高
+func (p *PDF) ScalePage(n int, width, height float64) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid page size %vx%v", width, height)
+	}
+	pg, err := p.Page(n)
+	if err != nil {
+		return err
+	}
+	page := pg.obj
+	if pg.Rotate%180 != 0 {
+		width, height = height, width
+	}
+	src := pg.CropBox
+	s := math.Min(width/src.Width(), height/src.Height())
+	m := matrix{s, 0, 0, s, (width-src.Width()*s)/2 - src.LLX*s, (height-src.Height()*s)/2 - src.LLY*s}
+
+	p.materializeInherited(page)
+	p.wrapContent(page, []byte(fmt.Sprintf("q %s cm\n", m)), []byte("Q\n"))
+	media := Rect{0, 0, width, height}
+	p.setDictValue(page, "/MediaBox", media.array())
+	p.deleteDictValue(page, "/CropBox")
+	for _, box := range []BoxType{BoxBleed, BoxTrim, BoxArt} {
+		if r, ok := p.getRect(p.getValueByKey(page.Dict, string(box))); ok {
+			p.setDictValue(page, string(box), m.transformRect(r).intersect(media).array())
+		}
+	}
+	p.transformAnnots(page, m)
+	log.Default().Printf("scale page %d by %.4f to %vx%v", n, s, width, height)
+	return nil
+}
+
+// transformAnnots 按矩阵变换页面上注释的 /Rect 和 /QuadPoints
+func (p *PDF) transformAnnots(page *Obj, m matrix) {
+	annots, _ := p.resolve(p.getValueByKey(page.Dict, "/Annots")).([]interface{})
+	for _, item := range annots {
+		annot, _ := p.resolve(item).(*Obj)
+		if annot == nil {
+			continue
+		}
+		if r, ok := p.getRect(p.getValueByKey(annot.Dict, "/Rect")); ok {
+			p.setDictValue(annot, "/Rect", m.transformRect(r).array())
+		}
+		quads, ok := p.resolve(p.getValueByKey(annot.Dict, "/QuadPoints")).([]interface{})
+		if !ok || len(quads)%2 != 0 {
+			continue
+		}
+		list := make([]interface{}, 0, len(quads))
+		for i := 0; i < len(quads); i += 2 {
+			x, ok1 := toFloat(p.resolve(quads[i]))
+			y, ok2 := toFloat(p.resolve(quads[i+1]))
+			if !ok1 || !ok2 {
+				list = nil
+				break
+			}
+			x, y = m.transform(x, y)
+			list = append(list, roundFloat(x), roundFloat(y))
+		}
+		if list != nil {
+			p.setDictValue(annot, "/QuadPoints", list)
+		}
+	}
+}
+
+// AutoCrop 按第 n 页内容的外接矩形设置 /CropBox，四周留出 margin 点的边，
+// 白色填充的背景不算内容。页面没有内容时不修改
+func (p *PDF) AutoCrop(n int, margin float64) error {
+	pg, err := p.Page(n)
+	if err != nil {
+		return err
+	}
+	bounds := p.contentBounds(pg.obj, pg.Resources)
+	if bounds.isEmpty() {
+		log.Default().Printf("page %d has no content, skip crop", n)
+		return nil
+	}
+	crop := Rect{bounds.LLX - margin, bounds.LLY - margin, bounds.URX + margin, bounds.URY + margin}
+	crop = crop.intersect(pg.MediaBox)
+	if crop.isEmpty() {
+		log.Default().Printf("page %d content is outside media box, skip crop", n)
+		return nil
+	}
+	p.setDictValue(pg.obj, "/CropBox", crop.array())
+	return nil
+}
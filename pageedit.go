@@ -0,0 +1,476 @@
+package pdf
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// 页面的编辑: 删除、移动、旋转、插入空白页和复制页面，直接修改页面树
+
+// DeletePage 删除第 n 页 (从1开始)。书签中指向它的目标被去掉，
+// 其他页面上指向它的链接注释和指向它的命名目标被删除，
+// 它上面的表单控件从 /AcroForm 中去掉，其余指向它的引用改为 null，
+// 只被它使用的内容流、资源和注释也从文档中删除
+func (p *PDF) DeletePage(n int) error {
+	page, err := p.pageObj(n)
+	if err != nil {
+		return err
+	}
+	// 内容流、资源和注释等只被这一页使用的对象也删除
+	refs := p.referencedObjs(page)
+	p.detachPage(page)
+	p.removeObj(page)
+	p.removePageWidgets(page)
+	p.removePageRefs(page)
+	p.removeUnreferenced(refs)
+	log.Default().Printf("delete page %d", n)
+	return nil
+}
+
+// MovePage 把第 from 页移动到第 to 页的位置，其他页面顺序不变
+func (p *PDF) MovePage(from, to int) error {
+	total := p.NumPages()
+	if to < 1 || to > total {
+		return fmt.Errorf("page %d not found", to)
+	}
+	page, err := p.pageObj(from)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	p.detachPage(page)
+	return p.insertPage(page, to)
+}
+
+// RotatePage 把第 n 页顺时针旋转 degrees 度，degrees 必须是 90 的倍数，可以是负数
+func (p *PDF) RotatePage(n, degrees int) error {
+	if degrees%90 != 0 {
+		return fmt.Errorf("rotation %d is not a multiple of 90", degrees)
+	}
+	pg, err := p.Page(n)
+	if err != nil {
+		return err
+	}
+	p.setDictValue(pg.obj, "/Rotate", ((pg.Rotate+degrees)%360+360)%360)
+	return nil
+}
+
+// InsertBlankPage 在第 n 页之前插入一个 width x height 点的空白页，
+// n 为页数加一时加到最后
+func (p *PDF) InsertBlankPage(n int, width, height float64) error {
+	if n < 1 || n > p.NumPages()+1 {
+		return fmt.Errorf("page %d not found", n)
+	}
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid page size %vx%v", width, height)
+	}
+	page := p.addObj(&Obj{Dict: []*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/Page"}},
+		{Key: &NameObj{Name: "/MediaBox"}, Value: []interface{}{0, 0, width, height}},
+		{Key: &NameObj{Name: "/Resources"}, Value: []*Pair{}},
+	}})
+	return p.insertPage(page, n)
+}
+
+// DuplicatePage 复制第 n 页，放到它的后面。内容和资源和原来的页面共用，
+// 注释复制一份，表单域的控件和弹出窗口不复制
+func (p *PDF) DuplicatePage(n int) error {
+	page, err := p.pageObj(n)
+	if err != nil {
+		return err
+	}
+	p.materializeInherited(page)
+	dup := p.addObj(&Obj{Dict: cloneDict(page.Dict)})
+	if annots, ok := p.resolve(p.getValueByKey(page.Dict, "/Annots")).([]interface{}); ok {
+		list := make([]interface{}, 0, len(annots))
+		for _, item := range annots {
+			annot, _ := p.resolve(item).(*Obj)
+			if annot == nil {
+				continue
+			}
+			subtype := p.getNameObjByKey(annot.Dict, "/Subtype")
+			if subtype != nil && (subtype.Name == "/Widget" || subtype.Name == "/Popup") {
+				continue
+			}
+			clone := p.addObj(&Obj{Dict: cloneDict(annot.Dict)})
+			p.deleteDictValue(clone, "/Popup")
+			p.setDictValue(clone, "/P", objRef(dup))
+			list = append(list, objRef(clone))
+		}
+		p.setDictValue(dup, "/Annots", list)
+	}
+	return p.insertPage(dup, n+1)
+}
+
+// pageObj 返回第 n 页的页面对象
+func (p *PDF) pageObj(n int) (*Obj, error) {
+	var found *Obj
+	num := 0
+	p.walkPages(func(page *Obj, resources []*Pair) {
+		num++
+		if num == n {
+			found = page
+		}
+	})
+	if found == nil {
+		return nil, fmt.Errorf("page %d not found", n)
+	}
+	return found, nil
+}
+
+// pageTreeRoot 返回页面树的根节点
+func (p *PDF) pageTreeRoot() *Obj {
+	if p.Trailer == nil {
+		return nil
+	}
+	root, _ := p.resolve(p.getValueByKey(p.Trailer.Dict, "/Root")).(*Obj)
+	if root == nil {
+		return nil
+	}
+	pages, _ := p.resolve(p.getValueByKey(root.Dict, "/Pages")).(*Obj)
+	return pages
+}
+
+// getKids 返回页面树节点的 /Kids
+func (p *PDF) getKids(node *Obj) []interface{} {
+	kids, _ := p.resolve(p.getValueByKey(node.Dict, "/Kids")).([]interface{})
+	return kids
+}
+
+// setKids 设置页面树节点的 /Kids，/Kids 是数组对象的引用时修改数组对象
+func (p *PDF) setKids(node *Obj, kids []interface{}) {
+	if ref, ok := p.getValueByKey(node.Dict, "/Kids").(*Obj); ok {
+		if obj := p.getObj(ref); obj != nil && obj.Array != nil {
+			obj.Array = kids
+			return
+		}
+	}
+	p.setDictValue(node, "/Kids", kids)
+}
+
+// adjustCount 从 node 开始向上更新页面树节点的 /Count
+func (p *PDF) adjustCount(node *Obj, delta int) {
+	for i := 0; node != nil && i < 64; i++ {
+		p.setDictValue(node, "/Count", p.getIntByKey(node.Dict, "/Count")+delta)
+		node, _ = p.resolve(p.getValueByKey(node.Dict, "/Parent")).(*Obj)
+	}
+}
+
+// materializeInherited 把从父节点继承的属性写到页面中，移动页面后属性不变
+func (p *PDF) materializeInherited(page *Obj) {
+	for _, key := range inheritedKeys {
+		if p.getValueByKey(page.Dict, key) == nil {
+			if v := p.inheritedValue(page, key); v != nil {
+				p.setDictValue(page, key, v)
+			}
+		}
+	}
+}
+
+// detachPage 把页面从页面树中摘下来
+func (p *PDF) detachPage(page *Obj) {
+	p.materializeInherited(page)
+	parent, _ := p.resolve(p.getValueByKey(page.Dict, "/Parent")).(*Obj)
+	if parent == nil {
+		return
+	}
+	kids := p.getKids(parent)
+	list := make([]interface{}, 0, len(kids))
+	for _, kid := range kids {
+		if obj, _ := p.resolve(kid).(*Obj); obj != page {
+			list = append(list, kid)
+		}
+	}
+	p.setKids(parent, list)
+	p.adjustCount(parent, -1)
+	p.deleteDictValue(page, "/Parent")
+}
+
+// insertPage 把页面插到第 n 页之前，n 为页数加一时加到最后
+func (p *PDF) insertPage(page *Obj, n int) error {
+	total := p.NumPages()
+	if n < 1 || n > total+1 {
+		return fmt.Errorf("page %d not found", n)
+	}
+	p.materializeInherited(page)
+	var parent *Obj
+	index := 0
+	if total == 0 {
+		parent = p.pageTreeRoot()
+		if parent == nil {
+			return fmt.Errorf("page tree not found")
+		}
+	} else {
+		target := n
+		if n > total {
+			target = total
+		}
+		next, _ := p.pageObj(target)
+		parent, _ = p.resolve(p.getValueByKey(next.Dict, "/Parent")).(*Obj)
+		if parent == nil {
+			return fmt.Errorf("page %d has no parent", target)
+		}
+		for i, kid := range p.getKids(parent) {
+			if obj, _ := p.resolve(kid).(*Obj); obj == next {
+				index = i
+				if n > total {
+					index++
+				}
+				break
+			}
+		}
+	}
+	kids := p.getKids(parent)
+	list := make([]interface{}, 0, len(kids)+1)
+	list = append(list, kids[:index]...)
+	list = append(list, objRef(page))
+	list = append(list, kids[index:]...)
+	p.setKids(parent, list)
+	p.adjustCount(parent, 1)
+	p.setDictValue(page, "/Parent", objRef(parent))
+	return nil
+}
+
+// removeObj 从文档中删除对象，xref 中标记为空闲
+func (p *PDF) removeObj(obj *Obj) {
+	list := make([]*Obj, 0, len(p.Objects))
+	for _, v := range p.Objects {
+		if v != obj {
+			list = append(list, v)
+		}
+	}
+	p.Objects = list
+	for _, item := range p.Xref {
+		if item.ID == obj.ID && item.GID == obj.GenID && item.Flag == "n" {
+			item.GID++
+			item.Flag = "f"
+		}
+	}
+	p.linkFreeXref()
+}
+
+// linkFreeXref 把 xref 中的空闲项按对象序号连成链表: 第 0 项指向第一个空闲的对象，
+// 每个空闲项的偏移为下一个空闲的对象序号，最后一个为 0
+func (p *PDF) linkFreeXref() {
+	free := make([]*XrefItem, 0)
+	var head *XrefItem
+	for _, item := range p.Xref {
+		switch {
+		case item.ID == 0:
+			head = item
+		case item.Flag == "f":
+			free = append(free, item)
+		}
+	}
+	sort.SliceStable(free, func(i, j int) bool {
+		return free[i].ID < free[j].ID
+	})
+	next := 0
+	for i := len(free) - 1; i >= 0; i-- {
+		free[i].Offset = next
+		next = free[i].ID
+	}
+	if head != nil {
+		head.Offset = next
+	}
+}
+
+// removePageWidgets 把已经删除的页面上的表单控件从 /AcroForm 的域树和文档中删除，
+// 没有控件的域也删除
+func (p *PDF) removePageWidgets(page *Obj) {
+	widgets := make(map[*Obj]bool)
+	annots, _ := p.resolve(p.getValueByKey(page.Dict, "/Annots")).([]interface{})
+	for _, item := range annots {
+		annot, _ := p.resolve(item).(*Obj)
+		if annot == nil {
+			continue
+		}
+		if subtype := p.getNameObjByKey(annot.Dict, "/Subtype"); subtype != nil && subtype.Name == "/Widget" {
+			widgets[annot] = true
+		}
+	}
+	if len(widgets) == 0 || p.Trailer == nil {
+		return
+	}
+	root, _ := p.resolve(p.getValueByKey(p.Trailer.Dict, "/Root")).(*Obj)
+	if root == nil {
+		return
+	}
+	removed := make([]*Obj, 0, len(widgets))
+	for widget := range widgets {
+		removed = append(removed, widget)
+	}
+	// prune 去掉 list 中的控件，以及子节点都被去掉的域
+	var prune func(list []interface{}, depth int) []interface{}
+	prune = func(list []interface{}, depth int) []interface{} {
+		rest := make([]interface{}, 0, len(list))
+		for _, item := range list {
+			field, _ := p.resolve(item).(*Obj)
+			if field == nil {
+				rest = append(rest, item)
+				continue
+			}
+			if widgets[field] {
+				continue
+			}
+			if kids, ok := p.resolve(p.getValueByKey(field.Dict, "/Kids")).([]interface{}); ok && depth < 32 {
+				left := prune(kids, depth+1)
+				if len(left) == 0 && len(kids) > 0 {
+					removed = append(removed, field)
+					continue
+				}
+				if len(left) != len(kids) {
+					p.setDictValue(field, "/Kids", left)
+				}
+			}
+			rest = append(rest, item)
+		}
+		return rest
+	}
+	form := p.getResolvedDict(root.Dict, "/AcroForm")
+	if fields, ok := p.resolve(p.getValueByKey(form, "/Fields")).([]interface{}); ok {
+		if rest := prune(fields, 0); len(rest) != len(fields) {
+			p.setDictPath(&root.Dict, []string{"/AcroForm", "/Fields"}, rest)
+		}
+	}
+	// 控件和域之间有 /Parent 和 /Kids 的循环引用，直接删除，再删除只被它们引用的外观流等
+	refs := make([]*Obj, 0)
+	for _, obj := range removed {
+		refs = append(refs, p.referencedObjs(obj)...)
+		p.removeObj(obj)
+	}
+	for _, obj := range p.Objects {
+		for _, target := range removed {
+			obj.Dict = replaceRefs(obj.Dict, target).([]*Pair)
+			if obj.Array != nil {
+				obj.Array = replaceRefs(obj.Array, target).([]interface{})
+			}
+		}
+	}
+	p.removeUnreferenced(refs)
+}
+
+// removePageRefs 页面删除后清理指向它的引用:
+// 删除指向它的命名目标，书签去掉 /Dest 或者 /A，链接注释从页面中删除，其他的引用改为 null
+func (p *PDF) removePageRefs(page *Obj) {
+	isPageDest := func(value interface{}) bool {
+		if dict := p.resolveDict(value); dict != nil {
+			// 动作字典 << /S /GoTo /D [...] >>
+			value = p.getValueByKey(dict, "/D")
+		}
+		dest, ok := p.resolve(value).([]interface{})
+		if !ok || len(dest) == 0 {
+			return false
+		}
+		ref, ok := dest[0].(*Obj)
+		return ok && ref.ID == page.ID && ref.GenID == page.GenID
+	}
+	// 指向它的命名目标删除后，用这些名字的链接、书签也按指向它处理
+	var tree, dict map[string]bool
+	if p.Trailer != nil {
+		if root, _ := p.resolve(p.getValueByKey(p.Trailer.Dict, "/Root")).(*Obj); root != nil {
+			tree, dict = p.removeDests(root, isPageDest)
+		}
+	}
+	isRemovedDest := func(value interface{}) bool {
+		if action := p.resolveDict(value); action != nil {
+			value = p.getValueByKey(action, "/D")
+		}
+		switch v := p.resolve(value).(type) {
+		case string:
+			return tree[string(decodePDFString(v))]
+		case *NameObj:
+			return dict[v.Name]
+		}
+		return isPageDest(value)
+	}
+	links := make(map[*Obj]bool)
+	for _, obj := range p.Objects {
+		for _, key := range []string{"/Dest", "/A"} {
+			if !isRemovedDest(p.getValueByKey(obj.Dict, key)) {
+				continue
+			}
+			subtype := p.getNameObjByKey(obj.Dict, "/Subtype")
+			if subtype != nil && subtype.Name == "/Link" {
+				links[obj] = true
+			} else {
+				p.deleteDictValue(obj, key)
+			}
+		}
+	}
+	for _, obj := range p.Objects {
+		if annots, ok := p.resolve(p.getValueByKey(obj.Dict, "/Annots")).([]interface{}); ok && len(links) > 0 {
+			list := make([]interface{}, 0, len(annots))
+			for _, item := range annots {
+				if annot, _ := p.resolve(item).(*Obj); annot == nil || !links[annot] {
+					list = append(list, item)
+				}
+			}
+			if len(list) != len(annots) {
+				p.setDictValue(obj, "/Annots", list)
+			}
+		}
+		obj.Dict = replaceRefs(obj.Dict, page).([]*Pair)
+		if obj.Array != nil {
+			obj.Array = replaceRefs(obj.Array, page).([]interface{})
+		}
+	}
+	for link := range links {
+		p.removeObj(link)
+	}
+	if p.Trailer != nil {
+		p.Trailer.Dict = replaceRefs(p.Trailer.Dict, page).([]*Pair)
+	}
+}
+
+// replaceRefs 把 value 中指向 target 的引用改为 null
+func replaceRefs(value interface{}, target *Obj) interface{} {
+	switch v := value.(type) {
+	case *Obj:
+		if v.ID == target.ID && v.GenID == target.GenID {
+			return nil
+		}
+	case []*Pair:
+		for _, pair := range v {
+			pair.Value = replaceRefs(pair.Value, target)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = replaceRefs(item, target)
+		}
+	}
+	return value
+}
+
+// cloneDict 复制字典，直接的字典和数组也复制，对象引用不变
+func cloneDict(dict []*Pair) []*Pair {
+	if dict == nil {
+		return nil
+	}
+	list := make([]*Pair, 0, len(dict))
+	for _, pair := range dict {
+		list = append(list, &Pair{Key: &NameObj{Name: pair.Key.Name}, Value: cloneValue(pair.Value)})
+	}
+	return list
+}
+
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *Obj:
+		return objRef(v)
+	case []*Pair:
+		return cloneDict(v)
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, cloneValue(item))
+		}
+		return list
+	case *NameObj:
+		return &NameObj{Name: v.Name}
+	}
+	return value
+}
@@ -0,0 +1,128 @@
+package pdf
+
+import (
+	"reflect"
+	"testing"
+)
+
+// editDoc 三页的文档，第 1、2 页在一个中间节点下并继承它的 /MediaBox。
+// 书签和第 1 页上的链接指向第 2 页，第 2 页的内容流只有它使用，字体三页共用
+func editDoc(t *testing.T) *PDF {
+	return testPDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R /Outlines 3 0 R >>",
+		"<< /Type /Pages /Kids [4 0 R 7 0 R] /Count 3 /Resources << /Font << /F1 10 0 R >> >> >>",
+		"<< /Type /Outlines /First 11 0 R /Last 11 0 R /Count 1 >>",
+		"<< /Type /Pages /Parent 2 0 R /Kids [5 0 R 6 0 R] /Count 2 /MediaBox [0 0 300 400] >>",
+		"<< /Type /Page /Parent 4 0 R /Annots [12 0 R] >>",
+		"<< /Type /Page /Parent 4 0 R /Contents 8 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 500 600] /Contents 9 0 R >>",
+		testStream("", "BT /F1 12 Tf (two) Tj ET"),
+		testStream("", "BT /F1 12 Tf (three) Tj ET"),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Title (Two) /Parent 3 0 R /Dest [6 0 R /Fit] >>",
+		"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest [6 0 R /XYZ 0 0 0] >>",
+	})
+}
+
+// checkPageTree 检查每个节点的 /Count 为它下面的页数，子节点的 /Parent 指向它
+func checkPageTree(t *testing.T, p *PDF) {
+	t.Helper()
+	var count func(node *Obj, depth int) int
+	count = func(node *Obj, depth int) int {
+		if typ := p.getNameObjByKey(node.Dict, "/Type"); typ != nil && typ.Name == "/Page" {
+			return 1
+		}
+		n := 0
+		kids, _ := p.resolve(p.getValueByKey(node.Dict, "/Kids")).([]interface{})
+		for _, item := range kids {
+			kid, _ := p.resolve(item).(*Obj)
+			if kid == nil {
+				t.Fatalf("node %d has a missing kid %v", node.ID, item)
+			}
+			if parent, _ := p.resolve(p.getValueByKey(kid.Dict, "/Parent")).(*Obj); parent != node {
+				t.Errorf("/Parent of %d is %v, want %d", kid.ID, parent, node.ID)
+			}
+			n += count(kid, depth+1)
+		}
+		if c := p.getIntByKey(node.Dict, "/Count"); c != n {
+			t.Errorf("/Count of %d is %d, want %d", node.ID, c, n)
+		}
+		return n
+	}
+	count(p.pageTreeRoot(), 0)
+}
+
+func pageIDs(p *PDF) []int {
+	ids := make([]int, 0)
+	for _, pg := range p.Pages() {
+		ids = append(ids, pg.ID)
+	}
+	return ids
+}
+
+func TestDeletePage(t *testing.T) {
+	p := editDoc(t)
+	if err := p.DeletePage(2); err != nil {
+		t.Fatal(err)
+	}
+	p = reload(t, p)
+	checkPageTree(t, p)
+	if ids := pageIDs(p); !reflect.DeepEqual(ids, []int{5, 7}) {
+		t.Fatalf("pages %v", ids)
+	}
+	item := p.getObj(&Obj{ID: 11})
+	if item == nil || p.getValueByKey(item.Dict, "/Dest") != nil {
+		t.Errorf("outline item still has a destination: %v", item)
+	}
+	pg, _ := p.Page(1)
+	if annots, _ := p.resolve(p.getValueByKey(pg.obj.Dict, "/Annots")).([]interface{}); len(annots) != 0 {
+		t.Errorf("link to the deleted page is kept: %v", annots)
+	}
+	for _, id := range []int{6, 8, 12} {
+		if p.getObj(&Obj{ID: id}) != nil {
+			t.Errorf("object %d is not removed", id)
+		}
+	}
+	if p.getObj(&Obj{ID: 10}) == nil {
+		t.Error("shared font is removed")
+	}
+	if err := p.DeletePage(3); err == nil {
+		t.Error("deleted a page that does not exist")
+	}
+}
+
+func TestMoveAndDuplicatePage(t *testing.T) {
+	p := editDoc(t)
+	if err := p.MovePage(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	checkPageTree(t, p)
+	if ids := pageIDs(p); !reflect.DeepEqual(ids, []int{6, 7, 5}) {
+		t.Fatalf("pages after move %v", ids)
+	}
+	// 移到别的节点下后仍然使用原来继承的页面大小
+	if pg, _ := p.Page(3); pg.MediaBox != (Rect{0, 0, 300, 400}) {
+		t.Errorf("moved page MediaBox %v", pg.MediaBox)
+	}
+	if err := p.DuplicatePage(3); err != nil {
+		t.Fatal(err)
+	}
+	p = reload(t, p)
+	checkPageTree(t, p)
+	pages := p.Pages()
+	if len(pages) != 4 || pages[3].ID == pages[2].ID || pages[3].MediaBox != pages[2].MediaBox {
+		t.Fatalf("duplicated page %+v", pages[len(pages)-1])
+	}
+	annots, _ := p.resolve(p.getValueByKey(pages[3].obj.Dict, "/Annots")).([]interface{})
+	orig, _ := p.resolve(p.getValueByKey(pages[2].obj.Dict, "/Annots")).([]interface{})
+	if len(annots) != 1 || len(orig) != 1 {
+		t.Fatalf("annots %v, original %v", annots, orig)
+	}
+	link, _ := p.resolve(annots[0]).(*Obj)
+	if link == p.resolve(orig[0]) {
+		t.Error("annotation is shared with the original page")
+	}
+	if ref, _ := p.getValueByKey(link.Dict, "/P").(*Obj); ref == nil || ref.ID != pages[3].ID {
+		t.Errorf("/P of the copied annotation is %v", ref)
+	}
+}
@@ -2,14 +2,17 @@ package pdf
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
 	"errors"
 	"fmt"
+	"image"
+	"io"
 	"log"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // PDF 文档结构体, 定义参考：https://cloud.tencent.com/developer/article/1575759
@@ -29,6 +32,7 @@ type Obj struct {
 	Array  []interface{}
 	Int    int
 	typ    int
+	value  interface{} // 内容为实数、字符串、名字或者布尔值的对象
 }
 
 func (obj *Obj) IsImageStream() bool {
@@ -52,22 +56,9 @@ func (obj *Obj) IsImageStream() bool {
 	return false
 }
 
+// SaveImage 把图像流的原始数据 (不做解码) 保存到文件
 func (obj *Obj) SaveImage(file string) error {
-	buf := obj.Stream.body
-	if bytes.HasPrefix(buf, []byte("stream")) {
-		// 13 + \n
-		buf = buf[8:]
-	}
-	log.Default().Printf("image stream len: %d", len(buf))
-	err := os.WriteFile(file, buf, 0666)
-	if err != nil {
-		log.Default().Fatalf("save file err: %v", err)
-		return err
-	}
-	// save compress
-	cfile := fmt.Sprintf("./test-data/cf-%d-%d.jpeg", obj.ID, obj.GenID)
-	data := CompressImage(buf)
-	return os.WriteFile(cfile, data, 0666)
+	return os.WriteFile(file, obj.Stream.data(), 0666)
 }
 
 type Pair struct {
@@ -83,6 +74,27 @@ type Stream struct {
 	body []byte
 }
 
+// data 返回去掉 stream 关键字和换行后的流数据
+func (s *Stream) data() []byte {
+	buf := s.body
+	if !bytes.HasPrefix(buf, []byte("stream")) {
+		return buf
+	}
+	buf = buf[len("stream"):]
+	if bytes.HasPrefix(buf, []byte("\r\n")) {
+		return buf[2:]
+	}
+	if len(buf) > 0 && (buf[0] == '\n' || buf[0] == '\r') {
+		return buf[1:]
+	}
+	return buf
+}
+
+func (s *Stream) setData(data []byte) {
+	start := []byte{'s', 't', 'r', 'e', 'a', 'm', 13, '\n'}
+	s.body = append(start, data...)
+}
+
 type XrefItem struct {
 	ID     int
 	Offset int
@@ -111,140 +123,366 @@ func ReadFromFile(file string) (*PDF, error) {
 	return p, nil
 }
 
-func (p *PDF) ExportJPEG() error {
+// imageJob 一个图像以及跟随它处理的蒙版，同一个任务内的对象只由一个 goroutine 修改
+type imageJob struct {
+	obj   *Obj
+	masks []*Obj
+}
+
+// compressImageObj 用 opts.Workers 个 goroutine 并发压缩图像。
+// 每个任务只修改自己的对象，不新增对象，输出的顺序和对象序号与串行处理时一致
+func (p *PDF) compressImageObj(ctx context.Context, opts *CompressOptions) (*CompressReport, error) {
+	// /SMask 和 /Mask 引用的蒙版跟随所属的图像一起处理，共用的蒙版归第一个引用它的图像
+	masks := p.imageMasks()
+	done := make(map[*Obj]bool)
+	jobs := make([]*imageJob, 0)
 	for _, obj := range p.Objects {
-		if obj.IsImageStream() {
-			log.Default().Printf("found a image obj: %d %d", obj.ID, obj.GenID)
-			file := fmt.Sprintf("./test-data/%d-%d.jpeg", obj.ID, obj.GenID)
-			err := obj.SaveImage(file)
-			if err != nil {
-				return err
+		if !obj.IsImageStream() || masks[obj] {
+			continue
+		}
+		job := &imageJob{obj: obj}
+		for _, mask := range p.getMasks(obj) {
+			if !done[mask] {
+				done[mask] = true
+				job.masks = append(job.masks, mask)
 			}
 		}
+		jobs = append(jobs, job)
 	}
-	return nil
+
+	// 按任务的顺序收集结果，报告的顺序和并发数无关
+	results := make([][]*ImageReport, len(jobs))
+	ch := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < opts.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range ch {
+				results[idx] = p.compressImageJob(jobs[idx], opts)
+			}
+		}()
+	}
+	var err error
+loop:
+	for idx := range jobs {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break loop
+		case ch <- idx:
+		}
+	}
+	close(ch)
+	wg.Wait()
+	report := &CompressReport{}
+	for _, list := range results {
+		for _, item := range list {
+			report.add(item)
+		}
+	}
+	if err != nil {
+		return report, err
+	}
+	log.Default().Printf("compress %d image stream, %s", len(report.Images), report)
+	return report, nil
 }
 
-func (p *PDF) compressImageObj() error {
-	cnt := 0
-	for _, obj := range p.Objects {
-		if obj.IsImageStream() {
-			cnt++
+// compressImageJob 压缩图像以及跟随它的蒙版，返回每个对象的结果
+func (p *PDF) compressImageJob(job *imageJob, opts *CompressOptions) []*ImageReport {
+	obj := job.obj
+	item := p.newImageReport(obj)
+	reason := p.compressOneImage(obj, opts)
+	p.finishImageReport(item, obj, reason)
+	list := []*ImageReport{item}
+	for _, mask := range job.masks {
+		m := p.newImageReport(mask)
+		m.Mask = true
+		reason := p.compressMaskObj(mask, item.OldWidth, item.OldHeight, item.NewWidth, item.NewHeight)
+		p.finishImageReport(m, mask, reason)
+		list = append(list, m)
+	}
+	return list
+}
 
-			filter := p.getNameObjByKey(obj.Dict, "/Filter")
-			if filter.Name == "/CCITTFaxDecode" {
-				p.compressTIFFObj(obj)
-				continue
-			}
-			// DCTDecode
-			buf := obj.Stream.body
-			if bytes.HasPrefix(buf, []byte("stream")) {
-				// 13 + \n
-				buf = buf[8:]
+func (p *PDF) compressOneImage(obj *Obj, opts *CompressOptions) SkipReason {
+	filter := p.getFilterName(obj)
+	if filter == "/CCITTFaxDecode" {
+		return p.compressTIFFObj(obj)
+	}
+	if p.isBilevelImage(obj) {
+		return p.compressBilevelObj(obj)
+	}
+	var reduceSkip SkipReason
+	if opts.lossy() && opts.ReduceColor {
+		// 减色后没有变小时，再按原来的方式压缩
+		reason, ok := p.reduceColorObj(obj, opts)
+		if ok && reason == "" {
+			return ""
+		}
+		reduceSkip = reason
+	}
+	switch {
+	case filter == "/DCTDecode" && opts.lossy():
+		return p.compressDCTObj(obj, opts)
+	case filter == "/DCTDecode":
+		return p.optimizeDCTObj(obj, opts)
+	case filter == "/JPXDecode" && opts != nil && opts.TranscodeJPX:
+		return p.compressJPXObj(obj, opts)
+	}
+	if reduceSkip != "" {
+		return reduceSkip
+	}
+	return SkipUnsupported
+}
+
+// 解码 CCITT 数据后用 Group 4 重新编码，G3 的数据通常能小很多
+func (p *PDF) compressTIFFObj(obj *Obj) SkipReason {
+	// https://blog.idrsolutions.com/2011/08/ccitt-encoding-in-pdf-files-converting-pdf-ccitt-data-into-a-tiff/
+	buf := obj.Stream.data()
+	img, err := p.decodeCCITTObj(obj)
+	if err != nil {
+		log.Default().Printf("decode ccitt obj %d %d err: %v", obj.ID, obj.GenID, err)
+		return SkipDecodeError
+	}
+	data := EncodeCCITTG4(img)
+	log.Default().Printf("compress ccitt %d ---> %d", len(buf), len(data))
+	if len(data) >= len(buf) {
+		return SkipLarger
+	}
+	p.updateStream(obj, data)
+	// 原来可能还有 FlateDecode 等过滤器，替换后只有 CCITTFaxDecode
+	p.setDictValue(obj, "/Filter", &NameObj{Name: "/CCITTFaxDecode"})
+	p.setCCITTParams(obj, img)
+	return ""
+}
+
+// SaveTIFF 把 CCITTFaxDecode 编码的图像对象解码，保存为 Group 4 压缩的 TIFF
+func (p *PDF) SaveTIFF(obj *Obj, w io.Writer) error {
+	img, err := p.decodeCCITTObj(obj)
+	if err != nil {
+		return err
+	}
+	return EncodeTIFF(w, img)
+}
+
+// decodeCCITTObj 先执行 CCITTFaxDecode 前面的过滤器 (如 FlateDecode)，再解码 CCITT 数据
+func (p *PDF) decodeCCITTObj(obj *Obj) (*image.Gray, error) {
+	data, filter, err := p.decodeStream(obj)
+	if err != nil {
+		return nil, err
+	}
+	if filter != "/CCITTFaxDecode" {
+		return nil, errors.New("expect /CCITTFaxDecode image")
+	}
+	return DecodeCCITT(data, p.getCCITTParams(obj))
+}
+
+// 1 bit 单通道的图像 (扫描件常见的 Flate 压缩黑白图)，改用 CCITT Group 4 编码
+func (p *PDF) compressBilevelObj(obj *Obj) SkipReason {
+	buf, filter, err := p.decodeStream(obj)
+	if err != nil {
+		return SkipDecodeError
+	}
+	if filter != "" {
+		return SkipUnsupported
+	}
+	width := p.getIntByKey(obj.Dict, "/Width")
+	height := p.getIntByKey(obj.Dict, "/Height")
+	rowLen := (width + 7) / 8
+	if width <= 0 || height <= 0 || len(buf) < rowLen*height {
+		return SkipDecodeError
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := buf[y*rowLen:]
+		for x := 0; x < width; x++ {
+			if row[x/8]&(0x80>>uint(x%8)) != 0 {
+				img.Pix[y*img.Stride+x] = 255
 			}
-			data := CompressImage(buf)
-			start := []byte{'s', 't', 'r', 'e', 'a', 'm', 13, '\n'}
-			buf = append(start, data...)
-			obj.Stream.body = buf
-			// 更新长度
-			lenObj := p.getObjRefByKey(obj.Dict, "/Length")
-			newLen := len(obj.Stream.body) - 8
-			if lenObj != nil {
-				p.updateObjLen(lenObj, newLen)
-			} else {
-				p.updateImageObjLen(obj, newLen)
+		}
+	}
+	data := EncodeCCITTG4(img)
+	old := len(obj.Stream.data())
+	log.Default().Printf("compress bilevel image %d ---> %d", old, len(data))
+	if len(data) >= old {
+		return SkipLarger
+	}
+	p.updateStream(obj, data)
+	p.setDictValue(obj, "/Filter", &NameObj{Name: "/CCITTFaxDecode"})
+	p.setCCITTParams(obj, img)
+	return ""
+}
+
+// 1 bit 单通道的图像
+func (p *PDF) isBilevelImage(obj *Obj) bool {
+	if p.getBoolByKey(obj.Dict, "/ImageMask") {
+		return true
+	}
+	if p.getIntByKey(obj.Dict, "/BitsPerComponent") != 1 {
+		return false
+	}
+	cs := p.getNameObjByKey(obj.Dict, "/ColorSpace")
+	if cs != nil {
+		return cs.Name == "/DeviceGray" || cs.Name == "/CalGray"
+	}
+	// Indexed 等数组形式的颜色空间也是单通道
+	for _, pair := range obj.Dict {
+		if pair.Key.Name == "/ColorSpace" {
+			list, ok := pair.Value.([]interface{})
+			if ok && len(list) > 0 {
+				name, ok := list[0].(*NameObj)
+				return ok && name.Name == "/Indexed"
 			}
 		}
 	}
-	log.Default().Printf("compress %d image stream", cnt)
-	return nil
+	return false
 }
 
-func (p *PDF) compressTIFFObj(obj *Obj) {
-	// 妈的，压缩不了。不处理了
-	return
-	// 开始处理tiff image
-	// https://blog.idrsolutions.com/2011/08/ccitt-encoding-in-pdf-files-converting-pdf-ccitt-data-into-a-tiff/
-	parms := p.getDictByKey(obj.Dict, "/DecodeParms")
-	// Group 4 Two-Dimensional (G42D): usually have K-values less than 0.
-	k := p.getIntByKey(parms, "/K")
-	if k >= 0 {
-		return
+func (p *PDF) getCCITTParams(obj *Obj) *CCITTParams {
+	// 有多个过滤器时 /DecodeParms 为数组，取 CCITTFaxDecode 对应的
+	var parms []*Pair
+	names, list := p.getFilters(obj)
+	for i, name := range names {
+		if name == "/CCITTFaxDecode" {
+			parms = list[i]
+		}
 	}
-	width := p.getIntByKey(parms, "/Columns")
-	height := p.getIntByKey(parms, "/Rows")
-	header := []byte{'I', 'I', 42, 0}
-	w := bytes.NewBuffer(header)
-	//  first_ifd (Image file directory) / offset
-	tmp := make([]byte, 4)
-	binary.LittleEndian.PutUint32(tmp, uint32(8))
-	w.Write(tmp)
-
-	ifdLength := 10
-	headerLength := 10 + (ifdLength*12 + 4)
-
-	tmp = make([]byte, 2)
-	binary.LittleEndian.PutUint16(tmp, uint16(ifdLength))
-	w.Write(tmp)
-
-	// Dictionary should be in order based on the TiffTag value
-	p.writeTIFFTag(w, 255, 4, 1, 0)
-	p.writeTIFFTag(w, 256, 4, 1, width)
-	p.writeTIFFTag(w, 257, 4, 1, height)
-	p.writeTIFFTag(w, 258, 3, 1, 1)
-	p.writeTIFFTag(w, 259, 3, 1, 4) //Compression
-	p.writeTIFFTag(w, 262, 3, 1, 0)
-	p.writeTIFFTag(w, 273, 4, 1, headerLength)
-	p.writeTIFFTag(w, 277, 3, 1, 1)
-	p.writeTIFFTag(w, 278, 4, 1, height)
-
-	buf := obj.Stream.body
-	if bytes.HasPrefix(buf, []byte("stream")) {
-		// 13 + \n
-		buf = buf[8:]
-	}
-	p.writeTIFFTag(w, 279, 4, 1, len(buf))
-
-	tmp = make([]byte, 4)
-	binary.LittleEndian.PutUint32(tmp, uint32(0))
-	w.Write(tmp)
-
-	w.Write(buf)
-
-	file := fmt.Sprintf("./test-data/tt1-%d-%d.tif", obj.ID, obj.GenID)
-	os.WriteFile(file, w.Bytes(), 0666)
-
-	data := CompressTIFFImage(w.Bytes())
-	start := []byte{'s', 't', 'r', 'e', 'a', 'm', 13, '\n'}
-	buf = append(start, data...)
-	obj.Stream.body = buf
+	params := &CCITTParams{
+		K:                p.getIntByKey(parms, "/K"),
+		Columns:          p.getIntByKey(parms, "/Columns"),
+		Rows:             p.getIntByKey(parms, "/Rows"),
+		BlackIs1:         p.getBoolByKey(parms, "/BlackIs1"),
+		EncodedByteAlign: p.getBoolByKey(parms, "/EncodedByteAlign"),
+		EndOfLine:        p.getBoolByKey(parms, "/EndOfLine"),
+		EndOfBlock:       true,
+	}
+	if v, ok := p.getValueByKey(parms, "/EndOfBlock").(bool); ok {
+		params.EndOfBlock = v
+	}
+	if params.Columns == 0 {
+		params.Columns = 1728
+	}
+	if params.Rows == 0 {
+		params.Rows = p.getIntByKey(obj.Dict, "/Height")
+	}
+	return params
+}
+
+// 重新编码为 Group 4 后的 /DecodeParms，解码后的采样值不变，所以 BlackIs1 为 false
+func (p *PDF) setCCITTParams(obj *Obj, img image.Image) {
+	b := img.Bounds()
+	parms := []*Pair{
+		{Key: &NameObj{Name: "/K"}, Value: -1},
+		{Key: &NameObj{Name: "/Columns"}, Value: b.Dx()},
+		{Key: &NameObj{Name: "/Rows"}, Value: b.Dy()},
+	}
+	p.setDictValue(obj, "/DecodeParms", parms)
+}
+
+// updateStream 替换流对象的数据，并更新 /Length
+func (p *PDF) updateStream(obj *Obj, data []byte) {
+	obj.Stream.setData(data)
 	// 更新长度
 	lenObj := p.getObjRefByKey(obj.Dict, "/Length")
-	newLen := len(obj.Stream.body) - 8
 	if lenObj != nil {
-		p.updateObjLen(lenObj, newLen)
+		p.updateObjLen(lenObj, len(data))
 	} else {
-		p.updateImageObjLen(obj, newLen)
+		p.updateImageObjLen(obj, len(data))
 	}
+}
 
+// setDictValue 设置对象字典中 key 的值，key 不存在时追加
+func (p *PDF) setDictValue(obj *Obj, key string, value interface{}) {
+	setPairValue(&obj.Dict, key, value)
 }
 
-func (p *PDF) writeTIFFTag(w *bytes.Buffer, tag, typ, count, value int) {
-	tmp := make([]byte, 2)
-	binary.LittleEndian.PutUint16(tmp, uint16(tag))
-	w.Write(tmp)
+// deleteDictValue 删除对象字典中的 key
+func (p *PDF) deleteDictValue(obj *Obj, key string) {
+	dict := make([]*Pair, 0, len(obj.Dict))
+	for _, pair := range obj.Dict {
+		if pair.Key.Name != key {
+			dict = append(dict, pair)
+		}
+	}
+	obj.Dict = dict
+}
 
-	tmp = make([]byte, 2)
-	binary.LittleEndian.PutUint16(tmp, uint16(typ))
-	w.Write(tmp)
+func setPairValue(dict *[]*Pair, key string, value interface{}) {
+	for _, pair := range *dict {
+		if pair.Key.Name == key {
+			pair.Value = value
+			return
+		}
+	}
+	*dict = append(*dict, &Pair{Key: &NameObj{Name: key}, Value: value})
+}
 
-	tmp = make([]byte, 4)
-	binary.LittleEndian.PutUint32(tmp, uint32(count))
-	w.Write(tmp)
+// setDictPath 设置嵌套字典中的值，例如 /Resources /XObject /Im1。
+// 中间的字典不存在时创建，遇到对象引用时修改被引用的对象
+func (p *PDF) setDictPath(dict *[]*Pair, path []string, value interface{}) {
+	key := path[0]
+	if len(path) == 1 {
+		setPairValue(dict, key, value)
+		return
+	}
+	for _, pair := range *dict {
+		if pair.Key.Name != key {
+			continue
+		}
+		switch v := pair.Value.(type) {
+		case []*Pair:
+			p.setDictPath(&v, path[1:], value)
+			pair.Value = v
+			return
+		case *Obj:
+			if obj := p.getObj(v); obj != nil {
+				p.setDictPath(&obj.Dict, path[1:], value)
+				return
+			}
+		}
+	}
+	sub := make([]*Pair, 0)
+	p.setDictPath(&sub, path[1:], value)
+	setPairValue(dict, key, sub)
+}
 
-	tmp = make([]byte, 4)
-	binary.LittleEndian.PutUint32(tmp, uint32(value))
-	w.Write(tmp)
+// addObj 把新对象加入文档，分配新的对象序号，并更新 xref 和 trailer 中的 /Size
+func (p *PDF) addObj(obj *Obj) *Obj {
+	maxID := 0
+	for _, v := range p.Objects {
+		if v.ID > maxID {
+			maxID = v.ID
+		}
+	}
+	for _, item := range p.Xref {
+		if item.ID > maxID {
+			maxID = item.ID
+		}
+	}
+	obj.ID = maxID + 1
+	obj.GenID = 0
+	p.Objects = append(p.Objects, obj)
+	p.Xref = append(p.Xref, &XrefItem{ID: obj.ID, GID: 0, Flag: "n"})
+	if p.Trailer != nil {
+		setPairValue(&p.Trailer.Dict, "/Size", obj.ID+1)
+	}
+	return obj
+}
+
+// newStreamObj 创建一个新的流对象并加入文档
+func (p *PDF) newStreamObj(dict []*Pair, data []byte) *Obj {
+	obj := &Obj{Dict: dict, Stream: &Stream{}}
+	p.setDictValue(obj, "/Length", len(data))
+	obj.Stream.setData(data)
+	return p.addObj(obj)
+}
+
+// setContentData 用 Flate 压缩后替换内容流的数据
+func (p *PDF) setContentData(obj *Obj, data []byte) {
+	p.updateStream(obj, flateEncode(data))
+	p.setDictValue(obj, "/Filter", &NameObj{Name: "/FlateDecode"})
+	p.deleteDictValue(obj, "/DecodeParms")
 }
 
 func (p *PDF) updateImageObjLen(obj *Obj, size int) {
@@ -265,6 +503,66 @@ func (p *PDF) updateObjLen(obj *Obj, size int) {
 	}
 }
 
+// getObj 根据对象引用找到文档中真正的对象，找不到时返回 nil
+func (p *PDF) getObj(ref *Obj) *Obj {
+	if ref == nil {
+		return nil
+	}
+	for _, v := range p.Objects {
+		if v.ID == ref.ID && v.GenID == ref.GenID {
+			return v
+		}
+	}
+	return nil
+}
+
+// resolve 如果 value 是对象引用，返回引用的对象；否则原样返回
+func (p *PDF) resolve(value interface{}) interface{} {
+	ref, ok := value.(*Obj)
+	if !ok {
+		return value
+	}
+	obj := p.getObj(ref)
+	if obj == nil {
+		return nil
+	}
+	if obj.Stream != nil || len(obj.Dict) > 0 {
+		return obj
+	}
+	if obj.Array != nil {
+		return obj.Array
+	}
+	if obj.typ == ElementTypeNum {
+		return obj.Int
+	}
+	if obj.value != nil {
+		return obj.value
+	}
+	return obj
+}
+
+// getResolvedDict 返回 key 对应的字典，值为对象引用时取引用对象的字典
+func (p *PDF) getResolvedDict(dict []*Pair, key string) []*Pair {
+	switch v := p.resolve(p.getValueByKey(dict, key)).(type) {
+	case []*Pair:
+		return v
+	case *Obj:
+		return v.Dict
+	}
+	return nil
+}
+
+// resolveDict 值为字典或者字典对象的引用时返回字典，否则返回 nil
+func (p *PDF) resolveDict(value interface{}) []*Pair {
+	switch v := p.resolve(value).(type) {
+	case []*Pair:
+		return v
+	case *Obj:
+		return v.Dict
+	}
+	return nil
+}
+
 func (p *PDF) getDictByKey(dict []*Pair, key string) []*Pair {
 	for _, pair := range dict {
 		if pair.Key.Name == key {
@@ -289,6 +587,20 @@ func (p *PDF) getIntByKey(dict []*Pair, key string) int {
 	return 0
 }
 
+func (p *PDF) getBoolByKey(dict []*Pair, key string) bool {
+	v, _ := p.getValueByKey(dict, key).(bool)
+	return v
+}
+
+func (p *PDF) getValueByKey(dict []*Pair, key string) interface{} {
+	for _, pair := range dict {
+		if pair.Key.Name == key {
+			return pair.Value
+		}
+	}
+	return nil
+}
+
 func (p *PDF) getNameObjByKey(dict []*Pair, key string) *NameObj {
 	for _, pair := range dict {
 		if pair.Key.Name == key {
@@ -315,14 +627,28 @@ func (p *PDF) getObjRefByKey(dict []*Pair, key string) *Obj {
 	return nil
 }
 
+// SaveFile 保存文档，compress 为 true 时先按默认选项压缩图像
 func (p *PDF) SaveFile(file string, compress bool) error {
+	_, err := p.SaveFileWithReport(file, compress)
+	return err
+}
+
+// SaveFileWithReport 和 SaveFile 相同，同时返回每个图像的压缩结果。
+// compress 为 false 时报告为 nil
+func (p *PDF) SaveFileWithReport(file string, compress bool) (*CompressReport, error) {
+	var report *CompressReport
 	if compress {
-		// 更新image object
-		err := p.compressImageObj()
+		var err error
+		report, err = p.compressImageObj(context.Background(), nil)
 		if err != nil {
-			return err
+			return report, err
 		}
 	}
+	return report, p.writeFile(file)
+}
+
+// writeFile 把文档写到文件中
+func (p *PDF) writeFile(file string) error {
 	body := make([]byte, 0)
 	// 写文件头
 	w := bytes.NewBuffer(body)
@@ -360,7 +686,7 @@ func (p *PDF) writeTrailer(w *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
-	w.WriteString("startref\n")
+	w.WriteString("startxref\n")
 	str := strconv.Itoa(p.Trailer.StartXref)
 	w.WriteString(str)
 	w.WriteByte('\n')
@@ -441,6 +767,10 @@ func (p *PDF) writeObj(w *bytes.Buffer, obj *Obj) error {
 		w.WriteString(str)
 		w.WriteByte('\n')
 	}
+	if obj.value != nil {
+		writeContentValue(w, obj.value)
+		w.WriteByte('\n')
+	}
 	if len(obj.Array) > 0 {
 		// 写数组
 		err := p.writeArray(w, obj.Array)
@@ -541,6 +871,29 @@ func (p *PDF) writeDict(w *bytes.Buffer, dict []*Pair) error {
 			continue
 		}
 
+		// bool类型
+		b, ok := pair.Value.(bool)
+		if ok {
+			w.WriteByte(' ')
+			w.WriteString(strconv.FormatBool(b))
+			w.WriteByte('\n')
+			continue
+		}
+
+		// 实数类型
+		f, ok := pair.Value.(float64)
+		if ok {
+			w.WriteByte(' ')
+			w.WriteString(formatFloat(f))
+			w.WriteByte('\n')
+			continue
+		}
+
+		if pair.Value == nil {
+			w.WriteString(" null\n")
+			continue
+		}
+
 		typ := reflect.TypeOf(pair.Value)
 		log.Default().Fatalf("dict value type: %v, value: %v", typ, pair.Value)
 	}
@@ -590,6 +943,48 @@ func (p *PDF) writeArray(w *bytes.Buffer, array []interface{}) error {
 			continue
 		}
 
+		b, ok := item.(bool)
+		if ok {
+			w.WriteString(strconv.FormatBool(b))
+			if i < len(array)-1 {
+				w.WriteByte(' ')
+			}
+			continue
+		}
+
+		f, ok := item.(float64)
+		if ok {
+			w.WriteString(formatFloat(f))
+			if i < len(array)-1 {
+				w.WriteByte(' ')
+			}
+			continue
+		}
+
+		// 嵌套的数组和字典
+		sub, ok := item.([]interface{})
+		if ok {
+			p.writeArray(w, sub)
+			if i < len(array)-1 {
+				w.WriteByte(' ')
+			}
+			continue
+		}
+
+		dict, ok := item.([]*Pair)
+		if ok {
+			p.writeDict(w, dict)
+			continue
+		}
+
+		if item == nil {
+			w.WriteString("null")
+			if i < len(array)-1 {
+				w.WriteByte(' ')
+			}
+			continue
+		}
+
 		if !ok {
 			log.Default().Fatalf("array item unknown type: %v, value: %v", reflect.TypeOf(item), item)
 		}
@@ -598,6 +993,11 @@ func (p *PDF) writeArray(w *bytes.Buffer, array []interface{}) error {
 	return nil
 }
 
+// formatFloat 输出实数，不使用科学计数法
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
 func (p *PDF) writeObjRef(w *bytes.Buffer, obj *Obj) error {
 	str := fmt.Sprintf("%d %d R", obj.ID, obj.GenID)
 	w.WriteString(str)
@@ -754,16 +1154,6 @@ func (p *PDF) readObjects() error {
 
 	for {
 		typ := p.detectType()
-		// 开始读取字典对象
-		if typ == ElementTypeDict {
-			dict, err := p.readDict()
-			if err != nil {
-				return err
-			}
-			obj.Dict = dict
-			continue
-		}
-
 		if typ == ElementTypeCmdEndObj {
 			p.readString()
 			log.Default().Printf("read object end: endobj")
@@ -779,28 +1169,23 @@ func (p *PDF) readObjects() error {
 			continue
 		}
 
-		if typ == ElementTypeArray {
-			// 数组对象
-			array, err := p.readArray()
-			if err != nil {
-				return err
-			}
-			obj.Array = array
-			continue
-		}
-
-		if typ == ElementTypeNum {
-			p.skipSpace()
-			v, err := p.readInt()
-			if err != nil {
-				return err
-			}
+		// 对象的内容: 字典、数组、数字、字符串、名字、布尔值或者 null
+		v, err := p.readLexerObject()
+		if err != nil {
+			return fmt.Errorf("object %d %d: %v", obj.ID, obj.GenID, err)
+		}
+		switch v := v.(type) {
+		case []*Pair:
+			obj.Dict = v
+		case []interface{}:
+			obj.Array = v
+		case int:
 			obj.Int = v
 			obj.typ = ElementTypeNum
-			continue
+		case nil:
+		default:
+			obj.value = v
 		}
-
-		log.Default().Fatalf("unknown typ: %d", typ)
 	}
 
 	//log.Default().Printf("read obj[%d %d]: %v", obj.ID, obj.GenID, obj)
@@ -808,120 +1193,28 @@ func (p *PDF) readObjects() error {
 	return nil
 }
 
+// readArray 和 readDict 用 lexer 读取，和内容流共用同一个词法分析
 func (p *PDF) readArray() ([]interface{}, error) {
-	p.skipSpace()
-	ch := p.bytes[0]
-	if ch != '[' {
-		return nil, errors.New("expect [")
-	}
-	p.bytes = p.bytes[1:]
-	list := make([]interface{}, 0)
-	for {
-		typ := p.detectType()
-		if typ == ElementTypeName {
-			name, err := p.readNameObj()
-			if err != nil {
-				return nil, err
-			}
-			str := name.Name
-			end := strings.HasSuffix(str, "]")
-			if end {
-				name.Name = str[:len(str)-1]
-			}
-			list = append(list, name)
-			if end {
-				break
-			}
-			continue
-		}
-		if typ == ElementTypeNum {
-			v, err := p.readInt()
-			if err != nil {
-				return nil, err
-			}
-			list = append(list, v)
-			continue
-		}
-
-		if typ == ElementTypeObjRef {
-			obj, err := p.readObjRef()
-			if err != nil {
-				return nil, err
-			}
-			list = append(list, obj)
-			continue
-		}
-
-		if typ == ElementTypeHexString {
-			hex, err := p.readHexString()
-			if err != nil {
-				return nil, err
-			}
-			list = append(list, hex)
-			continue
-		}
-
-		if typ == ElementTypeCmdEndArray {
-			str, err := p.readString()
-			if err != nil {
-				return nil, err
-			}
-			str = str[0 : len(str)-1]
-			if len(str) == 0 {
-				break
-			}
-			if p.isNumber(str) {
-				v, err := strconv.Atoi(str)
-				if err != nil {
-					return nil, err
-				}
-				list = append(list, v)
-			} else if strings.HasPrefix(str, "/") {
-				name := &NameObj{Name: str}
-				list = append(list, name)
-			} else {
-				log.Default().Fatalf("unknown array end typ: %s", str)
-			}
-			break
-		} else {
-			log.Default().Fatalf("unknown typ: %d", typ)
-		}
-	}
-	return list, nil
-}
-
-func (p *PDF) readHexString() (string, error) {
-	hex, err := p.readString()
+	v, err := p.readLexerObject()
 	if err != nil {
-		return "", err
-	}
-	// 可能一下子读出了多个字符串，只取第一个
-	if !strings.HasPrefix(hex, "<") {
-		return "", errors.New("expect hex string: <")
+		return nil, err
 	}
-	idx := 0
-	for i, ch := range hex {
-		b := byte(ch)
-		if b == '>' {
-			idx = i
-			break
-		}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("expect [")
 	}
-	num := hex[0 : idx+1]
-	left := hex[idx+1:]
-	bytes := make([]byte, 0)
-	bytes = append(bytes, left...)
-	bytes = append(bytes, p.bytes...)
-	p.bytes = bytes
-	return num, nil
+	return list, nil
 }
 
-func (p *PDF) readNameObj() (*NameObj, error) {
-	str, err := p.readString()
+// readLexerObject 从当前位置读取一个完整的对象
+func (p *PDF) readLexerObject() (interface{}, error) {
+	l := newLexer(p.bytes)
+	v, err := l.readObject()
 	if err != nil {
 		return nil, err
 	}
-	return &NameObj{Name: str}, nil
+	p.bytes = p.bytes[l.pos:]
+	return v, nil
 }
 
 func (p *PDF) readStream() (*Stream, error) {
@@ -958,123 +1251,17 @@ func (p *PDF) readStream() (*Stream, error) {
 
 func (p *PDF) readDict() ([]*Pair, error) {
 	log.Default().Print("start to read dict")
-	// 读取开头的 <<
-	start, err := p.readString()
+	v, err := p.readLexerObject()
 	if err != nil {
 		return nil, err
 	}
-	if start != "<<" {
+	dict, ok := v.([]*Pair)
+	if !ok {
 		return nil, errors.New("expect <<")
 	}
-	dict := make([]*Pair, 0)
-	for {
-		typ := p.detectType()
-		if typ == ElementTypeCmdEndDict {
-			p.readString()
-			break
-		}
-		if typ != ElementTypeName {
-			return nil, errors.New("expect /Name object")
-		}
-		// read key, /Name
-		key, err := p.readNameObj()
-		if err != nil {
-			return nil, err
-		}
-		item := &Pair{}
-		item.Key = key
-		// read value
-		typ = p.detectType()
-		if typ == ElementTypeName {
-			value, err := p.readNameObj()
-			if err != nil {
-				return nil, err
-			}
-			item.Value = value
-			dict = append(dict, item)
-			continue
-		}
-		if typ == ElementTypeDict {
-			value, err := p.readDict()
-			if err != nil {
-				return nil, err
-			}
-			item.Value = value
-			dict = append(dict, item)
-			continue
-		}
-		if typ == ElementTypeObjRef {
-			value, err := p.readObjRef()
-			if err != nil {
-				return nil, err
-			}
-			item.Value = value
-			dict = append(dict, item)
-			continue
-		}
-		if typ == ElementTypeArray {
-			value, err := p.readArray()
-			if err != nil {
-				return nil, err
-			}
-			item.Value = value
-			dict = append(dict, item)
-			continue
-
-		}
-
-		if typ == ElementTypeNum {
-			value, err := p.readInt()
-			if err != nil {
-				return nil, err
-			}
-			item.Value = value
-			dict = append(dict, item)
-			continue
-		}
-
-		if typ == ElementTypeString {
-			value, err := p.readXString()
-			if err != nil {
-				return nil, err
-			}
-			item.Value = value
-			dict = append(dict, item)
-			continue
-		}
-
-		log.Default().Fatalf("unknown type: %d", typ)
-	}
 	return dict, nil
 }
 
-func (p *PDF) readXString() (string, error) {
-	// 读小括号包围的字符串
-	p.skipSpace()
-	buf := make([]byte, 0)
-	reader := bytes.NewReader(p.bytes)
-	cnt := 0
-	b, err := reader.ReadByte()
-	if err != nil {
-		return "", err
-	}
-	cnt++
-	for {
-		buf = append(buf, b)
-		b, err = reader.ReadByte()
-		if err != nil {
-			return "", err
-		}
-		cnt++
-		if b == ')' {
-			buf = append(buf, b)
-			break
-		}
-	}
-	p.bytes = p.bytes[cnt:]
-	return string(buf), nil
-}
-
 const (
 	ElementTypeUnkown      = -1
 	ElementTypeObj         = 0
@@ -1092,6 +1279,8 @@ const (
 	ElementTypeTrailer     = 12
 	ElementTypeHexString   = 13
 	ElementTypeEOF         = 14
+	ElementTypeBool        = 15
+	ElementTypeNull        = 16
 )
 
 func (p *PDF) detectType() int {
@@ -1111,7 +1300,7 @@ func (p *PDF) detectType() int {
 	// 对象
 	if len(words) >= 3 {
 		// 两个数 + "R"
-		if p.isNumber(words[0]) && p.isNumber(words[1]) && words[2] == "R" {
+		if p.isNumber(words[0]) && p.isNumber(words[1]) && isRefKeyword(words[2]) {
 			log.Default().Printf("found type obj ref")
 			return ElementTypeObjRef
 		}
@@ -1125,14 +1314,14 @@ func (p *PDF) detectType() int {
 
 	// 数字类型
 	if len(words) > 0 {
-		if p.isNumber(words[0]) {
+		if p.isNumber(words[0]) || isRealNumber(words[0]) {
 			log.Default().Printf("found type number")
 			return ElementTypeNum
 		}
 	}
 
 	// 字典类型 <<
-	if len(words) > 0 && words[0] == "<<" {
+	if len(words) > 0 && strings.HasPrefix(words[0], "<<") {
 		log.Default().Printf("found type dict")
 		return ElementTypeDict
 	}
@@ -1199,6 +1388,18 @@ func (p *PDF) detectType() int {
 		return ElementTypeEOF
 	}
 
+	// true / false
+	if len(words) > 0 && (strings.TrimSuffix(words[0], "]") == "true" || strings.TrimSuffix(words[0], "]") == "false") {
+		log.Default().Printf("found type bool")
+		return ElementTypeBool
+	}
+
+	// null
+	if len(words) > 0 && strings.TrimSuffix(words[0], "]") == "null" {
+		log.Default().Printf("found type null")
+		return ElementTypeNull
+	}
+
 	return -1
 }
 
@@ -1264,26 +1465,9 @@ func (p *PDF) readIntArray() ([]int, error) {
 	return list, nil
 }
 
-func (p *PDF) readObjRef() (*Obj, error) {
-	id, err := p.readInt()
-	if err != nil {
-		return &Obj{}, nil
-	}
-	gid, err := p.readInt()
-	if err != nil {
-		return nil, err
-	}
-	s, err := p.readString()
-	if err != nil {
-		return nil, err
-	}
-	if s != "R" {
-		return nil, errors.New("expect R")
-	}
-	return &Obj{
-		ID:    id,
-		GenID: gid,
-	}, nil
+// isRefKeyword 判断是否为对象引用的 R，可能紧跟着分隔符，如 R] 、R>>
+func isRefKeyword(word string) bool {
+	return strings.HasPrefix(word, "R") && (len(word) == 1 || isDelimiter(word[1]))
 }
 
 func (p *PDF) readString() (string, error) {
@@ -0,0 +1,68 @@
+package pdf
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// encodePDFString 把字节编码为 (...) 形式的字符串，转义括号、反斜杠和换行
+func encodePDFString(data []byte) string {
+	buf := strings.Builder{}
+	buf.WriteByte('(')
+	for _, b := range data {
+		switch b {
+		case '(', ')', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(b)
+		case '\r':
+			buf.WriteString("\\r")
+		case '\n':
+			buf.WriteString("\\n")
+		default:
+			buf.WriteByte(b)
+		}
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+// encodeTextString 按 PDF 文本字符串编码: 只有 ASCII 时原样保存，否则用带 BOM 的 UTF-16BE
+func encodeTextString(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return encodePDFString([]byte(s))
+	}
+	data := []byte{0xfe, 0xff}
+	for _, v := range utf16.Encode([]rune(s)) {
+		data = append(data, byte(v>>8), byte(v))
+	}
+	return encodePDFString(data)
+}
+
+// decodeTextString 解码 PDF 文本字符串，UTF-16BE (有 BOM) 或者 UTF-8 (有 BOM)，
+// 否则按 PDFDocEncoding 处理，这里把它近似为 Latin-1
+func decodeTextString(str string) string {
+	data := decodePDFString(str)
+	switch {
+	case len(data) >= 2 && data[0] == 0xfe && data[1] == 0xff:
+		units := make([]uint16, 0, len(data)/2)
+		for i := 2; i+1 < len(data); i += 2 {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case len(data) >= 3 && data[0] == 0xef && data[1] == 0xbb && data[2] == 0xbf && utf8.Valid(data[3:]):
+		return string(data[3:])
+	}
+	runes := make([]rune, 0, len(data))
+	for _, b := range data {
+		runes = append(runes, rune(b))
+	}
+	return string(runes)
+}
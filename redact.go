@@ -0,0 +1,712 @@
+package pdf
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+)
+
+// 涂黑: 从内容流中真正删除区域中的文字、路径和图像像素，再画上填充色的矩形。
+// 只画矩形盖住内容是不够的，下面的文字仍然可以复制和提取
+
+// Redaction 要涂黑的区域
+type Redaction struct {
+	Page int  // 页码，从1开始
+	Rect Rect // 默认用户空间中的矩形，不考虑页面的 /Rotate
+}
+
+// RedactOptions 涂黑的选项
+type RedactOptions struct {
+	Color []float64 // 填充的 RGB 颜色，默认为黑色
+}
+
+// Redact 涂黑 areas 中的区域:
+// 和区域相交的字形从文字操作符中删除，后面的文字位置不变，字形的高度取字体描述的 /Ascent 和 /Descent；
+// 完全在区域中的路径和 sh 删除，部分在区域中的用裁剪去掉区域中的部分；
+// 完全在区域中的图像删除，部分在区域中的图像把区域中的像素改为填充颜色后重新编码；
+// 和区域相交的注释删除，页面的缩略图、/PieceInfo 和 /Metadata 删除，
+// 包含被删除文字的标记内容去掉 /ActualText、/Alt 和 /E。
+// 被替换的内容流和图像如果没有其他地方引用，从文档中删除
+func (p *PDF) Redact(areas []Redaction, opts *RedactOptions) error {
+	if opts == nil {
+		opts = &RedactOptions{}
+	}
+	color := opts.Color
+	if len(color) != 3 {
+		color = []float64{0, 0, 0}
+	}
+	total := p.NumPages()
+	byPage := make(map[int][]Rect)
+	for _, a := range areas {
+		if a.Page < 1 || a.Page > total {
+			return fmt.Errorf("page %d not found", a.Page)
+		}
+		if r := a.Rect.normalize(); !r.isEmpty() {
+			byPage[a.Page] = append(byPage[a.Page], r)
+		}
+	}
+	r := &redactor{p: p, color: color, fonts: make(map[*Obj]*pdfFont)}
+	for _, pg := range p.Pages() {
+		if len(byPage[pg.Number]) == 0 {
+			continue
+		}
+		r.areas = byPage[pg.Number]
+		if err := r.page(pg); err != nil {
+			return fmt.Errorf("page %d: %v", pg.Number, err)
+		}
+	}
+	removed := p.removeUnreferenced(r.removed)
+	log.Default().Printf("redact %d glyphs, %d paths, %d images, %d annots, remove %d objs",
+		r.glyphs, r.paths, r.images, r.annots, removed)
+	return nil
+}
+
+// RedactMatches 涂黑搜索结果，每个四边形为一个区域
+func (p *PDF) RedactMatches(matches []*SearchMatch, opts *RedactOptions) error {
+	areas := make([]Redaction, 0, len(matches))
+	for _, m := range matches {
+		for _, q := range m.Quads {
+			areas = append(areas, Redaction{Page: m.Page, Rect: q.rect()})
+		}
+	}
+	return p.Redact(areas, opts)
+}
+
+// redactor 涂黑一页的内容
+type redactor struct {
+	p       *PDF
+	areas   []Rect
+	color   []float64
+	fonts   map[*Obj]*pdfFont
+	depth   int
+	removed []*Obj // 被替换的对象，最后没有引用时删除
+
+	glyphs, paths, images, annots int
+}
+
+// overlaps r 是否和某个区域相交，宽或者高为0的 r 也可以相交
+func (r *redactor) overlaps(box Rect) bool {
+	for _, a := range r.areas {
+		if box.LLX < a.URX && box.URX > a.LLX && box.LLY < a.URY && box.URY > a.LLY {
+			return true
+		}
+	}
+	return false
+}
+
+// inside r 是否完全在某个区域中
+func (r *redactor) inside(box Rect) bool {
+	for _, a := range r.areas {
+		if box.LLX >= a.LLX && box.URX <= a.URX && box.LLY >= a.LLY && box.URY <= a.URY {
+			return true
+		}
+	}
+	return false
+}
+
+// unboundedRect 没有 /BBox 的 sh 画满整个裁剪区域，不跟踪裁剪路径时当作无限大
+var unboundedRect = Rect{-1e5, -1e5, 1e5, 1e5}
+
+// shadingBox sh 画出的范围，为底纹的 /BBox，没有时为 unboundedRect
+func (r *redactor) shadingBox(op *Operator, res []*Pair, ctm matrix) Rect {
+	if len(op.Operands) != 1 {
+		return unboundedRect
+	}
+	name, _ := op.Operands[0].(*NameObj)
+	if name == nil {
+		return unboundedRect
+	}
+	p := r.p
+	var dict []*Pair
+	switch v := p.resolve(p.getValueByKey(p.getResolvedDict(res, "/Shading"), name.Name)).(type) {
+	case *Obj:
+		dict = v.Dict
+	case []*Pair:
+		dict = v
+	}
+	box, ok := p.getRect(p.getValueByKey(dict, "/BBox"))
+	if !ok {
+		return unboundedRect
+	}
+	return ctm.transformRect(box)
+}
+
+func (r *redactor) page(pg *Page) error {
+	p := r.p
+	res := p.pageResources(pg.obj)
+	ops, changed, err := r.content(p.pageContentData(pg.obj), &res, identityMatrix)
+	if err != nil {
+		return err
+	}
+	if changed {
+		r.removed = append(r.removed, p.pageContents(pg.obj)...)
+		setPairValue(&pg.obj.Dict, "/Resources", res)
+		pg.SetContent(ops)
+	}
+	fill := fmt.Sprintf("q %s %s %s rg\n", formatFloat(r.color[0]), formatFloat(r.color[1]), formatFloat(r.color[2]))
+	for _, a := range r.areas {
+		fill += fmt.Sprintf("%s %s %s %s re f\n",
+			formatFloat(roundFloat(a.LLX)), formatFloat(roundFloat(a.LLY)),
+			formatFloat(roundFloat(a.Width())), formatFloat(roundFloat(a.Height())))
+	}
+	p.appendContent(pg.obj, []byte(fill+"Q\n"))
+	r.removeAnnots(pg.obj)
+	// 缩略图和页面的元数据中可能有被涂黑的内容
+	for _, key := range []string{"/Thumb", "/PieceInfo", "/Metadata"} {
+		if obj, ok := p.getValueByKey(pg.obj.Dict, key).(*Obj); ok {
+			if obj = p.getObj(obj); obj != nil {
+				r.removed = append(r.removed, obj)
+			}
+		}
+		p.deleteDictValue(pg.obj, key)
+	}
+	return nil
+}
+
+// content 涂黑一段内容流，res 为它使用的资源字典的副本，新的 XObject 加到其中。
+// 返回新的操作符序列，没有修改时 changed 为 false
+func (r *redactor) content(data []byte, res *[]*Pair, ctm matrix) (ops []*Operator, changed bool, err error) {
+	p := r.p
+	s := newTextState(ctm)
+	font := func(name string) *pdfFont {
+		return p.cachedFont(r.fonts, p.getResolvedDict(*res, "/Font"), name)
+	}
+	ops = make([]*Operator, 0)
+	// 正在构造的路径和它的范围
+	path := make([]*Operator, 0)
+	var pathBox Rect
+	addPoint := func(x, y float64) {
+		x, y = s.gs.ctm.transform(x, y)
+		if len(path) == 0 {
+			pathBox = Rect{x, y, x, y}
+			return
+		}
+		pathBox.LLX, pathBox.LLY = math.Min(pathBox.LLX, x), math.Min(pathBox.LLY, y)
+		pathBox.URX, pathBox.URY = math.Max(pathBox.URX, x), math.Max(pathBox.URY, y)
+	}
+	// 标记内容的栈，其中有字形被删除的 BDC 要去掉替代文字
+	marked := make([]*Operator, 0)
+	touched := make(map[*Operator]bool)
+	c := newContentParser(data)
+	for {
+		op, err := c.next()
+		if err != nil {
+			return nil, false, err
+		}
+		if op == nil {
+			break
+		}
+		s.apply(op.Name, op.Operands, font)
+		v := make([]float64, 0, len(op.Operands))
+		for _, arg := range op.Operands {
+			if n, ok := toFloat(arg); ok {
+				v = append(v, n)
+			}
+		}
+		switch op.Name {
+		case "m", "l", "c", "v", "y":
+			for i := 0; i+1 < len(v); i += 2 {
+				addPoint(v[i], v[i+1])
+			}
+			path = append(path, op)
+			continue
+		case "re":
+			if len(v) == 4 {
+				addPoint(v[0], v[1])
+				addPoint(v[0]+v[2], v[1])
+				addPoint(v[0], v[1]+v[3])
+				addPoint(v[0]+v[2], v[1]+v[3])
+			}
+			path = append(path, op)
+			continue
+		case "h", "W", "W*":
+			path = append(path, op)
+			continue
+		case "S", "s", "f", "F", "f*", "B", "B*", "b", "b*", "n":
+			list, modified := r.paint(path, pathBox, op, &s.gs)
+			ops = append(ops, list...)
+			changed = changed || modified
+			path = path[:0]
+			continue
+		case "sh":
+			list, modified := r.paint(nil, r.shadingBox(op, *res, s.gs.ctm), op, &s.gs)
+			ops = append(ops, list...)
+			changed = changed || modified
+			continue
+		case "BMC", "BDC":
+			marked = append(marked, op)
+		case "EMC":
+			if len(marked) > 0 {
+				marked = marked[:len(marked)-1]
+			}
+		case "Tj", "'", "\"", "TJ":
+			if list := r.text(op, s); list != nil {
+				for _, m := range marked {
+					touched[m] = true
+				}
+				ops = append(ops, list...)
+				changed = true
+				continue
+			}
+		case "Do":
+			if list, modified := r.xobject(op, res, s.gs.ctm); modified {
+				ops = append(ops, list...)
+				changed = true
+				continue
+			}
+		case "BI":
+			if list, modified := r.inlineImage(op, res, s.gs.ctm); modified {
+				ops = append(ops, list...)
+				changed = true
+				continue
+			}
+		}
+		ops = append(ops, op)
+	}
+	if changed {
+		r.pruneXObjects(ops, res)
+	}
+	for op := range touched {
+		if op.Name != "BDC" || len(op.Operands) != 2 {
+			continue
+		}
+		if props, ok := op.Operands[1].([]*Pair); ok {
+			list := make([]*Pair, 0, len(props))
+			for _, pair := range props {
+				if pair.Key.Name != "/ActualText" && pair.Key.Name != "/Alt" && pair.Key.Name != "/E" {
+					list = append(list, pair)
+				}
+			}
+			op.Operands[1] = list
+		}
+	}
+	return ops, changed, nil
+}
+
+// pruneXObjects 去掉资源中不再使用的 XObject，被替换的图像和 Form 才能从文档中删除
+func (r *redactor) pruneXObjects(ops []*Operator, res *[]*Pair) {
+	used := make(map[string]bool)
+	for _, op := range ops {
+		if op.Name == "Do" && len(op.Operands) == 1 {
+			if name, ok := op.Operands[0].(*NameObj); ok {
+				used[name.Name] = true
+			}
+		}
+	}
+	xobjects := r.p.getResolvedDict(*res, "/XObject")
+	list := make([]*Pair, 0, len(xobjects))
+	for _, pair := range xobjects {
+		if used[pair.Key.Name] {
+			list = append(list, pair)
+		}
+	}
+	if len(list) != len(xobjects) {
+		setPairValue(res, "/XObject", list)
+	}
+}
+
+// paint 处理画路径的操作符和 sh，返回路径和 op 替换后的操作符
+func (r *redactor) paint(path []*Operator, box Rect, op *Operator, gs *graphicsState) ([]*Operator, bool) {
+	ops := append(append(make([]*Operator, 0, len(path)+1), path...), op)
+	switch op.Name {
+	case "S", "s", "B", "B*", "b", "b*":
+		d := gs.lineWidth * gs.ctm.scale() / 2
+		box = Rect{box.LLX - d, box.LLY - d, box.URX + d, box.URY + d}
+	}
+	clip := false
+	for _, item := range path {
+		clip = clip || item.Name == "W" || item.Name == "W*"
+	}
+	if op.Name == "n" || (len(path) == 0 && op.Name != "sh") || !r.overlaps(box) {
+		return ops, false
+	}
+	r.paths++
+	if r.inside(box) {
+		if clip {
+			// 保留裁剪路径，只是不画出来
+			return append(ops[:len(path)], &Operator{Name: "n"}), true
+		}
+		return nil, true
+	}
+	inv, ok := gs.ctm.invert()
+	if clip || !ok {
+		// 裁剪的同时画路径很少见，不能再嵌套 q Q，保留原样由填充的矩形盖住
+		log.Default().Printf("redact: keep clipping path partially in area")
+		return ops, false
+	}
+	// 用奇偶规则裁剪掉区域，路径在区域外的部分照常画出
+	outer := box
+	list := []*Operator{{Name: "q"}, {Name: "cm", Operands: inv.operands()}}
+	for _, a := range r.areas {
+		if box.intersect(a).isEmpty() {
+			continue
+		}
+		outer = outer.union(a)
+		list = append(list, &Operator{Name: "re", Operands: []interface{}{a.LLX, a.LLY, a.Width(), a.Height()}})
+	}
+	outer = Rect{outer.LLX - 1, outer.LLY - 1, outer.URX + 1, outer.URY + 1}
+	list = append(list,
+		&Operator{Name: "re", Operands: []interface{}{outer.LLX, outer.LLY, outer.Width(), outer.Height()}},
+		&Operator{Name: "W*"}, &Operator{Name: "n"},
+		&Operator{Name: "cm", Operands: gs.ctm.operands()})
+	list = append(list, ops...)
+	return append(list, &Operator{Name: "Q"}), true
+}
+
+// text 删除文字操作符中在区域里的字形，删除的字形换成 TJ 中的位移，后面的字形位置不变。
+// 没有删除字形时返回 nil
+func (r *redactor) text(op *Operator, s *textState) []*Operator {
+	if len(op.Operands) == 0 {
+		return nil
+	}
+	items := op.Operands[len(op.Operands)-1:]
+	if op.Name == "TJ" {
+		items, _ = op.Operands[0].([]interface{})
+	}
+	list := make([]interface{}, 0, len(items))
+	removed := false
+	for _, item := range items {
+		str, ok := item.(string)
+		if !ok {
+			if n, ok := toFloat(item); ok {
+				s.kern(n)
+			}
+			list = append(list, item)
+			continue
+		}
+		if s.gs.font == nil {
+			list = append(list, item)
+			continue
+		}
+		kept := make([]byte, 0)
+		s.show(decodePDFString(str), func(g *textGlyph, raw []byte) {
+			if !r.overlaps(g.bbox) {
+				kept = append(kept, raw...)
+				return
+			}
+			removed = true
+			r.glyphs++
+			if len(kept) > 0 {
+				list = append(list, encodePDFString(kept))
+				kept = kept[:0]
+			}
+			if s.gs.fontSize != 0 {
+				code := s.gs.font.codes(raw)[0]
+				list = append(list, roundFloat(-s.advance(code)*1000/s.gs.fontSize))
+			}
+		})
+		if len(kept) > 0 {
+			list = append(list, encodePDFString(kept))
+		}
+	}
+	if !removed {
+		return nil
+	}
+	ops := make([]*Operator, 0, 4)
+	switch op.Name {
+	case "'":
+		ops = append(ops, &Operator{Name: "T*"})
+	case "\"":
+		ops = append(ops,
+			&Operator{Name: "Tw", Operands: []interface{}{s.gs.wordSpace}},
+			&Operator{Name: "Tc", Operands: []interface{}{s.gs.charSpace}},
+			&Operator{Name: "T*"})
+	}
+	return append(ops, &Operator{Name: "TJ", Operands: []interface{}{list}})
+}
+
+// xobject 处理 Do: 图像在区域中的像素改为填充颜色，Form 递归涂黑后保存为新的 Form
+func (r *redactor) xobject(op *Operator, res *[]*Pair, ctm matrix) ([]*Operator, bool) {
+	p := r.p
+	if len(op.Operands) != 1 {
+		return nil, false
+	}
+	name, ok := op.Operands[0].(*NameObj)
+	if !ok {
+		return nil, false
+	}
+	obj, _ := p.resolve(p.getValueByKey(p.getResolvedDict(*res, "/XObject"), name.Name)).(*Obj)
+	if obj == nil || obj.Stream == nil {
+		return nil, false
+	}
+	subtype := p.getNameObjByKey(obj.Dict, "/Subtype")
+	if subtype == nil {
+		return nil, false
+	}
+	switch subtype.Name {
+	case "/Image":
+		box := ctm.transformRect(Rect{0, 0, 1, 1})
+		if !r.overlaps(box) {
+			return nil, false
+		}
+		r.images++
+		if r.inside(box) {
+			return nil, true
+		}
+		img := r.blankImage(obj, ctm)
+		if img == nil {
+			return nil, true
+		}
+		r.removed = append(r.removed, obj)
+		return []*Operator{r.useXObject(res, "/Im", img)}, true
+	case "/Form":
+		form := p.openForm(obj, *res, r.depth)
+		if form == nil {
+			return nil, false
+		}
+		ctm = form.matrix.multiply(ctm)
+		if bbox, ok := p.getRect(p.getValueByKey(obj.Dict, "/BBox")); ok {
+			box := ctm.transformRect(bbox.normalize())
+			if !r.overlaps(box) {
+				return nil, false
+			}
+			if r.inside(box) {
+				return nil, true
+			}
+		}
+		data, _, err := p.decodeStream(obj)
+		if err != nil {
+			// 不能确认其中的内容，整个去掉
+			log.Default().Printf("redact: decode form %d %d err: %v", obj.ID, obj.GenID, err)
+			return nil, true
+		}
+		copied := p.copyResources(form.resources)
+		r.depth++
+		ops, changed, err := r.content(data, &copied, ctm)
+		r.depth--
+		if err != nil {
+			log.Default().Printf("redact: parse form %d %d err: %v", obj.ID, obj.GenID, err)
+			return nil, true
+		}
+		if !changed {
+			return nil, false
+		}
+		clone := p.newStreamObj(cloneDict(obj.Dict), nil)
+		setPairValue(&clone.Dict, "/Resources", copied)
+		p.setContentData(clone, WriteContent(ops))
+		r.removed = append(r.removed, obj)
+		return []*Operator{r.useXObject(res, "/Fm", clone)}, true
+	}
+	return nil, false
+}
+
+// inlineImage 处理内嵌图像，部分在区域中时转为图像 XObject
+func (r *redactor) inlineImage(op *Operator, res *[]*Pair, ctm matrix) ([]*Operator, bool) {
+	box := ctm.transformRect(Rect{0, 0, 1, 1})
+	if op.Image == nil || !r.overlaps(box) {
+		return nil, false
+	}
+	r.images++
+	if r.inside(box) {
+		return nil, true
+	}
+	r.p.resolveInlineColorSpace(op.Image, *res)
+	img := r.blankImage(op.Image.obj(), ctm)
+	if img == nil {
+		return nil, true
+	}
+	return []*Operator{r.useXObject(res, "/Im", img)}, true
+}
+
+// useXObject 把 obj 加到资源字典中，返回画出它的 Do
+func (r *redactor) useXObject(res *[]*Pair, prefix string, obj *Obj) *Operator {
+	name := r.p.newXObjectName(*res, prefix)
+	r.p.setDictPath(res, []string{"/XObject", name}, objRef(obj))
+	return &Operator{Name: "Do", Operands: []interface{}{&NameObj{Name: name}}}
+}
+
+// blankImage 解码图像，和区域相交的像素改为填充颜色，保存为新的图像对象。
+// 模板蒙版 (/ImageMask) 和不能解码的图像返回 nil，由调用者整个去掉
+func (r *redactor) blankImage(obj *Obj, ctm matrix) *Obj {
+	p := r.p
+	if mask, ok := p.resolve(p.getValueByKey(obj.Dict, "/ImageMask")).(bool); ok && mask {
+		return nil
+	}
+	img, err := p.decodeImage(obj)
+	if err != nil {
+		log.Default().Printf("redact: decode image %d %d err: %v", obj.ID, obj.GenID, err)
+		return nil
+	}
+	b := img.Bounds()
+	var dst draw.Image
+	switch img.(type) {
+	case *image.Gray:
+		dst = image.NewGray(b)
+	case *image.CMYK:
+		dst = image.NewCMYK(b)
+	default:
+		dst = image.NewNRGBA(b)
+	}
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	fill := color.NRGBA{
+		R: uint8(math.Round(r.color[0] * 255)),
+		G: uint8(math.Round(r.color[1] * 255)),
+		B: uint8(math.Round(r.color[2] * 255)),
+		A: 0xff,
+	}
+	w, h := float64(b.Dx()), float64(b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		// 图像空间中第一行在单位正方形的上边
+		j := float64(y - b.Min.Y)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := float64(x - b.Min.X)
+			if !r.overlaps(ctm.transformRect(Rect{i / w, 1 - (j+1)/h, (i + 1) / w, 1 - j/h})) {
+				continue
+			}
+			if n, ok := dst.(*image.NRGBA); ok {
+				c := fill
+				c.A = n.NRGBAAt(x, y).A
+				n.SetNRGBA(x, y, c)
+			} else {
+				dst.Set(x, y, fill)
+			}
+		}
+	}
+	out := p.newStreamObj([]*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/XObject"}},
+		{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Image"}},
+	}, nil)
+	p.setImageData(out, dst)
+	return out
+}
+
+// removeAnnots 删除和区域相交的注释，以及它们的弹出窗口
+func (r *redactor) removeAnnots(page *Obj) {
+	p := r.p
+	annots, _ := p.resolve(p.getValueByKey(page.Dict, "/Annots")).([]interface{})
+	drop := make(map[*Obj]bool)
+	for _, item := range annots {
+		annot, _ := p.resolve(item).(*Obj)
+		if annot == nil {
+			continue
+		}
+		if rect, ok := p.getRect(p.getValueByKey(annot.Dict, "/Rect")); ok && r.overlaps(rect.normalize()) {
+			drop[annot] = true
+			if popup, ok := p.resolve(p.getValueByKey(annot.Dict, "/Popup")).(*Obj); ok {
+				drop[popup] = true
+			}
+		}
+	}
+	if len(drop) == 0 {
+		return
+	}
+	list := make([]interface{}, 0, len(annots))
+	for _, item := range annots {
+		if annot, _ := p.resolve(item).(*Obj); annot == nil || !drop[annot] {
+			list = append(list, item)
+		}
+	}
+	p.setDictValue(page, "/Annots", list)
+	for annot := range drop {
+		// 外观流是注释画出的内容，也要删除
+		for _, pair := range p.getResolvedDict(annot.Dict, "/AP") {
+			states := []interface{}{pair.Value}
+			if dict, ok := p.resolve(pair.Value).(*Obj); !ok || dict.Stream == nil {
+				states = states[:0]
+				for _, state := range p.resolveDict(pair.Value) {
+					states = append(states, state.Value)
+				}
+			}
+			for _, state := range states {
+				if ref, ok := state.(*Obj); ok {
+					if obj := p.getObj(ref); obj != nil && obj.Stream != nil {
+						r.removed = append(r.removed, obj)
+					}
+				}
+			}
+		}
+		p.removeObj(annot)
+		for _, obj := range p.Objects {
+			obj.Dict = replaceRefs(obj.Dict, annot).([]*Pair)
+			if obj.Array != nil {
+				obj.Array = replaceRefs(obj.Array, annot).([]interface{})
+			}
+		}
+		r.annots++
+	}
+}
+
+// removeUnreferenced 删除 list 中没有被引用的对象，删除的对象引用的其他对象也可能不再被引用，
+// 同样检查，直到没有可以删除的。返回删除的个数
+func (p *PDF) removeUnreferenced(list []*Obj) int {
+	cnt := 0
+	for {
+		rest := make([]*Obj, 0, len(list))
+		next := make([]*Obj, 0)
+		for _, obj := range list {
+			if p.getObj(obj) != obj {
+				// 已经删除了
+				continue
+			}
+			if p.isReferenced(obj) {
+				rest = append(rest, obj)
+				continue
+			}
+			p.removeObj(obj)
+			cnt++
+			next = append(next, p.referencedObjs(obj)...)
+		}
+		if len(rest) == len(list) && len(next) == 0 {
+			return cnt
+		}
+		list = append(rest, next...)
+	}
+}
+
+// referencedObjs 返回 obj 直接引用的对象
+func (p *PDF) referencedObjs(obj *Obj) []*Obj {
+	list := make([]*Obj, 0)
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case *Obj:
+			if ref := p.getObj(v); ref != nil {
+				list = append(list, ref)
+			}
+		case []*Pair:
+			for _, pair := range v {
+				walk(pair.Value)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(obj.Dict)
+	walk(obj.Array)
+	return list
+}
+
+// isReferenced 是否有其他对象或者 trailer 引用 target
+func (p *PDF) isReferenced(target *Obj) bool {
+	var refers func(value interface{}) bool
+	refers = func(value interface{}) bool {
+		switch v := value.(type) {
+		case *Obj:
+			return v.ID == target.ID && v.GenID == target.GenID
+		case []*Pair:
+			for _, pair := range v {
+				if refers(pair.Value) {
+					return true
+				}
+			}
+		case []interface{}:
+			for _, item := range v {
+				if refers(item) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, obj := range p.Objects {
+		if obj != target && (refers(obj.Dict) || refers(obj.Array)) {
+			return true
+		}
+	}
+	return p.Trailer != nil && refers(p.Trailer.Dict)
+}
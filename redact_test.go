@@ -0,0 +1,145 @@
+package pdf
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPDF 把 objs 依次作为 1 0 obj、2 0 obj ... 写成文档再读出来，第一个对象为目录
+func testPDF(t *testing.T, objs []string) *PDF {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, 0, len(objs))
+	for i, obj := range objs {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	start := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, start)
+	p := &PDF{bytes: []byte(b.String())}
+	if err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func testStream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\r\n%s\nendstream", dict, len(data), data)
+}
+
+func TestRedactText(t *testing.T) {
+	widths := strings.TrimSpace(strings.Repeat("500 ", 95))
+	p := testPDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R " +
+			"/Resources << /Font << /F1 5 0 R >> /XObject << /Fm1 6 0 R >> >> >>",
+		testStream("", "BT /F1 12 Tf 72 720 Td (Top Secret plan) Tj ET\n"+
+			"BT /F1 12 Tf 72 700 Td [(Keep)-200(Secret)] TJ 0 -14 Td 2 1 (Next Secret) \" ET\n"+
+			"q 1 0 0 1 0 -300 cm /Fm1 Do Q"),
+		fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /FirstChar 32 /LastChar 126 /Widths [%s] /FontDescriptor 7 0 R >>", widths),
+		testStream("/Type /XObject /Subtype /Form /BBox [0 0 612 792] /Resources << /Font << /F1 5 0 R >> >>",
+			"BT /F1 12 Tf 72 700 Td (Form Secret) Tj ET"),
+		// 行距只有 14 点，字形的高度取 Helvetica 的实际值，否则相邻两行的字形会相交
+		"<< /Type /FontDescriptor /FontName /Helvetica /Flags 32 /Ascent 718 /Descent -207 >>",
+	})
+	before, _ := p.Search("plan", nil)
+	matches, err := p.Search("Secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 4 {
+		t.Fatalf("found %d matches, want 4", len(matches))
+	}
+	if err := p.RedactMatches(matches, nil); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "redacted.pdf")
+	if err := p.SaveFile(file, false); err != nil {
+		t.Fatal(err)
+	}
+	q, err := ReadFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg, err := q.Page(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := pg.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(text, "Secret") {
+		t.Errorf("text still contains the redacted word:\n%s", text)
+	}
+	for _, word := range []string{"Top", "plan", "Keep", "Next", "Form"} {
+		if !strings.Contains(text, word) {
+			t.Errorf("text lost %q:\n%s", word, text)
+		}
+	}
+	// 删除的字形换成位移，后面的文字位置不变
+	after, _ := q.Search("plan", nil)
+	if len(before) != 1 || len(after) != 1 || before[0].Quads[0] != after[0].Quads[0] {
+		t.Errorf("plan moved: %v, %v", before, after)
+	}
+}
+
+func TestRedactGlyphsAndShadings(t *testing.T) {
+	p := testPDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R " +
+			"/Resources << /Font << /F1 5 0 R >> /Shading << /Sh1 6 0 R /Sh2 7 0 R >> >> >>",
+		testStream("", "q 0 0 100 100 re W n /Sh1 sh Q\n/Sh2 sh\nBT /F1 12 Tf 72 720 Td (ABCD) Tj ET"),
+		fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /FirstChar 32 /LastChar 126 /Widths [%s] >>",
+			strings.TrimSpace(strings.Repeat("500 ", 95))),
+		"<< /ShadingType 2 /ColorSpace /DeviceGray /Coords [0 0 50 0] /Function << /FunctionType 2 /Domain [0 1] /N 1 >> /BBox [10 10 50 50] >>",
+		"<< /ShadingType 2 /ColorSpace /DeviceGray /Coords [0 0 612 0] /Function << /FunctionType 2 /Domain [0 1] /N 1 >> >>",
+	})
+	// 第二个区域只碰到 A 的右下角，不包含它的中心
+	err := p.Redact([]Redaction{
+		{Page: 1, Rect: Rect{0, 0, 60, 60}},
+		{Page: 1, Rect: Rect{76, 716, 77, 718}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg, _ := p.Page(1)
+	text, err := pg.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(text, "A") || !strings.Contains(text, "BCD") {
+		t.Errorf("text %q, want only A removed", text)
+	}
+	ops, err := pg.Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// /Sh1 完全在区域中被删除，没有 /BBox 的 /Sh2 用奇偶规则裁剪掉区域
+	var shadings []string
+	for i, op := range ops {
+		if op.Name != "sh" {
+			continue
+		}
+		shadings = append(shadings, op.Operands[0].(*NameObj).Name)
+		clipped := false
+		for _, prev := range ops[:i] {
+			clipped = clipped || prev.Name == "W*"
+		}
+		if !clipped || i+1 >= len(ops) || ops[i+1].Name != "Q" {
+			t.Errorf("%v is not clipped", op.Operands[0])
+		}
+	}
+	if len(shadings) != 1 || shadings[0] != "/Sh2" {
+		t.Errorf("shadings %v, want [/Sh2]", shadings)
+	}
+}
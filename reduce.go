@@ -0,0 +1,238 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"log"
+)
+
+// 彩色图像的减色: 扫描件里很多 "彩色" 图像其实是白纸黑字，
+// 按饱和度和亮度直方图判断是否接近灰度或者黑白，转为 DeviceGray 或者 1 bit 图像
+
+const (
+	// reduceChroma 最大和最小分量的差超过它的像素算作彩色
+	reduceChroma = 32
+	// reduceColorFraction 彩色像素的比例不超过它时认为是灰度图
+	reduceColorFraction = 0.005
+	// reduceMidFraction 介于黑白两类之间的像素比例不超过它时认为是黑白图
+	reduceMidFraction = 0.05
+	// reduceContrast 黑白两类的平均亮度至少相差这么多
+	reduceContrast = 96
+	// reduceSamples 统计时最多采样的像素数，大图隔行隔列采样
+	reduceSamples = 1 << 20
+)
+
+// ColorAnalysis 图像颜色的统计结果
+type ColorAnalysis struct {
+	Histogram     [256]int // 亮度直方图
+	ColorFraction float64  // 彩色像素的比例
+	MidFraction   float64  // 介于黑白两类之间的像素比例
+	Threshold     uint8    // Otsu 方法得到的二值化阈值，小于它的为黑色
+	Dark, Light   float64  // 黑白两类的平均亮度
+	Gray          bool     // 接近灰度
+	Bilevel       bool     // 接近黑白，Gray 也为 true
+}
+
+// AnalyzeColor 统计图像的饱和度和亮度分布，判断是否可以转为灰度或者黑白
+func AnalyzeColor(img image.Image) *ColorAnalysis {
+	a := &ColorAnalysis{}
+	b := img.Bounds()
+	if b.Empty() {
+		return a
+	}
+	step := 1
+	for (b.Dx()/step)*(b.Dy()/step) > reduceSamples {
+		step++
+	}
+	total, colored := 0, 0
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			r, g, bl = r>>8, g>>8, bl>>8
+			hi, lo := r, r
+			for _, v := range []uint32{g, bl} {
+				if v > hi {
+					hi = v
+				}
+				if v < lo {
+					lo = v
+				}
+			}
+			if hi-lo > reduceChroma {
+				colored++
+			}
+			// 和 color.GrayModel 一致的亮度
+			lum := (19595*r + 38470*g + 7471*bl + 1<<15) >> 16
+			a.Histogram[lum]++
+			total++
+		}
+	}
+	a.ColorFraction = float64(colored) / float64(total)
+	a.Gray = a.ColorFraction <= reduceColorFraction
+	a.otsu(total)
+	a.Bilevel = a.Gray && a.Light-a.Dark >= reduceContrast && a.MidFraction <= reduceMidFraction
+	return a
+}
+
+// otsu 按类间方差最大选择阈值，再统计两类之间的像素比例
+func (a *ColorAnalysis) otsu(total int) {
+	sum := 0.0
+	for i, n := range a.Histogram {
+		sum += float64(i * n)
+	}
+	best, sumDark, countDark := -1.0, 0.0, 0
+	for t := 1; t < 256; t++ {
+		countDark += a.Histogram[t-1]
+		sumDark += float64((t - 1) * a.Histogram[t-1])
+		countLight := total - countDark
+		if countDark == 0 || countLight == 0 {
+			continue
+		}
+		dark := sumDark / float64(countDark)
+		light := (sum - sumDark) / float64(countLight)
+		v := float64(countDark) * float64(countLight) * (light - dark) * (light - dark)
+		if v > best {
+			best = v
+			a.Threshold = uint8(t)
+			a.Dark, a.Light = dark, light
+		}
+	}
+	if best < 0 {
+		// 只有一种亮度
+		a.Threshold = 128
+		a.Dark, a.Light = sum/float64(total), sum/float64(total)
+		return
+	}
+	// 两类平均亮度之间的中间一半算作过渡的像素
+	d := (a.Light - a.Dark) / 4
+	mid := 0
+	for i, n := range a.Histogram {
+		if float64(i) > a.Dark+d && float64(i) < a.Light-d {
+			mid += n
+		}
+	}
+	a.MidFraction = float64(mid) / float64(total)
+}
+
+// reduceColorObj 把接近黑白的图像二值化后用 CCITT G4 或者 Flate 保存，
+// 接近灰度的转为 DeviceGray: 原来是 JPEG 的用 JPEG，否则用 Flate 无损保存。
+// 返回 false 表示不能减色，由调用者按原来的方式处理，这时 SkipReason 可能给出不能减色的原因
+func (p *PDF) reduceColorObj(obj *Obj, opts *CompressOptions) (SkipReason, bool) {
+	filter := p.getFilterName(obj)
+	if filter != "" && filter != "/DCTDecode" && filter != "/JPXDecode" {
+		return "", false
+	}
+	if p.getIntByKey(obj.Dict, "/SMaskInData") != 0 || p.hasColorKeyMask(obj) {
+		// 透明通道在 JPX 码流中，或者颜色键按原来的分量个数给出，转为灰度后都会丢失
+		return SkipMask, false
+	}
+	img, err := p.decodeImageColor(obj)
+	if err != nil {
+		return "", false
+	}
+	if cmyk, ok := img.(*image.CMYK); ok {
+		img = p.convertCMYK(obj, cmyk, opts.cmykMode())
+	}
+	a := AnalyzeColor(img)
+	_, isGray := img.(*image.Gray)
+	switch {
+	case a.Bilevel:
+		return p.storeBilevel(obj, toGray(img), a.Threshold), true
+	case a.Gray && !isGray:
+		return p.storeGray(obj, toGray(img), filter == "/DCTDecode" || filter == "/JPXDecode", opts), true
+	}
+	return "", false
+}
+
+// storeBilevel 按阈值二值化，CCITT G4 和 Flate 中选择更小的
+func (p *PDF) storeBilevel(obj *Obj, gray *image.Gray, threshold uint8) SkipReason {
+	b := gray.Bounds()
+	bw := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if gray.GrayAt(b.Min.X+x, b.Min.Y+y).Y >= threshold {
+				bw.Pix[y*bw.Stride+x] = 255
+			}
+		}
+	}
+	g4 := EncodeCCITTG4(bw)
+	flate := flateEncode(packBits(bw))
+	old := len(obj.Stream.data())
+	log.Default().Printf("reduce image %d %d to bilevel %d ---> g4 %d flate %d", obj.ID, obj.GenID, old, len(g4), len(flate))
+	if minInt(len(g4), len(flate)) >= old {
+		return SkipLarger
+	}
+	if len(g4) <= len(flate) {
+		p.updateStream(obj, g4)
+		p.setDictValue(obj, "/Filter", &NameObj{Name: "/CCITTFaxDecode"})
+		p.setCCITTParams(obj, bw)
+	} else {
+		p.updateStream(obj, flate)
+		p.setDictValue(obj, "/Filter", &NameObj{Name: "/FlateDecode"})
+		p.deleteDictValue(obj, "/DecodeParms")
+	}
+	p.setGrayImageDict(obj, bw, 1)
+	return ""
+}
+
+// storeGray 保存为 DeviceGray，lossy 为 true 时用 JPEG 并且按 MaxWidth 和 MaxHeight 缩小
+func (p *PDF) storeGray(obj *Obj, gray *image.Gray, lossy bool, opts *CompressOptions) SkipReason {
+	b := gray.Bounds()
+	var data []byte
+	var parms []*Pair
+	filter := "/FlateDecode"
+	if lossy {
+		width, height := opts.targetSize(b.Dx(), b.Dy())
+		if width != b.Dx() || height != b.Dy() {
+			gray = resizeImage(gray, width, height).(*image.Gray)
+		}
+		out := bytes.Buffer{}
+		if err := jpeg.Encode(&out, gray, &jpeg.Options{Quality: opts.quality()}); err != nil {
+			log.Default().Printf("encode jpeg obj %d %d err: %v", obj.ID, obj.GenID, err)
+			return SkipEncodeError
+		}
+		data = out.Bytes()
+		filter = "/DCTDecode"
+	} else {
+		width := b.Dx()
+		pix := make([]byte, 0, width*b.Dy())
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			pix = append(pix, gray.Pix[gray.PixOffset(b.Min.X, y):gray.PixOffset(b.Min.X, y)+width]...)
+		}
+		data = flateEncode(pix)
+		if predicted := flateEncode(pngUpEncode(pix, width)); len(predicted) < len(data) {
+			data = predicted
+			parms = []*Pair{
+				{Key: &NameObj{Name: "/Predictor"}, Value: 12},
+				{Key: &NameObj{Name: "/Columns"}, Value: width},
+			}
+		}
+	}
+	old := len(obj.Stream.data())
+	log.Default().Printf("reduce image %d %d to gray %d ---> %d", obj.ID, obj.GenID, old, len(data))
+	if len(data) >= old {
+		return SkipLarger
+	}
+	p.updateStream(obj, data)
+	p.setDictValue(obj, "/Filter", &NameObj{Name: filter})
+	if parms != nil {
+		p.setDictValue(obj, "/DecodeParms", parms)
+	} else {
+		p.deleteDictValue(obj, "/DecodeParms")
+	}
+	p.setGrayImageDict(obj, gray, 8)
+	return ""
+}
+
+// setGrayImageDict 更新图像字典为 DeviceGray
+func (p *PDF) setGrayImageDict(obj *Obj, img image.Image, bpc int) {
+	b := img.Bounds()
+	p.setDictValue(obj, "/Width", b.Dx())
+	p.setDictValue(obj, "/Height", b.Dy())
+	p.setDictValue(obj, "/BitsPerComponent", bpc)
+	p.setDictValue(obj, "/ColorSpace", &NameObj{Name: "/DeviceGray"})
+	// 解码时已经处理了 /Decode 和 JPX 中的透明通道
+	p.deleteDictValue(obj, "/Decode")
+	p.deleteDictValue(obj, "/SMaskInData")
+}
@@ -0,0 +1,278 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/png"
+)
+
+// 替换或者插入图像: 替换时原地修改图像对象，页面内容通过名字引用它，位置和大小不变
+
+// ReplaceImage 用 img 替换对象 id gen 的图像，无损地用 Flate 保存，
+// 有透明像素时生成 /SMask
+func (p *PDF) ReplaceImage(id, gen int, img image.Image) error {
+	obj, err := p.getImageObj(id, gen)
+	if err != nil {
+		return err
+	}
+	p.setImageData(obj, img)
+	return nil
+}
+
+// ReplaceImageData 用 JPEG 或者 PNG (以及 GIF) 文件的数据替换对象 id gen 的图像，
+// JPEG 不重新编码，直接作为 /DCTDecode 的数据
+func (p *PDF) ReplaceImageData(id, gen int, data []byte) error {
+	obj, err := p.getImageObj(id, gen)
+	if err != nil {
+		return err
+	}
+	if info, err := parseJPEGInfo(data); err == nil {
+		return p.setJPEGData(obj, data, info)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	p.setImageData(obj, img)
+	return nil
+}
+
+// InsertImage 把 img 作为新的图像 XObject 画到第 page 页 (从1开始)，
+// x y 为左下角，width height 为显示的大小，单位都是点。返回新的图像对象
+func (p *PDF) InsertImage(page int, img image.Image, x, y, width, height float64) (*Obj, error) {
+	var target *Obj
+	num := 0
+	p.walkPages(func(obj *Obj, resources []*Pair) {
+		num++
+		if num == page {
+			target = obj
+		}
+	})
+	if target == nil {
+		return nil, fmt.Errorf("page %d not found", page)
+	}
+	obj := p.newStreamObj([]*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/XObject"}},
+		{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Image"}},
+	}, nil)
+	p.setImageData(obj, img)
+
+	// 继承的资源字典可能被其他页面共用，复制一份放到页面自己的字典中
+	resources := p.pageResources(target)
+	name := p.newXObjectName(resources, "/Im")
+	setPairValue(&target.Dict, "/Resources", resources)
+	p.setDictPath(&target.Dict, []string{"/Resources", "/XObject", name}, &Obj{ID: obj.ID, GenID: obj.GenID})
+
+	content := fmt.Sprintf("q %s 0 0 %s %s %s cm %s Do Q\n",
+		formatFloat(width), formatFloat(height), formatFloat(x), formatFloat(y), name)
+	p.appendContent(target, []byte(content))
+	return obj, nil
+}
+
+// getImageObj 找到对象 id gen，并检查它是图像
+func (p *PDF) getImageObj(id, gen int) (*Obj, error) {
+	obj := p.getObj(&Obj{ID: id, GenID: gen})
+	if obj == nil {
+		return nil, fmt.Errorf("obj %d %d not found", id, gen)
+	}
+	if !obj.IsImageStream() {
+		return nil, fmt.Errorf("obj %d %d is not an image", id, gen)
+	}
+	return obj, nil
+}
+
+// resetImageDict 去掉图像字典中和原来的数据相关的项
+func (p *PDF) resetImageDict(obj *Obj) {
+	for _, key := range []string{"/SMask", "/Mask", "/Decode", "/DecodeParms", "/ImageMask", "/SMaskInData", "/Alternates"} {
+		p.deleteDictValue(obj, key)
+	}
+	p.setDictValue(obj, "/Type", &NameObj{Name: "/XObject"})
+	p.setDictValue(obj, "/Subtype", &NameObj{Name: "/Image"})
+}
+
+// setImageData 把 img 按 DeviceGray、DeviceCMYK 或者 DeviceRGB 8 bit 保存到 obj，
+// 用 Flate 加 PNG Up 预测器压缩
+func (p *PDF) setImageData(obj *Obj, img image.Image) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	var pix []byte
+	cs, n := "/DeviceRGB", 3
+	switch v := img.(type) {
+	case *image.Gray:
+		cs, n = "/DeviceGray", 1
+		pix = make([]byte, 0, width*height)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			pix = append(pix, v.Pix[v.PixOffset(b.Min.X, y):v.PixOffset(b.Min.X, y)+width]...)
+		}
+	case *image.CMYK:
+		cs, n = "/DeviceCMYK", 4
+		pix = make([]byte, 0, width*height*4)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			pix = append(pix, v.Pix[v.PixOffset(b.Min.X, y):v.PixOffset(b.Min.X, y)+width*4]...)
+		}
+	default:
+		pix = make([]byte, 0, width*height*3)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				pix = append(pix, c.R, c.G, c.B)
+			}
+		}
+	}
+	p.resetImageDict(obj)
+	data, parms := encodeImagePixels(pix, width*n, n)
+	p.updateStream(obj, data)
+	p.setDictValue(obj, "/Filter", &NameObj{Name: "/FlateDecode"})
+	if parms != nil {
+		p.setDictValue(obj, "/DecodeParms", parms)
+	}
+	p.setDictValue(obj, "/Width", width)
+	p.setDictValue(obj, "/Height", height)
+	p.setDictValue(obj, "/ColorSpace", &NameObj{Name: cs})
+	p.setDictValue(obj, "/BitsPerComponent", 8)
+	if alpha := alphaChannel(img); alpha != nil {
+		smask := p.newSMask(alpha, width, height)
+		p.setDictValue(obj, "/SMask", &Obj{ID: smask.ID, GenID: smask.GenID})
+	}
+}
+
+// setJPEGData 把 JPEG 文件的数据直接作为图像数据
+func (p *PDF) setJPEGData(obj *Obj, data []byte, info *jpegInfo) error {
+	cs := ""
+	switch info.Components {
+	case 1:
+		cs = "/DeviceGray"
+	case 3:
+		cs = "/DeviceRGB"
+	case 4:
+		cs = "/DeviceCMYK"
+	default:
+		return fmt.Errorf("unsupported jpeg components: %d", info.Components)
+	}
+	if info.Width == 0 || info.Height == 0 {
+		return errors.New("invalid jpeg size")
+	}
+	p.resetImageDict(obj)
+	p.updateStream(obj, data)
+	p.setDictValue(obj, "/Filter", &NameObj{Name: "/DCTDecode"})
+	p.setDictValue(obj, "/Width", info.Width)
+	p.setDictValue(obj, "/Height", info.Height)
+	p.setDictValue(obj, "/ColorSpace", &NameObj{Name: cs})
+	p.setDictValue(obj, "/BitsPerComponent", 8)
+	if info.Components == 4 && info.Adobe {
+		// Adobe 软件保存的 CMYK JPEG 是反转的值
+		p.setDictValue(obj, "/Decode", []interface{}{1, 0, 1, 0, 1, 0, 1, 0})
+	}
+	return nil
+}
+
+// newSMask 创建 DeviceGray 的 /SMask 图像对象
+func (p *PDF) newSMask(alpha []byte, width, height int) *Obj {
+	dict := []*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/XObject"}},
+		{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Image"}},
+		{Key: &NameObj{Name: "/Width"}, Value: width},
+		{Key: &NameObj{Name: "/Height"}, Value: height},
+		{Key: &NameObj{Name: "/ColorSpace"}, Value: &NameObj{Name: "/DeviceGray"}},
+		{Key: &NameObj{Name: "/BitsPerComponent"}, Value: 8},
+		{Key: &NameObj{Name: "/Filter"}, Value: &NameObj{Name: "/FlateDecode"}},
+	}
+	data, parms := encodeImagePixels(alpha, width, 1)
+	if parms != nil {
+		dict = append(dict, &Pair{Key: &NameObj{Name: "/DecodeParms"}, Value: parms})
+	}
+	return p.newStreamObj(dict, data)
+}
+
+// encodeImagePixels 用 Flate 压缩像素数据，PNG Up 预测器更小时使用预测器
+func encodeImagePixels(pix []byte, rowLen, colors int) ([]byte, []*Pair) {
+	data := flateEncode(pix)
+	if rowLen == 0 {
+		return data, nil
+	}
+	predicted := flateEncode(pngUpEncode(pix, rowLen))
+	if len(predicted) >= len(data) {
+		return data, nil
+	}
+	return predicted, []*Pair{
+		{Key: &NameObj{Name: "/Predictor"}, Value: 12},
+		{Key: &NameObj{Name: "/Colors"}, Value: colors},
+		{Key: &NameObj{Name: "/Columns"}, Value: rowLen / colors},
+	}
+}
+
+// alphaChannel 返回图像的透明通道，完全不透明时返回 nil
+func alphaChannel(img image.Image) []byte {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return nil
+	}
+	b := img.Bounds()
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			_, _, _, a := img.At(x, y).RGBA()
+			if a>>8 != 0xff {
+				opaque = false
+			}
+			alpha = append(alpha, byte(a>>8))
+		}
+	}
+	if opaque {
+		return nil
+	}
+	return alpha
+}
+
+// pageResources 返回页面的资源字典，继承的或者是引用的资源字典复制一份，
+// 修改时不会影响其他页面
+func (p *PDF) pageResources(page *Obj) []*Pair {
+	return p.copyResources(p.getResolvedDict(p.resourcesOwner(page).Dict, "/Resources"))
+}
+
+// copyResources 复制资源字典和它的子字典，子字典中的对象引用不变
+func (p *PDF) copyResources(res []*Pair) []*Pair {
+	copied := make([]*Pair, 0, len(res)+1)
+	for _, pair := range res {
+		value := pair.Value
+		if dict := p.resolveDict(value); dict != nil {
+			// 子字典也复制，后面会往里面加东西
+			value = append([]*Pair{}, dict...)
+		}
+		copied = append(copied, &Pair{Key: pair.Key, Value: value})
+	}
+	return copied
+}
+
+// appendContent 在页面内容的最后追加 data。原来的内容用 q Q 包起来，
+// 避免它留下的图形状态影响追加的内容
+func (p *PDF) appendContent(page *Obj, data []byte) {
+	if len(p.pageContents(page)) == 0 {
+		p.wrapContent(page, nil, data)
+		return
+	}
+	p.wrapContent(page, []byte("q\n"), append([]byte("Q\n"), data...))
+}
+
+// wrapContent 在页面原来的内容前后各加一个内容流，原来的内容流不修改，可能被其他页面共用
+func (p *PDF) wrapContent(page *Obj, before, after []byte) {
+	contents := make([]interface{}, 0)
+	if len(before) > 0 {
+		head := p.newStreamObj(nil, nil)
+		p.setContentData(head, before)
+		contents = append(contents, objRef(head))
+	}
+	for _, obj := range p.pageContents(page) {
+		contents = append(contents, objRef(obj))
+	}
+	if len(after) > 0 {
+		tail := p.newStreamObj(nil, nil)
+		p.setContentData(tail, after)
+		contents = append(contents, objRef(tail))
+	}
+	p.setDictValue(page, "/Contents", contents)
+}
@@ -0,0 +1,102 @@
+package pdf
+
+import "fmt"
+
+// SkipReason 图像没有被替换的原因，为空时表示已经替换
+type SkipReason string
+
+const (
+	SkipLarger      SkipReason = "larger output"      // 压缩后没有变小
+	SkipUnsupported SkipReason = "unsupported filter" // 不支持的编码，或者当前选项下不处理
+	SkipMask        SkipReason = "mask"               // 重新编码会破坏图像的透明通道或者颜色键蒙版
+	SkipDecodeError SkipReason = "decode error"
+	SkipEncodeError SkipReason = "encode error"
+)
+
+// ImageReport 一个图像对象的压缩结果
+type ImageReport struct {
+	ID        int
+	GenID     int
+	Mask      bool // 被其他图像的 /SMask 或 /Mask 引用的蒙版，跟随所属的图像处理
+	OldSize   int  // 原来流数据的字节数
+	NewSize   int
+	OldFilter string
+	NewFilter string
+	OldWidth  int
+	OldHeight int
+	NewWidth  int
+	NewHeight int
+	Skipped   SkipReason
+}
+
+// CompressReport 一次压缩的结果，Images 按对象在文档中的顺序排列
+type CompressReport struct {
+	Images  []*ImageReport
+	OldSize int // 所有图像流原来的字节数
+	NewSize int
+}
+
+func (p *PDF) newImageReport(obj *Obj) *ImageReport {
+	return &ImageReport{
+		ID:        obj.ID,
+		GenID:     obj.GenID,
+		OldSize:   len(obj.Stream.data()),
+		OldFilter: p.getFilterName(obj),
+		OldWidth:  p.getIntByKey(obj.Dict, "/Width"),
+		OldHeight: p.getIntByKey(obj.Dict, "/Height"),
+	}
+}
+
+func (p *PDF) finishImageReport(item *ImageReport, obj *Obj, reason SkipReason) {
+	item.NewSize = len(obj.Stream.data())
+	item.NewFilter = p.getFilterName(obj)
+	item.NewWidth = p.getIntByKey(obj.Dict, "/Width")
+	item.NewHeight = p.getIntByKey(obj.Dict, "/Height")
+	item.Skipped = reason
+}
+
+func (r *CompressReport) add(item *ImageReport) {
+	r.Images = append(r.Images, item)
+	r.OldSize += item.OldSize
+	r.NewSize += item.NewSize
+}
+
+// Saved 节省的字节数
+func (r *CompressReport) Saved() int {
+	return r.OldSize - r.NewSize
+}
+
+// Ratio 节省的比例，0 到 1
+func (r *CompressReport) Ratio() float64 {
+	if r.OldSize == 0 {
+		return 0
+	}
+	return float64(r.Saved()) / float64(r.OldSize)
+}
+
+// String 返回类似 "saved 14.2 MB (63%)" 的摘要
+func (r *CompressReport) String() string {
+	return fmt.Sprintf("saved %s (%.0f%%)", formatBytes(r.Saved()), r.Ratio()*100)
+}
+
+// formatBytes 按 1024 进位显示字节数
+func formatBytes(n int) string {
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	if n < 1024 {
+		return fmt.Sprintf("%s%d B", sign, n)
+	}
+	v := float64(n)
+	units := []string{"KB", "MB", "GB", "TB"}
+	unit := ""
+	for _, u := range units {
+		v /= 1024
+		unit = u
+		if v < 1024 {
+			break
+		}
+	}
+	return fmt.Sprintf("%s%.1f %s", sign, v, unit)
+}
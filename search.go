@@ -0,0 +1,214 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 全文搜索: 在每页提取出的文字中查找，再按字形的位置得到结果在页面上的四边形
+
+// SearchOptions 搜索的选项
+type SearchOptions struct {
+	IgnoreCase bool
+	WholeWord  bool      // 结果的前后不能紧挨着字母或者数字；中文和日文不用空格分词，汉字和假名的前后都算边界
+	Regexp     bool      // query 为 Go regexp 语法的正则表达式，否则按普通文字查找，空白可以匹配换行
+	Highlight  bool      // 给每个结果加 /Highlight 注释，调用 SaveFile 时写入文件
+	Color      []float64 // 高亮的 RGB 颜色，默认为黄色
+}
+
+// Quad 页面上的四边形，点的顺序和 /QuadPoints 相同: 左上、右上、左下、右下
+type Quad [8]float64
+
+// SearchMatch 一个搜索结果，跨行的结果每行一个四边形
+type SearchMatch struct {
+	Page  int // 页码，从1开始
+	Text  string
+	Quads []Quad
+	BBox  Rect // 所有四边形的外接矩形
+}
+
+// Search 在所有页面中查找 query，按页码和在页面中的顺序返回结果
+func (p *PDF) Search(query string, opts *SearchOptions) ([]*SearchMatch, error) {
+	if opts == nil {
+		opts = &SearchOptions{}
+	}
+	re, err := searchRegexp(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	color := opts.Color
+	if len(color) != 3 {
+		color = []float64{1, 1, 0}
+	}
+	list := make([]*SearchMatch, 0)
+	for _, pg := range p.Pages() {
+		glyphs := make([]*textGlyph, 0)
+		if err := p.walkText(pg.obj, pg.Resources, func(g *textGlyph) {
+			glyphs = append(glyphs, g)
+		}); err != nil {
+			return list, fmt.Errorf("page %d: %v", pg.Number, err)
+		}
+		text, index := layoutGlyphs(glyphs)
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] || opts.WholeWord && !isWholeWord(text, loc[0], loc[1]) {
+				continue
+			}
+			m := &SearchMatch{Page: pg.Number, Text: text[loc[0]:loc[1]]}
+			m.Quads = matchQuads(glyphs, index[loc[0]:loc[1]])
+			for _, q := range m.Quads {
+				m.BBox = m.BBox.union(q.rect())
+			}
+			if len(m.Quads) == 0 {
+				continue
+			}
+			if opts.Highlight {
+				p.addHighlight(pg.obj, m, color)
+			}
+			list = append(list, m)
+		}
+	}
+	return list, nil
+}
+
+// searchRegexp 把查找的文字转为正则表达式
+func searchRegexp(query string, opts *SearchOptions) (*regexp.Regexp, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, errors.New("empty search query")
+	}
+	pattern := query
+	if !opts.Regexp {
+		fields := strings.Fields(query)
+		for i, f := range fields {
+			fields[i] = regexp.QuoteMeta(f)
+		}
+		pattern = strings.Join(fields, `\s+`)
+	}
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// isWholeWord 判断 text[start:end] 前后是否为单词的边界
+func isWholeWord(text string, start, end int) bool {
+	isWord := func(r rune) bool {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) {
+			return false
+		}
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+	}
+	if r, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWord(r) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWord(r) {
+		return false
+	}
+	return true
+}
+
+// matchQuads 按结果中的字形计算四边形，换行时开始新的四边形
+func matchQuads(glyphs []*textGlyph, index []int) []Quad {
+	quads := make([]Quad, 0, 1)
+	var first, last *textGlyph
+	flush := func() {
+		if first != nil {
+			quads = append(quads, glyphQuad(first, last))
+		}
+	}
+	for i, idx := range index {
+		if idx < 0 || i > 0 && index[i-1] == idx {
+			continue
+		}
+		g := glyphs[idx]
+		if first != nil {
+			if newline, _ := glyphBreak(last, g); newline {
+				flush()
+				first = nil
+			}
+		}
+		if first == nil {
+			first = g
+		}
+		last = g
+	}
+	flush()
+	return quads
+}
+
+// glyphQuad 从 first 的起点到 last 的终点，按字体的上升和下降高度沿文字方向展开
+func glyphQuad(first, last *textGlyph) Quad {
+	nx, ny := -first.dy, first.dx
+	asc := first.font.ascent / 1000 * first.fontSize
+	desc := first.font.descent / 1000 * first.fontSize
+	q := Quad{
+		first.x0 + nx*asc, first.y0 + ny*asc,
+		last.x1 + nx*asc, last.y1 + ny*asc,
+		first.x0 + nx*desc, first.y0 + ny*desc,
+		last.x1 + nx*desc, last.y1 + ny*desc,
+	}
+	for i, v := range q {
+		q[i] = roundFloat(v)
+	}
+	return q
+}
+
+// rect 四边形的外接矩形
+func (q Quad) rect() Rect {
+	r := Rect{q[0], q[1], q[0], q[1]}
+	for i := 2; i < 8; i += 2 {
+		r.LLX, r.URX = math.Min(r.LLX, q[i]), math.Max(r.URX, q[i])
+		r.LLY, r.URY = math.Min(r.LLY, q[i+1]), math.Max(r.URY, q[i+1])
+	}
+	return r
+}
+
+// addHighlight 给页面加一个 /Highlight 注释，外观流用正片叠底画出四边形，不遮住文字
+func (p *PDF) addHighlight(page *Obj, m *SearchMatch, color []float64) {
+	bbox := m.BBox.array()
+	quads := make([]interface{}, 0, len(m.Quads)*8)
+	var content strings.Builder
+	content.WriteString(fmt.Sprintf("/GS0 gs %s %s %s rg\n", formatFloat(color[0]), formatFloat(color[1]), formatFloat(color[2])))
+	for _, q := range m.Quads {
+		for _, v := range q {
+			quads = append(quads, v)
+		}
+		// 按左上、右上、右下、左下的顺序连成四边形
+		content.WriteString(fmt.Sprintf("%s %s m %s %s l %s %s l %s %s l h f\n",
+			formatFloat(q[0]), formatFloat(q[1]), formatFloat(q[2]), formatFloat(q[3]),
+			formatFloat(q[6]), formatFloat(q[7]), formatFloat(q[4]), formatFloat(q[5])))
+	}
+	ap := p.newStreamObj([]*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/XObject"}},
+		{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Form"}},
+		{Key: &NameObj{Name: "/BBox"}, Value: bbox},
+		{Key: &NameObj{Name: "/Resources"}, Value: []*Pair{
+			{Key: &NameObj{Name: "/ExtGState"}, Value: []*Pair{
+				{Key: &NameObj{Name: "/GS0"}, Value: []*Pair{
+					{Key: &NameObj{Name: "/BM"}, Value: &NameObj{Name: "/Multiply"}},
+				}},
+			}},
+		}},
+	}, nil)
+	p.setContentData(ap, []byte(content.String()))
+	annot := p.addObj(&Obj{Dict: []*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/Annot"}},
+		{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Highlight"}},
+		{Key: &NameObj{Name: "/Rect"}, Value: bbox},
+		{Key: &NameObj{Name: "/QuadPoints"}, Value: quads},
+		{Key: &NameObj{Name: "/C"}, Value: []interface{}{color[0], color[1], color[2]}},
+		{Key: &NameObj{Name: "/F"}, Value: 4},
+		{Key: &NameObj{Name: "/P"}, Value: objRef(page)},
+		{Key: &NameObj{Name: "/Contents"}, Value: encodeTextString(m.Text)},
+		{Key: &NameObj{Name: "/AP"}, Value: []*Pair{
+			{Key: &NameObj{Name: "/N"}, Value: objRef(ap)},
+		}},
+	}})
+	annots, _ := p.resolve(p.getValueByKey(page.Dict, "/Annots")).([]interface{})
+	list := append(append([]interface{}{}, annots...), objRef(annot))
+	p.setDictValue(page, "/Annots", list)
+}
@@ -0,0 +1,79 @@
+package pdf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// textDoc 一页的文档，内容为 content。
+// /F1 为每个字宽 500 的 Helvetica，/F2 为 Identity-H 编码的 Type0 字体，
+// 它的 /ToUnicode 把 <0001> 到 <0004> 对应为 中、文、字、我，每个字宽 1000
+func textDoc(t *testing.T, content string) *PDF {
+	widths := strings.TrimSpace(strings.Repeat("500 ", 95))
+	toUnicode := "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"4 beginbfchar <0001> <4E2D> <0002> <6587> <0003> <5B57> <0004> <6211> endbfchar\n" +
+		"endcmap end end"
+	return testPDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R " +
+			"/Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>",
+		testStream("", content),
+		fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /FirstChar 32 /LastChar 126 /Widths [%s] >>", widths),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Song /Encoding /Identity-H /DescendantFonts [7 0 R] /ToUnicode 8 0 R >>",
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /Song " +
+			"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /DW 1000 >>",
+		testStream("", toUnicode),
+	})
+}
+
+func TestSearch(t *testing.T) {
+	p := textDoc(t, "BT /F1 12 Tf 72 700 Td (Hello world, worldwide) Tj ET\n"+
+		"BT /F2 12 Tf 72 680 Td <0004000100020003> Tj ET")
+	for _, c := range []struct {
+		query string
+		opts  SearchOptions
+		want  []string
+	}{
+		{"world", SearchOptions{}, []string{"world", "world"}},
+		{"world", SearchOptions{WholeWord: true}, []string{"world"}},
+		{"WORLD", SearchOptions{}, []string{}},
+		{"WORLD", SearchOptions{IgnoreCase: true}, []string{"world", "world"}},
+		{"中文", SearchOptions{WholeWord: true}, []string{"中文"}},
+		{"wide 我中", SearchOptions{}, []string{"wide\n我中"}},
+	} {
+		opts := c.opts
+		matches, err := p.Search(c.query, &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0)
+		for _, m := range matches {
+			got = append(got, m.Text)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q %+v: got %q, want %q", c.query, c.opts, got, c.want)
+		}
+	}
+
+	// "world" 从第 6 个字开始，每个字宽 6 点；上升和下降为字号的 1 和 0.25 倍
+	matches, _ := p.Search("world", &SearchOptions{WholeWord: true})
+	want := Quad{108, 712, 138, 712, 108, 697, 138, 697}
+	if len(matches) != 1 || len(matches[0].Quads) != 1 || matches[0].Quads[0] != want {
+		t.Fatalf("quads %v, want %v", matches[0].Quads, want)
+	}
+	if matches[0].BBox != (Rect{108, 697, 138, 712}) {
+		t.Errorf("bbox %v", matches[0].BBox)
+	}
+	// 跨行的结果每行一个四边形
+	matches, _ = p.Search("wide 我中", nil)
+	if len(matches) != 1 || len(matches[0].Quads) != 2 {
+		t.Fatalf("quads of a match across lines: %v", matches)
+	}
+	if q := matches[0].Quads[1]; q != (Quad{72, 692, 96, 692, 72, 677, 96, 677}) {
+		t.Errorf("second line quad %v", q)
+	}
+}
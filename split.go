@@ -0,0 +1,72 @@
+package pdf
+
+import (
+	"fmt"
+	"log"
+)
+
+// PageRange 页码范围，From 和 To 都从1开始，包括两端
+type PageRange struct {
+	From int
+	To   int
+}
+
+func (r PageRange) String() string {
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// inPageRanges 第 n 页是否在某个范围中，没有范围时表示所有页面
+func inPageRanges(ranges []PageRange, n int) bool {
+	for _, r := range ranges {
+		if n >= r.From && n <= r.To {
+			return true
+		}
+	}
+	return len(ranges) == 0
+}
+
+// Split 按页码范围拆分文档，每个范围生成一个新文档。
+// 新文档只包含它的页面直接或间接引用的对象 (资源、字体、图像、注释等)，
+// 页面树、目录和 trailer 都是新建的，指向其他页面的引用改为 null。
+// 指向新文档中页面的命名目标也复制过去
+func (p *PDF) Split(ranges []PageRange) ([]*PDF, error) {
+	pages := make([]*Obj, 0)
+	p.walkPages(func(page *Obj, resources []*Pair) {
+		pages = append(pages, page)
+	})
+	for _, r := range ranges {
+		if r.From < 1 || r.To > len(pages) || r.From > r.To {
+			return nil, fmt.Errorf("invalid page range %s, document has %d pages", r, len(pages))
+		}
+	}
+	docs := make([]*PDF, 0, len(ranges))
+	for _, r := range ranges {
+		docs = append(docs, p.extractPages(pages[r.From-1:r.To]))
+		log.Default().Printf("split pages %s", r)
+	}
+	return docs, nil
+}
+
+// extractPages 用 pages 生成一个新文档
+func (p *PDF) extractPages(pages []*Obj) *PDF {
+	doc := newDocument(p.Header)
+	c := newObjCopier(p, doc)
+	c.skipPageTree()
+	catalog, root := c.newPageTree()
+	for _, page := range pages {
+		c.reserve(page)
+	}
+	for _, page := range pages {
+		doc.appendKid(root, c.copyPage(page, root))
+	}
+	var info interface{}
+	if p.Trailer != nil {
+		info = c.copyValue(p.getValueByKey(p.Trailer.Dict, "/Info"))
+		if root, _ := p.resolve(p.getValueByKey(p.Trailer.Dict, "/Root")).(*Obj); root != nil {
+			tree, dict := c.copyDests(root)
+			setDests(catalog, tree, dict)
+		}
+	}
+	doc.finishDocument(catalog, info)
+	return doc
+}
@@ -0,0 +1,93 @@
+package pdf
+
+import (
+	"reflect"
+	"testing"
+)
+
+// splitDoc 三页的文档: 第 1 页用继承的字体，第 2 页有图像，第 3 页有指向第 1 页的链接，
+// 命名目标 (p1)、(p3) 在名字树中，/old 在旧式的 /Dests 字典中
+func splitDoc(t *testing.T) *PDF {
+	return testPDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R /Names << /Dests << /Names [(p1) [3 0 R /Fit] (p3) [5 0 R /XYZ 0 0 0]] >> >> /Dests << /old [4 0 R /Fit] >> >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R 5 0 R] /Count 3 /MediaBox [0 0 300 400] /Resources << /Font << /F1 6 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im1 8 0 R >> >> /Contents 9 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Annots [10 0 R] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		testStream("", "BT /F1 12 Tf 72 700 Td (one) Tj ET"),
+		testStream("/Type /XObject /Subtype /Image /Width 1 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 8", "\x80"),
+		testStream("", "q 10 0 0 10 0 0 cm /Im1 Do Q"),
+		"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest [3 0 R /Fit] >>",
+	})
+}
+
+func TestSplit(t *testing.T) {
+	p := splitDoc(t)
+	if _, err := p.Split([]PageRange{{2, 4}}); err == nil {
+		t.Error("invalid page range accepted")
+	}
+	docs, err := p.Split([]PageRange{{1, 1}, {2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range []struct {
+		pages, objs, images int
+		tree                []string // 名字树中的命名目标
+		dict                []string // /Dests 字典中的命名目标
+	}{
+		// 目录、页面树、页面、内容流和继承的字体
+		{1, 5, 0, []string{"p1"}, []string{}},
+		// 目录、页面树、两个页面、图像、内容流、链接和继承的字体
+		{2, 8, 1, []string{"p3"}, []string{"/old"}},
+	} {
+		doc := reload(t, docs[i])
+		if n := doc.NumPages(); n != tc.pages {
+			t.Errorf("document %d: %d pages, want %d", i+1, n, tc.pages)
+		}
+		// 只包含页面用到的对象，其他页面的内容流和图像没有带过来
+		images := 0
+		for _, obj := range doc.Objects {
+			if obj.IsImageStream() {
+				images++
+			}
+		}
+		if len(doc.Objects) != tc.objs || images != tc.images {
+			t.Errorf("document %d: %d objects, %d images, want %d and %d", i+1, len(doc.Objects), images, tc.objs, tc.images)
+		}
+		for _, pg := range doc.Pages() {
+			if pg.MediaBox != (Rect{0, 0, 300, 400}) {
+				t.Errorf("document %d page %d: media box %v", i+1, pg.Number, pg.MediaBox)
+			}
+		}
+		catalog := testCatalog(t, doc)
+		tree := make([]string, 0)
+		if node := doc.getResolvedDict(doc.getResolvedDict(catalog.Dict, "/Names"), "/Dests"); node != nil {
+			doc.walkNameTree(node, func(key string, value interface{}) {
+				// 命名目标指向新文档中的页面
+				if page := doc.destPage(value); page == nil || doc.getNameObjByKey(page.Dict, "/Type").Name != "/Page" {
+					t.Errorf("document %d: destination %s points to %v", i+1, key, page)
+				}
+				tree = append(tree, key)
+			})
+		}
+		dict := make([]string, 0)
+		for _, pair := range doc.getResolvedDict(catalog.Dict, "/Dests") {
+			dict = append(dict, pair.Key.Name)
+		}
+		if !reflect.DeepEqual(tree, tc.tree) || !reflect.DeepEqual(dict, tc.dict) {
+			t.Errorf("document %d: destinations %v %v, want %v %v", i+1, tree, dict, tc.tree, tc.dict)
+		}
+	}
+
+	// 指向不在新文档中的页面的链接目标改为 null
+	doc := docs[1]
+	for _, obj := range doc.Objects {
+		if subtype := doc.getNameObjByKey(obj.Dict, "/Subtype"); subtype != nil && subtype.Name == "/Link" {
+			dest, _ := doc.getValueByKey(obj.Dict, "/Dest").([]interface{})
+			if len(dest) != 2 || dest[0] != nil {
+				t.Errorf("link destination %v", dest)
+			}
+		}
+	}
+}
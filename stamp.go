@@ -0,0 +1,174 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 页眉、页脚、页码和 Bates 编号: 按模板生成每页的文字，用标准 14 种字体画在页面内容的后面。
+// 文字放在 /Artifact 标记内容中，位置在页面上方的 /Subtype 为 /Header，其他为 /Footer
+
+// Stamp 每页的文字。Text 为模板，其中可以使用:
+// {page} 页码，{pages} 文档的总页数，{bates} Bates 编号 (BatesPrefix 加上补零的序号)。
+// 例如 "Page {page} of {pages}"、"{bates}"
+type Stamp struct {
+	Text     string    // 模板，可以用 \n 分为多行，有字体不能编码的字符时返回错误
+	Position Position  // 默认为 PositionCenter，页脚一般用 PositionBottom
+	Font     string    // 标准 14 种字体之一，默认 Helvetica
+	FontSize float64   // 默认 10
+	Color    []float64 // RGB 颜色，默认黑色
+
+	MarginX, MarginY float64 // 和页面左右、上下边缘的距离，都为 0 时为 36 (半英寸)
+
+	BatesPrefix string // Bates 编号的前缀，如 "ABC"
+	BatesStart  int    // 第一页的 Bates 序号，默认 1
+	BatesDigits int    // 序号补零后的位数，默认 6
+
+	Pages []PageRange // 加文字的页面，空表示所有页面
+}
+
+// bates 第 n 个 Bates 编号
+func (s *Stamp) bates(n int) string {
+	digits := s.BatesDigits
+	if digits <= 0 {
+		digits = 6
+	}
+	return fmt.Sprintf("%s%0*d", s.BatesPrefix, digits, n)
+}
+
+// expand 按页码、总页数和 Bates 序号展开模板
+func (s *Stamp) expand(page, pages, bates int) string {
+	return strings.NewReplacer(
+		"{page}", strconv.Itoa(page),
+		"{pages}", strconv.Itoa(pages),
+		"{bates}", s.bates(bates),
+	).Replace(s.Text)
+}
+
+// AddStamp 按模板给 s.Pages 中的页面加文字，返回下一个 Bates 序号，
+// 给下一个文档编号时作为它的 BatesStart
+func (p *PDF) AddStamp(s *Stamp) (int, error) {
+	next := s.BatesStart
+	if next <= 0 {
+		next = 1
+	}
+	font, err := lookupStandardFont(s.Font)
+	if err != nil {
+		return next, err
+	}
+	size := s.FontSize
+	if size <= 0 {
+		size = 10
+	}
+	color := s.Color
+	if len(color) != 3 {
+		color = []float64{0, 0, 0}
+	}
+	marginX, marginY := s.MarginX, s.MarginY
+	if marginX == 0 && marginY == 0 {
+		marginX, marginY = 36, 36
+	}
+	subtype := "/Footer"
+	switch s.Position {
+	case PositionTopLeft, PositionTop, PositionTopRight:
+		subtype = "/Header"
+	}
+	pages := p.Pages()
+	// 先展开和编码所有页面的文字，有字体不能编码的字符时不修改文档
+	texts := make(map[int][][]byte)
+	for _, pg := range pages {
+		if !inPageRanges(s.Pages, pg.Number) {
+			continue
+		}
+		lines := strings.Split(s.expand(pg.Number, len(pages), next+len(texts)), "\n")
+		encoded := make([][]byte, len(lines))
+		for i, line := range lines {
+			if encoded[i], err = font.encode(line); err != nil {
+				return next, fmt.Errorf("page %d: %v", pg.Number, err)
+			}
+		}
+		texts[pg.Number] = encoded
+	}
+	var fontObj *Obj
+	cnt := 0
+	for _, pg := range pages {
+		if !inPageRanges(s.Pages, pg.Number) {
+			continue
+		}
+		if fontObj == nil {
+			// 所有页面共用一个字体对象
+			fontObj = p.newStandardFontObj(font)
+		}
+		res := p.pageResources(pg.obj)
+		name := p.newResourceName(res, "/Font", "/F")
+		p.setDictPath(&res, []string{"/Font", name}, objRef(fontObj))
+		setPairValue(&pg.obj.Dict, "/Resources", res)
+
+		encoded := texts[pg.Number]
+		width := 0.0
+		for _, data := range encoded {
+			width = math.Max(width, font.width(data, size))
+		}
+		leading := size * 1.2
+		height := leading * float64(len(encoded))
+		w, h := pg.Size()
+		x, y := s.Position.anchor(w, h, width, height, 0)
+		// anchor 只有一个边距，左右和上下的边距分别处理
+		switch s.Position {
+		case PositionTopLeft, PositionLeft, PositionBottomLeft:
+			x += marginX
+		case PositionTopRight, PositionRight, PositionBottomRight:
+			x -= marginX
+		}
+		switch s.Position {
+		case PositionTopLeft, PositionTop, PositionTopRight:
+			y -= marginY
+		case PositionBottomLeft, PositionBottom, PositionBottomRight:
+			y += marginY
+		}
+		disp := displayMatrix(pg)
+
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "/Artifact <</Type /Pagination /Subtype %s>> BDC\nq %s %s %s rg BT %s %s Tf\n",
+			subtype, formatFloat(color[0]), formatFloat(color[1]), formatFloat(color[2]), name, formatFloat(size))
+		for i, data := range encoded {
+			// 每行按位置左对齐、右对齐或者居中，基线和水印相同在行的下边上方 0.3 个字号
+			lw := font.width(data, size)
+			dx := (width - lw) / 2
+			switch s.Position {
+			case PositionTopLeft, PositionLeft, PositionBottomLeft:
+				dx = 0
+			case PositionTopRight, PositionRight, PositionBottomRight:
+				dx = width - lw
+			}
+			m := matrix{1, 0, 0, 1, x - width/2 + dx, y + height/2 - leading*float64(i+1) + 0.3*size}.multiply(disp)
+			fmt.Fprintf(&content, "%s Tm %s Tj\n", m, encodePDFString(data))
+		}
+		content.WriteString("ET Q\nEMC\n")
+		p.appendContent(pg.obj, content.Bytes())
+		next++
+		cnt++
+	}
+	log.Default().Printf("stamp %d pages", cnt)
+	return next, nil
+}
+
+// StampDocuments 依次给多个文档加同样的文字，Bates 编号在文档之间连续。
+// 返回最后一个文档之后的下一个 Bates 序号
+func StampDocuments(s *Stamp, docs ...*PDF) (int, error) {
+	next := s.BatesStart
+	for i, doc := range docs {
+		c := *s
+		c.BatesStart = next
+		n, err := doc.AddStamp(&c)
+		if err != nil {
+			return next, fmt.Errorf("document %d: %v", i+1, err)
+		}
+		next = n
+	}
+	return next, nil
+}
@@ -0,0 +1,62 @@
+package pdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStampDocumentsBates(t *testing.T) {
+	docs := []*PDF{editDoc(t), mergeDoc(t)}
+	s := &Stamp{Text: "{bates} {page}/{pages}", Position: PositionBottomRight,
+		BatesPrefix: "ABC", BatesStart: 5, BatesDigits: 4}
+	next, err := StampDocuments(s, docs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 10 {
+		t.Errorf("next bates %d, want 10", next)
+	}
+	// 编号在文档之间连续，页码和总页数按各自的文档计算
+	want := [][]string{
+		{"ABC0005 1/3", "ABC0006 2/3", "ABC0007 3/3"},
+		{"ABC0008 1/2", "ABC0009 2/2"},
+	}
+	for i, doc := range docs {
+		for j, pg := range doc.Pages() {
+			text, err := pg.Text()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(text, want[i][j]) {
+				t.Errorf("document %d page %d: text %q, want %q", i+1, j+1, text, want[i][j])
+			}
+		}
+	}
+
+	// 只给第 2 页以后编号时，序号只按加了文字的页面递增
+	doc := editDoc(t)
+	next, err = StampDocuments(&Stamp{Text: "{bates}", Pages: []PageRange{{2, 3}}}, doc, mergeDoc(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 4 {
+		t.Errorf("next bates %d, want 4", next)
+	}
+	if text, _ := doc.Pages()[0].Text(); strings.Contains(text, "00000") {
+		t.Errorf("page 1 is stamped: %q", text)
+	}
+	if text, _ := doc.Pages()[2].Text(); !strings.Contains(text, "000002") {
+		t.Errorf("page 3: text %q, want 000002", text)
+	}
+
+	// 字体不能编码时返回错误，序号不变，文档不修改
+	doc = editDoc(t)
+	objs := len(doc.Objects)
+	next, err = StampDocuments(&Stamp{Text: "{bates} 第 {page} 页", BatesStart: 7}, doc)
+	if err == nil || !strings.HasPrefix(err.Error(), "document 1:") {
+		t.Errorf("error %v", err)
+	}
+	if next != 7 || len(doc.Objects) != objs {
+		t.Errorf("failed stamp: next %d, %d new objects", next, len(doc.Objects)-objs)
+	}
+}
@@ -0,0 +1,178 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 标准 14 种字体: 所有阅读器都内置，不需要嵌入字体文件，用于水印、页眉页脚等新加的文字。
+// 除 Symbol 和 ZapfDingbats 外都使用 WinAnsiEncoding。
+// 宽度取自 Adobe 的 AFM 文件，只收录了 ASCII 的可打印字符 (0x20 到 0x7e)，
+// 带重音的字母按不带重音的字母计算，其他字符按 n 的宽度估计
+
+// standardFont 一种标准字体
+type standardFont struct {
+	name     string
+	widths   []int // 0x20 到 0x7e 的宽度，nil 时都是 fixed
+	fixed    int
+	symbolic bool // Symbol 和 ZapfDingbats 使用字体内置的编码
+}
+
+var standardFonts = map[string]*standardFont{
+	"Helvetica":             {name: "Helvetica", widths: helveticaWidths},
+	"Helvetica-Oblique":     {name: "Helvetica-Oblique", widths: helveticaWidths},
+	"Helvetica-Bold":        {name: "Helvetica-Bold", widths: helveticaBoldWidths},
+	"Helvetica-BoldOblique": {name: "Helvetica-BoldOblique", widths: helveticaBoldWidths},
+	"Times-Roman":           {name: "Times-Roman", widths: timesRomanWidths},
+	"Times-Bold":            {name: "Times-Bold", widths: timesBoldWidths},
+	"Times-Italic":          {name: "Times-Italic", widths: timesItalicWidths},
+	"Times-BoldItalic":      {name: "Times-BoldItalic", widths: timesBoldItalicWidths},
+	"Courier":               {name: "Courier", fixed: 600},
+	"Courier-Oblique":       {name: "Courier-Oblique", fixed: 600},
+	"Courier-Bold":          {name: "Courier-Bold", fixed: 600},
+	"Courier-BoldOblique":   {name: "Courier-BoldOblique", fixed: 600},
+	// 符号字体的宽度没有收录，按 600 估计
+	"Symbol":       {name: "Symbol", fixed: 600, symbolic: true},
+	"ZapfDingbats": {name: "ZapfDingbats", fixed: 600, symbolic: true},
+}
+
+// lookupStandardFont 按名字取标准字体，名字前面可以带 /，空名字为 Helvetica
+func lookupStandardFont(name string) (*standardFont, error) {
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		name = "Helvetica"
+	}
+	f, ok := standardFonts[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a standard 14 font", name)
+	}
+	return f, nil
+}
+
+var (
+	winAnsiOnce  sync.Once
+	winAnsiCodes map[rune]byte
+)
+
+// encode 把文字按字体的编码转为字节。有不能编码的字符时返回错误，
+// 这时返回的字节中这些字符改为 ?
+func (f *standardFont) encode(text string) ([]byte, error) {
+	winAnsiOnce.Do(func() {
+		winAnsiCodes = make(map[rune]byte, 256)
+		for code := 255; code >= 0x20; code-- {
+			// 同一个字符有多个编码时取小的，如 space 和 nbspace
+			if runes := []rune(glyphText(winAnsiEncoding[code])); winAnsiEncoding[code] != "" && len(runes) == 1 {
+				winAnsiCodes[runes[0]] = byte(code)
+			}
+		}
+	})
+	var err error
+	data := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case f.symbolic && r < 256:
+			data = append(data, byte(r))
+		case !f.symbolic && winAnsiCodes[r] != 0:
+			data = append(data, winAnsiCodes[r])
+		default:
+			if err == nil {
+				err = fmt.Errorf("%q cannot be encoded in %s", r, f.name)
+			}
+			data = append(data, '?')
+		}
+	}
+	return data, err
+}
+
+// width 编码后的文字在字号 size 时的宽度
+func (f *standardFont) width(data []byte, size float64) float64 {
+	total := 0
+	for _, b := range data {
+		total += f.charWidth(b)
+	}
+	return float64(total) * size / 1000
+}
+
+func (f *standardFont) charWidth(code byte) int {
+	if f.widths == nil {
+		return f.fixed
+	}
+	if code >= 0x20 && code <= 0x7e {
+		return f.widths[code-0x20]
+	}
+	name := winAnsiEncoding[code]
+	for _, accent := range []string{"acute", "grave", "circumflex", "dieresis", "tilde", "ring", "cedilla", "caron"} {
+		if len(name) == len(accent)+1 && strings.HasSuffix(name, accent) {
+			return f.charWidth(name[0])
+		}
+	}
+	return f.widths['n'-0x20]
+}
+
+// newStandardFontObj 创建标准字体的字体对象
+func (p *PDF) newStandardFontObj(f *standardFont) *Obj {
+	dict := []*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/Font"}},
+		{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Type1"}},
+		{Key: &NameObj{Name: "/BaseFont"}, Value: &NameObj{Name: "/" + f.name}},
+	}
+	if !f.symbolic {
+		dict = append(dict, &Pair{Key: &NameObj{Name: "/Encoding"}, Value: &NameObj{Name: "/WinAnsiEncoding"}})
+	}
+	return p.addObj(&Obj{Dict: dict})
+}
+
+var helveticaWidths = []int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = []int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+var timesRomanWidths = []int{
+	250, 333, 408, 500, 500, 833, 778, 180, 333, 333, 500, 564, 250, 333, 250, 278,
+	500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 278, 278, 564, 564, 564, 444,
+	921, 722, 667, 667, 722, 611, 556, 722, 722, 333, 389, 722, 611, 889, 722, 722,
+	556, 722, 667, 556, 611, 722, 722, 944, 722, 722, 611, 333, 278, 333, 469, 500,
+	333, 444, 500, 444, 500, 444, 333, 500, 500, 278, 278, 500, 278, 778, 500, 500,
+	500, 500, 333, 389, 278, 500, 500, 722, 500, 500, 444, 480, 200, 480, 541,
+}
+
+var timesBoldWidths = []int{
+	250, 333, 555, 500, 500, 1000, 833, 278, 333, 333, 500, 570, 250, 333, 250, 278,
+	500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 333, 333, 570, 570, 570, 500,
+	930, 722, 667, 722, 722, 667, 611, 778, 778, 389, 500, 778, 667, 944, 722, 778,
+	611, 778, 722, 556, 667, 722, 722, 1000, 722, 722, 667, 333, 278, 333, 581, 500,
+	333, 500, 556, 444, 556, 444, 333, 500, 556, 278, 333, 556, 278, 833, 556, 500,
+	556, 556, 444, 389, 333, 556, 500, 722, 500, 500, 444, 394, 220, 394, 520,
+}
+
+var timesItalicWidths = []int{
+	250, 333, 420, 500, 500, 833, 778, 214, 333, 333, 500, 675, 250, 333, 250, 278,
+	500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 333, 333, 675, 675, 675, 500,
+	920, 611, 611, 667, 722, 611, 611, 722, 722, 333, 444, 667, 556, 833, 667, 722,
+	611, 722, 611, 500, 556, 722, 611, 833, 611, 556, 556, 389, 278, 389, 422, 500,
+	333, 500, 500, 444, 500, 444, 278, 500, 500, 278, 278, 444, 278, 722, 500, 500,
+	500, 500, 389, 389, 278, 500, 444, 667, 444, 444, 389, 400, 275, 400, 541,
+}
+
+var timesBoldItalicWidths = []int{
+	250, 389, 555, 500, 500, 833, 778, 278, 333, 333, 500, 570, 250, 333, 250, 278,
+	500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 333, 333, 570, 570, 570, 500,
+	832, 667, 667, 667, 722, 667, 667, 722, 778, 389, 500, 667, 611, 889, 722, 722,
+	611, 722, 667, 556, 611, 722, 667, 889, 667, 611, 611, 333, 278, 333, 570, 500,
+	333, 500, 500, 444, 500, 444, 333, 500, 556, 278, 278, 500, 278, 778, 556, 500,
+	500, 500, 389, 389, 278, 556, 444, 667, 500, 444, 389, 348, 220, 348, 570,
+}
@@ -0,0 +1,314 @@
+package pdf
+
+import (
+	"math"
+	"strings"
+)
+
+// 提取页面的文字: 运行内容流的图形和文字状态机得到每个字形的文字和位置，
+// 再按字形的位置推断换行和单词之间的空格
+
+// textGlyph 画出的一个字形，坐标都在页面的默认用户空间中
+type textGlyph struct {
+	text     string // 不知道对应的文字时为空
+	font     *pdfFont
+	fill     []float64
+	fontSize float64 // 变换后的有效字号
+	x0, y0   float64 // 基线的起点
+	x1, y1   float64 // 基线的终点，不包括字间距
+	dx, dy   float64 // 文字方向的单位向量
+	bbox     Rect
+}
+
+// textWalker 遍历内容流，对每个画出的字形调用 emit。
+// 不可见的文字 (Tr 3，例如扫描件 OCR 的文字层) 也会提取
+type textWalker struct {
+	p     *PDF
+	fonts map[*Obj]*pdfFont
+	depth int
+	emit  func(g *textGlyph)
+}
+
+// walkText 依次取出页面上画出的字形
+func (p *PDF) walkText(page *Obj, resources []*Pair, fn func(g *textGlyph)) error {
+	w := &textWalker{p: p, fonts: make(map[*Obj]*pdfFont), emit: fn}
+	return w.walk(p.pageContentData(page), resources, identityMatrix)
+}
+
+func (w *textWalker) walk(content []byte, resources []*Pair, ctm matrix) error {
+	s := newTextState(ctm)
+	font := func(name string) *pdfFont {
+		return w.p.cachedFont(w.fonts, w.p.getResolvedDict(resources, "/Font"), name)
+	}
+	return eachContentOp(content, func(op string, args []interface{}) bool {
+		s.apply(op, args, font)
+		switch op {
+		case "Do":
+			if len(args) == 1 {
+				if name, ok := args[0].(*NameObj); ok {
+					w.doForm(resources, name.Name, s.gs.ctm)
+				}
+			}
+		case "Tj", "'", "\"":
+			if len(args) > 0 {
+				if str, ok := args[len(args)-1].(string); ok {
+					s.show(decodePDFString(str), func(g *textGlyph, _ []byte) {
+						w.emit(g)
+					})
+				}
+			}
+		case "TJ":
+			if len(args) == 1 {
+				list, _ := args[0].([]interface{})
+				for _, item := range list {
+					if str, ok := item.(string); ok {
+						s.show(decodePDFString(str), func(g *textGlyph, _ []byte) {
+							w.emit(g)
+						})
+					} else if n, ok := toFloat(item); ok {
+						s.kern(n)
+					}
+				}
+			}
+		}
+		return true
+	})
+}
+
+// textState 运行内容流时的图形状态和文字矩阵，提取文字和涂黑共用
+type textState struct {
+	gs      graphicsState
+	stack   []graphicsState
+	tm, tlm matrix
+}
+
+func newTextState(ctm matrix) *textState {
+	return &textState{gs: graphicsState{ctm: ctm, lineWidth: 1, hScale: 1, fill: []float64{0}}}
+}
+
+// apply 执行操作符对状态的修改，' 和 " 只处理换行和间距，显示文字由调用者用 show 完成。
+// font 按资源中的名字取字体
+func (s *textState) apply(op string, args []interface{}, font func(name string) *pdfFont) {
+	v := make([]float64, 0, len(args))
+	for _, arg := range args {
+		if n, ok := toFloat(arg); ok {
+			v = append(v, n)
+		}
+	}
+	gs := &s.gs
+	switch op {
+	case "q":
+		s.stack = append(s.stack, *gs)
+	case "Q":
+		if len(s.stack) > 0 {
+			*gs = s.stack[len(s.stack)-1]
+			s.stack = s.stack[:len(s.stack)-1]
+		}
+	case "cm":
+		if m, ok := toMatrix(args); ok {
+			gs.ctm = m.multiply(gs.ctm)
+		}
+	case "w":
+		if len(v) == 1 {
+			gs.lineWidth = v[0]
+		}
+	case "g", "rg", "k", "sc", "scn":
+		if len(v) > 0 {
+			gs.fill = v
+		}
+	case "cs":
+		// 设置颜色空间后颜色为黑色
+		gs.fill = []float64{0}
+		if len(args) == 1 {
+			if name, ok := args[0].(*NameObj); ok && name.Name == "/DeviceCMYK" {
+				gs.fill = []float64{0, 0, 0, 1}
+			}
+		}
+	case "BT":
+		s.tm, s.tlm = identityMatrix, identityMatrix
+	case "Tf":
+		if len(args) == 2 {
+			if name, ok := args[0].(*NameObj); ok {
+				gs.font = font(name.Name)
+			}
+			gs.fontSize, _ = toFloat(args[1])
+		}
+	case "Tc":
+		if len(v) == 1 {
+			gs.charSpace = v[0]
+		}
+	case "Tw":
+		if len(v) == 1 {
+			gs.wordSpace = v[0]
+		}
+	case "Tz":
+		if len(v) == 1 {
+			gs.hScale = v[0] / 100
+		}
+	case "TL":
+		if len(v) == 1 {
+			gs.leading = v[0]
+		}
+	case "Ts":
+		if len(v) == 1 {
+			gs.rise = v[0]
+		}
+	case "Tr":
+		if len(v) == 1 {
+			gs.render = int(v[0])
+		}
+	case "Td", "TD":
+		if len(v) == 2 {
+			if op == "TD" {
+				gs.leading = -v[1]
+			}
+			s.tlm = matrix{1, 0, 0, 1, v[0], v[1]}.multiply(s.tlm)
+			s.tm = s.tlm
+		}
+	case "Tm":
+		if m, ok := toMatrix(args); ok {
+			s.tm, s.tlm = m, m
+		}
+	case "T*", "'", "\"":
+		if op == "\"" && len(v) >= 2 {
+			gs.wordSpace, gs.charSpace = v[0], v[1]
+		}
+		s.tlm = matrix{1, 0, 0, 1, 0, -gs.leading}.multiply(s.tlm)
+		s.tm = s.tlm
+	}
+}
+
+// show 画出 data 中的每个字形并移动文字矩阵，fn 的 code 为字形对应的原始字节
+func (s *textState) show(data []byte, fn func(g *textGlyph, code []byte)) {
+	gs := &s.gs
+	if gs.font == nil {
+		return
+	}
+	for _, raw := range gs.font.split(data) {
+		code := gs.font.codes(raw)[0]
+		w0 := gs.font.width(code) / 1000
+		trm := matrix{gs.fontSize * gs.hScale, 0, 0, gs.fontSize, 0, gs.rise}.multiply(s.tm).multiply(gs.ctm)
+		g := &textGlyph{text: gs.font.text(code), font: gs.font, fill: gs.fill}
+		g.x0, g.y0 = trm.transform(0, 0)
+		g.x1, g.y1 = trm.transform(w0, 0)
+		g.dx, g.dy = unitVector(trm[0], trm[1])
+		g.fontSize = math.Hypot(trm[2], trm[3])
+		g.bbox = trm.transformRect(Rect{0, gs.font.descent / 1000, w0, gs.font.ascent / 1000})
+		fn(g, raw)
+		s.tm = matrix{1, 0, 0, 1, s.advance(code) * gs.hScale, 0}.multiply(s.tm)
+	}
+}
+
+// advance 字形画出后文字矩阵移动的距离，不包括水平缩放
+func (s *textState) advance(code int) float64 {
+	gs := &s.gs
+	tx := gs.font.width(code)/1000*gs.fontSize + gs.charSpace
+	if !gs.font.composite && code == ' ' {
+		tx += gs.wordSpace
+	}
+	return tx
+}
+
+// kern TJ 数组中的数字，单位为千分之一字号
+func (s *textState) kern(n float64) {
+	s.tm = matrix{1, 0, 0, 1, -n / 1000 * s.gs.fontSize * s.gs.hScale, 0}.multiply(s.tm)
+}
+
+// doForm 递归提取 Form XObject 中的文字
+func (w *textWalker) doForm(resources []*Pair, name string, ctm matrix) {
+	p := w.p
+	obj, _ := p.resolve(p.getValueByKey(p.getResolvedDict(resources, "/XObject"), name)).(*Obj)
+	form := p.openForm(obj, resources, w.depth)
+	if form == nil {
+		return
+	}
+	data, _, err := p.decodeStream(obj)
+	if err != nil {
+		return
+	}
+	w.depth++
+	w.walk(data, form.resources, form.matrix.multiply(ctm))
+	w.depth--
+}
+
+func unitVector(x, y float64) (float64, float64) {
+	l := math.Hypot(x, y)
+	if l < 1e-9 {
+		return 1, 0
+	}
+	return x / l, y / l
+}
+
+// Text 返回页面上的文字，按内容流中画出的顺序。
+// 基线偏离前一个字形超过半个字号时换行，和前一个字形之间的空隙较大时加空格
+func (pg *Page) Text() (string, error) {
+	glyphs := make([]*textGlyph, 0)
+	err := pg.pdf.walkText(pg.obj, pg.Resources, func(g *textGlyph) {
+		glyphs = append(glyphs, g)
+	})
+	return layoutText(glyphs), err
+}
+
+// 推断空格和换行的阈值，单位为字号
+const (
+	wordGapRatio = 0.15
+	lineGapRatio = 0.5
+)
+
+// glyphBreak 判断 prev 和 g 之间是否需要换行或者空格
+func glyphBreak(prev, g *textGlyph) (newline, space bool) {
+	size := math.Max(prev.fontSize, g.fontSize)
+	if prev.dx*g.dx+prev.dy*g.dy < 0.9 {
+		// 文字方向变了
+		return true, false
+	}
+	ox, oy := g.x0-prev.x1, g.y0-prev.y1
+	along := ox*prev.dx + oy*prev.dy
+	perp := oy*prev.dx - ox*prev.dy
+	if math.Abs(perp) > lineGapRatio*size {
+		return true, false
+	}
+	return false, along > wordGapRatio*size || along < -size
+}
+
+// layoutText 把字形连接为文字，去掉每行末尾的空格
+func layoutText(glyphs []*textGlyph) string {
+	text, _ := layoutGlyphs(glyphs)
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// layoutGlyphs 把字形连接为文字，同时返回每个字节来自哪个字形，推断出的空格和换行为 -1。
+// 重复画的字形 (模拟粗体) 只保留一个
+func layoutGlyphs(glyphs []*textGlyph) (string, []int) {
+	var buf strings.Builder
+	index := make([]int, 0, len(glyphs))
+	var prev *textGlyph
+	for i, g := range glyphs {
+		if prev != nil && g.text == prev.text && g.text != "" &&
+			math.Hypot(g.x0-prev.x0, g.y0-prev.y0) < 0.1*g.fontSize {
+			continue
+		}
+		if prev != nil && buf.Len() > 0 {
+			newline, space := glyphBreak(prev, g)
+			last := buf.String()[buf.Len()-1]
+			switch {
+			case newline && last != '\n':
+				buf.WriteByte('\n')
+				index = append(index, -1)
+			case space && last != ' ' && last != '\n' && !strings.HasPrefix(g.text, " "):
+				buf.WriteByte(' ')
+				index = append(index, -1)
+			}
+		}
+		buf.WriteString(g.text)
+		for j := 0; j < len(g.text); j++ {
+			index = append(index, i)
+		}
+		prev = g
+	}
+	return buf.String(), index
+}
@@ -0,0 +1,90 @@
+package pdf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fontDoc 一页的文档，用到各种字体编码:
+// /F1 标准编码的 Helvetica，/F2 Identity-H 的 Type0 字体加 ToUnicode，
+// /F3 用 /Differences 改了编码，/F4 的 ToUnicode 优先于编码，/Fm1 中的文字在 Form 里
+func fontDoc(t *testing.T) *PDF {
+	widths := strings.TrimSpace(strings.Repeat("500 ", 95))
+	return testPDF(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R " +
+			"/Resources << /Font << /F1 5 0 R /F2 6 0 R /F3 9 0 R /F4 10 0 R >> /XObject << /Fm1 12 0 R >> >> >>",
+		testStream("", "BT /F1 12 Tf 72 700 Td [(Hel) -100 (lo) -1000 (there)] TJ ET\n"+
+			"BT /F3 12 Tf 72 680 Td (ABC a) Tj ET\n"+
+			"BT /F4 12 Tf 72 660 Td (AA) Tj ET\n"+
+			"BT 1 0 0 rg /F2 12 Tf 72 640 Td <0004000100020003> Tj ET\n"+
+			"q 1 0 0 1 0 -100 cm /Fm1 Do Q"),
+		fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /FirstChar 32 /LastChar 126 /Widths [%s] >>", widths),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /ABCDEF+Song /Encoding /Identity-H /DescendantFonts [7 0 R] /ToUnicode 8 0 R >>",
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /ABCDEF+Song " +
+			"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /DW 1000 >>",
+		testStream("", "1 begincodespacerange <0000> <FFFF> endcodespacerange\n"+
+			"1 beginbfrange <0001> <0002> [<4E2D> <6587>] endbfrange\n"+
+			"2 beginbfchar <0003> <5B57> <0004> <6211> endbfchar"),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Custom /Encoding << /BaseEncoding /WinAnsiEncoding /Differences [65 /Euro /uni4E2D /Aacute.sc 97 /f_i] >> >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Custom /Encoding /WinAnsiEncoding /ToUnicode 11 0 R >>",
+		testStream("", "1 begincodespacerange <00> <FF> endcodespacerange 1 beginbfchar <41> <0416> endbfchar"),
+		testStream("/Type /XObject /Subtype /Form /BBox [0 0 612 792] /Resources << /Font << /F1 5 0 R >> >>",
+			"BT /F1 12 Tf 72 700 Td (form) Tj ET"),
+	})
+}
+
+func TestPageText(t *testing.T) {
+	pg, err := fontDoc(t).Page(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := pg.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Hello there", "€中Á fi", "ЖЖ", "我中文字", "form"}
+	if lines := strings.Split(strings.TrimSpace(text), "\n"); !reflect.DeepEqual(lines, want) {
+		t.Errorf("text %q, want %q", lines, want)
+	}
+}
+
+func TestGlyphsAndWords(t *testing.T) {
+	pg, err := fontDoc(t).Page(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glyphs, err := pg.Glyphs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 第一行 -100 的位移不分词，-1000 的位移分词；Type0 字体每个字宽 1000，颜色为红色
+	if len(glyphs) != 25 {
+		t.Fatalf("%d glyphs, want 25", len(glyphs))
+	}
+	want := TextBox{Text: "我", BBox: Rect{72, 637, 84, 652}, Font: "Song", FontSize: 12, Color: "#ff0000"}
+	if g := glyphs[17]; *g != want {
+		t.Errorf("glyph %+v, want %+v", *g, want)
+	}
+	words, err := pg.Words()
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := make([]string, 0, len(words))
+	for _, w := range words {
+		texts = append(texts, w.Text)
+	}
+	if want := []string{"Hello", "there", "€中Á", "fi", "ЖЖ", "我中文字", "form"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("words %q, want %q", texts, want)
+	}
+	// TJ 中的位移移动后面的字形，Form 中的文字按 cm 的矩阵计算位置
+	if box := words[1].BBox; box != (Rect{115.2, 697, 145.2, 712}) {
+		t.Errorf("there: %v", box)
+	}
+	if box := words[6].BBox; box != (Rect{72, 597, 96, 612}) {
+		t.Errorf("form: %v", box)
+	}
+}
@@ -0,0 +1,129 @@
+package pdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// 带位置的文字: 每个字形或者单词的外接矩形、字体、字号和填充颜色，
+// 用于表格识别和按位置提取字段
+
+// TextBox 页面上的一个字形或者单词，BBox 为默认用户空间中的外接矩形
+type TextBox struct {
+	Text     string  `json:"text"`
+	BBox     Rect    `json:"bbox"`
+	Font     string  `json:"font"` // /BaseFont，去掉了子集的前缀
+	FontSize float64 `json:"size"` // 变换后的有效字号
+	Color    string  `json:"color"`
+}
+
+// PageText 一页的带位置的文字
+type PageText struct {
+	Page  int        `json:"page"`
+	Box   Rect       `json:"box"` // 页面的 CropBox
+	Items []*TextBox `json:"items"`
+}
+
+// Glyphs 返回页面上每个有文字的字形，按内容流中画出的顺序
+func (pg *Page) Glyphs() ([]*TextBox, error) {
+	list := make([]*TextBox, 0)
+	err := pg.pdf.walkText(pg.obj, pg.Resources, func(g *textGlyph) {
+		if g.text != "" {
+			list = append(list, g.box())
+		}
+	})
+	return list, err
+}
+
+// Words 返回页面上的单词，按空白、较大的空隙和换行拆分字形，
+// 字体、字号和颜色取单词的第一个字形
+func (pg *Page) Words() ([]*TextBox, error) {
+	list := make([]*TextBox, 0)
+	var word *TextBox
+	var prev *textGlyph
+	err := pg.pdf.walkText(pg.obj, pg.Resources, func(g *textGlyph) {
+		if word != nil && prev != nil {
+			if newline, space := glyphBreak(prev, g); newline || space {
+				word = nil
+			}
+		}
+		prev = g
+		if strings.TrimSpace(g.text) == "" {
+			word = nil
+			return
+		}
+		if word == nil {
+			word = g.box()
+			list = append(list, word)
+			return
+		}
+		word.Text += g.text
+		word.BBox = word.BBox.union(g.box().BBox)
+	})
+	return list, err
+}
+
+// TextLayout 返回所有页面的带位置的文字，words 为 true 时按单词，否则按字形
+func (p *PDF) TextLayout(words bool) ([]*PageText, error) {
+	list := make([]*PageText, 0)
+	for _, pg := range p.Pages() {
+		item := &PageText{Page: pg.Number, Box: pg.CropBox}
+		var err error
+		if words {
+			item.Items, err = pg.Words()
+		} else {
+			item.Items, err = pg.Glyphs()
+		}
+		if err != nil {
+			return list, fmt.Errorf("page %d: %v", pg.Number, err)
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// TextLayoutJSON 把 TextLayout 的结果输出为 JSON
+func (p *PDF) TextLayoutJSON(words bool) ([]byte, error) {
+	list, err := p.TextLayout(words)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(list, "", "  ")
+}
+
+// box 转为导出的结构，坐标保留 4 位小数
+func (g *textGlyph) box() *TextBox {
+	r := g.bbox
+	return &TextBox{
+		Text:     g.text,
+		BBox:     Rect{roundFloat(r.LLX), roundFloat(r.LLY), roundFloat(r.URX), roundFloat(r.URY)},
+		Font:     g.font.name,
+		FontSize: roundFloat(g.fontSize),
+		Color:    colorHex(g.fill),
+	}
+}
+
+// colorHex 把颜色分量转为 #rrggbb，1 个分量为 Gray，3 个为 RGB，4 个为 CMYK，
+// 其他颜色空间 (如 Separation 和 Pattern) 不能准确转换，按分量个数近似
+func colorHex(c []float64) string {
+	var r, g, b float64
+	switch len(c) {
+	case 3:
+		r, g, b = c[0], c[1], c[2]
+	case 4:
+		r = (1 - c[0]) * (1 - c[3])
+		g = (1 - c[1]) * (1 - c[3])
+		b = (1 - c[2]) * (1 - c[3])
+	default:
+		if len(c) > 0 {
+			r = c[0]
+		}
+		g, b = r, r
+	}
+	clamp := func(v float64) int {
+		return int(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", clamp(r), clamp(g), clamp(b))
+}
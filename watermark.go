@@ -0,0 +1,325 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"strings"
+)
+
+// 水印和印章: 文字或者图像做成一个 Form XObject，所有页面共用，
+// 每页的内容中只加一个画出它的 Do。画水印的内容放在 /Artifact 标记内容中，
+// /Subtype 为 /Watermark，删除时按这个标记找到它们
+
+// Position 内容在页面上的位置，按页面显示的方向 (考虑 /Rotate)
+type Position int
+
+const (
+	PositionCenter Position = iota
+	PositionTopLeft
+	PositionTop
+	PositionTopRight
+	PositionLeft
+	PositionRight
+	PositionBottomLeft
+	PositionBottom
+	PositionBottomRight
+)
+
+// anchor 宽高为 w h 的内容放在 width x height 的页面上时，内容中心的位置
+func (pos Position) anchor(width, height, w, h, margin float64) (float64, float64) {
+	x, y := width/2, height/2
+	switch pos {
+	case PositionTopLeft, PositionLeft, PositionBottomLeft:
+		x = margin + w/2
+	case PositionTopRight, PositionRight, PositionBottomRight:
+		x = width - margin - w/2
+	}
+	switch pos {
+	case PositionTopLeft, PositionTop, PositionTopRight:
+		y = height - margin - h/2
+	case PositionBottomLeft, PositionBottom, PositionBottomRight:
+		y = margin + h/2
+	}
+	return x, y
+}
+
+// displayMatrix 从页面显示的坐标 (显示的左下角为原点) 到默认用户空间的矩阵
+func displayMatrix(pg *Page) matrix {
+	// 和 placeMatrix 相同，页面顺时针旋转 Rotate 度显示
+	theta := -float64(pg.Rotate) * math.Pi / 180
+	cos, sin := math.Round(math.Cos(theta)), math.Round(math.Sin(theta))
+	m := matrix{cos, sin, -sin, cos, 0, 0}
+	box := m.transformRect(pg.CropBox)
+	inv, _ := m.multiply(matrix{1, 0, 0, 1, -box.LLX, -box.LLY}).invert()
+	return inv
+}
+
+// Watermark 水印或者印章，Text 和 Image 二选一
+type Watermark struct {
+	Text     string      // 文字，可以用 \n 分为多行，每行居中；有字体不能编码的字符时返回错误
+	Image    image.Image // Text 为空时使用图像
+	Font     string      // 标准 14 种字体之一，默认 Helvetica
+	FontSize float64     // 默认 48
+	Color    []float64   // 文字的 RGB 颜色，默认灰色
+	Opacity  float64     // 不透明度，写到 ExtGState 的 /ca 和 /CA；0 表示没有设置，和 1 一样完全不透明，不在 0 到 1 之间时返回错误
+	Rotation float64     // 逆时针旋转的角度，绕中心旋转
+
+	Position         Position
+	Margin           float64 // 和页面边缘的距离，Position 不是中心时使用
+	OffsetX, OffsetY float64 // 在 Position 的基础上再移动的距离
+	Width, Height    float64 // 图像显示的大小，只给出一个时按比例计算，都没有时按 72 dpi
+
+	Behind bool        // 画在页面内容的下面，否则画在上面
+	Pages  []PageRange // 加水印的页面，空表示所有页面
+}
+
+// AddWatermark 给页面加水印，所有页面共用一个 Form XObject
+func (p *PDF) AddWatermark(wm *Watermark) error {
+	form, width, height, err := p.newWatermarkForm(wm)
+	if err != nil {
+		return err
+	}
+	theta := wm.Rotation * math.Pi / 180
+	cos, sin := math.Cos(theta), math.Sin(theta)
+	// 绕中心旋转，再按旋转后的外接矩形对齐
+	center := matrix{1, 0, 0, 1, -width / 2, -height / 2}.multiply(matrix{cos, sin, -sin, cos, 0, 0})
+	box := center.transformRect(Rect{0, 0, width, height})
+	cnt := 0
+	for _, pg := range p.Pages() {
+		if !inPageRanges(wm.Pages, pg.Number) {
+			continue
+		}
+		w, h := pg.Size()
+		x, y := wm.Position.anchor(w, h, box.Width(), box.Height(), wm.Margin)
+		m := center.multiply(matrix{1, 0, 0, 1, x + wm.OffsetX, y + wm.OffsetY}).multiply(displayMatrix(pg))
+
+		res := p.pageResources(pg.obj)
+		name := p.newXObjectName(res, "/Wm")
+		p.setDictPath(&res, []string{"/XObject", name}, objRef(form))
+		setPairValue(&pg.obj.Dict, "/Resources", res)
+		content := fmt.Sprintf("/Artifact <</Type /Pagination /Subtype /Watermark>> BDC\nq %s cm %s Do Q\nEMC\n", m, name)
+		if wm.Behind {
+			p.wrapContent(pg.obj, []byte(content), nil)
+		} else {
+			p.appendContent(pg.obj, []byte(content))
+		}
+		cnt++
+	}
+	log.Default().Printf("add watermark %d %d to %d pages", form.ID, form.GenID, cnt)
+	return nil
+}
+
+// newWatermarkForm 创建画出水印的 Form，返回它的宽和高
+func (p *PDF) newWatermarkForm(wm *Watermark) (*Obj, float64, float64, error) {
+	if wm.Opacity < 0 || wm.Opacity > 1 {
+		return nil, 0, 0, fmt.Errorf("opacity %v out of range [0, 1]", wm.Opacity)
+	}
+	var content bytes.Buffer
+	resources := make([]*Pair, 0, 3)
+	if wm.Opacity > 0 && wm.Opacity < 1 {
+		resources = append(resources, &Pair{Key: &NameObj{Name: "/ExtGState"}, Value: []*Pair{
+			{Key: &NameObj{Name: "/GS1"}, Value: []*Pair{
+				{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/ExtGState"}},
+				{Key: &NameObj{Name: "/ca"}, Value: wm.Opacity},
+				{Key: &NameObj{Name: "/CA"}, Value: wm.Opacity},
+			}},
+		}})
+		content.WriteString("/GS1 gs\n")
+	}
+	var width, height float64
+	switch {
+	case wm.Text != "":
+		font, err := lookupStandardFont(wm.Font)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		size := wm.FontSize
+		if size <= 0 {
+			size = 48
+		}
+		color := wm.Color
+		if len(color) != 3 {
+			color = []float64{0.5, 0.5, 0.5}
+		}
+		lines := strings.Split(wm.Text, "\n")
+		encoded := make([][]byte, len(lines))
+		for i, line := range lines {
+			if encoded[i], err = font.encode(line); err != nil {
+				return nil, 0, 0, err
+			}
+			width = math.Max(width, font.width(encoded[i], size))
+		}
+		leading := size * 1.2
+		height = leading * float64(len(lines))
+		fmt.Fprintf(&content, "%s %s %s rg\nBT\n/F1 %s Tf\n",
+			formatFloat(color[0]), formatFloat(color[1]), formatFloat(color[2]), formatFloat(size))
+		for i, data := range encoded {
+			// 基线在这一行的下边上方 0.3 个字号，大写字母大致在行中居中
+			x := (width - font.width(data, size)) / 2
+			y := height - leading*float64(i+1) + 0.3*size
+			fmt.Fprintf(&content, "1 0 0 1 %s %s Tm %s Tj\n",
+				formatFloat(roundFloat(x)), formatFloat(roundFloat(y)), encodePDFString(data))
+		}
+		content.WriteString("ET\n")
+		fontObj := p.newStandardFontObj(font)
+		resources = append(resources, &Pair{Key: &NameObj{Name: "/Font"}, Value: []*Pair{
+			{Key: &NameObj{Name: "/F1"}, Value: objRef(fontObj)},
+		}})
+	case wm.Image != nil:
+		b := wm.Image.Bounds()
+		if b.Empty() {
+			return nil, 0, 0, errors.New("empty watermark image")
+		}
+		width, height = wm.Width, wm.Height
+		switch {
+		case width <= 0 && height <= 0:
+			width, height = float64(b.Dx()), float64(b.Dy())
+		case height <= 0:
+			height = width * float64(b.Dy()) / float64(b.Dx())
+		case width <= 0:
+			width = height * float64(b.Dx()) / float64(b.Dy())
+		}
+		img := p.newStreamObj([]*Pair{
+			{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/XObject"}},
+			{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Image"}},
+		}, nil)
+		p.setImageData(img, wm.Image)
+		fmt.Fprintf(&content, "q %s 0 0 %s 0 0 cm /Im1 Do Q\n", formatFloat(roundFloat(width)), formatFloat(roundFloat(height)))
+		resources = append(resources, &Pair{Key: &NameObj{Name: "/XObject"}, Value: []*Pair{
+			{Key: &NameObj{Name: "/Im1"}, Value: objRef(img)},
+		}})
+	default:
+		return nil, 0, 0, errors.New("watermark has neither text nor image")
+	}
+	form := p.newStreamObj([]*Pair{
+		{Key: &NameObj{Name: "/Type"}, Value: &NameObj{Name: "/XObject"}},
+		{Key: &NameObj{Name: "/Subtype"}, Value: &NameObj{Name: "/Form"}},
+		{Key: &NameObj{Name: "/BBox"}, Value: Rect{0, 0, width, height}.array()},
+		{Key: &NameObj{Name: "/Resources"}, Value: resources},
+	}, nil)
+	p.setContentData(form, content.Bytes())
+	return form, width, height, nil
+}
+
+// RemoveWatermarks 删除页面中的水印，即 /Subtype 为 /Watermark 的 /Artifact 标记内容，
+// 包括 AddWatermark 加的和其他软件按同样方式加的。pages 为空时处理所有页面，返回删除的个数
+func (p *PDF) RemoveWatermarks(pages []PageRange) int {
+	cnt := 0
+	removed := make([]*Obj, 0)
+	for _, pg := range p.Pages() {
+		if inPageRanges(pages, pg.Number) {
+			cnt += p.removeArtifacts(pg, "/Watermark", &removed)
+		}
+	}
+	p.removeUnreferenced(removed)
+	log.Default().Printf("remove %d watermarks", cnt)
+	return cnt
+}
+
+// removeArtifacts 从页面的内容流中删除 /Subtype 为 subtype 的 /Artifact 标记内容，
+// 被替换的内容流和不再使用的 XObject 加到 removed 中。返回删除的个数
+func (p *PDF) removeArtifacts(pg *Page, subtype string, removed *[]*Obj) int {
+	cnt := 0
+	names := make(map[string]bool)
+	contents := make([]interface{}, 0)
+	for _, obj := range p.pageContents(pg.obj) {
+		data, _, err := p.decodeStream(obj)
+		if err == nil && bytes.Contains(data, []byte(subtype)) {
+			if ops, err := ParseContent(data); err == nil {
+				if kept, n := p.filterArtifacts(ops, pg.Resources, subtype, names); n > 0 {
+					cnt += n
+					*removed = append(*removed, obj)
+					if len(kept) > 0 {
+						stream := p.newStreamObj(nil, nil)
+						p.setContentData(stream, WriteContent(kept))
+						contents = append(contents, objRef(stream))
+					}
+					continue
+				}
+			}
+		}
+		contents = append(contents, objRef(obj))
+	}
+	if cnt == 0 {
+		return 0
+	}
+	p.setDictValue(pg.obj, "/Contents", contents)
+	// 删除的内容中画出的 XObject 如果别处不再使用，从资源中去掉
+	used := make(map[string]bool)
+	eachContentOp(p.pageContentData(pg.obj), func(op string, args []interface{}) bool {
+		if op == "Do" && len(args) == 1 {
+			if name, ok := args[0].(*NameObj); ok {
+				used[name.Name] = true
+			}
+		}
+		return true
+	})
+	res := p.pageResources(pg.obj)
+	xobjects := p.getResolvedDict(res, "/XObject")
+	list := make([]*Pair, 0, len(xobjects))
+	for _, pair := range xobjects {
+		if !names[pair.Key.Name] || used[pair.Key.Name] {
+			list = append(list, pair)
+			continue
+		}
+		if ref, ok := pair.Value.(*Obj); ok {
+			if obj := p.getObj(ref); obj != nil {
+				*removed = append(*removed, obj)
+			}
+		}
+	}
+	setPairValue(&res, "/XObject", list)
+	setPairValue(&pg.obj.Dict, "/Resources", res)
+	return cnt
+}
+
+// filterArtifacts 去掉 ops 中 /Subtype 为 subtype 的 /Artifact 标记内容，
+// 其中画出的 XObject 名字记到 names 中
+func (p *PDF) filterArtifacts(ops []*Operator, resources []*Pair, subtype string, names map[string]bool) ([]*Operator, int) {
+	kept := make([]*Operator, 0, len(ops))
+	cnt, depth := 0, 0
+	for _, op := range ops {
+		if depth > 0 {
+			switch op.Name {
+			case "BMC", "BDC":
+				depth++
+			case "EMC":
+				depth--
+			case "Do":
+				if len(op.Operands) == 1 {
+					if name, ok := op.Operands[0].(*NameObj); ok {
+						names[name.Name] = true
+					}
+				}
+			}
+			continue
+		}
+		if op.Name == "BDC" && p.isArtifact(op, resources, subtype) {
+			depth = 1
+			cnt++
+			continue
+		}
+		kept = append(kept, op)
+	}
+	return kept, cnt
+}
+
+// isArtifact 判断 BDC 是否为 /Subtype 为 subtype 的 /Artifact，属性可以是资源 /Properties 中的名字
+func (p *PDF) isArtifact(op *Operator, resources []*Pair, subtype string) bool {
+	if len(op.Operands) != 2 {
+		return false
+	}
+	if tag, ok := op.Operands[0].(*NameObj); !ok || tag.Name != "/Artifact" {
+		return false
+	}
+	props := p.resolveDict(op.Operands[1])
+	if name, ok := op.Operands[1].(*NameObj); ok {
+		props = p.resolveDict(p.getValueByKey(p.getResolvedDict(resources, "/Properties"), name.Name))
+	}
+	v := p.getNameObjByKey(props, "/Subtype")
+	return v != nil && v.Name == subtype
+}
@@ -0,0 +1,71 @@
+package pdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWatermarkRoundTrip(t *testing.T) {
+	p := textDoc(t, "BT /F1 12 Tf 72 700 Td (Hello world) Tj ET")
+	objs := len(p.Objects)
+	pageText := func() string {
+		pg, _ := p.Page(1)
+		text, err := pg.Text()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return text
+	}
+
+	// Helvetica 不能编码中文，不透明度超出范围，都返回错误并且不修改文档
+	for _, wm := range []*Watermark{{Text: "草稿"}, {Text: "DRAFT", Opacity: 1.5}, {Text: "DRAFT", Opacity: -1}} {
+		if err := p.AddWatermark(wm); err == nil {
+			t.Errorf("%+v: no error", wm)
+		}
+	}
+	if len(p.Objects) != objs {
+		t.Fatalf("failed watermarks added %d objects", len(p.Objects)-objs)
+	}
+
+	if err := p.AddWatermark(&Watermark{Text: "DRAFT", Opacity: 0.3, Rotation: 45}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddWatermark(&Watermark{Text: "COPY", Behind: true}); err != nil {
+		t.Fatal(err)
+	}
+	text := pageText()
+	for _, word := range []string{"DRAFT", "COPY", "Hello world"} {
+		if !strings.Contains(text, word) {
+			t.Errorf("text lost %q:\n%s", word, text)
+		}
+	}
+	// 只有设置了不透明度的水印有 /ExtGState
+	opacity := make([]interface{}, 0)
+	for _, obj := range p.Objects {
+		if subtype := p.getNameObjByKey(obj.Dict, "/Subtype"); subtype == nil || subtype.Name != "/Form" {
+			continue
+		}
+		gs := p.getResolvedDict(p.getResolvedDict(p.getResolvedDict(obj.Dict, "/Resources"), "/ExtGState"), "/GS1")
+		opacity = append(opacity, p.getValueByKey(gs, "/ca"))
+	}
+	if len(opacity) != 2 || opacity[0] != 0.3 || opacity[1] != nil {
+		t.Errorf("opacity %v, want [0.3 <nil>]", opacity)
+	}
+
+	if n := p.RemoveWatermarks(nil); n != 2 {
+		t.Fatalf("removed %d watermarks, want 2", n)
+	}
+	text = pageText()
+	if strings.Contains(text, "DRAFT") || strings.Contains(text, "COPY") || !strings.Contains(text, "Hello world") {
+		t.Errorf("text after removing watermarks:\n%s", text)
+	}
+	// 水印的 Form 和字体也从文档中删除
+	for _, obj := range p.Objects {
+		if subtype := p.getNameObjByKey(obj.Dict, "/Subtype"); subtype != nil && subtype.Name == "/Form" {
+			t.Errorf("form %d %d is left", obj.ID, obj.GenID)
+		}
+	}
+	if n := p.RemoveWatermarks(nil); n != 0 {
+		t.Errorf("removed %d watermarks again", n)
+	}
+}